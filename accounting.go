@@ -0,0 +1,108 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"cloud.google.com/go/cloudsqlconn/internal/cloudsql"
+	"cloud.google.com/go/cloudsqlconn/internal/trace"
+)
+
+// connIPTypes are the IP types that connections are counted by.
+var connIPTypes = [...]string{cloudsql.PublicIP, cloudsql.PrivateIP, cloudsql.PublicIPv6, ipTypeIAP, ipTypeProvided}
+
+// connCounters counts the open connections to an instance. Its counts must be
+// accessed atomically, so that Dial and Close update them without locking.
+// The 64-bit fields come first so that they are 64-bit aligned for atomic
+// access on 32-bit platforms.
+type connCounters struct {
+	open int64
+	// limit is the instance's connection limit, or 0 if unknown.
+	limit int64
+	// byIPType holds the counts for each of connIPTypes, and recorders
+	// their metrics.
+	byIPType  [len(connIPTypes)]int64
+	recorders [len(connIPTypes)]trace.ConnRecorder
+	// warned is set while open is at or above the fraction of limit that
+	// WithConnLimitWarning warns at, guarded by warnMu.
+	warnMu sync.Mutex
+	warned bool
+}
+
+// newConnCounters returns the counters of an instance, whose metrics are
+// tagged with label, for the Dialer with dialerID.
+func newConnCounters(label, dialerID string) *connCounters {
+	c := &connCounters{}
+	for i, t := range connIPTypes {
+		c.recorders[i] = trace.NewConnRecorder(label, dialerID, t)
+	}
+	return c
+}
+
+// opened counts a connection opened over ipType and returns the number of
+// open connections.
+func (c *connCounters) opened(ipType string) int64 {
+	open := atomic.AddInt64(&c.open, 1)
+	if i := ipTypeIndex(ipType); i >= 0 {
+		atomic.AddInt64(&c.byIPType[i], 1)
+		c.recorders[i].RecordOpen()
+	}
+	return open
+}
+
+// closed counts a connection opened over ipType as closed and returns the
+// number of open connections.
+func (c *connCounters) closed(ipType string) int64 {
+	open := atomic.AddInt64(&c.open, -1)
+	if i := ipTypeIndex(ipType); i >= 0 {
+		atomic.AddInt64(&c.byIPType[i], -1)
+		c.recorders[i].RecordClose()
+	}
+	return open
+}
+
+// ipTypeIndex returns the index of ipType in connIPTypes, or -1.
+func ipTypeIndex(ipType string) int {
+	for i, t := range connIPTypes {
+		if t == ipType {
+			return i
+		}
+	}
+	return -1
+}
+
+// counters returns the connection counters of the instance with connection
+// name cn. Once created, an instance's counters are found without locking.
+func (d *Dialer) counters(cn string) *connCounters {
+	if c, ok := d.openConns.Load(cn); ok {
+		return c.(*connCounters)
+	}
+	c, _ := d.openConns.LoadOrStore(cn, newConnCounters(d.metricInstance(cn), d.dialerID))
+	return c.(*connCounters)
+}
+
+// openConnCounter returns the counter of open connections for the instance
+// with connection name cn.
+func (d *Dialer) openConnCounter(cn string) *int64 {
+	return &d.counters(cn).open
+}
+
+// openConnCount returns the number of open connections to the instance with
+// connection name cn.
+func (d *Dialer) openConnCount(cn string) int64 {
+	return atomic.LoadInt64(d.openConnCounter(cn))
+}
@@ -0,0 +1,108 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/cloudsqlconn/internal/cloudsql"
+	"cloud.google.com/go/cloudsqlconn/internal/mock"
+)
+
+// nopConn is a net.Conn that does nothing, so that benchmarks measure only
+// the Dialer's bookkeeping.
+type nopConn struct{ net.Conn }
+
+func (nopConn) LocalAddr() net.Addr  { return &net.TCPAddr{} }
+func (nopConn) RemoteAddr() net.Addr { return &net.TCPAddr{} }
+func (nopConn) Close() error         { return nil }
+
+// BenchmarkConnAccounting measures opening and closing connections to several
+// instances from many goroutines, as a busy Dialer does.
+func BenchmarkConnAccounting(b *testing.B) {
+	d, err := NewDialer(context.Background(), WithTokenSource(mock.EmptyTokenSource{}))
+	if err != nil {
+		b.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	instances := []string{"p:r:i1", "p:r:i2", "p:r:i3", "p:r:i4"}
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		n := 0
+		for pb.Next() {
+			inst := instances[n%len(instances)]
+			n++
+			c := d.newInstrumentedConn(context.Background(), nopConn{}, nopConn{}, inst, cloudsql.PublicIP)
+			c.Close()
+		}
+	})
+}
+
+func TestConnAccounting(t *testing.T) {
+	tcs := []struct {
+		desc string
+		opts []DialerOption
+		// wantTracked is whether the connection is added to the set of
+		// open connections
+		wantTracked bool
+	}{
+		{desc: "default"},
+		{
+			desc:        "with maintenance drain",
+			opts:        []DialerOption{WithMaintenanceDrain(time.Minute)},
+			wantTracked: true,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.desc, func(t *testing.T) {
+			opts := append([]DialerOption{WithTokenSource(mock.EmptyTokenSource{})}, tc.opts...)
+			d, err := NewDialer(context.Background(), opts...)
+			if err != nil {
+				t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+			}
+			defer d.Close()
+
+			c := d.newInstrumentedConn(context.Background(), nopConn{}, nopConn{}, "p:r:i", cloudsql.PrivateIP)
+			if got := d.openConnCount("p:r:i"); got != 1 {
+				t.Fatalf("open connections, want = 1, got = %v", got)
+			}
+			want := Stats{Instances: map[string]InstanceStats{
+				"p:r:i": {OpenConns: 1, OpenConnsByIPType: map[string]int{cloudsql.PrivateIP: 1}},
+			}}
+			if got := d.Stats(); !reflect.DeepEqual(got, want) {
+				t.Fatalf("Stats, want = %+v, got = %+v", want, got)
+			}
+			if got := len(d.openConnsFor("p:r:i")); got != 1 && tc.wantTracked || got != 0 && !tc.wantTracked {
+				t.Fatalf("tracked connections, want tracked = %v, got = %v", tc.wantTracked, got)
+			}
+
+			c.Close()
+			if got := d.openConnCount("p:r:i"); got != 0 {
+				t.Fatalf("open connections after Close, want = 0, got = %v", got)
+			}
+			if got := d.Stats(); len(got.Instances) != 0 {
+				t.Fatalf("Stats after Close, want no instances, got = %+v", got)
+			}
+			if got := len(d.openConnsFor("p:r:i")); got != 0 {
+				t.Fatalf("tracked connections after Close, want = 0, got = %v", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"cloud.google.com/go/cloudsqlconn/errtypes"
+	"cloud.google.com/go/cloudsqlconn/instance"
+)
+
+// Alias registers alias as another name for target, which is an instance
+// connection name or the name of a registered replica set. Dial, Resolve, and
+// ForceRefresh accept the alias wherever they accept target, so application
+// code and DSNs can refer to a logical name such as "orders-db" that can be
+// re-pointed without code changes. Calling Alias again with the same alias
+// replaces its target; open connections are unaffected. An alias may not
+// itself be an instance connection name or the name of a replica set.
+func (d *Dialer) Alias(alias, target string) error {
+	if instance.ValidateConnName(alias) == nil {
+		return errtypes.NewConfigError("alias conflicts with an instance connection name", alias)
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if _, ok := d.replicaSets[alias]; ok {
+		return errtypes.NewConfigError("alias conflicts with a replica set name", alias)
+	}
+	if _, ok := d.replicaSets[target]; !ok {
+		if err := instance.ValidateConnName(target); err != nil {
+			return err
+		}
+	}
+	d.aliases[alias] = target
+	return nil
+}
+
+// resolveAlias returns the target of name if it is a registered alias, or
+// name unchanged otherwise.
+func (d *Dialer) resolveAlias(name string) string {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	if target, ok := d.aliases[name]; ok {
+		return target
+	}
+	return name
+}
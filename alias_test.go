@@ -0,0 +1,118 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"cloud.google.com/go/cloudsqlconn/errtypes"
+	"cloud.google.com/go/cloudsqlconn/internal/mock"
+)
+
+func TestAlias(t *testing.T) {
+	ctx := context.Background()
+	prod := mock.NewFakeCSQLInstance("my-project", "my-region", "prod")
+	staging := mock.NewFakeCSQLInstance("my-project", "my-region", "staging",
+		mock.WithPublicIP("10.0.0.2"))
+	svc, cleanup, err := mock.NewSQLAdminService(
+		ctx,
+		mock.InstanceGetSuccess(prod, 1),
+		mock.CreateEphemeralSuccess(prod, 1),
+		mock.InstanceGetSuccess(staging, 1),
+		mock.CreateEphemeralSuccess(staging, 1),
+	)
+	if err != nil {
+		t.Fatalf("failed to create test SQL admin service: %s", err)
+	}
+	stop := mock.StartServerProxy(t, prod)
+	defer func() {
+		stop()
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	d, err := NewDialer(ctx, WithTokenSource(mock.EmptyTokenSource{}))
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	d.sqladmin = svc
+
+	if err := d.Alias("orders-db", "my-project:my-region:prod"); err != nil {
+		t.Fatalf("Alias failed: %v", err)
+	}
+	conn, err := d.Dial(ctx, "orders-db")
+	if err != nil {
+		t.Fatalf("expected Dial to succeed, but got error: %v", err)
+	}
+	conn.Close()
+
+	// Re-pointing the alias to a replica set takes effect on the next call.
+	err = d.RegisterReplicaSet("staging-db", RoundRobin, "my-project:my-region:staging")
+	if err != nil {
+		t.Fatalf("RegisterReplicaSet failed: %v", err)
+	}
+	if err := d.Alias("orders-db", "staging-db"); err != nil {
+		t.Fatalf("Alias failed: %v", err)
+	}
+	addr, err := d.Resolve(ctx, "orders-db")
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if want := "10.0.0.2:3307"; addr != want {
+		t.Fatalf("want = %v, got = %v", want, addr)
+	}
+}
+
+func TestAliasErrors(t *testing.T) {
+	d, err := NewDialer(context.Background(), WithTokenSource(mock.EmptyTokenSource{}))
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	err = d.RegisterReplicaSet("my-db", RoundRobin, "my-project:my-region:primary")
+	if err != nil {
+		t.Fatalf("RegisterReplicaSet failed: %v", err)
+	}
+	if err := d.Alias("orders-db", "my-db"); err != nil {
+		t.Fatalf("Alias failed: %v", err)
+	}
+
+	tcs := []struct {
+		desc          string
+		alias, target string
+	}{
+		{desc: "alias is a connection name", alias: "my-project:my-region:other", target: "my-db"},
+		{desc: "alias is a replica set", alias: "my-db", target: "my-project:my-region:primary"},
+		{desc: "invalid target", alias: "other-db", target: "not-an-instance"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.desc, func(t *testing.T) {
+			var wantErr *errtypes.ConfigError
+			if err := d.Alias(tc.alias, tc.target); !errors.As(err, &wantErr) {
+				t.Fatalf("want = %T, got = %v", wantErr, err)
+			}
+		})
+	}
+
+	var wantErr *errtypes.ConfigError
+	err = d.RegisterReplicaSet("orders-db", RoundRobin, "my-project:my-region:primary")
+	if !errors.As(err, &wantErr) {
+		t.Fatalf("when replica set name is an alias, want = %T, got = %v", wantErr, err)
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// The modes in which a Dialer authenticates to an instance, as reported in
+// AuditEvent.AuthMode.
+const (
+	// AuthModeEphemeralCert is authentication with an ephemeral client
+	// certificate from the Cloud SQL Admin API.
+	AuthModeEphemeralCert = "EPHEMERAL_CERT"
+	// AuthModeProvidedCert is authentication with a client certificate from
+	// WithClientCertProvider.
+	AuthModeProvidedCert = "PROVIDED_CERT"
+	// AuthModeStaticCert is authentication with the client certificate of
+	// WithStaticConnectInfo.
+	AuthModeStaticCert = "STATIC_CERT"
+)
+
+// AuditEvent describes a call to Dial.
+type AuditEvent struct {
+	// Principal is the principal passed to WithAuditHook.
+	Principal string
+	// Requested is the instance argument passed to Dial.
+	Requested string
+	// Instance is the connection name of the instance dialed last, or empty
+	// if Dial failed before choosing one.
+	Instance string
+	// IPType is the IP type (PUBLIC, PRIVATE, PUBLIC_IPV6, IAP, or PROVIDED)
+	// of the connection, or empty if Dial failed.
+	IPType string
+	// RemoteAddr is the connection's remote network address, or nil if Dial
+	// failed.
+	RemoteAddr net.Addr
+	// AuthMode is how the Dialer authenticates to the instance, one of the
+	// AuthMode constants, or empty if Dial failed before choosing an
+	// instance.
+	AuthMode string
+	// Err is the error Dial returned, or nil if it succeeded.
+	Err error
+	// Latency is how long Dial took.
+	Latency time.Duration
+	// Context is the context passed to Dial, so that the hook can read its
+	// values, e.g., the end user a request is served for. It may be done by
+	// the time the hook is called.
+	Context context.Context
+}
+
+// WithAuditHook returns a DialerOption that calls fn once for every call to
+// Dial, successful or not, e.g., to write connection-level audit trails to
+// security logs that server-side logs cannot attribute to client workloads.
+// principal names the workload the Dialer acts for, such as its service
+// account, and is recorded in every event. fn is called before Dial returns
+// and should not block.
+func WithAuditHook(principal string, fn func(AuditEvent)) DialerOption {
+	return func(d *dialerConfig) {
+		d.auditPrincipal = principal
+		d.onAudit = fn
+	}
+}
+
+// audit reports a call to Dial for instance that started at start and
+// returned conn and err. cn is the connection name of the instance dialed
+// last, if any.
+func (d *Dialer) audit(ctx context.Context, instance, cn string, start time.Time, conn net.Conn, err error) {
+	if d.onAudit == nil {
+		return
+	}
+	e := AuditEvent{
+		Principal: d.auditPrincipal,
+		Requested: instance,
+		Instance:  cn,
+		Err:       err,
+		Latency:   d.clock.Now().Sub(start),
+		Context:   ctx,
+	}
+	if cn != "" {
+		e.AuthMode = d.authMode(cn)
+	}
+	if ic, ok := conn.(*instrumentedConn); ok && err == nil {
+		e.IPType = ic.ipType
+		e.RemoteAddr = ic.RemoteAddr()
+	}
+	d.onAudit(e)
+}
+
+// authMode returns how the Dialer authenticates to the instance with
+// connection name cn.
+func (d *Dialer) authMode(cn string) string {
+	if _, ok := d.staticInfo[cn]; ok {
+		return AuthModeStaticCert
+	}
+	if d.certProvider != nil {
+		return AuthModeProvidedCert
+	}
+	return AuthModeEphemeralCert
+}
@@ -0,0 +1,86 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"testing"
+
+	"cloud.google.com/go/cloudsqlconn/internal/mock"
+)
+
+type auditKey struct{}
+
+func TestWithAuditHook(t *testing.T) {
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+	svc, cleanup, err := mock.NewSQLAdminService(
+		context.Background(),
+		mock.InstanceGetSuccess(inst, 1),
+		mock.CreateEphemeralSuccess(inst, 1),
+	)
+	if err != nil {
+		t.Fatalf("failed to create test SQL admin service: %s", err)
+	}
+	stop := mock.StartServerProxy(t, inst)
+	defer func() {
+		stop()
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	var events []AuditEvent
+	d, err := NewDialer(context.Background(),
+		WithTokenSource(mock.EmptyTokenSource{}),
+		WithAuditHook("app@my-project.iam.gserviceaccount.com", func(e AuditEvent) {
+			events = append(events, e)
+		}),
+	)
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	d.sqladmin = svc
+	if err := d.Alias("db", "my-project:my-region:my-instance"); err != nil {
+		t.Fatalf("Alias failed: %v", err)
+	}
+
+	ctx := context.WithValue(context.Background(), auditKey{}, "tenant-1")
+	conn, err := d.Dial(ctx, "db")
+	if err != nil {
+		t.Fatalf("expected Dial to succeed, but got error: %v", err)
+	}
+	conn.Close()
+	if _, err := d.Dial(ctx, "bad-instance-name"); err == nil {
+		t.Fatal("want Dial to fail")
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("want an event per Dial, got = %v", events)
+	}
+	ok := events[0]
+	if ok.Principal != "app@my-project.iam.gserviceaccount.com" || ok.Requested != "db" ||
+		ok.Instance != "my-project:my-region:my-instance" || ok.IPType != "PUBLIC" ||
+		ok.AuthMode != AuthModeEphemeralCert || ok.Err != nil || ok.RemoteAddr == nil {
+		t.Fatalf("unexpected event for a successful Dial: %+v", ok)
+	}
+	if v := ok.Context.Value(auditKey{}); v != "tenant-1" {
+		t.Fatalf("want the Dial's context values, got = %v", v)
+	}
+	failed := events[1]
+	if failed.Requested != "bad-instance-name" || failed.Err == nil || failed.IPType != "" || failed.RemoteAddr != nil {
+		t.Fatalf("unexpected event for a failed Dial: %+v", failed)
+	}
+}
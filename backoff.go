@@ -0,0 +1,142 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/cloudsqlconn/errtypes"
+)
+
+// RetryPolicy configures how DialWithRetry retries a failed Dial. Start from
+// DefaultRetryPolicy and adjust the fields that need to differ.
+type RetryPolicy struct {
+	// MaxAttempts is the most times Dial is called, including the first.
+	// Values less than 1 are treated as 1.
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry. Each further wait
+	// is Multiplier times longer, up to MaxBackoff if it is positive. A
+	// Multiplier of 1 or less keeps the waits constant.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	// Jitter is the fraction, from 0 to 1, by which each wait is randomly
+	// shortened, so that clients that failed together don't retry together.
+	Jitter float64
+	// Retryable reports whether a Dial that failed with err should be
+	// retried. If nil, IsRetryable is used.
+	Retryable func(err error) bool
+}
+
+// DefaultRetryPolicy returns the recommended RetryPolicy: up to 5 attempts,
+// waiting from 200ms, doubling up to 5s, with up to half of each wait
+// removed at random.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: 200 * time.Millisecond,
+		MaxBackoff:     5 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.5,
+	}
+}
+
+var (
+	retryJitterMu sync.Mutex
+	// retryJitterRand is seeded per process so that processes that failed
+	// together do not retry together.
+	retryJitterRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// retryJitter returns a random number in [0.0,1.0) to jitter a retry's wait
+// with.
+func retryJitter() float64 {
+	retryJitterMu.Lock()
+	defer retryJitterMu.Unlock()
+	return retryJitterRand.Float64()
+}
+
+// DialWithRetry calls d.Dial with instance and opts until it succeeds, the
+// error is not retryable, or policy.MaxAttempts is reached, waiting between
+// attempts as policy configures. It returns the error of the last attempt.
+// ctx bounds the total time spent, including the waits. Unlike WithDialRetries,
+// which only retries the TCP connect and TLS handshake, each attempt is a
+// complete Dial, so errors retrieving the instance's information are retried
+// too.
+func DialWithRetry(ctx context.Context, d *Dialer, instance string, policy RetryPolicy, opts ...DialOption) (net.Conn, error) {
+	retryable := policy.Retryable
+	if retryable == nil {
+		retryable = IsRetryable
+	}
+	backoff := policy.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		conn, err := d.Dial(ctx, instance, opts...)
+		if err == nil || attempt >= policy.MaxAttempts || ctx.Err() != nil || !retryable(err) {
+			return conn, err
+		}
+		wait := backoff
+		if policy.Jitter > 0 {
+			wait -= time.Duration(policy.Jitter * retryJitter() * float64(wait))
+		}
+		if werr := d.sleep(ctx, wait); werr != nil {
+			return nil, err
+		}
+		if policy.Multiplier > 1 {
+			backoff = time.Duration(float64(backoff) * policy.Multiplier)
+		}
+		if policy.MaxBackoff > 0 && backoff > policy.MaxBackoff {
+			backoff = policy.MaxBackoff
+		}
+	}
+}
+
+// IsRetryable reports whether a Dial that failed with err may succeed if
+// retried. Failures to connect to the instance, failures to reach the Cloud
+// SQL Admin API, and its errors that are transient, such as rate limiting or
+// server errors, are retryable. Configuration errors, other refresh failures
+// (e.g., an unsupported instance), other API errors (e.g., missing
+// permissions or an instance that does not exist), an instance that is not
+// running, an expired static certificate, a closed Dialer, and a canceled
+// or expired context are not.
+func IsRetryable(err error) bool {
+	switch {
+	case err == nil,
+		errors.Is(err, context.Canceled),
+		errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, errtypes.ErrDialerClosed),
+		errors.Is(err, errtypes.ErrInstanceNotRunning),
+		errors.Is(err, errtypes.ErrStaticCertExpired):
+		return false
+	}
+	var rErr *errtypes.RefreshError
+	if errors.As(err, &rErr) {
+		code := rErr.HTTPStatusCode()
+		if code == 0 {
+			// the request did not reach the API, or the refresh failed for
+			// a reason retrying won't fix
+			var netErr net.Error
+			return errors.As(rErr, &netErr)
+		}
+		return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+	}
+	var dErr *errtypes.DialError
+	return errors.As(err, &dErr)
+}
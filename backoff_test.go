@@ -0,0 +1,103 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/cloudsqlconn/errtypes"
+	"cloud.google.com/go/cloudsqlconn/internal/mock"
+	"cloud.google.com/go/cloudsqlconn/internal/sqladmin"
+)
+
+func TestIsRetryable(t *testing.T) {
+	cn := "my-project:my-region:my-instance"
+	apiErr := func(code int) error {
+		return errtypes.NewRefreshError("failed to get instance metadata", cn, &sqladmin.Error{Code: code})
+	}
+	tcs := []struct {
+		desc string
+		err  error
+		want bool
+	}{
+		{desc: "dial error", err: errtypes.NewDialError("failed to dial", cn, errors.New("connection refused")), want: true},
+		{desc: "refresh network error", err: errtypes.NewRefreshError("failed to get instance metadata", cn, &url.Error{Op: "Get", URL: "https://sqladmin.googleapis.com", Err: errors.New("connection reset")}), want: true},
+		{desc: "refresh failure", err: errtypes.NewRefreshError("failed to decode valid PEM cert", cn, nil)},
+		{desc: "refresh failure with cause", err: errtypes.NewRefreshError("failed to parse scheduled maintenance time", cn, errors.New("bad time"))},
+		{desc: "rate limited", err: apiErr(429), want: true},
+		{desc: "server error", err: apiErr(503), want: true},
+		{desc: "permission denied", err: apiErr(403)},
+		{desc: "not found", err: apiErr(404)},
+		{desc: "config error", err: errtypes.NewConfigError("invalid instance connection name", cn)},
+		{desc: "not running", err: errtypes.NewRefreshError("instance is stopped", cn, errtypes.ErrInstanceNotRunning)},
+		{desc: "dialer closed", err: errtypes.ErrDialerClosed},
+		{desc: "context canceled", err: fmt.Errorf("dial: %w", context.Canceled)},
+		{desc: "other error", err: errors.New("boom")},
+	}
+	for _, tc := range tcs {
+		if got := IsRetryable(tc.err); got != tc.want {
+			t.Errorf("%s: want = %v, got = %v", tc.desc, tc.want, got)
+		}
+	}
+}
+
+func TestDialWithRetry(t *testing.T) {
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+	var attempts int
+	d, err := NewDialer(context.Background(),
+		WithStaticConnectInfo("my-project:my-region:my-instance", staticInfo(t, inst)),
+		WithAuditHook("app", func(AuditEvent) { attempts++ }),
+	)
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	policy := DefaultRetryPolicy()
+	policy.MaxAttempts = 3
+	policy.InitialBackoff = time.Millisecond
+
+	// nothing listens for the instance, so every attempt fails to dial
+	_, err = DialWithRetry(context.Background(), d, "my-project:my-region:my-instance", policy)
+	var dErr *errtypes.DialError
+	if !errors.As(err, &dErr) {
+		t.Fatalf("want = *errtypes.DialError, got = %v", err)
+	}
+	if attempts != 3 {
+		t.Fatalf("want 3 attempts, got = %v", attempts)
+	}
+
+	attempts = 0
+	_, err = DialWithRetry(context.Background(), d, "bad-instance-name", policy)
+	var cErr *errtypes.ConfigError
+	if !errors.As(err, &cErr) {
+		t.Fatalf("want = *errtypes.ConfigError, got = %v", err)
+	}
+	if attempts != 1 {
+		t.Fatalf("want a config error not to be retried, got %v attempts", attempts)
+	}
+
+	stop := mock.StartServerProxy(t, inst)
+	defer stop()
+	conn, err := DialWithRetry(context.Background(), d, "my-project:my-region:my-instance", policy)
+	if err != nil {
+		t.Fatalf("expected DialWithRetry to succeed, but got error: %v", err)
+	}
+	conn.Close()
+}
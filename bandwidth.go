@@ -0,0 +1,96 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"golang.org/x/time/rate"
+)
+
+// errLimitedConnClosed is returned by a limitedConn read or write that was
+// waiting on the limit when the connection was closed.
+var errLimitedConnClosed = errors.New("connection closed while waiting on bandwidth limit")
+
+// limitedConn is a net.Conn whose reads and writes are each limited to a
+// number of bytes per second by a token bucket.
+type limitedConn struct {
+	net.Conn
+	burst  int
+	rlim   *rate.Limiter
+	wlim   *rate.Limiter
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// newLimitedConn returns conn limited to bytesPerSec in each direction. Up to
+// one second's worth of bytes may be transferred in a burst.
+func newLimitedConn(conn net.Conn, bytesPerSec int) *limitedConn {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &limitedConn{
+		Conn:   conn,
+		burst:  bytesPerSec,
+		rlim:   rate.NewLimiter(rate.Limit(bytesPerSec), bytesPerSec),
+		wlim:   rate.NewLimiter(rate.Limit(bytesPerSec), bytesPerSec),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Read reads at most one burst from the connection and then waits until the
+// bytes read are within the limit.
+func (c *limitedConn) Read(p []byte) (int, error) {
+	if len(p) > c.burst {
+		p = p[:c.burst]
+	}
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		if werr := c.rlim.WaitN(c.ctx, n); werr != nil && err == nil {
+			err = errLimitedConnClosed
+		}
+	}
+	return n, err
+}
+
+// Write writes p to the connection one burst at a time, waiting before each
+// until it is within the limit.
+func (c *limitedConn) Write(p []byte) (int, error) {
+	var written int
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > c.burst {
+			chunk = chunk[:c.burst]
+		}
+		if err := c.wlim.WaitN(c.ctx, len(chunk)); err != nil {
+			return written, errLimitedConnClosed
+		}
+		n, err := c.Conn.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// Close unblocks any reads or writes waiting on the limit and closes the
+// connection.
+func (c *limitedConn) Close() error {
+	c.cancel()
+	return c.Conn.Close()
+}
@@ -0,0 +1,98 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestLimitedConnWrite(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	go io.Copy(ioutil.Discard, server)
+
+	const limit = 10000
+	c := newLimitedConn(client, limit)
+	defer c.Close()
+
+	// The first second's worth is the burst, so the rest takes about a second.
+	start := time.Now()
+	n, err := c.Write(make([]byte, 2*limit))
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if n != 2*limit {
+		t.Fatalf("Write wrote %v bytes, want %v", n, 2*limit)
+	}
+	if got := time.Since(start); got < 900*time.Millisecond {
+		t.Fatalf("Write took %v, want at least 900ms", got)
+	}
+}
+
+func TestLimitedConnRead(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+
+	const limit = 10000
+	go server.Write(make([]byte, 2*limit))
+	c := newLimitedConn(client, limit)
+	defer c.Close()
+
+	start := time.Now()
+	buf := make([]byte, 4*limit)
+	var got int
+	for got < 2*limit {
+		n, err := c.Read(buf)
+		if err != nil {
+			t.Fatalf("Read failed: %v", err)
+		}
+		if n > limit {
+			t.Fatalf("Read returned %v bytes, want at most %v", n, limit)
+		}
+		got += n
+	}
+	if d := time.Since(start); d < 900*time.Millisecond {
+		t.Fatalf("Read took %v, want at least 900ms", d)
+	}
+}
+
+func TestLimitedConnCloseUnblocksWrite(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	go io.Copy(ioutil.Discard, server)
+
+	const limit = 100
+	c := newLimitedConn(client, limit)
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := c.Write(make([]byte, 100*limit))
+		errCh <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+	c.Close()
+
+	select {
+	case err := <-errCh:
+		if err == nil {
+			t.Fatal("want Write to fail after Close")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Write did not return after Close")
+	}
+}
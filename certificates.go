@@ -0,0 +1,70 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"time"
+)
+
+// InstanceCertificates holds the certificates that a Dialer uses to connect
+// to an instance.
+type InstanceCertificates struct {
+	// ClientCert is the ephemeral client certificate, with its private key,
+	// that the instance accepts for TLS client authentication. Its Leaf is
+	// set.
+	ClientCert tls.Certificate
+	// ServerCAs are the certificates of the CAs that issue the instance's
+	// server certificate.
+	ServerCAs []*x509.Certificate
+	// Expiry is when ClientCert expires.
+	Expiry time.Time
+}
+
+// Certificates returns the current client certificate and server CAs for the
+// instance, so that they can be used by a TLS implementation of the caller's
+// own or exported to a sidecar, e.g., through Envoy's secret discovery
+// service. The instance argument is an instance connection name, the name of
+// a replica set's primary, an alias, or a domain name, as with Dial. Like
+// Dial, Certificates waits for the instance's information to be refreshed if
+// necessary. The client certificate changes each time the Dialer refreshes
+// the instance's information, so callers should call Certificates again
+// before Expiry.
+//
+// How the server certificate identifies the instance depends on its server
+// CA mode. Certificates of instances with a legacy, self-signed CA do not
+// match the instance's address; they carry the common name
+// "<project>:<instance>", which a TLS implementation must verify in place of
+// the host name. Certificates of instances using Certificate Authority
+// Service, which need WithCASServerValidation, are instead issued for the
+// instance's IP addresses and DNS name as SANs, so the usual host name
+// verification applies and their common name must not be relied on.
+func (d *Dialer) Certificates(ctx context.Context, instance string) (InstanceCertificates, error) {
+	names, err := d.resolveDNS(ctx, d.resolveAlias(instance))
+	if err != nil {
+		return InstanceCertificates{}, err
+	}
+	i, err := d.instance(ctx, d.resolveReplicaSet(names[0], false))
+	if err != nil {
+		return InstanceCertificates{}, err
+	}
+	cert, cas, expiry, err := i.Certificates(ctx)
+	if err != nil {
+		return InstanceCertificates{}, err
+	}
+	return InstanceCertificates{ClientCert: cert, ServerCAs: cas, Expiry: expiry}, nil
+}
@@ -0,0 +1,100 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"cloud.google.com/go/cloudsqlconn/internal/mock"
+)
+
+func TestCertificates(t *testing.T) {
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+	svc, cleanup, err := mock.NewSQLAdminService(
+		context.Background(),
+		mock.InstanceGetSuccess(inst, 1),
+		mock.CreateEphemeralSuccess(inst, 1),
+	)
+	if err != nil {
+		t.Fatalf("failed to create test SQL admin service: %s", err)
+	}
+	stop := mock.StartServerProxy(t, inst)
+	defer func() {
+		stop()
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	d, err := NewDialer(context.Background(), WithTokenSource(mock.EmptyTokenSource{}))
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	d.sqladmin = svc
+	if err := d.Alias("db", "my-project:my-region:my-instance"); err != nil {
+		t.Fatalf("Alias failed: %v", err)
+	}
+
+	certs, err := d.Certificates(context.Background(), "db")
+	if err != nil {
+		t.Fatalf("expected Certificates to succeed, but got error: %v", err)
+	}
+	if certs.ClientCert.Leaf == nil || !certs.ClientCert.Leaf.NotAfter.Equal(certs.Expiry) {
+		t.Fatalf("want the client certificate to expire at %v", certs.Expiry)
+	}
+
+	// the certificates are enough to connect with a TLS configuration of the
+	// caller's own
+	pool := x509.NewCertPool()
+	for _, c := range certs.ServerCAs {
+		pool.AddCert(c)
+	}
+	cfg := &tls.Config{
+		Certificates:       []tls.Certificate{certs.ClientCert},
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(raw [][]byte, _ [][]*x509.Certificate) error {
+			c, err := x509.ParseCertificate(raw[0])
+			if err != nil {
+				return err
+			}
+			if _, err := c.Verify(x509.VerifyOptions{Roots: pool}); err != nil {
+				return err
+			}
+			if c.Subject.CommonName != "my-project:my-instance" {
+				return errors.New("unexpected server certificate")
+			}
+			return nil
+		},
+	}
+	conn, err := tls.Dial("tcp", fmt.Sprintf("127.0.0.1:%s", serverProxyPort), cfg)
+	if err != nil {
+		t.Fatalf("expected to connect with the certificates, but got error: %v", err)
+	}
+	defer conn.Close()
+	data, err := ioutil.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("failed to read from the instance: %v", err)
+	}
+	if string(data) != "my-instance" {
+		t.Fatalf("want = %q, got = %q", "my-instance", string(data))
+	}
+}
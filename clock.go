@@ -0,0 +1,54 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"time"
+
+	"cloud.google.com/go/cloudsqlconn/internal/cloudsql"
+)
+
+// Clock tells the time and schedules functions to run in the future. It is
+// used with WithClock to control time in tests. A fake clock, such as the one
+// from github.com/jonboulle/clockwork, can be adapted to it.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// AfterFunc calls f in its own goroutine after d has elapsed.
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a function scheduled by a Clock.
+type Timer interface {
+	// Stop prevents the function from running. It returns false if the
+	// function has already run or been stopped.
+	Stop() bool
+}
+
+// realClock is a Clock backed by the time package.
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer { return time.AfterFunc(d, f) }
+
+// instanceClock adapts a Clock for use by cloudsql.Instance.
+type instanceClock struct{ c Clock }
+
+func (ic instanceClock) Now() time.Time { return ic.c.Now() }
+
+func (ic instanceClock) AfterFunc(d time.Duration, f func()) cloudsql.Timer {
+	return ic.c.AfterFunc(d, f)
+}
@@ -0,0 +1,83 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"reflect"
+	"time"
+
+	"cloud.google.com/go/cloudsqlconn/errtypes"
+	"cloud.google.com/go/cloudsqlconn/instance"
+)
+
+// Configure overrides the Dialer's configuration for a single instance. The
+// name argument is an instance connection name, the name of a replica
+// set, in which case the configuration applies to all of its current
+// members, or an alias of either. Only WithRefreshTimeout may be given, e.g.,
+// to allow a longer refresh for an instance reached over a slow route to the
+// Cloud SQL Admin API, or a shorter one for an instance where Dial should
+// fail fast, and Configure returns an error if any other option is. The
+// override applies to refresh operations that start after Configure returns
+// and replaces any earlier one.
+func (d *Dialer) Configure(name string, opts ...DialerOption) error {
+	var cfg dialerConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.refreshTimeout <= 0 {
+		return errtypes.NewConfigError("Configure requires a positive refresh timeout", name)
+	}
+	if !reflect.DeepEqual(cfg, dialerConfig{refreshTimeout: cfg.refreshTimeout}) {
+		return errtypes.NewConfigError("Configure only supports WithRefreshTimeout", name)
+	}
+	names, err := d.configurableNames(d.resolveAlias(name))
+	if err != nil {
+		return err
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	for _, cn := range names {
+		d.refreshTimeouts[cn] = cfg.refreshTimeout
+		if i, ok := d.instances[cn]; ok {
+			i.SetRefreshTimeout(cfg.refreshTimeout)
+		}
+	}
+	return nil
+}
+
+// configurableNames returns the instance connection names that name, which
+// is an instance connection name or the name of a replica set, stands for.
+func (d *Dialer) configurableNames(name string) ([]string, error) {
+	d.lock.RLock()
+	rs, ok := d.replicaSets[name]
+	d.lock.RUnlock()
+	if ok {
+		primary, replicas := rs.members()
+		return append([]string{primary}, replicas...), nil
+	}
+	if err := instance.ValidateConnName(name); err != nil {
+		return nil, err
+	}
+	return []string{name}, nil
+}
+
+// refreshTimeoutFor returns the refresh timeout of the instance with connection
+// name cn. d.lock must be held.
+func (d *Dialer) refreshTimeoutFor(cn string) time.Duration {
+	if t, ok := d.refreshTimeouts[cn]; ok {
+		return t
+	}
+	return d.refreshTimeout
+}
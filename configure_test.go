@@ -0,0 +1,120 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/cloudsqlconn/errtypes"
+	"cloud.google.com/go/cloudsqlconn/internal/mock"
+)
+
+func TestConfigureRefreshTimeout(t *testing.T) {
+	// slow doesn't answer until the test ends, so refreshes last until they
+	// time out
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer slow.Close()
+	defer close(release)
+
+	d, err := NewDialer(context.Background(),
+		WithTokenSource(mock.EmptyTokenSource{}),
+		WithRefreshTimeout(time.Minute),
+		WithEndpointResolver(func(string) string { return slow.URL + "/" }),
+	)
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+
+	cn := "my-project:my-region:my-instance"
+	if err := d.Configure(cn, WithRefreshTimeout(100*time.Millisecond)); err != nil {
+		t.Fatalf("Configure failed: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	start := time.Now()
+	if _, err := d.Dial(ctx, cn); err == nil {
+		t.Fatal("want Dial to fail when the refresh times out")
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("want the refresh to time out after the instance's timeout, took %v", elapsed)
+	}
+}
+
+func TestConfigureErrors(t *testing.T) {
+	d, err := NewDialer(context.Background(), WithTokenSource(mock.EmptyTokenSource{}))
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+
+	tcs := []struct {
+		desc string
+		name string
+		opts []DialerOption
+	}{
+		{desc: "no options", name: "p:r:i"},
+		{desc: "other options", name: "p:r:i", opts: []DialerOption{WithUserAgent("agent")}},
+		{
+			desc: "other options with a refresh timeout",
+			name: "p:r:i",
+			opts: []DialerOption{WithRefreshTimeout(time.Second), WithCASServerValidation()},
+		},
+		{desc: "invalid name", name: "bad-name", opts: []DialerOption{WithRefreshTimeout(time.Second)}},
+	}
+	for _, tc := range tcs {
+		err := d.Configure(tc.name, tc.opts...)
+		var wantErr *errtypes.ConfigError
+		if !errors.As(err, &wantErr) {
+			t.Errorf("%s: want = %T, got = %v", tc.desc, wantErr, err)
+		}
+	}
+}
+
+func TestConfigureReplicaSet(t *testing.T) {
+	d, err := NewDialer(context.Background(), WithTokenSource(mock.EmptyTokenSource{}))
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	if err := d.RegisterReplicaSet("orders", RoundRobin, "p:r:primary", "p:r:replica"); err != nil {
+		t.Fatalf("RegisterReplicaSet failed: %v", err)
+	}
+
+	if err := d.Configure("orders", WithRefreshTimeout(time.Second)); err != nil {
+		t.Fatalf("Configure failed: %v", err)
+	}
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	for _, cn := range []string{"p:r:primary", "p:r:replica"} {
+		if got := d.refreshTimeoutFor(cn); got != time.Second {
+			t.Errorf("refresh timeout of %v, want = %v, got = %v", cn, time.Second, got)
+		}
+	}
+	if got := d.refreshTimeoutFor("p:r:other"); got != d.refreshTimeout {
+		t.Errorf("refresh timeout of another instance, want = %v, got = %v", d.refreshTimeout, got)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"math"
+	"sync/atomic"
+
+	"cloud.google.com/go/cloudsqlconn/internal/trace"
+)
+
+// WithConnLimitWarning returns a DialerOption that warns when the
+// connections the Dialer has open to an instance reach fraction (e.g., 0.8)
+// of the instance's connection limit, so that a misconfigured pool is caught
+// before the instance starts refusing connections. The warning is logged to
+// the Logger set with WithLogger and counted by the OpenCensus view
+// /cloudsqlconn/conn_limit_warning_count, once each time the threshold is
+// reached. The limit is read from the instance's max_connections (or, for SQL
+// Server, user connections) database flag; instances without the flag are not
+// checked. Connections made by other clients are not counted, so fraction
+// should leave room for them.
+func WithConnLimitWarning(fraction float64) DialerOption {
+	return func(d *dialerConfig) {
+		d.connLimit = fraction
+	}
+}
+
+// observeConnLimit records the connection limit reported by a refresh of the
+// instance with connection name cn.
+func (d *Dialer) observeConnLimit(cn string, limit int) {
+	if d.connLimit <= 0 {
+		return
+	}
+	atomic.StoreInt64(&d.counters(cn).limit, int64(limit))
+}
+
+// connLimitThreshold returns the number of open connections at which c's
+// instance is warned about, or 0 if it is not.
+func (d *Dialer) connLimitThreshold(c *connCounters) int64 {
+	limit := atomic.LoadInt64(&c.limit)
+	if d.connLimit <= 0 || limit <= 0 {
+		return 0
+	}
+	return int64(math.Ceil(d.connLimit * float64(limit)))
+}
+
+// checkConnLimit warns if open, the number of connections open to the
+// instance with connection name cn after one was opened, has reached the
+// warning threshold.
+func (d *Dialer) checkConnLimit(cn string, c *connCounters, open int64) {
+	t := d.connLimitThreshold(c)
+	if t == 0 || open < t {
+		return
+	}
+	// decide on the count under the lock, so a concurrent close can't rearm
+	// the warning while the count is at or above the threshold
+	c.warnMu.Lock()
+	open = atomic.LoadInt64(&c.open)
+	warn := !c.warned && open >= t
+	if warn {
+		c.warned = true
+	}
+	c.warnMu.Unlock()
+	if !warn {
+		return
+	}
+	d.logf(cn, "%d connections are open, reaching %.0f%% of the instance's limit of %d connections",
+		open, d.connLimit*100, atomic.LoadInt64(&c.limit))
+	d.recordMetrics(func() {
+		trace.RecordConnLimitWarning(context.Background(), d.metricInstance(cn), d.dialerID)
+	})
+}
+
+// resetConnLimit rearms the warning once open, the number of connections
+// open after one was closed, has dropped below the warning threshold.
+func (d *Dialer) resetConnLimit(c *connCounters, open int64) {
+	t := d.connLimitThreshold(c)
+	if t == 0 || open >= t {
+		return
+	}
+	c.warnMu.Lock()
+	if atomic.LoadInt64(&c.open) < t {
+		c.warned = false
+	}
+	c.warnMu.Unlock()
+}
@@ -0,0 +1,124 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/cloudsqlconn/internal/mock"
+)
+
+func TestConnLimitWarning(t *testing.T) {
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance",
+		mock.WithDatabaseFlags(map[string]string{"max_connections": "4"}),
+	)
+	svc, cleanup, err := mock.NewSQLAdminService(
+		context.Background(),
+		mock.InstanceGetSuccess(inst, 1),
+		mock.CreateEphemeralSuccess(inst, 1),
+	)
+	if err != nil {
+		t.Fatalf("failed to create test SQL admin service: %s", err)
+	}
+	stop := mock.StartServerProxy(t, inst)
+	defer func() {
+		stop()
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	logs := make(chanLogger, 10)
+	d, err := NewDialer(context.Background(),
+		WithTokenSource(mock.EmptyTokenSource{}),
+		WithLogger(logs),
+		WithConnLimitWarning(0.5),
+	)
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	d.sqladmin = svc
+
+	dial := func() func() error {
+		conn, err := d.Dial(context.Background(), "my-project:my-region:my-instance")
+		if err != nil {
+			t.Fatalf("expected Dial to succeed, but got error: %v", err)
+		}
+		return conn.Close
+	}
+	close1 := dial()
+	select {
+	case msg := <-logs:
+		t.Fatalf("want no warning below the threshold, got = %q", msg)
+	case <-time.After(100 * time.Millisecond):
+	}
+	close2 := dial()
+	select {
+	case msg := <-logs:
+		if !strings.Contains(msg, "2 connections are open") || !strings.Contains(msg, "limit of 4") {
+			t.Fatalf("want a warning about 2 of 4 connections, got = %q", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("want a warning at the threshold")
+	}
+
+	// the warning is rearmed once the connections drop below the threshold
+	c := d.counters("my-project:my-region:my-instance")
+	warned := func() bool {
+		c.warnMu.Lock()
+		defer c.warnMu.Unlock()
+		return c.warned
+	}
+	close3 := dial()
+	if !warned() {
+		t.Fatal("want the warning to stay fired above the threshold")
+	}
+	close3()
+	if !warned() {
+		t.Fatal("want the warning to stay fired at the threshold")
+	}
+	close2()
+	if warned() {
+		t.Fatal("want the warning rearmed below the threshold")
+	}
+	close1()
+
+	// the warning is decided on the current count, not that of a
+	// concurrent open or close
+	atomic.StoreInt64(&c.open, 3)
+	d.resetConnLimit(c, 1)
+	if warned() {
+		t.Fatal("want the warning to stay rearmed until the threshold is reached")
+	}
+	d.checkConnLimit("my-project:my-region:my-instance", c, 3)
+	if !warned() {
+		t.Fatal("want the warning fired at the threshold")
+	}
+	d.resetConnLimit(c, 1)
+	if !warned() {
+		t.Fatal("want the warning to stay fired while the count is at the threshold")
+	}
+	atomic.StoreInt64(&c.open, 0)
+	d.resetConnLimit(c, 0)
+	d.checkConnLimit("my-project:my-region:my-instance", c, 2)
+	if warned() {
+		t.Fatal("want no warning once the count has dropped below the threshold")
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"net"
+)
+
+// DialContextConn is like Dial, but the returned connection is also closed
+// when ctx is done. This scopes a connection to a request without the caller
+// having to watch the context itself. Closing the connection first releases
+// the context.
+func (d *Dialer) DialContextConn(ctx context.Context, instance string, opts ...DialOption) (net.Conn, error) {
+	conn, err := d.Dial(ctx, instance, opts...)
+	if err != nil {
+		return nil, err
+	}
+	ic, ok := conn.(*instrumentedConn)
+	if !ok {
+		// wrap the connection so that closing it stops watching ctx
+		ic = &instrumentedConn{Conn: conn, netConn: conn, closeFunc: func() {}}
+	}
+	ic.closeOnDone(ctx)
+	return ic, nil
+}
+
+// closeOnDone closes the connection when ctx is done, unless the connection
+// is closed first.
+func (i *instrumentedConn) closeOnDone(ctx context.Context) {
+	if ctx.Done() == nil {
+		return
+	}
+	i.closed = make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			i.Close()
+		case <-i.closed:
+		}
+	}()
+}
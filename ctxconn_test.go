@@ -0,0 +1,105 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/cloudsqlconn/internal/mock"
+)
+
+func TestDialContextConnClosesOnCancel(t *testing.T) {
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+	svc, cleanup, err := mock.NewSQLAdminService(
+		context.Background(),
+		mock.InstanceGetSuccess(inst, 1),
+		mock.CreateEphemeralSuccess(inst, 1),
+	)
+	if err != nil {
+		t.Fatalf("failed to create test SQL admin service: %s", err)
+	}
+	stop := mock.StartServerProxy(t, inst)
+	defer func() {
+		stop()
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	closed := make(chan ConnInfo, 2)
+	d, err := NewDialer(context.Background(),
+		WithTokenSource(mock.EmptyTokenSource{}),
+		WithConnectionHooks(nil, func(info ConnInfo) { closed <- info }),
+	)
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	d.sqladmin = svc
+
+	// A connection closed by the caller stops watching its context.
+	ctx, cancel := context.WithCancel(context.Background())
+	conn, err := d.DialContextConn(ctx, "my-project:my-region:my-instance")
+	if err != nil {
+		t.Fatalf("expected DialContextConn to succeed, but got error: %v", err)
+	}
+	if err := conn.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	<-closed
+	cancel()
+
+	// A connection still open when its context is canceled is closed.
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	conn, err = d.DialContextConn(ctx, "my-project:my-region:my-instance")
+	if err != nil {
+		t.Fatalf("expected DialContextConn to succeed, but got error: %v", err)
+	}
+	defer conn.Close()
+	cancel()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection was not closed after its context was canceled")
+	}
+	select {
+	case <-closed:
+		t.Fatal("connection was reported closed more than once")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestInstrumentedConnCloseTwice(t *testing.T) {
+	// a net.Pipe does not report closing it twice as an error
+	c, _ := net.Pipe()
+	closes := make(chan struct{}, 2)
+	ic := &instrumentedConn{Conn: c, netConn: c, closeFunc: func() { closes <- struct{}{} }}
+	if err := ic.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if err := ic.Close(); err != nil {
+		t.Fatalf("second Close failed: %v", err)
+	}
+	<-closes
+	select {
+	case <-closes:
+		t.Fatal("connection was reported closed more than once")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
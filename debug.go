@@ -0,0 +1,230 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// debugConfig is the sanitized configuration of a Dialer. It must never
+// include credentials, keys, or certificates.
+type debugConfig struct {
+	UserAgent         string `json:"user_agent"`
+	RefreshTimeout    string `json:"refresh_timeout"`
+	DefaultIPType     string `json:"default_ip_type"`
+	IPv6Preferred     bool   `json:"ipv6_preferred"`
+	TCPKeepAlive      string `json:"tcp_keep_alive"`
+	ServerValidation  string `json:"server_validation"`
+	ClientCertSource  string `json:"client_cert_source"`
+	FailoverThreshold int    `json:"failover_threshold,omitempty"`
+	MaintenanceDrain  string `json:"maintenance_drain,omitempty"`
+	LivenessInterval  string `json:"liveness_interval,omitempty"`
+	RefreshPaused     bool   `json:"refresh_paused"`
+}
+
+// debugInstance is the state of a single instance.
+type debugInstance struct {
+	Healthy      bool              `json:"healthy"`
+	Degraded     bool              `json:"degraded"`
+	Throttled    bool              `json:"cpu_throttled"`
+	State        string            `json:"state,omitempty"`
+	InstanceType string            `json:"instance_type,omitempty"`
+	IPAddrs      map[string]string `json:"ip_addresses,omitempty"`
+	IAMAuthN     bool              `json:"iam_authn"`
+	CASServerCA  bool              `json:"cas_server_ca"`
+	CertNotAfter *time.Time        `json:"cert_not_after,omitempty"`
+	LastRefresh  *time.Time        `json:"last_refresh,omitempty"`
+	NextRefresh  *time.Time        `json:"next_refresh,omitempty"`
+	LastError    string            `json:"last_refresh_error,omitempty"`
+	Failures     int               `json:"consecutive_failures"`
+	OpenConns    int64             `json:"open_connections"`
+	Maintenance  *time.Time        `json:"scheduled_maintenance,omitempty"`
+	APICalls     map[string]int64  `json:"admin_api_calls"`
+}
+
+// debugReplicaSet is the state of a registered replica set.
+type debugReplicaSet struct {
+	Primary  string   `json:"primary"`
+	Replicas []string `json:"replicas"`
+	DR       string   `json:"dr_replica,omitempty"`
+	Failures int      `json:"consecutive_primary_failures"`
+}
+
+// debugState is the document produced by DebugJSON.
+type debugState struct {
+	DialerID    string                     `json:"dialer_id"`
+	Config      debugConfig                `json:"config"`
+	APICalls    map[string]int64           `json:"admin_api_calls"`
+	Instances   map[string]debugInstance   `json:"instances"`
+	ReplicaSets map[string]debugReplicaSet `json:"replica_sets,omitempty"`
+	Aliases     map[string]string          `json:"aliases,omitempty"`
+}
+
+// DebugJSON returns a JSON document describing the Dialer's internal state:
+// its configuration, and for each instance it has connected to, the result of
+// recent refreshes, the expiration of the client certificate in use, and the
+// number of open connections. Credentials, keys, and certificates are never
+// included, so the output is safe to attach to bug reports.
+func (d *Dialer) DebugJSON() ([]byte, error) {
+	return json.MarshalIndent(d.debugState(), "", "  ")
+}
+
+// debugState collects the Dialer's internal state for DebugJSON and
+// PublishExpvar.
+func (d *Dialer) debugState() debugState {
+	s := debugState{
+		DialerID: d.dialerID,
+		Config: debugConfig{
+			UserAgent:         d.userAgent,
+			RefreshTimeout:    d.refreshTimeout.String(),
+			DefaultIPType:     d.defaultDialCfg.ipType,
+			IPv6Preferred:     d.defaultDialCfg.ipv6Preferred,
+			TCPKeepAlive:      d.defaultDialCfg.tcpKeepAlive.String(),
+			ServerValidation:  d.serverValidation,
+			ClientCertSource:  "ephemeral",
+			FailoverThreshold: d.failoverThreshold,
+		},
+		APICalls:    make(map[string]int64),
+		Instances:   make(map[string]debugInstance),
+		ReplicaSets: make(map[string]debugReplicaSet),
+		Aliases:     make(map[string]string),
+	}
+	if d.certProvider != nil {
+		s.Config.ClientCertSource = "provider"
+	}
+	if d.maintenanceDrain > 0 {
+		s.Config.MaintenanceDrain = d.maintenanceDrain.String()
+	}
+	if d.livenessInterval > 0 {
+		s.Config.LivenessInterval = d.livenessInterval.String()
+	}
+
+	d.lock.RLock()
+	s.Config.RefreshPaused = d.refreshPaused
+	for cn, i := range d.instances {
+		st := i.Status()
+		di := debugInstance{
+			Healthy:      i.Healthy(),
+			Degraded:     st.Degraded,
+			Throttled:    st.Throttled,
+			State:        st.State,
+			InstanceType: st.InstanceType,
+			IPAddrs:      st.IPAddrs,
+			IAMAuthN:     st.IAMAuthN,
+			CASServerCA:  st.CASServerCerts,
+			Failures:     st.Failures,
+			APICalls:     st.APICalls,
+		}
+		for method, n := range st.APICalls {
+			s.APICalls[method] += n
+		}
+		if !st.Expiry.IsZero() {
+			di.CertNotAfter = &st.Expiry
+		}
+		if !st.LastRefresh.IsZero() {
+			di.LastRefresh = &st.LastRefresh
+		}
+		if !st.NextRefresh.IsZero() {
+			di.NextRefresh = &st.NextRefresh
+		}
+		if st.LastErr != nil {
+			di.LastError = st.LastErr.Error()
+		}
+		s.Instances[cn] = di
+	}
+	for name, rs := range d.replicaSets {
+		rs.mu.RLock()
+		s.ReplicaSets[name] = debugReplicaSet{
+			Primary:  rs.primary,
+			Replicas: rs.replicas,
+			DR:       rs.dr,
+			Failures: rs.failures,
+		}
+		rs.mu.RUnlock()
+	}
+	for alias, target := range d.aliases {
+		s.Aliases[alias] = target
+	}
+	d.lock.RUnlock()
+
+	for cn, di := range s.Instances {
+		di.OpenConns = d.openConnCount(cn)
+		d.connLock.Lock()
+		if start, ok := d.maintenance[cn]; ok {
+			di.Maintenance = &start
+		}
+		d.connLock.Unlock()
+		s.Instances[cn] = di
+	}
+	return s
+}
+
+var (
+	// expvarMu guards expvarDialers and makes checking for and publishing a
+	// variable in PublishExpvar atomic.
+	expvarMu sync.Mutex
+	// expvarDialers maps the names published by PublishExpvar to the Dialer
+	// each describes, or to nil once that Dialer is closed, so that the
+	// variable doesn't keep a closed Dialer alive.
+	expvarDialers = make(map[string]*Dialer)
+)
+
+// PublishExpvar publishes the document returned by DebugJSON as the expvar
+// variable name, so that it is served by the expvar handler at /debug/vars
+// alongside the process's other variables. The document is rebuilt each time
+// the variable is read. expvar variables cannot be removed, so once the Dialer
+// is closed the variable is null, and another Dialer may publish under the
+// same name. PublishExpvar returns an error if the name is in use by an open
+// Dialer or by another expvar variable.
+func (d *Dialer) PublishExpvar(name string) error {
+	expvarMu.Lock()
+	defer expvarMu.Unlock()
+	if cur, ok := expvarDialers[name]; ok {
+		if cur != nil {
+			return fmt.Errorf("expvar variable %q is already published", name)
+		}
+		expvarDialers[name] = d
+		return nil
+	}
+	if expvar.Get(name) != nil {
+		return fmt.Errorf("expvar variable %q is already published", name)
+	}
+	expvarDialers[name] = d
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		expvarMu.Lock()
+		d := expvarDialers[name]
+		expvarMu.Unlock()
+		if d == nil {
+			return nil
+		}
+		return d.debugState()
+	}))
+	return nil
+}
+
+// unpublishExpvar detaches the variables published by d from it.
+func (d *Dialer) unpublishExpvar() {
+	expvarMu.Lock()
+	defer expvarMu.Unlock()
+	for name, cur := range expvarDialers {
+		if cur == d {
+			expvarDialers[name] = nil
+		}
+	}
+}
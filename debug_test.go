@@ -0,0 +1,163 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/cloudsqlconn/internal/mock"
+)
+
+func TestDebugJSON(t *testing.T) {
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+	svc, cleanup, err := mock.NewSQLAdminService(
+		context.Background(),
+		mock.InstanceGetSuccess(inst, 1),
+		mock.CreateEphemeralSuccess(inst, 1),
+	)
+	if err != nil {
+		t.Fatalf("failed to create test SQL admin service: %s", err)
+	}
+	stop := mock.StartServerProxy(t, inst)
+	defer func() {
+		stop()
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	d, err := NewDialer(context.Background(), WithTokenSource(mock.EmptyTokenSource{}))
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	d.sqladmin = svc
+
+	cn := "my-project:my-region:my-instance"
+	conn, err := d.Dial(context.Background(), cn)
+	if err != nil {
+		t.Fatalf("expected Dial to succeed, but got error: %v", err)
+	}
+	defer conn.Close()
+
+	b, err := d.DebugJSON()
+	if err != nil {
+		t.Fatalf("DebugJSON failed: %v", err)
+	}
+	if strings.Contains(string(b), "PRIVATE KEY") || strings.Contains(string(b), "CERTIFICATE") {
+		t.Fatalf("DebugJSON leaked key material: %s", b)
+	}
+	var got debugState
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("DebugJSON returned invalid JSON: %v", err)
+	}
+	if got.DialerID != d.dialerID {
+		t.Fatalf("dialer ID mismatch, want = %v, got = %v", d.dialerID, got.DialerID)
+	}
+	i, ok := got.Instances[cn]
+	if !ok {
+		t.Fatalf("want instance %v in DebugJSON, got = %s", cn, b)
+	}
+	if !i.Healthy || i.CertNotAfter == nil || i.OpenConns != 1 {
+		t.Fatalf("unexpected instance state: %s", b)
+	}
+}
+
+func TestPublishExpvar(t *testing.T) {
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+	svc, cleanup, err := mock.NewSQLAdminService(
+		context.Background(),
+		mock.InstanceGetSuccess(inst, 1),
+		mock.CreateEphemeralSuccess(inst, 1),
+	)
+	if err != nil {
+		t.Fatalf("failed to create test SQL admin service: %s", err)
+	}
+	stop := mock.StartServerProxy(t, inst)
+	defer func() {
+		stop()
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	d, err := NewDialer(context.Background(), WithTokenSource(mock.EmptyTokenSource{}))
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	d.sqladmin = svc
+	other, err := NewDialer(context.Background(), WithTokenSource(mock.EmptyTokenSource{}))
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer other.Close()
+
+	// Only one of two Dialers publishing the same name at once succeeds.
+	name := "cloudsqlconn_test_" + d.dialerID
+	errs := make(chan error, 2)
+	go func() { errs <- d.PublishExpvar(name + "_race") }()
+	go func() { errs <- other.PublishExpvar(name + "_race") }()
+	if err1, err2 := <-errs, <-errs; (err1 == nil) == (err2 == nil) {
+		t.Fatalf("want exactly one PublishExpvar to succeed, got errors %v and %v", err1, err2)
+	}
+
+	if err := d.PublishExpvar(name); err != nil {
+		t.Fatalf("PublishExpvar failed: %v", err)
+	}
+	if err := d.PublishExpvar(name); err == nil {
+		t.Fatal("want PublishExpvar to fail for an existing name")
+	}
+
+	cn := "my-project:my-region:my-instance"
+	conn, err := d.Dial(context.Background(), cn)
+	if err != nil {
+		t.Fatalf("expected Dial to succeed, but got error: %v", err)
+	}
+	defer conn.Close()
+
+	// The variable reflects instances dialed after it was published.
+	v := expvar.Get(name)
+	var got debugState
+	if err := json.Unmarshal([]byte(v.String()), &got); err != nil {
+		t.Fatalf("expvar variable is invalid JSON: %v", err)
+	}
+	i, ok := got.Instances[cn]
+	if !ok {
+		t.Fatalf("want instance %v in expvar variable, got = %v", cn, v)
+	}
+	if i.CertNotAfter == nil || i.Failures != 0 {
+		t.Fatalf("unexpected instance state: %v", v)
+	}
+
+	// Once the Dialer is closed, the variable no longer refers to it and
+	// the name may be reused.
+	d.Close()
+	if got := v.String(); got != "null" {
+		t.Fatalf("want closed Dialer's variable to be null, got = %v", got)
+	}
+	next, err := NewDialer(context.Background(), WithTokenSource(mock.EmptyTokenSource{}))
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer next.Close()
+	if err := next.PublishExpvar(name); err != nil {
+		t.Fatalf("want PublishExpvar to reuse a closed Dialer's name, got error: %v", err)
+	}
+}
@@ -0,0 +1,250 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"strings"
+
+	"cloud.google.com/go/cloudsqlconn/errtypes"
+	"cloud.google.com/go/cloudsqlconn/instance"
+	"cloud.google.com/go/cloudsqlconn/internal/cloudsql"
+	"cloud.google.com/go/cloudsqlconn/internal/sqladmin"
+)
+
+// The checks that Diagnose performs, in the order they are performed.
+const (
+	// CheckCredentials checks that the Dialer's credentials yield a token.
+	CheckCredentials = "credentials"
+	// CheckAPIEnabled checks that the Cloud SQL Admin API is enabled and
+	// that the instance can be retrieved from it.
+	CheckAPIEnabled = "api_enabled"
+	// CheckConnectPermission checks that the Dialer's credentials have the
+	// cloudsql.instances.connect permission on the instance.
+	CheckConnectPermission = "connect_permission"
+	// CheckIPReachable checks that the instance has an IP address of the
+	// type selected by the default DialOptions and that its server-side
+	// proxy accepts TCP connections at that address.
+	CheckIPReachable = "ip_reachable"
+	// CheckIAMAuthN reports whether the instance has IAM database
+	// authentication enabled. It never fails.
+	CheckIAMAuthN = "iam_authn"
+)
+
+// Finding is the result of a single check made by Diagnose.
+type Finding struct {
+	// Check is the check that was made, e.g., CheckAPIEnabled.
+	Check string
+	// OK reports whether the check passed.
+	OK bool
+	// Message describes the result and, when the check failed, how to fix
+	// it.
+	Message string
+	// Hint suggests how to fix a failed check, if a fix is known.
+	Hint *errtypes.Hint
+}
+
+// Report is the result of Diagnose.
+type Report struct {
+	// Instance is the connection name of the instance that was diagnosed.
+	Instance string
+	// Findings are the results of the checks that were made, in order.
+	// Checks that depend on an earlier check that failed are not made.
+	Findings []Finding
+}
+
+// OK reports whether every check passed.
+func (r Report) OK() bool {
+	for _, f := range r.Findings {
+		if !f.OK {
+			return false
+		}
+	}
+	return true
+}
+
+func (r Report) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "diagnosis of %s:", r.Instance)
+	for _, f := range r.Findings {
+		status := "OK"
+		if !f.OK {
+			status = "FAIL"
+		}
+		fmt.Fprintf(&b, "\n  [%s] %s: %s", status, f.Check, f.Message)
+		if f.Hint == nil {
+			continue
+		}
+		for _, l := range f.Hint.Links {
+			fmt.Fprintf(&b, "\n    see %s", l)
+		}
+	}
+	return b.String()
+}
+
+// Diagnose checks whether the Dialer is able to connect to instanceName, which
+// is an instance connection name or an alias of one, and describes how to fix
+// any problem it finds. It checks the Dialer's credentials, that the Cloud SQL
+// Admin API is enabled, that the credentials have permission to connect, that
+// the instance's server-side proxy is reachable at an address of the type
+// selected by the default DialOptions, and whether the instance has IAM
+// database authentication enabled. Diagnose calls the Cloud SQL Admin API
+// directly and does not change the information the Dialer uses to connect to
+// the instance. Failed checks are reported in the Report; an error is
+// returned only if instanceName is not a valid connection name or the checks
+// could not be made.
+func (d *Dialer) Diagnose(ctx context.Context, instanceName string) (Report, error) {
+	cn, err := instance.ParseConnName(d.resolveAlias(instanceName))
+	if err != nil {
+		return Report{}, err
+	}
+	r := Report{Instance: cn.String()}
+	add := func(f Finding) bool {
+		r.Findings = append(r.Findings, f)
+		return f.OK
+	}
+
+	if d.checkToken {
+		if err := d.validateCredentials(ctx); err != nil {
+			add(Finding{
+				Check: CheckCredentials,
+				Message: fmt.Sprintf("failed to obtain a token with the Dialer's credentials: %v; "+
+					"check the credentials passed to NewDialer or the Application Default Credentials", err),
+			})
+			return r, nil
+		}
+		add(Finding{Check: CheckCredentials, OK: true, Message: "obtained a token"})
+	}
+
+	d.lock.RLock()
+	key := d.key
+	d.lock.RUnlock()
+	if key == nil && d.certProvider == nil {
+		// generate the default key without holding the lock
+		var err error
+		if key, err = getDefaultKeys(); err != nil {
+			return r, err
+		}
+	}
+	d.lock.Lock()
+	client, err := d.adminClient(cn.String())
+	if d.key == nil {
+		d.key = key
+	}
+	key = d.key
+	d.lock.Unlock()
+	if err != nil {
+		return r, err
+	}
+
+	db, err := client.GetInstance(ctx, cn.Project(), cn.Name())
+	if !add(diagnoseAPICall(CheckAPIEnabled, cn, err,
+		"retrieved the instance from the Cloud SQL Admin API", "failed to get the instance")) {
+		return r, nil
+	}
+
+	if d.certProvider != nil {
+		add(Finding{
+			Check:   CheckConnectPermission,
+			OK:      true,
+			Message: "skipped, client certificates are obtained from the certificate provider",
+		})
+	} else {
+		pub, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+		if err != nil {
+			return r, err
+		}
+		_, err = client.CreateEphemeral(ctx, cn.Project(), cn.Name(), &sqladmin.SslCertsCreateEphemeralRequest{
+			PublicKey: string(pem.EncodeToMemory(&pem.Block{Bytes: pub, Type: "RSA PUBLIC KEY"})),
+		})
+		if !add(diagnoseAPICall(CheckConnectPermission, cn, err,
+			"obtained a client certificate", "failed to obtain a client certificate")) {
+			return r, nil
+		}
+	}
+
+	add(d.diagnoseReachable(ctx, cloudsql.IPAddrs(db)))
+
+	if cloudsql.IAMAuthN(db) {
+		add(Finding{Check: CheckIAMAuthN, OK: true, Message: "IAM database authentication is enabled"})
+	} else {
+		add(Finding{
+			Check: CheckIAMAuthN,
+			OK:    true,
+			Message: "IAM database authentication is disabled; set the cloudsql.iam_authentication " +
+				"flag on the instance to log in as IAM principals",
+		})
+	}
+	return r, nil
+}
+
+// diagnoseAPICall describes the result of a call to the Cloud SQL Admin API
+// for the instance cn made for check, which failed with err if it is not nil.
+func diagnoseAPICall(check string, cn instance.ConnName, err error, okMsg, failMsg string) Finding {
+	f := Finding{Check: check}
+	if err == nil {
+		f.OK = true
+		f.Message = okMsg
+		return f
+	}
+	f.Message = fmt.Sprintf("%s: %v", failMsg, err)
+	if h := errtypes.NewRefreshError(failMsg, cn.String(), err).Hint; h != nil {
+		f.Message = fmt.Sprintf("%s; %s", f.Message, h.Message)
+		f.Hint = h
+	}
+	return f
+}
+
+// diagnoseReachable checks that the server-side proxy accepts TCP
+// connections at one of ipAddrs of the types selected by the default
+// DialOptions.
+func (d *Dialer) diagnoseReachable(ctx context.Context, ipAddrs map[string]string) Finding {
+	f := Finding{Check: CheckIPReachable}
+	if d.defaultDialCfg.iapTarget != nil {
+		f.OK = true
+		f.Message = "skipped, connections are made through an IAP tunnel"
+		return f
+	}
+	ipTypes := d.defaultDialCfg.preferredIPTypes()
+	var errs []string
+	for _, t := range ipTypes {
+		ip, ok := ipAddrs[t]
+		if !ok {
+			continue
+		}
+		addr := net.JoinHostPort(ip, serverProxyPort)
+		conn, err := d.dial(ctx, "tcp", addr)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s (%s): %v", addr, t, err))
+			continue
+		}
+		conn.Close()
+		f.OK = true
+		f.Message = fmt.Sprintf("reached the instance at %s (%s)", addr, t)
+		return f
+	}
+	if len(errs) == 0 {
+		f.Message = fmt.Sprintf("the instance has no IP address of type %s; use a DialOption "+
+			"such as WithPrivateIP to select a type it has", strings.Join(ipTypes, ", "))
+		return f
+	}
+	f.Message = fmt.Sprintf("failed to reach the instance at %s; check that a network route and "+
+		"firewall rules allow outbound TCP connections to port %s", strings.Join(errs, ", "), serverProxyPort)
+	return f
+}
@@ -0,0 +1,200 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"cloud.google.com/go/cloudsqlconn/errtypes"
+	"cloud.google.com/go/cloudsqlconn/internal/mock"
+)
+
+// checks returns the checks of the findings in r and whether each passed.
+func checks(r Report) map[string]bool {
+	m := make(map[string]bool)
+	for _, f := range r.Findings {
+		m[f.Check] = f.OK
+	}
+	return m
+}
+
+func TestDiagnose(t *testing.T) {
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+	svc, cleanup, err := mock.NewSQLAdminService(
+		context.Background(),
+		mock.InstanceGetSuccess(inst, 1),
+		mock.CreateEphemeralSuccess(inst, 1),
+	)
+	if err != nil {
+		t.Fatalf("failed to create SQL Admin service: %v", err)
+	}
+	stop := mock.StartServerProxy(t, inst)
+	defer func() {
+		stop()
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	d, err := NewDialer(context.Background(), WithTokenSource(mock.EmptyTokenSource{}))
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	d.sqladmin = svc
+
+	r, err := d.Diagnose(context.Background(), "my-project:my-region:my-instance")
+	if err != nil {
+		t.Fatalf("expected Diagnose to succeed, but got error: %v", err)
+	}
+	if !r.OK() {
+		t.Fatalf("want every check to pass, got = %v", r)
+	}
+	want := map[string]bool{
+		CheckCredentials:       true,
+		CheckAPIEnabled:        true,
+		CheckConnectPermission: true,
+		CheckIPReachable:       true,
+		CheckIAMAuthN:          true,
+	}
+	if got := checks(r); !reflect.DeepEqual(got, want) {
+		t.Fatalf("checks, want = %v, got = %v", want, got)
+	}
+	if _, ok := d.instances["my-project:my-region:my-instance"]; ok {
+		t.Fatal("want Diagnose to leave the Dialer's instances unchanged")
+	}
+}
+
+func TestDiagnoseFailures(t *testing.T) {
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+	tcs := []struct {
+		desc string
+		reqs []*mock.Request
+		opts []DialerOption
+		want map[string]bool
+		// action is the action suggested by the last finding, if any
+		action string
+	}{
+		{
+			desc: "API not enabled",
+			reqs: []*mock.Request{
+				mock.InstanceGetError(inst, http.StatusForbidden, "accessNotConfigured", 1),
+			},
+			want:   map[string]bool{CheckCredentials: true, CheckAPIEnabled: false},
+			action: errtypes.ActionEnableAdminAPI,
+		},
+		{
+			desc: "missing connect permission",
+			reqs: []*mock.Request{
+				mock.InstanceGetSuccess(inst, 1),
+				mock.CreateEphemeralError(inst, http.StatusForbidden, "notAuthorized", 1),
+			},
+			want: map[string]bool{
+				CheckCredentials:       true,
+				CheckAPIEnabled:        true,
+				CheckConnectPermission: false,
+			},
+			action: errtypes.ActionGrantClientRole,
+		},
+		{
+			desc: "unreachable",
+			reqs: []*mock.Request{
+				mock.InstanceGetSuccess(inst, 1),
+				mock.CreateEphemeralSuccess(inst, 1),
+			},
+			opts: []DialerOption{
+				WithDialFunc(func(context.Context, string, string) (net.Conn, error) {
+					return nil, errors.New("connection refused")
+				}),
+			},
+			want: map[string]bool{
+				CheckCredentials:       true,
+				CheckAPIEnabled:        true,
+				CheckConnectPermission: true,
+				CheckIPReachable:       false,
+				CheckIAMAuthN:          true,
+			},
+		},
+		{
+			desc: "no IP of the selected type",
+			reqs: []*mock.Request{
+				mock.InstanceGetSuccess(inst, 1),
+				mock.CreateEphemeralSuccess(inst, 1),
+			},
+			opts: []DialerOption{WithDefaultDialOptions(WithPrivateIP())},
+			want: map[string]bool{
+				CheckCredentials:       true,
+				CheckAPIEnabled:        true,
+				CheckConnectPermission: true,
+				CheckIPReachable:       false,
+				CheckIAMAuthN:          true,
+			},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.desc, func(t *testing.T) {
+			svc, cleanup, err := mock.NewSQLAdminService(context.Background(), tc.reqs...)
+			if err != nil {
+				t.Fatalf("failed to create SQL Admin service: %v", err)
+			}
+			defer func() {
+				if err := cleanup(); err != nil {
+					t.Fatalf("%v", err)
+				}
+			}()
+			opts := append([]DialerOption{WithTokenSource(mock.EmptyTokenSource{})}, tc.opts...)
+			d, err := NewDialer(context.Background(), opts...)
+			if err != nil {
+				t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+			}
+			defer d.Close()
+			d.sqladmin = svc
+
+			r, err := d.Diagnose(context.Background(), "my-project:my-region:my-instance")
+			if err != nil {
+				t.Fatalf("expected Diagnose to succeed, but got error: %v", err)
+			}
+			if r.OK() {
+				t.Fatalf("want a check to fail, got = %v", r)
+			}
+			if got := checks(r); !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("checks, want = %v, got = %v", tc.want, got)
+			}
+			if tc.action == "" {
+				return
+			}
+			last := r.Findings[len(r.Findings)-1]
+			if last.Hint == nil || last.Hint.Action != tc.action {
+				t.Fatalf("hint, want action = %v, got = %+v", tc.action, last.Hint)
+			}
+		})
+	}
+}
+
+func TestDiagnoseInvalidName(t *testing.T) {
+	d, err := NewDialer(context.Background(), WithTokenSource(mock.EmptyTokenSource{}))
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	if _, err := d.Diagnose(context.Background(), "bad-name"); err == nil {
+		t.Fatal("want Diagnose to fail for an invalid connection name")
+	}
+}
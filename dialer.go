@@ -19,18 +19,22 @@ import (
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"net"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"cloud.google.com/go/cloudsqlconn/errtypes"
 	"cloud.google.com/go/cloudsqlconn/internal/cloudsql"
+	"cloud.google.com/go/cloudsqlconn/internal/sqladmin"
 	"cloud.google.com/go/cloudsqlconn/internal/trace"
 	"github.com/google/uuid"
 	"golang.org/x/net/proxy"
-	"google.golang.org/api/option"
-	sqladmin "google.golang.org/api/sqladmin/v1beta4"
+	"golang.org/x/oauth2"
 )
 
 const (
@@ -62,49 +66,279 @@ func getDefaultKeys() (*rsa.PrivateKey, error) {
 //
 // Use NewDialer to initialize a Dialer.
 type Dialer struct {
+	*dialerState
+
+	// defaultDialCfg holds the constructor level DialOptions, or those given
+	// to WithDefaults, so that it can be copied and mutated by the Dial
+	// function.
+	defaultDialCfg dialCfg
+}
+
+// dialerState is the state of a Dialer that is shared with the views
+// returned by WithDefaults.
+type dialerState struct {
 	lock sync.RWMutex
 	// instances map connection names (e.g., my-project:us-central1:my-instance)
 	// to *cloudsql.Instance types.
-	instances      map[string]*cloudsql.Instance
+	instances map[string]*cloudsql.Instance
+	// replicaSets map logical names to a primary instance and its replicas.
+	replicaSets map[string]*replicaSet
+	// aliases map alternative names to instance connection names or replica
+	// set names.
+	aliases map[string]string
+	// openConns map connection names to the *connCounters of their open
+	// connections.
+	openConns sync.Map
+	// refreshPaused is true between calls to PauseRefresh and ResumeRefresh.
+	refreshPaused bool
+
+	// connLock guards conns, maintenance, and drainTimers.
+	connLock sync.Mutex
+	// conns map connection names to the set of open connections. They are
+	// only tracked when trackConns is set.
+	conns map[string]map[*instrumentedConn]struct{}
+	// trackConns is set when liveness probes or maintenance draining need
+	// the open connections.
+	trackConns bool
+	// maintenance map connection names to the start of the instance's next
+	// scheduled maintenance.
+	maintenance map[string]time.Time
+	// drainTimers map connection names to timers that close the instance's
+	// connections before scheduled maintenance.
+	drainTimers map[string]*time.Timer
+
+	// key represents the client. If nil, the default key is generated when
+	// it is first needed.
 	key            *rsa.PrivateKey
 	refreshTimeout time.Duration
+	// serverValidation is how server certificates are verified (i.e., LEGACY
+	// or CAS).
+	serverValidation string
+	// certProvider, if set, supplies client certificates in place of
+	// ephemeral certificates.
+	certProvider func(ctx context.Context, instance string) (tls.Certificate, error)
+	// staticInfo maps connection names to connect info provisioned
+	// out-of-band, used in place of the Cloud SQL Admin API.
+	staticInfo map[string]StaticConnectInfo
+
+	// maxDials, if positive, bounds the dials in progress to
+	// each instance, which hold a slot in dialSlots, guarded by
+	// dialSlotsLock.
+	maxDials      int
+	dialSlotsLock sync.Mutex
+	dialSlots     map[string]*dialSlots
+
+	// onAudit, if set, is called for every Dial with auditPrincipal.
+	auditPrincipal string
+	onAudit        func(AuditEvent)
+
+	// failoverThreshold is the number of consecutive failed dials to a
+	// replica set's primary before checking for a promoted replica. Zero
+	// disables failover.
+	failoverThreshold int
+	onFailover        func(FailoverEvent)
+
+	// maintenanceDrain is how long before scheduled maintenance to close
+	// connections to an instance. Zero disables draining.
+	maintenanceDrain time.Duration
+	onMaintenance    func(instance string, start time.Time)
+
+	// onThrottle is called when a refresh started late enough to indicate
+	// CPU throttling.
+	onThrottle func(instance string, late time.Duration)
+
+	// logger, if set, receives failed background refreshes, and logLock
+	// guards logStates, which rate limits them.
+	logger    Logger
+	logLock   sync.Mutex
+	logStates map[string]*logState
+
+	// traceSampling is n when one in every n Dials is traced, and dialCount
+	// counts Dials to choose them. inlineMetrics is set when Dial records
+	// metrics without starting goroutines.
+	traceSampling uint32
+	dialCount     uint32
+	inlineMetrics bool
+
+	// refreshTimeouts map connection names to the refresh timeouts that
+	// override refreshTimeout for them.
+	refreshTimeouts map[string]time.Duration
+
+	// clock schedules refreshes and measures latencies.
+	clock Clock
+
+	// refreshLimiter, if set, bounds concurrent refreshes across instances.
+	refreshLimiter *cloudsql.RefreshLimiter
+	// refreshStrategy, if set, schedules refreshes in place of refreshing
+	// ahead of expiry.
+	refreshStrategy RefreshStrategy
+
+	// emitters maps connection names to the files that EmitCertificates
+	// keeps up to date, and emitWrites to the state of writing them, both
+	// guarded by emitLock.
+	emitLock   sync.Mutex
+	emitters   map[string][]certEmitter
+	emitWrites map[string]*emitWrite
+
+	// warmConns is the number of established connections kept ready for
+	// each instance, and warmMaxIdle is how long one may wait before it is
+	// discarded. Zero warmConns disables warm connections.
+	warmConns   int
+	warmMaxIdle time.Duration
+	// warmLock guards warmPools.
+	warmLock sync.Mutex
+	// warmPools map connection names to their warm connections.
+	warmPools map[string]*warmPool
 
 	sqladmin *sqladmin.Service
+	// sqladminOpts holds the options used to create the sqladmin client,
+	// excluding any credentials.
+	sqladminOpts []sqladmin.Option
+	// credentialOpts holds the credentials used to create sqladmin clients.
+	credentialOpts []sqladmin.Option
+	// resolveEndpoint, if set, maps a project to its Admin API endpoint.
+	resolveEndpoint func(project string) string
+	// projectCreds maps projects to the credentials used for them in place
+	// of credentialOpts.
+	projectCreds map[string]oauth2.TokenSource
+	// endpointClients map Admin API endpoints returned by resolveEndpoint,
+	// and projects with credentials of their own, to their clients.
+	endpointClients map[string]*sqladmin.Service
+	// userAgent is the user agent sent to the Cloud SQL Admin API.
+	userAgent string
+	// netDial makes network connections, e.g., to an SSH bastion or the IAP
+	// tunnel endpoint.
+	netDial dialFunc
+	// dial makes the TCP connections to instances.
+	dial dialFunc
+	// sshJumpHost, if set, is the bastion that dial connects through.
+	sshJumpHost *sshJumpHost
+	// lookupTXT, if set, looks up the TXT records that map domain names to
+	// instance connection names, and dnsSuffixes are the search domains
+	// tried for names that are not fully qualified.
+	lookupTXT   txtLookup
+	dnsSuffixes []string
+	// dnsLock guards dnsCache, candidates, and candidateDomains.
+	dnsLock sync.Mutex
+	// dnsCache maps fully qualified domain names to their cached TXT
+	// records.
+	dnsCache map[string]dnsCacheEntry
+	// candidates map the instances that domain names resolve to along with
+	// others to their dial history.
+	candidates map[string]*candidateHealth
+	// candidateDomains map domain names to the instances they last resolved
+	// to, so that the history of instances no longer resolved to is dropped.
+	candidateDomains map[string][]string
+	// iapTokens authenticates IAP tunnels. It is derived from credentialOpts
+	// on first use.
+	iapTokens oauth2.TokenSource
+	// strictStartup is set when Validate checks startupInstances.
+	strictStartup    bool
+	startupInstances []string
+	// checkToken is set when the Dialer's credentials can be checked, which
+	// they cannot with a custom HTTP client.
+	checkToken bool
+	// strictDials is set when Dial rejects DialOptions that conflict.
+	strictDials bool
+	// connLimit is the fraction of an instance's connection limit at which
+	// a warning is logged, or 0 to not warn.
+	connLimit float64
+	// metricLabel, if set, maps instance connection names to the values of
+	// the instance tag of metrics.
+	metricLabel InstanceLabeler
 
-	// defaultDialCfg holds the constructor level DialOptions, so that it can
-	// be copied and mutated by the Dial function.
-	defaultDialCfg dialCfg
+	// warmDialCfg holds the constructor level DialOptions, which warm
+	// connections are made with.
+	warmDialCfg dialCfg
 
 	// dialerID uniquely identifies a Dialer. Used for monitoring purposes,
 	// *only* when a client has configured OpenCensus exporters.
 	dialerID string
+
+	// onConnOpen and onConnClose are called when a connection returned by
+	// Dial is opened and closed.
+	onConnOpen  func(ConnInfo)
+	onConnClose func(ConnInfo)
+
+	// leakThreshold is how long a connection may stay open before it is
+	// reported to onLeak. Zero disables leak detection.
+	leakThreshold time.Duration
+	onLeak        func(info ConnInfo, stack []byte)
+
+	// livenessInterval is how often open connections are probed. Zero
+	// disables probing.
+	livenessInterval time.Duration
+	onDeadConn       func(instance string, conn net.Conn)
+
+	// done is closed when the Dialer is closed to stop background
+	// goroutines.
+	done chan struct{}
+	// failovers tracks replica set failovers in progress, which Close waits
+	// for.
+	failovers sync.WaitGroup
+
+	// dialsCtx is canceled by Close, which rejects new Dials and cancels
+	// those in progress.
+	dialsCtx    context.Context
+	cancelDials context.CancelFunc
+
+	// eventsLock guards events, the channel returned by Events, which is
+	// nil until Events is first called, and the state used to report
+	// changes: the expiry last reported near for each instance and the
+	// connection names each domain name last resolved to.
+	eventsLock   sync.Mutex
+	events       chan Event
+	eventsClosed bool
+	nearExpiry   map[string]time.Time
+	dnsTargets   map[string][]string
 }
 
 // NewDialer creates a new Dialer.
 //
-// Initial calls to NewDialer make take longer than normal because generation of an
-// RSA keypair is performed. Calls with a WithRSAKeyPair DialOption or after a default
-// RSA keypair is generated will be faster.
+// Unless a key is provided with WithRSAKey or WithRSAKeyFile, an RSA keypair is
+// generated when the Dialer first connects to an instance, so creating a Dialer
+// is cheap and the first Dial in a process may take longer than normal. The
+// generated keypair is shared by all Dialers in the process.
+//
+// Finding credentials may block, e.g., while the metadata server is
+// unreachable. If ctx is done first, NewDialer returns an
+// *errtypes.InitError wrapping ctx's error, whose Timeout method reports
+// whether ctx's deadline was exceeded. The search for credentials cannot be
+// interrupted, so it continues in a goroutine that exits, discarding its
+// result, only once the search completes; while discovery is stuck, each such
+// NewDialer call leaves one goroutine behind. The Dialer does not keep ctx, so
+// its credentials remain usable after ctx is done.
 func NewDialer(ctx context.Context, opts ...DialerOption) (*Dialer, error) {
 	cfg := &dialerConfig{
-		refreshTimeout: 30 * time.Second,
-		sqladminOpts:   []option.ClientOption{option.WithUserAgent(userAgent)},
+		refreshTimeout:   30 * time.Second,
+		serverValidation: cloudsql.LegacyServerValidation,
+		clock:            realClock{},
 	}
 	for _, opt := range opts {
 		opt(cfg)
 	}
+	ua := strings.Join(append([]string{userAgent}, cfg.userAgents...), " ")
+	cfg.sqladminOpts = append([]sqladmin.Option{sqladmin.WithUserAgent(ua)}, cfg.sqladminOpts...)
+	if cfg.httpClient != nil {
+		cfg.sqladminOpts = append(cfg.sqladminOpts, sqladmin.WithHTTPClient(cfg.httpClient))
+	}
+	if cfg.dialFunc != nil {
+		cfg.sqladminOpts = append(cfg.sqladminOpts, sqladmin.WithDialContext(cfg.dialFunc))
+	}
 
-	if cfg.rsaKey == nil {
-		key, err := getDefaultKeys()
+	if err := ctx.Err(); err != nil {
+		return nil, errtypes.NewInitError("context done before creating dialer", err)
+	}
+	if cfg.rsaKey == nil && cfg.rsaKeyFile != "" {
+		key, err := loadOrCreateKey(cfg.rsaKeyFile)
 		if err != nil {
-			return nil, fmt.Errorf("failed to generate RSA keys: %v", err)
+			return nil, err
 		}
 		cfg.rsaKey = key
 	}
-
-	client, err := sqladmin.NewService(ctx, cfg.sqladminOpts...)
+	client, err := newAdminClient(ctx, cfg)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create sqladmin client: %v", err)
+		return nil, err
 	}
 
 	dialCfg := dialCfg{
@@ -122,140 +356,792 @@ func NewDialer(ctx context.Context, opts ...DialerOption) (*Dialer, error) {
 		// it.
 		return nil, err
 	}
-	d := &Dialer{
+	dialsCtx, cancelDials := context.WithCancel(context.Background())
+	s := &dialerState{
 		instances:      make(map[string]*cloudsql.Instance),
+		replicaSets:    make(map[string]*replicaSet),
+		aliases:        make(map[string]string),
+		conns:          make(map[string]map[*instrumentedConn]struct{}),
+		maintenance:    make(map[string]time.Time),
+		drainTimers:    make(map[string]*time.Timer),
 		key:            cfg.rsaKey,
 		refreshTimeout: cfg.refreshTimeout,
 		sqladmin:       client,
-		defaultDialCfg: dialCfg,
+		sqladminOpts:   cfg.sqladminOpts,
+		credentialOpts: cfg.credentialOpts,
+		userAgent:      ua,
+		warmDialCfg:    dialCfg,
 		dialerID:       uuid.New().String(),
+
+		failoverThreshold: cfg.failoverThreshold,
+		onFailover:        cfg.onFailover,
+		maintenanceDrain:  cfg.maintenanceDrain,
+		onMaintenance:     cfg.onMaintenance,
+		livenessInterval:  cfg.livenessInterval,
+		onDeadConn:        cfg.onDeadConn,
+		serverValidation:  cfg.serverValidation,
+		certProvider:      cfg.certProvider,
+		staticInfo:        cfg.staticInfo,
+		auditPrincipal:    cfg.auditPrincipal,
+		onAudit:           cfg.onAudit,
+		maxDials:          cfg.maxDials,
+		dialSlots:         make(map[string]*dialSlots),
+		onConnOpen:        cfg.onConnOpen,
+		onConnClose:       cfg.onConnClose,
+		leakThreshold:     cfg.leakThreshold,
+		onLeak:            cfg.onLeak,
+		onThrottle:        cfg.onThrottle,
+		logger:            cfg.logger,
+		inlineMetrics:     cfg.inlineMetrics,
+		refreshStrategy:   cfg.refreshStrategy,
+		refreshTimeouts:   make(map[string]time.Duration),
+		clock:             cfg.clock,
+		resolveEndpoint:   cfg.resolveEndpoint,
+		projectCreds:      cfg.projectCreds,
+		endpointClients:   make(map[string]*sqladmin.Service),
+		warmConns:         cfg.warmConns,
+		warmMaxIdle:       cfg.warmMaxIdle,
+		warmPools:         make(map[string]*warmPool),
+		done:              make(chan struct{}),
+		dialsCtx:          dialsCtx,
+		cancelDials:       cancelDials,
+	}
+	if cfg.traceSampling > 1 {
+		s.traceSampling = uint32(cfg.traceSampling)
+	}
+	d := &Dialer{dialerState: s, defaultDialCfg: dialCfg}
+	d.netDial = proxy.Dial
+	if cfg.dialFunc != nil {
+		d.netDial = cfg.dialFunc
+	}
+	d.dial = d.netDial
+	if cfg.sshJumpHost != nil {
+		d.sshJumpHost = cfg.sshJumpHost
+		d.sshJumpHost.netDial = d.netDial
+		d.dial = d.sshJumpHost.dial
+	}
+	if cfg.dnsResolver {
+		d.lookupTXT = newTXTLookup(cfg.dialFunc, cfg.dnsServer)
+		d.dnsSuffixes = cfg.dnsSuffixes
+	}
+	if cfg.refreshLimit > 0 {
+		d.refreshLimiter = cloudsql.NewRefreshLimiter(cfg.refreshLimit)
+	}
+	d.trackConns = d.livenessInterval > 0 || d.maintenanceDrain > 0
+	if d.livenessInterval > 0 {
+		go d.probeConns()
+	}
+	d.checkToken = cfg.httpClient == nil
+	d.strictDials = cfg.strictDials
+	d.connLimit = cfg.connLimit
+	d.metricLabel = cfg.metricLabel
+	if cfg.strictStartup {
+		d.strictStartup = true
+		d.startupInstances = cfg.startupInstances
+		if err := d.Validate(ctx); err != nil {
+			d.Close()
+			return nil, err
+		}
 	}
 	return d, nil
 }
 
+// ForceRefresh triggers an immediate refresh of the information used to
+// connect to an instance, such as its IP addresses, server CA, and the client
+// certificate. It is useful after changing an instance's configuration. The
+// instance argument is an instance connection name, the name of a replica
+// set, in which case all of its members are refreshed, or an alias of either.
+// With WithDNSResolver, it may also be a domain name, in which case all of
+// the instances its TXT records hold are refreshed. ForceRefresh does not
+// wait for the refresh to complete.
+func (d *Dialer) ForceRefresh(instance string) error {
+	resolved, err := d.resolveDNS(context.Background(), d.resolveAlias(instance))
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, name := range resolved {
+		d.lock.RLock()
+		rs, ok := d.replicaSets[name]
+		d.lock.RUnlock()
+		if !ok {
+			names = append(names, name)
+			continue
+		}
+		primary, replicas := rs.members()
+		names = append(append(names, primary), replicas...)
+	}
+	for _, cn := range names {
+		i, err := d.instance(context.Background(), cn)
+		if err != nil {
+			return err
+		}
+		i.ForceRefresh()
+	}
+	return nil
+}
+
+// SetTokenSource replaces the credentials used by the Dialer with an OAuth2
+// token source. Subsequent calls to the Cloud SQL Admin API, including
+// background refreshes of instances that have already been dialed, use the new
+// token source. Cached connection info and open connections are unaffected.
+// Projects with credentials set by WithCredentialsForProject keep them.
+func (d *Dialer) SetTokenSource(ts oauth2.TokenSource) error {
+	credentialOpts := []sqladmin.Option{sqladmin.WithTokenSource(ts)}
+	opts := append(append([]sqladmin.Option{}, d.sqladminOpts...), credentialOpts...)
+	client, err := sqladmin.NewService(context.Background(), opts...)
+	if err != nil {
+		return fmt.Errorf("failed to create sqladmin client: %v", err)
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.sqladmin = client
+	d.credentialOpts = credentialOpts
+	d.iapTokens = nil
+	// Clients for resolved endpoints are recreated on demand with the new
+	// credentials.
+	d.endpointClients = make(map[string]*sqladmin.Service)
+	for cn, i := range d.instances {
+		c, err := d.adminClient(cn)
+		if err != nil {
+			return err
+		}
+		i.SetClient(c)
+	}
+	return nil
+}
+
 // Dial returns a net.Conn connected to the specified Cloud SQL instance. The instance argument must be the
-// instance's connection name, which is in the format "project-name:region:instance-name".
+// instance's connection name, which is in the format "project-name:region:instance-name", or the
+// name of a replica set registered with RegisterReplicaSet, or an alias registered with Alias.
+// With WithDNSResolver, it may also be a domain name whose TXT record holds the connection name.
+// If its TXT records hold several connection names, each is tried in turn until one connects.
+//
+// The returned net.Conn implements interface{ ConnectionState() tls.ConnectionState }, which
+// provides the negotiated TLS connection state.
 func (d *Dialer) Dial(ctx context.Context, instance string, opts ...DialOption) (conn net.Conn, err error) {
-	startTime := time.Now()
+	startTime := d.clock.Now()
+	ctx = d.sampleDial(ctx)
 	var endDial trace.EndSpanFunc
 	ctx, endDial = trace.StartSpan(ctx, "cloud.google.com/go/cloudsqlconn.Dial",
 		trace.AddInstanceName(instance),
 		trace.AddDialerID(d.dialerID),
 	)
 	defer func() { endDial(err) }()
+	var cn string
+	defer func() { d.audit(ctx, instance, cn, startTime, conn, err) }()
+	ctx, dialDone, err := d.startDial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if !dialDone() {
+			return
+		}
+		// the Dialer was closed while dialing
+		if conn != nil {
+			_ = conn.Close() // best effort close attempt
+			conn = nil
+		}
+		err = errtypes.ErrDialerClosed
+	}()
+	cfg := d.newDialCfg(opts)
+	if cfg.preConn != nil {
+		defer func() {
+			if err != nil {
+				_ = cfg.preConn.conn.Close() // best effort close attempt
+			}
+		}()
+	}
+	if err := d.validateDialCfg(instance, cfg); err != nil {
+		return nil, err
+	}
+	names, err := d.resolveDNS(ctx, d.resolveAlias(instance))
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 1 {
+		conn, cn, err = d.dialName(ctx, names[0], cfg, startTime)
+		return conn, err
+	}
+	for _, name := range d.orderCandidates(names) {
+		conn, cn, err = d.dialName(ctx, name, cfg, startTime)
+		d.recordCandidateDial(name, err)
+		// a provided connection can only be used once
+		if err == nil || ctx.Err() != nil || cfg.preConn != nil {
+			break
+		}
+	}
+	return conn, err
+}
+
+// newDialCfg returns the options for a Dial given opts: the Dialer's default
+// DialOptions, overridden by opts. Only an IP type given in opts counts as
+// set, since a default IP type does not conflict with the Dial's other
+// options.
+func (d *Dialer) newDialCfg(opts []DialOption) dialCfg {
 	cfg := d.defaultDialCfg
+	cfg.ipTypeSet = false
 	for _, opt := range opts {
 		opt(&cfg)
 	}
+	return cfg
+}
+
+// dialName connects to name, which is an instance connection name or the name
+// of a replica set, for Dial, returning the connection name of the instance it
+// dialed. startTime is when Dial was called.
+func (d *Dialer) dialName(ctx context.Context, name string, cfg dialCfg, startTime time.Time) (conn net.Conn, instance string, err error) {
+	instance = d.resolveReplicaSet(name, cfg.readOnly)
+	defer func() { d.recordPrimaryDial(name, instance, err) }()
+
+	i, err := d.instance(ctx, instance)
+	if err != nil {
+		return nil, instance, err
+	}
+	// Warm connections are made with the default options, so they can only
+	// be used when no others, except a priority or the default IP type, were
+	// given.
+	warmCfg := cfg
+	warmCfg.priority = d.warmDialCfg.priority
+	warmCfg.ipTypeSet = d.warmDialCfg.ipTypeSet
+	useWarm := d.warmConns > 0 && warmCfg == d.warmDialCfg
+	if useWarm {
+		defer d.refillWarm(i, instance)
+	}
+	var (
+		tlsConn *tls.Conn
+		netConn net.Conn
+		ipType  string
+		ok      bool
+	)
+	if useWarm {
+		tlsConn, netConn, ipType, ok = d.takeWarm(instance)
+	}
+	if !ok {
+		tlsConn, netConn, ipType, err = d.connectWithRetries(ctx, i, cfg)
+		if err != nil {
+			return nil, instance, err
+		}
+	}
+	latency := d.clock.Now().Sub(startTime).Milliseconds()
+	d.recordMetrics(func() { trace.RecordDialLatency(ctx, d.metricInstance(instance), d.dialerID, latency) })
 
+	conn = tlsConn
+	if cfg.mirror != nil {
+		conn = &mirrorConn{Conn: tlsConn, m: cfg.mirror}
+	}
+	return d.newInstrumentedConn(ctx, conn, netConn, instance, ipType), instance, nil
+}
+
+// preferredIPTypes returns the IP types that cfg allows, in order of
+// preference.
+func (cfg dialCfg) preferredIPTypes() []string {
+	ipTypes := []string{cfg.ipType}
+	if cfg.ipType == cloudsql.AutoIP {
+		ipTypes = []string{cloudsql.PublicIP, cloudsql.PrivateIP}
+	}
+	if cfg.ipv6Preferred && ipTypes[0] == cloudsql.PublicIP {
+		ipTypes = append([]string{cloudsql.PublicIPv6}, ipTypes...)
+	}
+	return ipTypes
+}
+
+// connect retrieves the information needed to connect to the instance and
+// establishes a TLS connection to its server-side proxy. It returns the TLS
+// connection, its underlying transport connection, and the IP type of the
+// address it connected to, ipTypeIAP for an IAP tunnel, or ipTypeProvided for
+// a connection provided with WithPreconnectedConn. It also returns the
+// instance's addresses of the types cfg prefers, as it found them before
+// connecting, or nil if it didn't get that far or dialed no address.
+func (d *Dialer) connect(ctx context.Context, i *cloudsql.Instance, cfg dialCfg) (tlsConn *tls.Conn, conn net.Conn, ipType string, dialed map[string]string, err error) {
 	var endInfo trace.EndSpanFunc
 	ctx, endInfo = trace.StartSpan(ctx, "cloud.google.com/go/cloudsqlconn/internal.InstanceInfo")
-	i, err := d.instance(instance)
+	ipTypes := cfg.preferredIPTypes()
+	if cfg.iapTarget != nil || cfg.preConn != nil {
+		// the VM, or the provided connection, forwards to the instance, so
+		// any IP address will do
+		ipTypes = []string{cloudsql.PrivateIP, cloudsql.PublicIP, cloudsql.PublicIPv6}
+	}
+	segStart := d.clock.Now()
+	ipAddrs, tlsCfg, err := i.ConnectAddrs(ctx, ipTypes...)
+	endInfo(err)
 	if err != nil {
-		endInfo(err)
-		return nil, err
+		return nil, nil, "", nil, err
 	}
-	addr, tlsCfg, err := i.ConnectInfo(ctx, cfg.ipType)
+	d.recordSegment(i.String(), trace.DialSegmentInstanceInfo, segStart)
+	if cfg.iapTarget == nil && cfg.preConn == nil {
+		dialed = ipAddrs
+	}
+
+	release, err := d.acquireDialSlot(ctx, i.String(), cfg.priority)
 	if err != nil {
-		endInfo(err)
-		return nil, err
+		return nil, nil, "", dialed, err
 	}
-	endInfo(err)
+	defer release()
 
 	var connectEnd trace.EndSpanFunc
 	ctx, connectEnd = trace.StartSpan(ctx, "cloud.google.com/go/cloudsqlconn/internal.Connect")
 	defer func() { connectEnd(err) }()
-	addr = net.JoinHostPort(addr, serverProxyPort)
-	conn, err = proxy.Dial(ctx, "tcp", addr)
+	// candidates are tried in order of preference
+	var addrs []string
+	addrTypes := make(map[string]string)
+	for _, t := range ipTypes {
+		if a, ok := ipAddrs[t]; ok {
+			a = net.JoinHostPort(a, serverProxyPort)
+			addrs = append(addrs, a)
+			addrTypes[a] = t
+		}
+	}
+	segStart = d.clock.Now()
+	var addr string
+	switch {
+	case cfg.preConn != nil:
+		conn = cfg.preConn.conn
+	case cfg.iapTarget != nil:
+		conn, err = d.dialIAP(ctx, cfg.iapTarget)
+	default:
+		conn, addr, err = dialParallel(ctx, d.dial, addrs, fallbackDelay)
+	}
 	if err != nil {
 		// refresh the instance info in case it caused the connection failure
-		i.ForceRefresh()
-		return nil, errtypes.NewDialError("failed to dial", i.String(), err)
+		i.ForceRefreshContext(ctx)
+		return nil, nil, "", dialed, errtypes.NewDialError("failed to dial", i.String(), err)
+	}
+	d.recordSegment(i.String(), trace.DialSegmentTCPConnect, segStart)
+	switch {
+	case cfg.preConn != nil:
+		ipType = ipTypeProvided
+	case cfg.iapTarget != nil:
+		ipType = ipTypeIAP
+	default:
+		ipType = addrTypes[addr]
 	}
-	if c, ok := conn.(*net.TCPConn); ok {
+	if addr != "" && len(addrs) > 1 {
+		d.recordMetrics(func() {
+			trace.RecordDialPath(context.Background(), d.metricInstance(i.String()), d.dialerID, addrTypes[addr])
+		})
+	}
+	// a provided connection keeps the caller's settings
+	if c, ok := conn.(*net.TCPConn); ok && cfg.preConn == nil {
 		if err := c.SetKeepAlive(true); err != nil {
-			return nil, errtypes.NewDialError("failed to set keep-alive", i.String(), err)
+			_ = conn.Close() // best effort close attempt
+			return nil, nil, "", dialed, errtypes.NewDialError("failed to set keep-alive", i.String(), err)
 		}
 		if err := c.SetKeepAlivePeriod(cfg.tcpKeepAlive); err != nil {
-			return nil, errtypes.NewDialError("failed to set keep-alive period", i.String(), err)
+			_ = conn.Close() // best effort close attempt
+			return nil, nil, "", dialed, errtypes.NewDialError("failed to set keep-alive period", i.String(), err)
 		}
 	}
-	tlsConn := tls.Client(conn, tlsCfg)
+	var transport net.Conn = conn
+	if cfg.bandwidthLimit > 0 {
+		transport = newLimitedConn(conn, cfg.bandwidthLimit)
+	}
+	segStart = d.clock.Now()
+	tlsConn = tls.Client(transport, tlsCfg)
 	if err := tlsConn.Handshake(); err != nil {
-		// refresh the instance info in case it caused the handshake failure
-		i.ForceRefresh()
+		if handshakeRejected(err) {
+			// refresh the instance info in case it caused the handshake
+			// failure, e.g., a stale client certificate or server CA
+			i.ForceRefreshContext(ctx)
+		}
 		_ = tlsConn.Close() // best effort close attempt
-		return nil, errtypes.NewDialError("handshake failed", i.String(), err)
+		return nil, nil, "", dialed, errtypes.NewDialError("handshake failed", i.String(), err)
 	}
-	latency := time.Since(startTime).Milliseconds()
-	go func() {
-		trace.RecordDialLatency(ctx, instance, d.dialerID, latency)
-		trace.RecordConnectionOpen(ctx, instance, d.dialerID)
-	}()
+	d.recordSegment(i.String(), trace.DialSegmentTLSHandshake, segStart)
+	trace.AnnotateSpan(ctx,
+		trace.AddLocalAddr(conn.LocalAddr().String()),
+		trace.AddRemoteAddr(conn.RemoteAddr().String()),
+	)
+	return tlsConn, conn, ipType, dialed, nil
+}
+
+// handshakeRejected reports whether err indicates that a TLS handshake failed
+// because either side rejected the other's certificate, which fresh instance
+// information may fix, rather than because of a network error, which it
+// would not.
+func handshakeRejected(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "remote error" {
+		// the server sent an alert, e.g., for an expired client certificate
+		return true
+	}
+	var (
+		uaErr   x509.UnknownAuthorityError
+		invErr  x509.CertificateInvalidError
+		hostErr x509.HostnameError
+		dialErr *errtypes.DialError
+	)
+	// the server's certificate failed verification
+	return errors.As(err, &uaErr) || errors.As(err, &invErr) ||
+		errors.As(err, &hostErr) || errors.As(err, &dialErr)
+}
+
+// serverCARotated reports whether err indicates that the server's certificate
+// was not signed by the server CA the Dialer knows about, which happens when
+// the instance's server CA has been rotated.
+func serverCARotated(err error) bool {
+	var uaErr x509.UnknownAuthorityError
+	return errors.As(err, &uaErr)
+}
+
+// ConnInfo describes a connection returned by Dial.
+type ConnInfo struct {
+	// Instance is the connection name of the instance the connection is to.
+	Instance string
+	// LocalAddr and RemoteAddr are the connection's local and remote network
+	// addresses. With Network, they form the connection's 5-tuple, which
+	// network teams can match with VPC flow logs and server-side logs.
+	LocalAddr  net.Addr
+	RemoteAddr net.Addr
+	// Network is the network of LocalAddr and RemoteAddr, e.g., "tcp".
+	Network string
+	// IPType is the IP type (PUBLIC, PRIVATE, PUBLIC_IPV6, IAP, or PROVIDED)
+	// the connection was dialed over.
+	IPType string
+	// TLSVersion and CipherSuite are the TLS version and cipher suite
+	// negotiated for the connection (e.g., tls.VersionTLS13).
+	TLSVersion  uint16
+	CipherSuite uint16
+	// TLSResumed reports whether the TLS session was resumed from an earlier
+	// connection.
+	TLSResumed bool
+	// TLSUnique identifies the TLS session: it is the session's tls-unique
+	// channel binding (RFC 5929). It is nil for TLS 1.3, which has none.
+	TLSUnique []byte
+	// Opened is when the connection was established.
+	Opened time.Time
+	// Closed is when the connection was closed, or the zero time if it is
+	// still open.
+	Closed time.Time
+	// Context is the context passed to Dial, so that hooks can read its
+	// values, e.g., a tenant ID or trace context set by middleware. It may be
+	// done by the time a hook is called.
+	Context context.Context
+}
+
+// recordSegment records the latency of the segment of a dial to instance that
+// started at start.
+func (d *Dialer) recordSegment(instance, segment string, start time.Time) {
+	latency := d.clock.Now().Sub(start).Milliseconds()
+	d.recordMetrics(func() {
+		trace.RecordDialSegmentLatency(context.Background(), d.metricInstance(instance), d.dialerID, segment, latency)
+	})
+}
 
-	return newInstrumentedConn(tlsConn, instance, d.dialerID), nil
+// newInstrumentedConn initializes an instrumentedConn that is counted by the
+// Dialer until it is closed. The netConn argument is the connection
+// underlying conn, ipType is the IP type it was dialed over, and ctx is the
+// context it was dialed with. Opening and closing the connection updates
+// the instance's counters without locking or starting goroutines, unless
+// connections are tracked or a close hook is set.
+func (d *Dialer) newInstrumentedConn(ctx context.Context, conn, netConn net.Conn, instance, ipType string) *instrumentedConn {
+	counters := d.counters(instance)
+	d.checkConnLimit(instance, counters, counters.opened(ipType))
+	ic := &instrumentedConn{Conn: conn, netConn: netConn, ipType: ipType}
+	info := ConnInfo{
+		Instance:   instance,
+		LocalAddr:  conn.LocalAddr(),
+		RemoteAddr: conn.RemoteAddr(),
+		Network:    conn.RemoteAddr().Network(),
+		IPType:     ipType,
+		Opened:     d.clock.Now(),
+		Context:    ctx,
+	}
+	if c, ok := conn.(interface{ ConnectionState() tls.ConnectionState }); ok {
+		cs := c.ConnectionState()
+		info.TLSVersion = cs.Version
+		info.CipherSuite = cs.CipherSuite
+		info.TLSResumed = cs.DidResume
+		info.TLSUnique = cs.TLSUnique
+	}
+	ic.closeFunc = func() {
+		d.resetConnLimit(counters, counters.closed(ipType))
+		if d.trackConns {
+			d.untrackConn(instance, ic)
+		}
+		if d.onConnClose != nil {
+			info := info
+			info.Closed = d.clock.Now()
+			go d.onConnClose(info)
+		}
+	}
+	ic.leakTimer = d.watchLeak(info)
+	if d.trackConns {
+		d.trackConn(instance, ic)
+	}
+	if d.onConnOpen != nil {
+		d.onConnOpen(info)
+	}
+	return ic
 }
 
-// newInstrumentedConn initializes an instrumentedConn that on closing will
-// decrement the number of open connects and record the result.
-func newInstrumentedConn(conn net.Conn, instance, dialerID string) *instrumentedConn {
-	return &instrumentedConn{
-		Conn: conn,
-		closeFunc: func() {
-			trace.RecordConnectionClose(context.Background(), instance, dialerID)
-		},
+// trackConn adds c to the set of open connections to instance.
+func (d *Dialer) trackConn(instance string, c *instrumentedConn) {
+	d.connLock.Lock()
+	defer d.connLock.Unlock()
+	cs, ok := d.conns[instance]
+	if !ok {
+		cs = make(map[*instrumentedConn]struct{})
+		d.conns[instance] = cs
 	}
+	cs[c] = struct{}{}
+}
+
+// untrackConn removes c from the set of open connections to instance.
+func (d *Dialer) untrackConn(instance string, c *instrumentedConn) {
+	d.connLock.Lock()
+	defer d.connLock.Unlock()
+	delete(d.conns[instance], c)
+}
+
+// openConnsFor returns the open connections to instance.
+func (d *Dialer) openConnsFor(instance string) []*instrumentedConn {
+	d.connLock.Lock()
+	defer d.connLock.Unlock()
+	cs := make([]*instrumentedConn, 0, len(d.conns[instance]))
+	for c := range d.conns[instance] {
+		cs = append(cs, c)
+	}
+	return cs
 }
 
 // instrumentedConn wraps a net.Conn and invokes closeFunc when the connection
 // is closed.
 type instrumentedConn struct {
 	net.Conn
+	// netConn is the transport connection underlying Conn.
+	netConn net.Conn
+	// ipType is the IP type netConn was dialed over.
+	ipType    string
 	closeFunc func()
+	// leakTimer reports the connection as leaked unless stopped by Close. It
+	// is nil when leak detection is disabled.
+	leakTimer *time.Timer
+	// closed is closed by Close when set, to stop watching a context passed
+	// to DialContextConn.
+	closed chan struct{}
+	// closeOnce ensures that a close is only reported once.
+	closeOnce sync.Once
+	// dead is set to 1 once the connection has been reported dead and must
+	// be accessed atomically.
+	dead int32
+}
+
+// errUnsupported is returned by instrumentedConn methods that the underlying
+// connection does not support.
+var errUnsupported = errors.New("operation not supported by underlying connection")
+
+// SyscallConn returns a raw network connection from the transport underlying
+// the TLS connection. This allows drivers to access the socket for features
+// like cancellation. Reads and writes on the raw connection bypass TLS.
+func (i *instrumentedConn) SyscallConn() (syscall.RawConn, error) {
+	sc, ok := i.netConn.(syscall.Conn)
+	if !ok {
+		return nil, errUnsupported
+	}
+	return sc.SyscallConn()
+}
+
+// ConnectionState returns the negotiated TLS connection state, including the
+// server's certificate chain, the TLS version, and the cipher suite.
+func (i *instrumentedConn) ConnectionState() tls.ConnectionState {
+	cs, ok := i.Conn.(interface{ ConnectionState() tls.ConnectionState })
+	if !ok {
+		return tls.ConnectionState{}
+	}
+	return cs.ConnectionState()
+}
+
+// CloseRead shuts down the reading side of the underlying transport
+// connection.
+func (i *instrumentedConn) CloseRead() error {
+	cr, ok := i.netConn.(interface{ CloseRead() error })
+	if !ok {
+		return errUnsupported
+	}
+	return cr.CloseRead()
+}
+
+// CloseWrite shuts down the writing side of the connection. For TLS
+// connections, this sends a close_notify alert to the server.
+func (i *instrumentedConn) CloseWrite() error {
+	cw, ok := i.Conn.(interface{ CloseWrite() error })
+	if !ok {
+		return errUnsupported
+	}
+	return cw.CloseWrite()
 }
 
 // Close delegates to the underylying net.Conn interface and reports the close
-// to the provided closeFunc only when Close returns no error.
+// to the provided closeFunc only when Close returns no error, and only the
+// first time.
 func (i *instrumentedConn) Close() error {
 	err := i.Conn.Close()
 	if err != nil {
 		return err
 	}
-	go i.closeFunc()
+	// the underlying connection may not report closing it again as an
+	// error, so the close is only reported once
+	i.closeOnce.Do(func() {
+		if i.leakTimer != nil {
+			i.leakTimer.Stop()
+		}
+		if i.closed != nil {
+			close(i.closed)
+		}
+		i.closeFunc()
+	})
 	return nil
 }
 
 // Close closes the Dialer; it prevents the Dialer from refreshing the information
-// needed to connect. Additional dial operations may succeed until the information
-// expires.
+// needed to connect. Dials in progress are cancelled, and they and any later
+// Dials return errtypes.ErrDialerClosed, as do other methods that use an
+// instance's information, such as ForceRefresh and WarmupAll. Connections
+// already returned by Dial stay open. Close may be called any number of
+// times, e.g., from several shutdown paths or through the views returned by
+// WithDefaults; calls after the first have no effect.
 func (d *Dialer) Close() {
+	d.cancelDials()
+	d.closeState()
+	d.unpublishExpvar()
+	// failovers stop once done is closed, but may still use the Dialer until
+	// they notice
+	d.failovers.Wait()
+}
+
+// closeState closes the instances and stops the background goroutines of the
+// Dialer, unless they were already closed.
+func (d *Dialer) closeState() {
 	d.lock.Lock()
 	defer d.lock.Unlock()
+	select {
+	case <-d.done:
+		return
+	default:
+	}
 	for _, i := range d.instances {
 		i.Close()
 	}
+	close(d.done)
+	d.closeEvents()
+	d.closeWarm()
+	if d.sshJumpHost != nil {
+		d.sshJumpHost.close()
+	}
+	d.connLock.Lock()
+	defer d.connLock.Unlock()
+	for _, t := range d.drainTimers {
+		t.Stop()
+	}
 }
 
-func (d *Dialer) instance(connName string) (*cloudsql.Instance, error) {
+// instance returns the Instance for connName, creating it if needed. A new
+// Instance's initial refresh sees the values of ctx. It returns
+// errtypes.ErrDialerClosed once the Dialer is closed.
+func (d *Dialer) instance(ctx context.Context, connName string) (*cloudsql.Instance, error) {
+	select {
+	case <-d.done:
+		// a closed Dialer must not start refreshing instances again
+		return nil, errtypes.ErrDialerClosed
+	default:
+	}
 	// Check instance cache
 	d.lock.RLock()
 	i, ok := d.instances[connName]
+	key := d.key
 	d.lock.RUnlock()
 	if !ok {
+		// Generating the default key takes a while, so do it before taking
+		// the lock that Dials of other instances need.
+		if key == nil {
+			var err error
+			if key, err = getDefaultKeys(); err != nil {
+				return nil, fmt.Errorf("failed to generate RSA keys: %v", err)
+			}
+		}
 		d.lock.Lock()
+		select {
+		case <-d.done:
+			d.lock.Unlock()
+			return nil, errtypes.ErrDialerClosed
+		default:
+		}
 		// Recheck to ensure instance wasn't created between locks
 		i, ok = d.instances[connName]
 		if !ok {
 			// Create a new instance
 			var err error
-			i, err = cloudsql.NewInstance(connName, d.sqladmin, d.key, d.refreshTimeout)
+			opts := []cloudsql.InstanceOption{
+				cloudsql.WithContextValues(ctx),
+				cloudsql.WithRefreshHandler(func(e cloudsql.RefreshEvent) {
+					d.handleRefresh(connName, e)
+				}),
+				cloudsql.WithAPICallHandler(func(method string) {
+					trace.RecordAdminAPICall(context.Background(), d.metricInstance(connName), d.dialerID, method)
+				}),
+				cloudsql.WithServerValidation(d.serverValidation),
+				cloudsql.WithClock(instanceClock{d.clock}),
+			}
+			if d.certProvider != nil {
+				opts = append(opts, cloudsql.WithCertProvider(d.certProvider))
+			}
+			if d.refreshLimiter != nil {
+				opts = append(opts, cloudsql.WithRefreshLimiter(d.refreshLimiter))
+			}
+			if info, ok := d.staticInfo[connName]; ok {
+				opts = append(opts, cloudsql.WithStaticInfo(cloudsql.StaticInfo{
+					IPAddrs:       info.IPAddrs,
+					ServerCACerts: info.ServerCAs,
+					ClientCert:    info.ClientCert,
+				}))
+			}
+			if d.refreshStrategy != nil {
+				opts = append(opts, cloudsql.WithRefreshStrategy(instanceStrategy(connName, d.refreshStrategy)))
+			}
+			client, err := d.adminClient(connName)
 			if err != nil {
 				d.lock.Unlock()
 				return nil, err
 			}
+			if d.key == nil {
+				d.key = key
+			}
+			i, err = cloudsql.NewInstance(connName, client, d.key, d.refreshTimeoutFor(connName), opts...)
+			if err != nil {
+				d.lock.Unlock()
+				return nil, err
+			}
+			if d.refreshPaused {
+				i.Pause()
+			}
 			d.instances[connName] = i
 		}
 		d.lock.Unlock()
 	}
 	return i, nil
 }
+
+// handleRefresh is called after every completed refresh operation of the
+// instance with connection name cn.
+func (d *Dialer) handleRefresh(cn string, e cloudsql.RefreshEvent) {
+	trace.RecordRefreshResult(context.Background(), d.metricInstance(cn), d.dialerID, e.Err)
+	d.reportRefresh(cn, e)
+	if e.Throttled && d.onThrottle != nil {
+		d.onThrottle(cn, e.Late)
+	}
+	if e.Err != nil {
+		d.logf(cn, "background refresh failed: %v", e.Err)
+		return
+	}
+	trace.RecordCertExpiry(context.Background(), d.metricInstance(cn), d.dialerID, e.Expiry)
+	d.observeConnLimit(cn, e.MaxConnections)
+	d.observeMaintenance(cn, e.MaintenanceStart)
+	d.observeDR(cn, e.InstanceType)
+	go d.emitCertificates(cn, InstanceCertificates{
+		ClientCert: e.ClientCert,
+		ServerCAs:  e.ServerCAs,
+		Expiry:     e.Expiry,
+	})
+}
@@ -16,13 +16,25 @@ package cloudsqlconn
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
 	"errors"
+	"io"
 	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"cloud.google.com/go/cloudsqlconn/errtypes"
 	"cloud.google.com/go/cloudsqlconn/internal/mock"
+	"golang.org/x/oauth2"
 )
 
 func TestDialerCanConnectToInstance(t *testing.T) {
@@ -55,6 +67,14 @@ func TestDialerCanConnectToInstance(t *testing.T) {
 	}
 	defer conn.Close()
 
+	tlsConn, ok := conn.(interface{ ConnectionState() tls.ConnectionState })
+	if !ok {
+		t.Fatal("expected conn to expose its TLS connection state")
+	}
+	if cs := tlsConn.ConnectionState(); !cs.HandshakeComplete || len(cs.PeerCertificates) == 0 {
+		t.Fatalf("expected completed handshake with peer certificates, got = %+v", cs)
+	}
+
 	data, err := ioutil.ReadAll(conn)
 	if err != nil {
 		t.Fatalf("expected ReadAll to succeed, got error %v", err)
@@ -154,3 +174,804 @@ func TestDialWithConfigurationErrors(t *testing.T) {
 		t.Fatalf("when TLS handshake fails, want = %T, got = %v", wantErr2, err)
 	}
 }
+
+func TestInstrumentedConnPassthrough(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to start listener: %v", err)
+	}
+	defer ln.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		accepted <- c
+	}()
+
+	tcpConn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to dial listener: %v", err)
+	}
+	server := <-accepted
+	defer server.Close()
+
+	conn := &instrumentedConn{Conn: tcpConn, netConn: tcpConn, closeFunc: func() {}}
+	defer conn.Close()
+
+	if _, err := conn.SyscallConn(); err != nil {
+		t.Fatalf("SyscallConn failed: %v", err)
+	}
+
+	if err := conn.SetReadDeadline(time.Now().Add(10 * time.Millisecond)); err != nil {
+		t.Fatalf("SetReadDeadline failed: %v", err)
+	}
+	var netErr net.Error
+	if _, err := conn.Read(make([]byte, 1)); !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Fatalf("when read deadline passes, want timeout error, got = %v", err)
+	}
+
+	if err := conn.CloseWrite(); err != nil {
+		t.Fatalf("CloseWrite failed: %v", err)
+	}
+	if _, err := server.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("after CloseWrite, want = %v, got = %v", io.EOF, err)
+	}
+	if err := conn.CloseRead(); err != nil {
+		t.Fatalf("CloseRead failed: %v", err)
+	}
+
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	pipe := &instrumentedConn{Conn: c1, netConn: c1, closeFunc: func() {}}
+	defer pipe.Close()
+	if _, err := pipe.SyscallConn(); err == nil {
+		t.Fatal("want SyscallConn to fail when unsupported")
+	}
+	if err := pipe.CloseRead(); err == nil {
+		t.Fatal("want CloseRead to fail when unsupported")
+	}
+	if err := pipe.CloseWrite(); err == nil {
+		t.Fatal("want CloseWrite to fail when unsupported")
+	}
+}
+
+func TestSetTokenSource(t *testing.T) {
+	// api records the token that each request is authenticated with.
+	var (
+		mu     sync.Mutex
+		tokens []string
+	)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		tokens = append(tokens, r.Header.Get("Authorization"))
+		mu.Unlock()
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer api.Close()
+
+	d, err := NewDialer(context.Background(),
+		WithTokenSource(oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "old-token"})),
+		WithEndpointResolver(func(string) string { return api.URL + "/" }),
+	)
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+
+	err = d.SetTokenSource(oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "new-token"}))
+	if err != nil {
+		t.Fatalf("SetTokenSource failed: %v", err)
+	}
+	if _, err := d.Dial(context.Background(), "my-project:my-region:my-instance"); err == nil {
+		t.Fatal("want Dial through the unavailable Admin API to fail")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(tokens) == 0 {
+		t.Fatal("want the Dial to call the Admin API")
+	}
+	for _, tok := range tokens {
+		if tok != "Bearer new-token" {
+			t.Fatalf("want requests to use the new token, got = %v", tokens)
+		}
+	}
+}
+
+func TestDialerForceRefresh(t *testing.T) {
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+	svc, cleanup, err := mock.NewSQLAdminService(
+		context.Background(),
+		mock.InstanceGetSuccess(inst, 2),
+		mock.CreateEphemeralSuccess(inst, 2),
+	)
+	if err != nil {
+		t.Fatalf("failed to create test SQL admin service: %s", err)
+	}
+	stop := mock.StartServerProxy(t, inst)
+	defer func() {
+		stop()
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	d, err := NewDialer(context.Background(), WithTokenSource(mock.EmptyTokenSource{}))
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	d.sqladmin = svc
+
+	cn := "my-project:my-region:my-instance"
+	for i := 0; i < 2; i++ {
+		if err := d.ForceRefresh(cn); err != nil {
+			t.Fatalf("ForceRefresh failed: %v", err)
+		}
+		conn, err := d.Dial(context.Background(), cn)
+		if err != nil {
+			t.Fatalf("expected Dial to succeed, but got error: %v", err)
+		}
+		conn.Close()
+	}
+
+	err = d.ForceRefresh("bad-instance-name")
+	var wantErr *errtypes.ConfigError
+	if !errors.As(err, &wantErr) {
+		t.Fatalf("when instance name is invalid, want = %T, got = %v", wantErr, err)
+	}
+}
+
+func TestDialRetriesAfterServerCARotation(t *testing.T) {
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+	// rotated has the same name but a different server CA.
+	rotated := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+	svc, cleanup, err := mock.NewSQLAdminService(
+		context.Background(),
+		mock.InstanceGetSuccess(rotated, 1),
+		mock.InstanceGetSuccess(inst, 1),
+		mock.CreateEphemeralSuccess(inst, 2),
+	)
+	if err != nil {
+		t.Fatalf("failed to create test SQL admin service: %s", err)
+	}
+	stop := mock.StartServerProxy(t, inst)
+	defer func() {
+		stop()
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	d, err := NewDialer(context.Background(), WithTokenSource(mock.EmptyTokenSource{}))
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	d.sqladmin = svc
+
+	conn, err := d.Dial(context.Background(), "my-project:my-region:my-instance")
+	if err != nil {
+		t.Fatalf("expected Dial to succeed after refreshing the server CA, but got error: %v", err)
+	}
+	conn.Close()
+}
+
+func TestHandshakeRejected(t *testing.T) {
+	tcs := []struct {
+		desc string
+		err  error
+		want bool
+	}{
+		{
+			desc: "alert from the server",
+			err:  &net.OpError{Op: "remote error", Err: errors.New("tls: bad certificate")},
+			want: true,
+		},
+		{
+			desc: "unknown server CA",
+			err:  x509.UnknownAuthorityError{},
+			want: true,
+		},
+		{
+			desc: "expired server certificate",
+			err:  x509.CertificateInvalidError{Reason: x509.Expired},
+			want: true,
+		},
+		{
+			desc: "server certificate for another host",
+			err:  x509.HostnameError{},
+			want: true,
+		},
+		{
+			desc: "server certificate for another instance",
+			err:  errtypes.NewDialError("certificate had CN \"other\"", "p:r:i", nil),
+			want: true,
+		},
+		{
+			desc: "connection closed",
+			err:  io.EOF,
+			want: false,
+		},
+		{
+			desc: "connection reset",
+			err:  &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")},
+			want: false,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.desc, func(t *testing.T) {
+			if got := handshakeRejected(tc.err); got != tc.want {
+				t.Fatalf("handshakeRejected(%v), want = %v, got = %v", tc.err, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestDialHandshakeResetDoesNotRefresh(t *testing.T) {
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+	svc, cleanup, err := mock.NewSQLAdminService(
+		context.Background(),
+		mock.InstanceGetSuccess(inst, 1),
+		mock.CreateEphemeralSuccess(inst, 1),
+	)
+	if err != nil {
+		t.Fatalf("failed to create test SQL admin service: %s", err)
+	}
+	stop := mock.StartServerProxy(t, inst)
+	defer func() {
+		stop()
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	// reset closes connections before the handshake completes
+	reset, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer reset.Close()
+	go func() {
+		for {
+			c, err := reset.Accept()
+			if err != nil {
+				return
+			}
+			c.Close()
+		}
+	}()
+	var (
+		mu    sync.Mutex
+		first = true
+	)
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		mu.Lock()
+		if first {
+			addr = reset.Addr().String()
+			first = false
+		}
+		mu.Unlock()
+		var d net.Dialer
+		return d.DialContext(ctx, network, addr)
+	}
+
+	d, err := NewDialer(context.Background(),
+		WithTokenSource(mock.EmptyTokenSource{}),
+		WithDialFunc(dial),
+	)
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	d.sqladmin = svc
+
+	cn := "my-project:my-region:my-instance"
+	if _, err := d.Dial(context.Background(), cn); err == nil {
+		t.Fatal("expected Dial to fail when the connection is reset")
+	}
+	i, err := d.instance(context.Background(), cn)
+	if err != nil {
+		t.Fatalf("instance failed: %v", err)
+	}
+	// A forced refresh would have been scheduled immediately.
+	if next := i.Status().NextRefresh; time.Until(next) < time.Minute {
+		t.Fatalf("want no refresh before the certificate expires, next refresh at %v", next)
+	}
+	// The second Dial uses the original instance information.
+	conn, err := d.Dial(context.Background(), cn)
+	if err != nil {
+		t.Fatalf("expected Dial to succeed, but got error: %v", err)
+	}
+	conn.Close()
+}
+
+func TestDialerWithCASServerValidation(t *testing.T) {
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance",
+		mock.WithCASServerCert())
+	svc, cleanup, err := mock.NewSQLAdminService(
+		context.Background(),
+		mock.InstanceGetSuccess(inst, 1),
+		mock.CreateEphemeralSuccess(inst, 1),
+	)
+	if err != nil {
+		t.Fatalf("failed to create test SQL admin service: %s", err)
+	}
+	stop := mock.StartServerProxy(t, inst)
+	defer func() {
+		stop()
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	d, err := NewDialer(context.Background(),
+		WithTokenSource(mock.EmptyTokenSource{}),
+		WithCASServerValidation(),
+	)
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	d.sqladmin = svc
+
+	conn, err := d.Dial(context.Background(), "my-project:my-region:my-instance")
+	if err != nil {
+		t.Fatalf("expected Dial to succeed, but got error: %v", err)
+	}
+	defer conn.Close()
+
+	data, err := ioutil.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("expected ReadAll to succeed, got error %v", err)
+	}
+	if string(data) != "my-instance" {
+		t.Fatalf("expected known response from the server, but got %v", string(data))
+	}
+}
+
+func TestDialerDuringLegacyServerCARotation(t *testing.T) {
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance",
+		mock.WithServerCARotation())
+	svc, cleanup, err := mock.NewSQLAdminService(
+		context.Background(),
+		mock.InstanceGetSuccess(inst, 1),
+		mock.CreateEphemeralSuccess(inst, 1),
+	)
+	if err != nil {
+		t.Fatalf("failed to create test SQL admin service: %s", err)
+	}
+	stop := mock.StartServerProxy(t, inst)
+	defer func() {
+		stop()
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	d, err := NewDialer(context.Background(), WithTokenSource(mock.EmptyTokenSource{}))
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	d.sqladmin = svc
+
+	// The instance reports two CAs, but default options still connect.
+	conn, err := d.Dial(context.Background(), "my-project:my-region:my-instance")
+	if err != nil {
+		t.Fatalf("expected Dial to succeed, but got error: %v", err)
+	}
+	defer conn.Close()
+
+	data, err := ioutil.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("expected ReadAll to succeed, got error %v", err)
+	}
+	if string(data) != "my-instance" {
+		t.Fatalf("expected known response from the server, but got %v", string(data))
+	}
+}
+
+func TestDialerWithClientCertProvider(t *testing.T) {
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+	// No ephemeral certificate is requested when a provider is configured.
+	svc, cleanup, err := mock.NewSQLAdminService(
+		context.Background(),
+		mock.InstanceGetSuccess(inst, 1),
+	)
+	if err != nil {
+		t.Fatalf("failed to create test SQL admin service: %s", err)
+	}
+	stop := mock.StartServerProxy(t, inst)
+	defer func() {
+		stop()
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	var called string
+	provider := func(_ context.Context, instance string) (tls.Certificate, error) {
+		called = instance
+		certPEM, err := mock.SignWithClientKey(inst.Cert, inst.Key, &key.PublicKey)
+		if err != nil {
+			return tls.Certificate{}, err
+		}
+		b, _ := pem.Decode(certPEM)
+		return tls.Certificate{Certificate: [][]byte{b.Bytes}, PrivateKey: key}, nil
+	}
+
+	d, err := NewDialer(context.Background(),
+		WithTokenSource(mock.EmptyTokenSource{}),
+		WithClientCertProvider(provider),
+	)
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	d.sqladmin = svc
+
+	conn, err := d.Dial(context.Background(), "my-project:my-region:my-instance")
+	if err != nil {
+		t.Fatalf("expected Dial to succeed, but got error: %v", err)
+	}
+	conn.Close()
+	if want := "my-project:my-region:my-instance"; called != want {
+		t.Fatalf("provider called with wrong instance, want = %v, got = %v", want, called)
+	}
+}
+
+func TestDialerWithIPv6Preferred(t *testing.T) {
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance",
+		mock.WithPublicIPv6("::1"))
+	svc, cleanup, err := mock.NewSQLAdminService(
+		context.Background(),
+		mock.InstanceGetSuccess(inst, 1),
+		mock.CreateEphemeralSuccess(inst, 1),
+	)
+	if err != nil {
+		t.Fatalf("failed to create test SQL admin service: %s", err)
+	}
+	stop := mock.StartServerProxy(t, inst)
+	defer func() {
+		stop()
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	d, err := NewDialer(context.Background(), WithTokenSource(mock.EmptyTokenSource{}))
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	d.sqladmin = svc
+
+	conn, err := d.Dial(context.Background(), "my-project:my-region:my-instance", WithIPv6Preferred())
+	if err != nil {
+		t.Fatalf("expected Dial to succeed, but got error: %v", err)
+	}
+	defer conn.Close()
+	if ip := conn.RemoteAddr().(*net.TCPAddr).IP; ip.To4() != nil {
+		t.Fatalf("want connection over IPv6, got remote address %v", ip)
+	}
+}
+
+func TestDialerWithAutoIP(t *testing.T) {
+	// The public IP is unreachable, so the private IP must win.
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance",
+		mock.WithPublicIP("192.0.2.1"), mock.WithPrivateIP("127.0.0.1"))
+	svc, cleanup, err := mock.NewSQLAdminService(
+		context.Background(),
+		mock.InstanceGetSuccess(inst, 1),
+		mock.CreateEphemeralSuccess(inst, 1),
+	)
+	if err != nil {
+		t.Fatalf("failed to create test SQL admin service: %s", err)
+	}
+	stop := mock.StartServerProxy(t, inst)
+	defer func() {
+		stop()
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	d, err := NewDialer(context.Background(),
+		WithTokenSource(mock.EmptyTokenSource{}),
+		WithDefaultDialOptions(WithAutoIP()),
+	)
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	d.sqladmin = svc
+
+	conn, err := d.Dial(context.Background(), "my-project:my-region:my-instance")
+	if err != nil {
+		t.Fatalf("expected Dial to succeed, but got error: %v", err)
+	}
+	conn.Close()
+}
+
+func TestDialerConnectionHooks(t *testing.T) {
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+	svc, cleanup, err := mock.NewSQLAdminService(
+		context.Background(),
+		mock.InstanceGetSuccess(inst, 1),
+		mock.CreateEphemeralSuccess(inst, 1),
+	)
+	if err != nil {
+		t.Fatalf("failed to create test SQL admin service: %s", err)
+	}
+	stop := mock.StartServerProxy(t, inst)
+	defer func() {
+		stop()
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	opened := make(chan ConnInfo, 1)
+	closed := make(chan ConnInfo, 1)
+	d, err := NewDialer(context.Background(),
+		WithTokenSource(mock.EmptyTokenSource{}),
+		WithConnectionHooks(
+			func(c ConnInfo) { opened <- c },
+			func(c ConnInfo) { closed <- c },
+		),
+	)
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	d.sqladmin = svc
+	// the events are timestamped with the Dialer's clock
+	now := time.Now()
+	clk := &manualClock{now: now}
+	d.clock = clk
+
+	cn := "my-project:my-region:my-instance"
+	conn, err := d.Dial(context.Background(), cn)
+	if err != nil {
+		t.Fatalf("expected Dial to succeed, but got error: %v", err)
+	}
+	o := <-opened
+	if o.Instance != cn || o.RemoteAddr == nil || !o.Opened.Equal(now) || !o.Closed.IsZero() {
+		t.Fatalf("unexpected open event: %+v", o)
+	}
+	if o.Network != "tcp" || o.IPType != "PUBLIC" || o.TLSVersion == 0 || o.CipherSuite == 0 {
+		t.Fatalf("want the connection's 5-tuple and TLS details, got: %+v", o)
+	}
+
+	clk.advance(time.Minute)
+	conn.Close()
+	select {
+	case c := <-closed:
+		if c.Instance != cn || c.Opened != o.Opened || !c.Closed.Equal(now.Add(time.Minute)) {
+			t.Fatalf("unexpected close event: %+v", c)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for close event")
+	}
+}
+
+func TestDialerWithUserAgent(t *testing.T) {
+	// api records the user agent of each request.
+	var (
+		mu  sync.Mutex
+		uas []string
+	)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		uas = append(uas, r.Header.Get("User-Agent"))
+		mu.Unlock()
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer api.Close()
+
+	d, err := NewDialer(context.Background(),
+		WithTokenSource(mock.EmptyTokenSource{}),
+		WithEndpointResolver(func(string) string { return api.URL + "/" }),
+		WithUserAgent("my-service/2.3"),
+		WithUserAgent("my-framework/1.0"),
+	)
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	if _, err := d.Dial(context.Background(), "my-project:my-region:my-instance"); err == nil {
+		t.Fatal("want Dial through the unavailable Admin API to fail")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(uas) == 0 {
+		t.Fatal("want the Dial to call the Admin API")
+	}
+	want := userAgent + " my-service/2.3 my-framework/1.0"
+	for _, ua := range uas {
+		if ua != want {
+			t.Fatalf("user agent mismatch, want = %v, got = %v", want, ua)
+		}
+	}
+}
+
+func TestDialerWithRefreshConcurrency(t *testing.T) {
+	// api tracks how many projects have requests in progress at once. Each
+	// refresh makes two concurrent requests for its instance's project.
+	var (
+		mu       sync.Mutex
+		inflight = make(map[string]int)
+		maxProjs int
+	)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		project := strings.Split(strings.SplitAfter(r.URL.Path, "/projects/")[1], "/")[0]
+		mu.Lock()
+		inflight[project]++
+		if len(inflight) > maxProjs {
+			maxProjs = len(inflight)
+		}
+		mu.Unlock()
+		time.Sleep(100 * time.Millisecond)
+		mu.Lock()
+		if inflight[project]--; inflight[project] == 0 {
+			delete(inflight, project)
+		}
+		mu.Unlock()
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer api.Close()
+
+	d, err := NewDialer(context.Background(),
+		WithTokenSource(mock.EmptyTokenSource{}),
+		WithEndpointResolver(func(string) string { return api.URL + "/" }),
+		WithRefreshConcurrency(1),
+	)
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+
+	var wg sync.WaitGroup
+	for _, cn := range []string{"project-a:my-region:my-instance", "project-b:my-region:my-instance"} {
+		wg.Add(1)
+		go func(cn string) {
+			defer wg.Done()
+			d.Dial(context.Background(), cn)
+		}(cn)
+	}
+	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if maxProjs != 1 {
+		t.Fatalf("want refreshes of different instances not to overlap, got %v at once", maxProjs)
+	}
+}
+
+// recordingTransport records the requests it receives and fails them.
+type recordingTransport struct {
+	mu   sync.Mutex
+	reqs []*http.Request
+}
+
+func (rt *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.reqs = append(rt.reqs, req)
+	return nil, errors.New("recordingTransport: request not sent")
+}
+
+func TestDialerWithHTTPClient(t *testing.T) {
+	rt := &recordingTransport{}
+	d, err := NewDialer(context.Background(),
+		WithHTTPClient(&http.Client{Transport: rt}),
+		WithRefreshTimeout(time.Second),
+	)
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+
+	if _, err := d.Dial(context.Background(), "my-project:my-region:my-instance"); err == nil {
+		t.Fatal("want Dial to fail when the HTTP client fails every request")
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if len(rt.reqs) == 0 {
+		t.Fatal("want Admin API requests to be sent with the custom HTTP client")
+	}
+	if ua := rt.reqs[0].Header.Get("User-Agent"); !strings.Contains(ua, userAgent) {
+		t.Fatalf("want user agent to contain %q, got = %q", userAgent, ua)
+	}
+}
+
+func TestDialerResumesTLSSessions(t *testing.T) {
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+	svc, cleanup, err := mock.NewSQLAdminService(
+		context.Background(),
+		mock.InstanceGetSuccess(inst, 1),
+		mock.CreateEphemeralSuccess(inst, 1),
+	)
+	if err != nil {
+		t.Fatalf("failed to create test SQL admin service: %s", err)
+	}
+	stop := mock.StartServerProxy(t, inst)
+	defer func() {
+		stop()
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	d, err := NewDialer(context.Background(), WithTokenSource(mock.EmptyTokenSource{}))
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	d.sqladmin = svc
+
+	dial := func() tls.ConnectionState {
+		conn, err := d.Dial(context.Background(), "my-project:my-region:my-instance")
+		if err != nil {
+			t.Fatalf("expected Dial to succeed, but got error: %v", err)
+		}
+		defer conn.Close()
+		// Reading processes the session ticket sent after the handshake.
+		if _, err := ioutil.ReadAll(conn); err != nil {
+			t.Fatalf("read failed: %v", err)
+		}
+		return conn.(interface{ ConnectionState() tls.ConnectionState }).ConnectionState()
+	}
+	if dial().DidResume {
+		t.Fatal("want the first connection to perform a full handshake")
+	}
+	if !dial().DidResume {
+		t.Fatal("want the second connection to resume the first's TLS session")
+	}
+}
+
+func TestDialerGeneratesKeyLazily(t *testing.T) {
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+	svc, cleanup, err := mock.NewSQLAdminService(
+		context.Background(),
+		mock.InstanceGetSuccess(inst, 1),
+		mock.CreateEphemeralSuccess(inst, 1),
+	)
+	if err != nil {
+		t.Fatalf("failed to create test SQL admin service: %s", err)
+	}
+	stop := mock.StartServerProxy(t, inst)
+	defer func() {
+		stop()
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	d, err := NewDialer(context.Background(), WithTokenSource(mock.EmptyTokenSource{}))
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	d.sqladmin = svc
+	if d.key != nil {
+		t.Fatal("want NewDialer to not generate a key")
+	}
+
+	conn, err := d.Dial(context.Background(), "my-project:my-region:my-instance")
+	if err != nil {
+		t.Fatalf("expected Dial to succeed, but got error: %v", err)
+	}
+	conn.Close()
+	if d.key == nil {
+		t.Fatal("want a key to be generated by the first Dial")
+	}
+}
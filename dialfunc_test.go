@@ -0,0 +1,228 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/cloudsqlconn/internal/mock"
+)
+
+// recordingDialer dials with a net.Dialer and records the addresses dialed.
+type recordingDialer struct {
+	mu    sync.Mutex
+	addrs []string
+}
+
+func (r *recordingDialer) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	r.mu.Lock()
+	r.addrs = append(r.addrs, addr)
+	r.mu.Unlock()
+	var d net.Dialer
+	return d.DialContext(ctx, network, addr)
+}
+
+func (r *recordingDialer) dialed() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.addrs...)
+}
+
+func TestDialerWithDialFunc(t *testing.T) {
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+	svc, cleanup, err := mock.NewSQLAdminService(
+		context.Background(),
+		mock.InstanceGetSuccess(inst, 1),
+		mock.CreateEphemeralSuccess(inst, 1),
+	)
+	if err != nil {
+		t.Fatalf("failed to create SQL Admin service: %v", err)
+	}
+	stop := mock.StartServerProxy(t, inst)
+	defer func() {
+		stop()
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	var rd recordingDialer
+	d, err := NewDialer(context.Background(),
+		WithTokenSource(mock.EmptyTokenSource{}),
+		WithDialFunc(rd.dial),
+	)
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	d.sqladmin = svc
+
+	conn, err := d.Dial(context.Background(), "my-project:my-region:my-instance")
+	if err != nil {
+		t.Fatalf("expected Dial to succeed, but got error: %v", err)
+	}
+	defer conn.Close()
+	data, err := ioutil.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("expected ReadAll to succeed, got error %v", err)
+	}
+	if string(data) != "my-instance" {
+		t.Fatalf("expected known response from the server, but got %v", string(data))
+	}
+	if got := rd.dialed(); len(got) != 1 || !strings.HasSuffix(got[0], ":3307") {
+		t.Fatalf("dialed addresses, got = %v, want the instance at port 3307", got)
+	}
+}
+
+func TestDialerWithDialFuncAdminAPI(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer api.Close()
+
+	var rd recordingDialer
+	d, err := NewDialer(context.Background(),
+		WithTokenSource(mock.EmptyTokenSource{}),
+		WithDialFunc(rd.dial),
+		WithEndpointResolver(func(string) string { return api.URL }),
+	)
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+
+	if _, err := d.Dial(context.Background(), "my-project:my-region:my-instance"); err == nil {
+		t.Fatal("want Dial to fail when the Admin API is unavailable")
+	}
+	want := strings.TrimPrefix(api.URL, "http://")
+	for _, addr := range rd.dialed() {
+		if addr == want {
+			return
+		}
+	}
+	t.Fatalf("want the Admin API at %v to be dialed with the dial func, got = %v", want, rd.dialed())
+}
+
+func TestDialContextPropagation(t *testing.T) {
+	type tenantKey struct{}
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+	svc, cleanup, err := mock.NewSQLAdminService(
+		context.Background(),
+		mock.InstanceGetSuccess(inst, 1),
+	)
+	if err != nil {
+		t.Fatalf("failed to create SQL Admin service: %v", err)
+	}
+	stop := mock.StartServerProxy(t, inst)
+	defer func() {
+		stop()
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	var (
+		mu                      sync.Mutex
+		dialTenant, certTenant  interface{}
+		openTenant, closeTenant interface{}
+		dialDeadline            time.Time
+	)
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		mu.Lock()
+		dialTenant = ctx.Value(tenantKey{})
+		dialDeadline, _ = ctx.Deadline()
+		mu.Unlock()
+		var d net.Dialer
+		return d.DialContext(ctx, network, addr)
+	}
+	provider := func(ctx context.Context, _ string) (tls.Certificate, error) {
+		mu.Lock()
+		certTenant = ctx.Value(tenantKey{})
+		mu.Unlock()
+		certPEM, err := mock.SignWithClientKey(inst.Cert, inst.Key, &key.PublicKey)
+		if err != nil {
+			return tls.Certificate{}, err
+		}
+		b, _ := pem.Decode(certPEM)
+		return tls.Certificate{Certificate: [][]byte{b.Bytes}, PrivateKey: key}, nil
+	}
+	// the close hook is called asynchronously
+	closed := make(chan struct{})
+	d, err := NewDialer(context.Background(),
+		WithTokenSource(mock.EmptyTokenSource{}),
+		WithDialFunc(dial),
+		WithClientCertProvider(provider),
+		WithConnectionHooks(
+			func(info ConnInfo) {
+				mu.Lock()
+				openTenant = info.Context.Value(tenantKey{})
+				mu.Unlock()
+			},
+			func(info ConnInfo) {
+				mu.Lock()
+				closeTenant = info.Context.Value(tenantKey{})
+				mu.Unlock()
+				close(closed)
+			},
+		),
+	)
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	d.sqladmin = svc
+
+	deadline := time.Now().Add(time.Minute)
+	ctx, cancel := context.WithDeadline(context.WithValue(context.Background(), tenantKey{}, "tenant-a"), deadline)
+	defer cancel()
+	conn, err := d.Dial(ctx, "my-project:my-region:my-instance")
+	if err != nil {
+		t.Fatalf("expected Dial to succeed, but got error: %v", err)
+	}
+	conn.Close()
+	<-closed
+
+	mu.Lock()
+	defer mu.Unlock()
+	for name, got := range map[string]interface{}{
+		"dial func":     dialTenant,
+		"cert provider": certTenant,
+		"open hook":     openTenant,
+		"close hook":    closeTenant,
+	} {
+		if got != "tenant-a" {
+			t.Errorf("%v, got value = %v, want = tenant-a", name, got)
+		}
+	}
+	if !dialDeadline.Equal(deadline) {
+		t.Errorf("dial func deadline, got = %v, want = %v", dialDeadline, deadline)
+	}
+}
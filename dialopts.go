@@ -0,0 +1,80 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"fmt"
+
+	"cloud.google.com/go/cloudsqlconn/errtypes"
+	"cloud.google.com/go/cloudsqlconn/internal/cloudsql"
+)
+
+// WithStrictDialOptions returns a DialerOption that makes Dial return an
+// *errtypes.ConfigError for combinations of DialOptions in which one would be
+// ignored, rather than dialing without it: an IP type DialOption or
+// WithIPv6Preferred with WithIAPTunnel, WithIPv6Preferred with WithPrivateIP,
+// and WithPriority without WithMaxConcurrentDials. This catches mistakes
+// before they surface as a connection over an unexpected route. Options with
+// invalid values, such as an IAP tunnel to an invalid port, are rejected
+// regardless. An IP type given with WithDefaultDialOptions does not conflict
+// with the options given to a Dial.
+//
+// These checks only consider the options themselves. Whether the instance
+// has an address of the requested IP type is checked against its information
+// once it is retrieved, before connecting, with or without
+// WithStrictDialOptions.
+func WithStrictDialOptions() DialerOption {
+	return func(d *dialerConfig) {
+		d.strictDials = true
+	}
+}
+
+// validateDialCfg returns a ConfigError if cfg, the options for dialing
+// instance, has invalid values or, with WithStrictDialOptions, options that
+// would be ignored.
+func (d *Dialer) validateDialCfg(instance string, cfg dialCfg) error {
+	if t := cfg.iapTarget; t != nil {
+		if t.project == "" || t.zone == "" || t.vm == "" {
+			return errtypes.NewConfigError("WithIAPTunnel requires a project, zone, and VM", instance)
+		}
+		if t.port < 1 || t.port > 65535 {
+			return errtypes.NewConfigError(fmt.Sprintf("WithIAPTunnel requires a valid port, got %d", t.port), instance)
+		}
+	}
+	if cfg.preConn != nil && cfg.iapTarget != nil {
+		return errtypes.NewConfigError("WithPreconnectedConn cannot be combined with WithIAPTunnel", instance)
+	}
+	if !d.strictDials {
+		return nil
+	}
+	var conflict string
+	switch {
+	case cfg.iapTarget != nil && cfg.ipTypeSet:
+		conflict = "WithIAPTunnel ignores the IP type DialOption it was given with"
+	case cfg.preConn != nil && (cfg.ipTypeSet || cfg.ipv6Preferred):
+		conflict = "WithPreconnectedConn ignores IP type DialOptions"
+	case cfg.preConn != nil && cfg.dialRetries > 0:
+		conflict = "WithPreconnectedConn ignores WithDialRetries"
+	case cfg.iapTarget != nil && cfg.ipv6Preferred:
+		conflict = "WithIAPTunnel ignores WithIPv6Preferred"
+	case cfg.ipv6Preferred && cfg.ipType == cloudsql.PrivateIP:
+		conflict = "WithIPv6Preferred has no effect with WithPrivateIP"
+	case cfg.priority != PriorityNormal && d.maxDials <= 0:
+		conflict = "WithPriority has no effect without WithMaxConcurrentDials"
+	default:
+		return nil
+	}
+	return errtypes.NewConfigError(conflict, instance)
+}
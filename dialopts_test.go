@@ -0,0 +1,96 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"cloud.google.com/go/cloudsqlconn/errtypes"
+	"cloud.google.com/go/cloudsqlconn/internal/cloudsql"
+	"cloud.google.com/go/cloudsqlconn/internal/mock"
+)
+
+func TestValidateDialCfg(t *testing.T) {
+	iap := WithIAPTunnel("vm-project", "vm-zone", "my-vm", 3307)
+	tcs := []struct {
+		desc     string
+		strict   bool
+		maxDials int
+		defaults []DialOption
+		opts     []DialOption
+		wantErr  bool
+	}{
+		{desc: "defaults", strict: true},
+		{desc: "IAP tunnel", strict: true, opts: []DialOption{iap}},
+		{desc: "IAP tunnel without a VM", opts: []DialOption{WithIAPTunnel("vm-project", "vm-zone", "", 3307)}, wantErr: true},
+		{desc: "IAP tunnel to an invalid port", opts: []DialOption{WithIAPTunnel("vm-project", "vm-zone", "my-vm", 0)}, wantErr: true},
+		{desc: "IAP tunnel with an IP type", opts: []DialOption{WithPrivateIP(), iap}},
+		{desc: "IAP tunnel with an IP type, strict", strict: true, opts: []DialOption{WithPrivateIP(), iap}, wantErr: true},
+		{desc: "IAP tunnel with a default IP type, strict", strict: true, defaults: []DialOption{WithPrivateIP()}, opts: []DialOption{iap}},
+		{desc: "IAP tunnel with an IP type over a default, strict", strict: true, defaults: []DialOption{WithPrivateIP()}, opts: []DialOption{WithPublicIP(), iap}, wantErr: true},
+		{desc: "IAP tunnel with IPv6, strict", strict: true, opts: []DialOption{WithIPv6Preferred(), iap}, wantErr: true},
+		{desc: "private IPv6", opts: []DialOption{WithPrivateIP(), WithIPv6Preferred()}},
+		{desc: "private IPv6, strict", strict: true, opts: []DialOption{WithPrivateIP(), WithIPv6Preferred()}, wantErr: true},
+		{desc: "public IPv6, strict", strict: true, opts: []DialOption{WithPublicIP(), WithIPv6Preferred()}},
+		{desc: "priority without a limit, strict", strict: true, opts: []DialOption{WithPriority(PriorityHigh)}, wantErr: true},
+		{desc: "provided conn with IAP tunnel", opts: []DialOption{WithPreconnectedConn(nil), iap}, wantErr: true},
+		{desc: "provided conn with an IP type", opts: []DialOption{WithPreconnectedConn(nil), WithPrivateIP()}},
+		{desc: "provided conn with an IP type, strict", strict: true, opts: []DialOption{WithPreconnectedConn(nil), WithPrivateIP()}, wantErr: true},
+		{desc: "priority with a limit, strict", strict: true, maxDials: 2, opts: []DialOption{WithPriority(PriorityHigh)}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.desc, func(t *testing.T) {
+			d := &Dialer{
+				dialerState:    &dialerState{strictDials: tc.strict, maxDials: tc.maxDials},
+				defaultDialCfg: dialCfg{ipType: cloudsql.PublicIP},
+			}
+			for _, opt := range tc.defaults {
+				opt(&d.defaultDialCfg)
+			}
+			err := d.validateDialCfg("my-project:my-region:my-instance", d.newDialCfg(tc.opts))
+			var cErr *errtypes.ConfigError
+			if tc.wantErr && !errors.As(err, &cErr) {
+				t.Fatalf("want = *errtypes.ConfigError, got = %v", err)
+			}
+			if !tc.wantErr && err != nil {
+				t.Fatalf("want no error, got = %v", err)
+			}
+		})
+	}
+}
+
+func TestDialRejectsConflictingOptions(t *testing.T) {
+	d, err := NewDialer(context.Background(),
+		WithTokenSource(mock.EmptyTokenSource{}),
+		WithStrictDialOptions(),
+	)
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+
+	// the options are rejected before the instance is looked up
+	_, err = d.Dial(context.Background(), "my-project:my-region:my-instance",
+		WithPrivateIP(), WithIPv6Preferred())
+	var cErr *errtypes.ConfigError
+	if !errors.As(err, &cErr) {
+		t.Fatalf("want = *errtypes.ConfigError, got = %v", err)
+	}
+	if len(d.instances) != 0 {
+		t.Fatal("want the instance not to be refreshed")
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"sync"
+
+	"cloud.google.com/go/cloudsqlconn/errtypes"
+)
+
+// WithMaxConcurrentDials returns a DialerOption that allows at most n TCP
+// connects and TLS handshakes to each instance at a time. Further dials wait
+// for one in progress to finish, or return an error once their context is
+// done. Waiting dials are admitted in order of priority (see WithPriority),
+// and in the order they arrived among dials of the same priority. This
+// smooths the storm of connections that pools open after an instance
+// restarts, which can otherwise overwhelm a small instance and trip its
+// connection limits. Warm connections count towards the limit with
+// PriorityLow. The default, or an n of zero or less, is no limit.
+func WithMaxConcurrentDials(n int) DialerOption {
+	return func(d *dialerConfig) {
+		d.maxDials = n
+	}
+}
+
+// Priority orders dials waiting for admission under WithMaxConcurrentDials.
+type Priority int
+
+// The priorities of dials, from lowest to highest.
+const (
+	// PriorityLow is for background work, such as batch jobs, that can wait
+	// for interactive traffic.
+	PriorityLow Priority = -1
+	// PriorityNormal is the default priority.
+	PriorityNormal Priority = 0
+	// PriorityHigh is for interactive traffic.
+	PriorityHigh Priority = 1
+)
+
+// WithPriority returns a DialOption that admits the dial with priority p when
+// it waits for other dials to the instance to finish, so that, e.g.,
+// interactive traffic is connected before background jobs sharing the Dialer.
+// Dials that are already connecting are never interrupted. The priority has no
+// effect without WithMaxConcurrentDials.
+func WithPriority(p Priority) DialOption {
+	return func(cfg *dialCfg) {
+		cfg.priority = p
+	}
+}
+
+// dialSlots admits at most a fixed number of dials at once, in order of
+// priority.
+type dialSlots struct {
+	mu   sync.Mutex
+	free int
+	// waiting holds the dials waiting for a slot in the order they arrived.
+	waiting []*slotWaiter
+}
+
+// slotWaiter is a dial waiting for a slot, which is handed to it by closing
+// ready.
+type slotWaiter struct {
+	priority Priority
+	ready    chan struct{}
+}
+
+// acquire waits for a slot until ctx is done.
+func (s *dialSlots) acquire(ctx context.Context, p Priority) error {
+	s.mu.Lock()
+	if s.free > 0 && len(s.waiting) == 0 {
+		s.free--
+		s.mu.Unlock()
+		return nil
+	}
+	w := &slotWaiter{priority: p, ready: make(chan struct{})}
+	s.waiting = append(s.waiting, w)
+	s.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+	}
+	s.mu.Lock()
+	for i, o := range s.waiting {
+		if o == w {
+			s.waiting = append(s.waiting[:i], s.waiting[i+1:]...)
+			s.mu.Unlock()
+			return ctx.Err()
+		}
+	}
+	s.mu.Unlock()
+	// the slot was handed over as ctx was done, so pass it on
+	s.release()
+	return ctx.Err()
+}
+
+// release frees a slot, handing it to the waiting dial with the highest
+// priority, if any.
+func (s *dialSlots) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.waiting) == 0 {
+		s.free++
+		return
+	}
+	next := 0
+	for i, w := range s.waiting {
+		if w.priority > s.waiting[next].priority {
+			next = i
+		}
+	}
+	w := s.waiting[next]
+	s.waiting = append(s.waiting[:next], s.waiting[next+1:]...)
+	close(w.ready)
+}
+
+// acquireDialSlot waits until fewer than the maximum number of concurrent
+// dials to the instance with connection name cn are in progress, admitting
+// dials of higher priority p first. The returned function must be called
+// once the dial is done.
+func (d *Dialer) acquireDialSlot(ctx context.Context, cn string, p Priority) (func(), error) {
+	if d.maxDials <= 0 {
+		return func() {}, nil
+	}
+	d.dialSlotsLock.Lock()
+	slots, ok := d.dialSlots[cn]
+	if !ok {
+		slots = &dialSlots{free: d.maxDials}
+		d.dialSlots[cn] = slots
+	}
+	d.dialSlotsLock.Unlock()
+	if err := slots.acquire(ctx, p); err != nil {
+		return nil, errtypes.NewDialError("context done while waiting for other dials to the instance", cn, err)
+	}
+	return slots.release, nil
+}
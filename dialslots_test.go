@@ -0,0 +1,177 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/cloudsqlconn/internal/mock"
+)
+
+func TestWithMaxConcurrentDials(t *testing.T) {
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+	svc, cleanup, err := mock.NewSQLAdminService(
+		context.Background(),
+		mock.InstanceGetSuccess(inst, 1),
+		mock.CreateEphemeralSuccess(inst, 1),
+	)
+	if err != nil {
+		t.Fatalf("failed to create test SQL admin service: %s", err)
+	}
+	stop := mock.StartServerProxy(t, inst)
+	defer func() {
+		stop()
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	// slowDial records the most TCP connects in progress at once.
+	var (
+		mu           sync.Mutex
+		active, most int
+	)
+	slowDial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		mu.Lock()
+		active++
+		if active > most {
+			most = active
+		}
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			active--
+			mu.Unlock()
+		}()
+		time.Sleep(50 * time.Millisecond)
+		var d net.Dialer
+		return d.DialContext(ctx, network, addr)
+	}
+	d, err := NewDialer(context.Background(),
+		WithTokenSource(mock.EmptyTokenSource{}),
+		WithDialFunc(slowDial),
+		WithMaxConcurrentDials(2),
+	)
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	d.sqladmin = svc
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 6)
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn, err := d.Dial(context.Background(), "my-project:my-region:my-instance")
+			if err != nil {
+				errs <- err
+				return
+			}
+			conn.Close()
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("expected Dial to succeed, but got error: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if most > 2 {
+		t.Fatalf("want at most 2 dials at once, got = %v", most)
+	}
+}
+
+func TestAcquireDialSlotContextDone(t *testing.T) {
+	d, err := NewDialer(context.Background(),
+		WithTokenSource(mock.EmptyTokenSource{}),
+		WithMaxConcurrentDials(1),
+	)
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+
+	release, err := d.acquireDialSlot(context.Background(), "p:r:i", PriorityNormal)
+	if err != nil {
+		t.Fatalf("acquireDialSlot failed: %v", err)
+	}
+	// other instances have slots of their own
+	releaseOther, err := d.acquireDialSlot(context.Background(), "p:r:other", PriorityNormal)
+	if err != nil {
+		t.Fatalf("acquireDialSlot failed: %v", err)
+	}
+	releaseOther()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := d.acquireDialSlot(ctx, "p:r:i", PriorityNormal); err == nil {
+		t.Fatal("want an error once the context is done")
+	}
+	release()
+	release, err = d.acquireDialSlot(context.Background(), "p:r:i", PriorityNormal)
+	if err != nil {
+		t.Fatalf("acquireDialSlot after release failed: %v", err)
+	}
+	release()
+}
+
+func TestDialSlotsPriority(t *testing.T) {
+	s := &dialSlots{free: 1}
+	if err := s.acquire(context.Background(), PriorityNormal); err != nil {
+		t.Fatalf("acquire failed: %v", err)
+	}
+
+	order := make(chan Priority, 4)
+	waiters := []Priority{PriorityLow, PriorityNormal, PriorityHigh, PriorityNormal}
+	for i, p := range waiters {
+		go func(p Priority) {
+			if err := s.acquire(context.Background(), p); err != nil {
+				t.Errorf("acquire failed: %v", err)
+				return
+			}
+			order <- p
+		}(p)
+		// wait for the dial to queue, so that arrival order is known
+		for {
+			s.mu.Lock()
+			n := len(s.waiting)
+			s.mu.Unlock()
+			if n == i+1 {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	want := []Priority{PriorityHigh, PriorityNormal, PriorityNormal, PriorityLow}
+	for _, w := range want {
+		s.release()
+		select {
+		case got := <-order:
+			if got != w {
+				t.Fatalf("admitted, want = %v, got = %v", w, got)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("want a waiting dial to be admitted")
+		}
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"sort"
+
+	"cloud.google.com/go/cloudsqlconn/errtypes"
+	"cloud.google.com/go/cloudsqlconn/internal/sqladmin"
+)
+
+// ListInstances returns the connection names of the instances in project that
+// can be dialed and whose user labels include every key and value in
+// labelSelector. An empty labelSelector matches all instances. The names are
+// returned in sorted order.
+func (d *Dialer) ListInstances(ctx context.Context, project string, labelSelector map[string]string) ([]string, error) {
+	d.lock.RLock()
+	client, ok := d.cachedProjectClient(project)
+	d.lock.RUnlock()
+	if !ok {
+		var err error
+		d.lock.Lock()
+		client, err = d.projectClient(project)
+		d.lock.Unlock()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var names []string
+	err := client.ListInstances(ctx, project, func(resp *sqladmin.InstancesListResponse) error {
+		for _, db := range resp.Items {
+			// only Second Generation instances support the connector
+			if db.BackendType != "SECOND_GEN" || db.ConnectionName == "" {
+				continue
+			}
+			if !matchLabels(db, labelSelector) {
+				continue
+			}
+			names = append(names, db.ConnectionName)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errtypes.NewRefreshError("failed to list instances", project, err)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// matchLabels reports whether db has every label in selector.
+func matchLabels(db *sqladmin.DatabaseInstance, selector map[string]string) bool {
+	if len(selector) == 0 {
+		return true
+	}
+	if db.Settings == nil {
+		return false
+	}
+	for k, v := range selector {
+		if got, ok := db.Settings.UserLabels[k]; !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,82 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"cloud.google.com/go/cloudsqlconn/errtypes"
+	"cloud.google.com/go/cloudsqlconn/internal/mock"
+)
+
+func TestListInstances(t *testing.T) {
+	insts := []mock.FakeCSQLInstance{
+		mock.NewFakeCSQLInstance("my-project", "my-region", "prod-b",
+			mock.WithUserLabels(map[string]string{"env": "prod", "team": "b"})),
+		mock.NewFakeCSQLInstance("my-project", "my-region", "prod-a",
+			mock.WithUserLabels(map[string]string{"env": "prod", "team": "a"})),
+		mock.NewFakeCSQLInstance("my-project", "my-region", "dev",
+			mock.WithUserLabels(map[string]string{"env": "dev"})),
+		mock.NewFakeCSQLInstance("my-project", "my-region", "unlabeled"),
+		mock.NewFakeCSQLInstance("my-project", "my-region", "first-gen",
+			mock.WithFirstGenBackend(),
+			mock.WithUserLabels(map[string]string{"env": "prod"})),
+	}
+	svc, cleanup, err := mock.NewSQLAdminService(
+		context.Background(),
+		mock.InstancesListSuccess("my-project", insts, 2),
+	)
+	if err != nil {
+		t.Fatalf("failed to create test SQL admin service: %s", err)
+	}
+	defer func() {
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	d, err := NewDialer(context.Background(), WithTokenSource(mock.EmptyTokenSource{}))
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	d.sqladmin = svc
+
+	got, err := d.ListInstances(context.Background(), "my-project", map[string]string{"env": "prod"})
+	if err != nil {
+		t.Fatalf("ListInstances failed: %v", err)
+	}
+	want := []string{"my-project:my-region:prod-a", "my-project:my-region:prod-b"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ListInstances mismatch, want = %v, got = %v", want, got)
+	}
+
+	got, err = d.ListInstances(context.Background(), "my-project", nil)
+	if err != nil {
+		t.Fatalf("ListInstances failed: %v", err)
+	}
+	if len(got) != 4 {
+		t.Fatalf("want all dialable instances without a selector, got = %v", got)
+	}
+
+	_, err = d.ListInstances(context.Background(), "other-project", nil)
+	var wantErr *errtypes.RefreshError
+	if !errors.As(err, &wantErr) {
+		t.Fatalf("when API call fails, want = %T, got = %v", wantErr, err)
+	}
+}
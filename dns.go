@@ -0,0 +1,226 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/cloudsqlconn/errtypes"
+	"cloud.google.com/go/cloudsqlconn/instance"
+)
+
+// WithDNSResolver returns a DialerOption that lets Dial, Resolve, and
+// ForceRefresh accept a domain name in place of an instance connection name.
+// The name's DNS TXT record holds the connection name of the instance, e.g.,
+// "orders.db.internal.example.com. TXT my-project:my-region:orders", so an
+// instance can be re-pointed by changing the record. A name may have several
+// such records, each optionally prefixed with a priority, e.g.,
+// "10 my-project:my-region:orders", and Dial tries the instances in order of
+// priority, lowest first, until one connects. Instances that most recent
+// dials have failed to connect to are tried last, except for one attempt
+// every 30 seconds to find out whether they have recovered. Records, and names
+// that are not found, are cached for their TTL, or for 30 seconds when the
+// system's resolvers are used, as they do not report TTLs.
+//
+// suffixes are search domains, each of which may be written as a wildcard
+// such as "*.db.internal.example.com". A name without a dot, such as
+// "orders", is looked up in each search domain in order, and a name with a
+// dot is looked up as is and then in each search domain, so that application
+// configuration need not hold fully qualified names. Names ending in a dot,
+// or in one of the search domains, are only looked up as is.
+//
+// When used with WithDialFunc, DNS queries are made with its function.
+func WithDNSResolver(suffixes ...string) DialerOption {
+	return func(d *dialerConfig) {
+		d.dnsResolver = true
+		for _, s := range suffixes {
+			d.dnsSuffixes = append(d.dnsSuffixes, normalizeDNSSuffix(s))
+		}
+	}
+}
+
+// WithDNSServer returns a DialerOption that sends the DNS queries of
+// WithDNSResolver to the server at addr instead of the system's resolvers,
+// e.g., to a Cloud DNS private zone resolver or an on-premises server. addr
+// is "host:port", or a host, in which case port 53 is used. The server's
+// answers are cached for their TTL.
+func WithDNSServer(addr string) DialerOption {
+	return func(d *dialerConfig) {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			addr = net.JoinHostPort(addr, "53")
+		}
+		d.dnsServer = addr
+	}
+}
+
+// normalizeDNSSuffix turns a search domain such as "*.example.com" or
+// "example.com." into the form ".example.com".
+func normalizeDNSSuffix(s string) string {
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "*"), ".")
+	if !strings.HasPrefix(s, ".") {
+		s = "." + s
+	}
+	return s
+}
+
+// txtLookup looks up the TXT records of the fully qualified domain name qn
+// and returns them with how long they may be cached. It returns a
+// *net.DNSError that reports IsNotFound, along with how long that may be
+// cached, if qn has no TXT records.
+type txtLookup func(ctx context.Context, qn string) (recs []string, ttl time.Duration, err error)
+
+// newTXTLookup returns a txtLookup that makes DNS queries with dial if it is
+// not nil. The queries are sent to server, if set, and otherwise to the
+// system's resolvers, which do not report TTLs.
+func newTXTLookup(dial dialFunc, server string) txtLookup {
+	r := net.DefaultResolver
+	if dial != nil {
+		r = &net.Resolver{PreferGo: true, Dial: dial}
+	}
+	if server != "" {
+		if dial == nil {
+			var nd net.Dialer
+			dial = nd.DialContext
+		}
+		return func(ctx context.Context, qn string) ([]string, time.Duration, error) {
+			return queryTXT(ctx, dial, server, qn)
+		}
+	}
+	return func(ctx context.Context, qn string) ([]string, time.Duration, error) {
+		recs, err := r.LookupTXT(ctx, qn)
+		return recs, defaultDNSTTL, err
+	}
+}
+
+// dnsQueryNames returns the fully qualified names to look up for name, in
+// order.
+func (d *Dialer) dnsQueryNames(name string) []string {
+	if strings.HasSuffix(name, ".") {
+		return []string{name}
+	}
+	for _, s := range d.dnsSuffixes {
+		if strings.HasSuffix(name, s) {
+			return []string{name + "."}
+		}
+	}
+	var names []string
+	if strings.Contains(name, ".") {
+		names = append(names, name+".")
+	}
+	for _, s := range d.dnsSuffixes {
+		names = append(names, name+s+".")
+	}
+	return names
+}
+
+// resolveDNS returns the instance connection names held by the TXT records of
+// the domain name, in the order they should be tried, trying each search
+// domain in turn. It returns just name when DNS resolution is disabled or
+// name is already an instance connection name or the name of a replica set.
+func (d *Dialer) resolveDNS(ctx context.Context, name string) ([]string, error) {
+	if d.lookupTXT == nil || instance.ValidateConnName(name) == nil {
+		return []string{name}, nil
+	}
+	d.lock.RLock()
+	_, ok := d.replicaSets[name]
+	d.lock.RUnlock()
+	if ok {
+		return []string{name}, nil
+	}
+	qns := d.dnsQueryNames(name)
+	if len(qns) == 0 {
+		// not a domain name, so report it as an invalid connection name
+		return nil, instance.ValidateConnName(name)
+	}
+	var err error
+	for _, qn := range qns {
+		var cns []string
+		cns, err = d.lookupConnNames(ctx, qn)
+		if err == nil {
+			d.reportDNSTargets(name, cns)
+			d.updateCandidates(name, cns)
+			return cns, nil
+		}
+		var dnsErr *net.DNSError
+		if !errors.Is(err, errNoConnName) && !(errors.As(err, &dnsErr) && dnsErr.IsNotFound) {
+			break
+		}
+	}
+	return nil, errtypes.NewDialError("failed to resolve domain name", name, err)
+}
+
+// errNoConnName is returned by lookupConnNames when a domain name has no TXT
+// record holding an instance connection name.
+var errNoConnName = errors.New("no TXT record holds an instance connection name")
+
+// lookupConnNames returns the instance connection names held by the TXT
+// records of the fully qualified domain name qn, in order of priority. A
+// record holds either a connection name or a priority followed by a
+// connection name, e.g., "10 my-project:my-region:my-instance", where lower
+// priorities come first and no priority is 0. Connection names with the same
+// priority are in sorted order. Other records are ignored.
+func (d *Dialer) lookupConnNames(ctx context.Context, qn string) ([]string, error) {
+	recs, err := d.cachedLookupTXT(ctx, qn)
+	if err != nil {
+		return nil, err
+	}
+	type candidate struct {
+		priority int
+		cn       string
+	}
+	var cs []candidate
+	for _, r := range recs {
+		f := strings.Fields(r)
+		if len(f) == 0 || len(f) > 2 {
+			continue
+		}
+		c := candidate{cn: f[len(f)-1]}
+		if instance.ValidateConnName(c.cn) != nil {
+			continue
+		}
+		if len(f) == 2 {
+			p, err := strconv.Atoi(f[0])
+			if err != nil || p < 0 {
+				continue
+			}
+			c.priority = p
+		}
+		cs = append(cs, c)
+	}
+	if len(cs) == 0 {
+		return nil, errNoConnName
+	}
+	sort.Slice(cs, func(i, j int) bool {
+		if cs[i].priority != cs[j].priority {
+			return cs[i].priority < cs[j].priority
+		}
+		return cs[i].cn < cs[j].cn
+	})
+	seen := make(map[string]bool)
+	var cns []string
+	for _, c := range cs {
+		if !seen[c.cn] {
+			seen[c.cn] = true
+			cns = append(cns, c.cn)
+		}
+	}
+	return cns, nil
+}
@@ -0,0 +1,427 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/cloudsqlconn/errtypes"
+	"cloud.google.com/go/cloudsqlconn/internal/mock"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// fakeTXT returns a txtLookup backed by recs, which maps fully qualified names
+// to their records. Names without records are not found. Nothing is cached.
+func fakeTXT(recs map[string][]string) txtLookup {
+	return func(_ context.Context, name string) ([]string, time.Duration, error) {
+		r, ok := recs[name]
+		if !ok {
+			return nil, 0, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+		}
+		return r, 0, nil
+	}
+}
+
+func TestDNSQueryNames(t *testing.T) {
+	d := &Dialer{dialerState: &dialerState{dnsSuffixes: []string{
+		normalizeDNSSuffix("*.db.internal.example.com"),
+		normalizeDNSSuffix("example.com."),
+	}}}
+	tcs := []struct {
+		name string
+		want []string
+	}{
+		{
+			name: "orders",
+			want: []string{"orders.db.internal.example.com.", "orders.example.com."},
+		},
+		{
+			name: "orders.eu",
+			want: []string{"orders.eu.", "orders.eu.db.internal.example.com.", "orders.eu.example.com."},
+		},
+		{
+			name: "orders.db.internal.example.com",
+			want: []string{"orders.db.internal.example.com."},
+		},
+		{
+			name: "orders.other.org.",
+			want: []string{"orders.other.org."},
+		},
+	}
+	for _, tc := range tcs {
+		if got := d.dnsQueryNames(tc.name); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("dnsQueryNames(%q), want = %v, got = %v", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestResolveDNS(t *testing.T) {
+	d := &Dialer{dialerState: &dialerState{
+		clock:       realClock{},
+		replicaSets: map[string]*replicaSet{"orders-rs": {}},
+		dnsSuffixes: []string{".db.example.com"},
+		lookupTXT: fakeTXT(map[string][]string{
+			"orders.db.example.com.":  {"p:r:orders"},
+			"billing.db.example.com.": {"v=spf1 -all", "p:r:billing"},
+			"invalid.db.example.com.": {"not a connection name"},
+			"fallback.eu.":            {"p:r:fallback"},
+			"ha.db.example.com.": {
+				"20 p:r:b-standby", "p:r:primary", "20 p:r:a-standby",
+				"10 p:r:primary", "x p:r:bad-priority", "",
+			},
+		}),
+	}}
+	tcs := []struct {
+		desc string
+		name string
+		want []string
+	}{
+		{desc: "connection name", name: "p:r:i", want: []string{"p:r:i"}},
+		{desc: "replica set", name: "orders-rs", want: []string{"orders-rs"}},
+		{desc: "short name", name: "orders", want: []string{"p:r:orders"}},
+		{desc: "fully qualified name", name: "orders.db.example.com.", want: []string{"p:r:orders"}},
+		{desc: "other TXT records", name: "billing", want: []string{"p:r:billing"}},
+		{desc: "name with a dot", name: "fallback.eu", want: []string{"p:r:fallback"}},
+		{
+			desc: "several instances",
+			name: "ha",
+			want: []string{"p:r:primary", "p:r:a-standby", "p:r:b-standby"},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, err := d.resolveDNS(context.Background(), tc.name)
+			if err != nil {
+				t.Fatalf("resolveDNS failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("resolveDNS(%q), want = %v, got = %v", tc.name, tc.want, got)
+			}
+		})
+	}
+
+	for _, name := range []string{"missing", "invalid"} {
+		_, err := d.resolveDNS(context.Background(), name)
+		var wantErr *errtypes.DialError
+		if !errors.As(err, &wantErr) {
+			t.Fatalf("resolveDNS(%q), want = %T, got = %v", name, wantErr, err)
+		}
+	}
+}
+
+func TestResolveDNSStopsOnServerFailure(t *testing.T) {
+	var queried []string
+	d := &Dialer{dialerState: &dialerState{
+		dnsSuffixes: []string{".a.example.com", ".b.example.com"},
+		clock:       realClock{},
+		lookupTXT: func(_ context.Context, name string) ([]string, time.Duration, error) {
+			queried = append(queried, name)
+			return nil, time.Minute, &net.DNSError{Err: "server misbehaving", Name: name}
+		},
+	}}
+	_, err := d.resolveDNS(context.Background(), "orders")
+	var wantErr *errtypes.DialError
+	if !errors.As(err, &wantErr) {
+		t.Fatalf("want = %T, got = %v", wantErr, err)
+	}
+	if want := []string{"orders.a.example.com."}; !reflect.DeepEqual(queried, want) {
+		t.Fatalf("queried, want = %v, got = %v", want, queried)
+	}
+}
+
+func TestResolveDNSDisabled(t *testing.T) {
+	d := &Dialer{dialerState: &dialerState{}}
+	got, err := d.resolveDNS(context.Background(), "orders")
+	if err != nil {
+		t.Fatalf("resolveDNS failed: %v", err)
+	}
+	if want := []string{"orders"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("resolveDNS, want = %v, got = %v", want, got)
+	}
+}
+
+func TestDialerWithDNSResolver(t *testing.T) {
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+	svc, cleanup, err := mock.NewSQLAdminService(
+		context.Background(),
+		mock.InstanceGetSuccess(inst, 1),
+		mock.CreateEphemeralSuccess(inst, 1),
+	)
+	if err != nil {
+		t.Fatalf("failed to create SQL Admin service: %v", err)
+	}
+	stop := mock.StartServerProxy(t, inst)
+	defer func() {
+		stop()
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	d, err := NewDialer(context.Background(),
+		WithTokenSource(mock.EmptyTokenSource{}),
+		WithDNSResolver("*.db.internal.example.com"),
+	)
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	d.sqladmin = svc
+	d.lookupTXT = fakeTXT(map[string][]string{
+		"my-db.db.internal.example.com.": {"my-project:my-region:my-instance"},
+	})
+
+	conn, err := d.Dial(context.Background(), "my-db")
+	if err != nil {
+		t.Fatalf("expected Dial to succeed, but got error: %v", err)
+	}
+	defer conn.Close()
+	data, err := ioutil.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("expected ReadAll to succeed, got error %v", err)
+	}
+	if string(data) != "my-instance" {
+		t.Fatalf("expected known response from the server, but got %v", string(data))
+	}
+
+	if _, err := d.Resolve(context.Background(), "my-db"); err != nil {
+		t.Fatalf("expected Resolve to succeed, but got error: %v", err)
+	}
+	if err := d.ForceRefresh("unknown-db"); err == nil {
+		t.Fatal("expected ForceRefresh to fail for an unknown domain name")
+	}
+}
+
+// fakeDNSServer is a DNS server on UDP and TCP that answers TXT queries.
+type fakeDNSServer struct {
+	// recs maps fully qualified names to their records, which are answered
+	// with ttl. Other names are not found, with an SOA record whose minimum
+	// is negTTL.
+	recs   map[string][]string
+	ttl    uint32
+	negTTL uint32
+	// cnames maps fully qualified names to the canonical names they are
+	// aliases for, which are answered with a CNAME record alone.
+	cnames map[string]string
+	// truncate makes answers over UDP truncated, so that clients retry over
+	// TCP.
+	truncate bool
+
+	mu      sync.Mutex
+	queries map[string]int
+}
+
+// start starts the server and returns its address.
+func (s *fakeDNSServer) start(t *testing.T) string {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	l, err := net.Listen("tcp", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	s.queries = make(map[string]int)
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if b := s.answer(buf[:n], s.truncate); b != nil {
+				pc.WriteTo(b, addr)
+			}
+		}
+	}()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			var lb [2]byte
+			if _, err := io.ReadFull(c, lb[:]); err == nil {
+				buf := make([]byte, binary.BigEndian.Uint16(lb[:]))
+				if _, err := io.ReadFull(c, buf); err == nil {
+					if b := s.answer(buf, false); b != nil {
+						c.Write(append([]byte{byte(len(b) >> 8), byte(len(b))}, b...))
+					}
+				}
+			}
+			c.Close()
+		}
+	}()
+	return pc.LocalAddr().String()
+}
+
+// answer returns the packed response to the query b.
+func (s *fakeDNSServer) answer(b []byte, truncate bool) []byte {
+	var req dnsmessage.Message
+	if err := req.Unpack(b); err != nil || len(req.Questions) != 1 {
+		return nil
+	}
+	q := req.Questions[0]
+	s.mu.Lock()
+	s.queries[q.Name.String()]++
+	s.mu.Unlock()
+	resp := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: req.ID, Response: true, Authoritative: true},
+		Questions: req.Questions,
+	}
+	txts, ok := s.recs[q.Name.String()]
+	cname, isAlias := s.cnames[q.Name.String()]
+	switch {
+	case truncate:
+		resp.Truncated = true
+	case isAlias:
+		resp.Answers = append(resp.Answers, dnsmessage.Resource{
+			Header: dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypeCNAME, Class: dnsmessage.ClassINET, TTL: s.ttl},
+			Body:   &dnsmessage.CNAMEResource{CNAME: dnsmessage.MustNewName(cname)},
+		})
+	case !ok || q.Type != dnsmessage.TypeTXT:
+		resp.RCode = dnsmessage.RCodeNameError
+		zone := dnsmessage.MustNewName("example.com.")
+		resp.Authorities = append(resp.Authorities, dnsmessage.Resource{
+			Header: dnsmessage.ResourceHeader{Name: zone, Type: dnsmessage.TypeSOA, Class: dnsmessage.ClassINET, TTL: 3600},
+			Body:   &dnsmessage.SOAResource{NS: zone, MBox: zone, MinTTL: s.negTTL},
+		})
+	default:
+		for _, txt := range txts {
+			resp.Answers = append(resp.Answers, dnsmessage.Resource{
+				Header: dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypeTXT, Class: dnsmessage.ClassINET, TTL: s.ttl},
+				Body:   &dnsmessage.TXTResource{TXT: []string{txt}},
+			})
+		}
+	}
+	out, err := resp.Pack()
+	if err != nil {
+		return nil
+	}
+	return out
+}
+
+// count returns the number of queries for the fully qualified name qn.
+func (s *fakeDNSServer) count(qn string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.queries[qn]
+}
+
+func TestDialerWithDNSServer(t *testing.T) {
+	s := &fakeDNSServer{recs: map[string][]string{
+		"orders.db.internal.example.com.": {"my-project:my-region:orders"},
+	}}
+	addr := s.start(t)
+	d, err := NewDialer(context.Background(),
+		WithTokenSource(mock.EmptyTokenSource{}),
+		WithDNSResolver("*.db.internal.example.com"),
+		WithDNSServer(addr),
+	)
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+
+	got, err := d.resolveDNS(context.Background(), "orders")
+	if err != nil {
+		t.Fatalf("resolveDNS failed: %v", err)
+	}
+	if want := []string{"my-project:my-region:orders"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("resolveDNS, want = %v, got = %v", want, got)
+	}
+	if _, err := d.resolveDNS(context.Background(), "missing"); err == nil {
+		t.Fatal("expected resolveDNS to fail for a missing name")
+	}
+}
+
+func TestWithDNSServerDefaultPort(t *testing.T) {
+	tcs := []struct {
+		addr string
+		want string
+	}{
+		{addr: "169.254.169.254", want: "169.254.169.254:53"},
+		{addr: "10.0.0.2:5353", want: "10.0.0.2:5353"},
+		{addr: "::1", want: "[::1]:53"},
+	}
+	for _, tc := range tcs {
+		var cfg dialerConfig
+		WithDNSServer(tc.addr)(&cfg)
+		if cfg.dnsServer != tc.want {
+			t.Errorf("WithDNSServer(%q), want = %v, got = %v", tc.addr, tc.want, cfg.dnsServer)
+		}
+	}
+}
+
+func TestDialerWithDNSResolverTriesEachInstance(t *testing.T) {
+	down := mock.NewFakeCSQLInstance("my-project", "my-region", "down")
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+	svc, cleanup, err := mock.NewSQLAdminService(
+		context.Background(),
+		// the refresh of down may fail before it requests a certificate, so
+		// that request isn't expected
+		mock.InstanceGetError(down, http.StatusServiceUnavailable, "backendError", 1),
+		mock.InstanceGetSuccess(inst, 1),
+		mock.CreateEphemeralSuccess(inst, 1),
+	)
+	if err != nil {
+		t.Fatalf("failed to create SQL Admin service: %v", err)
+	}
+	stop := mock.StartServerProxy(t, inst)
+	defer func() {
+		stop()
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	d, err := NewDialer(context.Background(),
+		WithTokenSource(mock.EmptyTokenSource{}),
+		WithDNSResolver(),
+	)
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	d.sqladmin = svc
+	d.lookupTXT = fakeTXT(map[string][]string{
+		"ha.example.com.": {"1 my-project:my-region:my-instance", "0 my-project:my-region:down"},
+	})
+
+	conn, err := d.Dial(context.Background(), "ha.example.com")
+	if err != nil {
+		t.Fatalf("expected Dial to succeed, but got error: %v", err)
+	}
+	defer conn.Close()
+	data, err := ioutil.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("expected ReadAll to succeed, got error %v", err)
+	}
+	if string(data) != "my-instance" {
+		t.Fatalf("expected the second instance to be dialed, but got %v", string(data))
+	}
+}
@@ -0,0 +1,260 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/cloudsqlconn/internal/trace"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	// defaultDNSTTL is how long DNS answers are cached when their TTL is not
+	// known, e.g., when they come from the system's resolvers.
+	defaultDNSTTL = 30 * time.Second
+	// dnsQueryTimeout bounds a DNS query when the context has no deadline.
+	dnsQueryTimeout = 5 * time.Second
+	// maxCNAMEs is the most aliases followed to find a name's TXT records.
+	maxCNAMEs = 8
+)
+
+// dnsCacheEntry is the cached result of looking up the TXT records of a
+// domain name. err, if set, is the *net.DNSError reporting that the name was
+// not found.
+type dnsCacheEntry struct {
+	recs    []string
+	err     error
+	expires time.Time
+}
+
+// cachedLookupTXT returns the TXT records of the fully qualified domain name
+// qn, from the cache if they have not expired. Names that are not found are
+// cached too, so that a search domain that doesn't hold a name isn't queried
+// on every Dial. Other errors are not cached.
+func (d *Dialer) cachedLookupTXT(ctx context.Context, qn string) ([]string, error) {
+	now := d.clock.Now()
+	d.dnsLock.Lock()
+	e, ok := d.dnsCache[qn]
+	d.dnsLock.Unlock()
+	if ok && now.Before(e.expires) {
+		result := trace.DNSCacheHit
+		if e.err != nil {
+			result = trace.DNSCacheNegativeHit
+		}
+		trace.RecordDNSCacheLookup(context.Background(), d.dialerID, result)
+		return e.recs, e.err
+	}
+	trace.RecordDNSCacheLookup(context.Background(), d.dialerID, trace.DNSCacheMiss)
+
+	recs, ttl, err := d.lookupTXT(ctx, qn)
+	var dnsErr *net.DNSError
+	if ttl <= 0 || (err != nil && !(errors.As(err, &dnsErr) && dnsErr.IsNotFound)) {
+		return recs, err
+	}
+	d.dnsLock.Lock()
+	defer d.dnsLock.Unlock()
+	if d.dnsCache == nil {
+		d.dnsCache = make(map[string]dnsCacheEntry)
+	}
+	for n, e := range d.dnsCache {
+		if !now.Before(e.expires) {
+			delete(d.dnsCache, n)
+		}
+	}
+	d.dnsCache[qn] = dnsCacheEntry{recs: recs, err: err, expires: now.Add(ttl)}
+	return recs, err
+}
+
+// queryTXT queries the DNS server at server for the TXT records of the fully
+// qualified domain name qn, over UDP and then over TCP if the answer was
+// truncated. An answer with only CNAME records is followed to the canonical
+// name, for up to maxCNAMEs aliases. The records may be cached for the
+// smallest of their TTLs and those of the aliases, and a name that is not
+// found for the negative caching TTL of its zone.
+func queryTXT(ctx context.Context, dial dialFunc, server, qn string) ([]string, time.Duration, error) {
+	name, aliasTTL := qn, time.Duration(-1)
+	for n := 0; ; n++ {
+		recs, ttl, target, err := queryTXTName(ctx, dial, server, name)
+		if aliasTTL >= 0 && ttl > aliasTTL {
+			ttl = aliasTTL
+		}
+		if target == "" || err != nil {
+			return recs, ttl, err
+		}
+		if n == maxCNAMEs {
+			return nil, 0, &net.DNSError{Err: "too many CNAME records", Name: qn, Server: server}
+		}
+		name, aliasTTL = target, ttl
+	}
+}
+
+// queryTXTName makes a single query for the TXT records of qn, as described
+// by queryTXT. If the answer holds no TXT records but CNAME records, it
+// returns the canonical name they lead to, with the smallest of their TTLs,
+// for the caller to query instead.
+func queryTXTName(ctx context.Context, dial dialFunc, server, qn string) (recs []string, ttl time.Duration, target string, err error) {
+	name, err := dnsmessage.NewName(qn)
+	if err != nil {
+		return nil, 0, "", &net.DNSError{Err: err.Error(), Name: qn, Server: server}
+	}
+	var id [2]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, 0, "", err
+	}
+	q := dnsmessage.Message{
+		Header: dnsmessage.Header{ID: binary.BigEndian.Uint16(id[:]), RecursionDesired: true},
+		Questions: []dnsmessage.Question{
+			{Name: name, Type: dnsmessage.TypeTXT, Class: dnsmessage.ClassINET},
+		},
+	}
+	resp, err := exchangeDNS(ctx, dial, "udp", server, q)
+	if err == nil && resp.Truncated {
+		resp, err = exchangeDNS(ctx, dial, "tcp", server, q)
+	}
+	if err != nil {
+		return nil, 0, "", &net.DNSError{Err: err.Error(), Name: qn, Server: server}
+	}
+	notFound := &net.DNSError{Err: "no such host", Name: qn, Server: server, IsNotFound: true}
+	switch resp.RCode {
+	case dnsmessage.RCodeSuccess:
+	case dnsmessage.RCodeNameError:
+		return nil, negativeTTL(resp), "", notFound
+	default:
+		return nil, 0, "", &net.DNSError{Err: "server misbehaving: " + resp.RCode.String(), Name: qn, Server: server}
+	}
+	var cnameTTL time.Duration
+	for _, rr := range resp.Answers {
+		t := time.Duration(rr.Header.TTL) * time.Second
+		switch body := rr.Body.(type) {
+		case *dnsmessage.TXTResource:
+			// a record's strings form a single value, as with net.LookupTXT
+			recs = append(recs, strings.Join(body.TXT, ""))
+			if len(recs) == 1 || t < ttl {
+				ttl = t
+			}
+		case *dnsmessage.CNAMEResource:
+			// the aliases leading to the TXT records, in order
+			if target == "" || t < cnameTTL {
+				cnameTTL = t
+			}
+			target = body.CNAME.String()
+		}
+	}
+	if len(recs) > 0 {
+		if target != "" && cnameTTL < ttl {
+			ttl = cnameTTL
+		}
+		return recs, ttl, "", nil
+	}
+	if target != "" {
+		return nil, cnameTTL, target, nil
+	}
+	return nil, negativeTTL(resp), "", notFound
+}
+
+// negativeTTL returns how long the "not found" answer resp may be cached,
+// which is the smaller of the TTL and the minimum field of the zone's SOA
+// record, if the server included it, as described in RFC 2308.
+func negativeTTL(resp *dnsmessage.Message) time.Duration {
+	for _, rr := range resp.Authorities {
+		soa, ok := rr.Body.(*dnsmessage.SOAResource)
+		if !ok {
+			continue
+		}
+		ttl := rr.Header.TTL
+		if soa.MinTTL < ttl {
+			ttl = soa.MinTTL
+		}
+		return time.Duration(ttl) * time.Second
+	}
+	return defaultDNSTTL
+}
+
+// exchangeDNS sends the query q to the DNS server at server over network and
+// returns the response.
+func exchangeDNS(ctx context.Context, dial dialFunc, network, server string, q dnsmessage.Message) (*dnsmessage.Message, error) {
+	b, err := q.Pack()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := dial(ctx, network, server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(dnsQueryTimeout)
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	if network == "tcp" {
+		// messages over TCP are prefixed with their length
+		b = append([]byte{byte(len(b) >> 8), byte(len(b))}, b...)
+		if _, err := conn.Write(b); err != nil {
+			return nil, err
+		}
+		var l [2]byte
+		if _, err := io.ReadFull(conn, l[:]); err != nil {
+			return nil, err
+		}
+		buf := make([]byte, binary.BigEndian.Uint16(l[:]))
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			return nil, err
+		}
+		return parseDNSResponse(buf, q)
+	}
+
+	if _, err := conn.Write(b); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 1232)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := parseDNSResponse(buf[:n], q)
+		if err != nil {
+			// ignore stray packets, e.g., a late answer to an earlier query
+			continue
+		}
+		return resp, nil
+	}
+}
+
+// parseDNSResponse parses b as the response to the query q.
+func parseDNSResponse(b []byte, q dnsmessage.Message) (*dnsmessage.Message, error) {
+	var resp dnsmessage.Message
+	if err := resp.Unpack(b); err != nil {
+		return nil, err
+	}
+	if !resp.Response || resp.ID != q.ID || len(resp.Questions) != 1 ||
+		!strings.EqualFold(resp.Questions[0].Name.String(), q.Questions[0].Name.String()) {
+		return nil, fmt.Errorf("unexpected DNS response to query %v", q.ID)
+	}
+	return &resp, nil
+}
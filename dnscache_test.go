@@ -0,0 +1,181 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/cloudsqlconn/internal/mock"
+)
+
+// manualClock is a Clock whose time only changes when advanced. Functions are
+// scheduled in real time.
+type manualClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *manualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *manualClock) AfterFunc(d time.Duration, f func()) Timer { return time.AfterFunc(d, f) }
+
+func (c *manualClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestDNSCacheHonorsTTL(t *testing.T) {
+	s := &fakeDNSServer{
+		recs:   map[string][]string{"orders.db.example.com.": {"p:r:orders"}},
+		ttl:    60,
+		negTTL: 10,
+	}
+	addr := s.start(t)
+	clk := &manualClock{now: time.Now()}
+	d, err := NewDialer(context.Background(),
+		WithTokenSource(mock.EmptyTokenSource{}),
+		WithDNSResolver("*.db.example.com"),
+		WithDNSServer(addr),
+		WithClock(clk),
+	)
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+
+	resolve := func(name string) {
+		_, _ = d.resolveDNS(context.Background(), name)
+	}
+	tcs := []struct {
+		desc    string
+		advance time.Duration
+		want    int
+	}{
+		{desc: "first lookup", want: 1},
+		{desc: "cached", advance: 30 * time.Second, want: 1},
+		{desc: "expired", advance: 31 * time.Second, want: 2},
+	}
+	for _, tc := range tcs {
+		clk.advance(tc.advance)
+		resolve("orders")
+		if got := s.count("orders.db.example.com."); got != tc.want {
+			t.Fatalf("%s: queries, want = %v, got = %v", tc.desc, tc.want, got)
+		}
+	}
+
+	// names that are not found are cached for the SOA minimum
+	negTCs := []struct {
+		desc    string
+		advance time.Duration
+		want    int
+	}{
+		{desc: "first lookup", want: 1},
+		{desc: "cached", advance: 5 * time.Second, want: 1},
+		{desc: "expired", advance: 6 * time.Second, want: 2},
+	}
+	for _, tc := range negTCs {
+		clk.advance(tc.advance)
+		resolve("missing")
+		if got := s.count("missing.db.example.com."); got != tc.want {
+			t.Fatalf("not found, %s: queries, want = %v, got = %v", tc.desc, tc.want, got)
+		}
+	}
+}
+
+func TestDNSCacheRetriesErrors(t *testing.T) {
+	var calls int
+	d := &Dialer{dialerState: &dialerState{
+		clock: realClock{},
+		lookupTXT: func(context.Context, string) ([]string, time.Duration, error) {
+			calls++
+			return nil, time.Minute, context.DeadlineExceeded
+		},
+	}}
+	for i := 0; i < 2; i++ {
+		if _, err := d.cachedLookupTXT(context.Background(), "orders.example.com."); err == nil {
+			t.Fatal("expected cachedLookupTXT to fail")
+		}
+	}
+	if calls != 2 {
+		t.Fatalf("lookups, want = 2, got = %v", calls)
+	}
+}
+
+func TestQueryTXTOverTCP(t *testing.T) {
+	s := &fakeDNSServer{
+		recs:     map[string][]string{"orders.example.com.": {"p:r:orders"}},
+		ttl:      60,
+		truncate: true,
+	}
+	addr := s.start(t)
+	var nd net.Dialer
+	recs, ttl, err := queryTXT(context.Background(), nd.DialContext, addr, "orders.example.com.")
+	if err != nil {
+		t.Fatalf("queryTXT failed: %v", err)
+	}
+	if len(recs) != 1 || recs[0] != "p:r:orders" {
+		t.Fatalf("records, want = [p:r:orders], got = %v", recs)
+	}
+	if ttl != time.Minute {
+		t.Fatalf("ttl, want = %v, got = %v", time.Minute, ttl)
+	}
+	// once over UDP and once over TCP
+	if got := s.count("orders.example.com."); got != 2 {
+		t.Fatalf("queries, want = 2, got = %v", got)
+	}
+}
+
+func TestQueryTXTFollowsCNAME(t *testing.T) {
+	s := &fakeDNSServer{
+		recs: map[string][]string{"orders.db.example.net.": {"p:r:orders"}},
+		cnames: map[string]string{
+			"orders.example.com.": "orders.db.example.net.",
+			"loop.example.com.":   "loop.example.net.",
+			"loop.example.net.":   "loop.example.com.",
+		},
+		ttl: 60,
+	}
+	addr := s.start(t)
+	var nd net.Dialer
+	recs, ttl, err := queryTXT(context.Background(), nd.DialContext, addr, "orders.example.com.")
+	if err != nil {
+		t.Fatalf("queryTXT failed: %v", err)
+	}
+	if len(recs) != 1 || recs[0] != "p:r:orders" {
+		t.Fatalf("records, want = [p:r:orders], got = %v", recs)
+	}
+	if ttl != time.Minute {
+		t.Fatalf("ttl, want = %v, got = %v", time.Minute, ttl)
+	}
+	if got := s.count("orders.db.example.net."); got != 1 {
+		t.Fatalf("queries for the canonical name, want = 1, got = %v", got)
+	}
+
+	_, _, err = queryTXT(context.Background(), nd.DialContext, addr, "loop.example.com.")
+	var dnsErr *net.DNSError
+	if !errors.As(err, &dnsErr) || dnsErr.IsNotFound {
+		t.Fatalf("want a DNS error for a CNAME loop, got = %v", err)
+	}
+}
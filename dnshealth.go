@@ -0,0 +1,115 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"time"
+)
+
+const (
+	// candidateWeight is the weight of the latest dial in a DNS candidate's
+	// success rate, which is an exponentially weighted moving average.
+	candidateWeight = 0.3
+	// candidateHealthyRate is the success rate below which a DNS candidate is
+	// unhealthy.
+	candidateHealthyRate = 0.5
+	// candidateReprobeInterval is how long after its last dial an unhealthy
+	// DNS candidate is tried in its usual order again, to find out whether
+	// it has recovered.
+	candidateReprobeInterval = 30 * time.Second
+)
+
+// candidateHealth is the dial history of an instance that a domain name
+// resolves to along with others.
+type candidateHealth struct {
+	rate     float64
+	lastDial time.Time
+}
+
+// orderCandidates returns the instance connection names cns that a domain
+// name resolves to in the order Dial should try them: healthy candidates,
+// and unhealthy ones that are due to be probed again, in their usual order,
+// followed by the other unhealthy candidates. Candidates that have not been
+// dialed are healthy.
+func (d *Dialer) orderCandidates(cns []string) []string {
+	now := d.clock.Now()
+	ordered := make([]string, 0, len(cns))
+	var unhealthy []string
+	d.dnsLock.Lock()
+	for _, cn := range cns {
+		h, ok := d.candidates[cn]
+		if !ok || h.rate >= candidateHealthyRate || now.Sub(h.lastDial) >= candidateReprobeInterval {
+			ordered = append(ordered, cn)
+			continue
+		}
+		unhealthy = append(unhealthy, cn)
+	}
+	d.dnsLock.Unlock()
+	return append(ordered, unhealthy...)
+}
+
+// recordCandidateDial updates the success rate of the DNS candidate cn with
+// the result of dialing it. Dials canceled by the caller are not counted.
+func (d *Dialer) recordCandidateDial(cn string, err error) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	result := 1.0
+	if err != nil {
+		result = 0
+	}
+	d.dnsLock.Lock()
+	defer d.dnsLock.Unlock()
+	if d.candidates == nil {
+		d.candidates = make(map[string]*candidateHealth)
+	}
+	h, ok := d.candidates[cn]
+	if !ok {
+		h = &candidateHealth{rate: 1}
+		d.candidates[cn] = h
+	}
+	h.rate = (1-candidateWeight)*h.rate + candidateWeight*result
+	h.lastDial = d.clock.Now()
+}
+
+// updateCandidates records that the domain name name resolved to the
+// instance connection names cns. If that differs from the last time, the
+// dial history of instances that no domain name resolves to anymore is
+// dropped.
+func (d *Dialer) updateCandidates(name string, cns []string) {
+	d.dnsLock.Lock()
+	defer d.dnsLock.Unlock()
+	if old, ok := d.candidateDomains[name]; ok && reflect.DeepEqual(old, cns) {
+		return
+	}
+	if d.candidateDomains == nil {
+		d.candidateDomains = make(map[string][]string)
+	}
+	d.candidateDomains[name] = append([]string(nil), cns...)
+	resolved := make(map[string]bool)
+	for _, cns := range d.candidateDomains {
+		for _, cn := range cns {
+			resolved[cn] = true
+		}
+	}
+	for cn := range d.candidates {
+		if !resolved[cn] {
+			delete(d.candidates, cn)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestOrderCandidates(t *testing.T) {
+	clk := &manualClock{now: time.Now()}
+	d := &Dialer{dialerState: &dialerState{clock: clk}}
+	cns := []string{"p:r:a", "p:r:b", "p:r:c"}
+	errDial := errors.New("dial failed")
+
+	check := func(desc string, want []string) {
+		t.Helper()
+		if got := d.orderCandidates(cns); !reflect.DeepEqual(got, want) {
+			t.Fatalf("%s: want = %v, got = %v", desc, want, got)
+		}
+	}
+	check("no history", cns)
+
+	d.recordCandidateDial("p:r:a", errDial)
+	check("one failure", cns)
+
+	d.recordCandidateDial("p:r:a", errDial)
+	check("unhealthy", []string{"p:r:b", "p:r:c", "p:r:a"})
+
+	clk.advance(candidateReprobeInterval)
+	check("due to be probed", cns)
+
+	d.recordCandidateDial("p:r:a", errDial)
+	check("failed probe", []string{"p:r:b", "p:r:c", "p:r:a"})
+
+	clk.advance(candidateReprobeInterval)
+	d.recordCandidateDial("p:r:a", nil)
+	d.recordCandidateDial("p:r:a", nil)
+	clk.advance(time.Second)
+	check("recovered", cns)
+}
+
+func TestRecordCandidateDialIgnoresCanceled(t *testing.T) {
+	d := &Dialer{dialerState: &dialerState{clock: &manualClock{now: time.Now()}}}
+	for i := 0; i < 5; i++ {
+		d.recordCandidateDial("p:r:a", context.Canceled)
+	}
+	if _, ok := d.candidates["p:r:a"]; ok {
+		t.Fatal("want canceled dials not to be recorded")
+	}
+}
+
+func TestUpdateCandidatesDropsHistory(t *testing.T) {
+	d := &Dialer{dialerState: &dialerState{clock: &manualClock{now: time.Now()}}}
+	d.updateCandidates("ha.example.com", []string{"p:r:a", "p:r:b"})
+	d.updateCandidates("other.example.com", []string{"p:r:b", "p:r:c"})
+	for _, cn := range []string{"p:r:a", "p:r:b", "p:r:c"} {
+		d.recordCandidateDial(cn, errors.New("dial failed"))
+	}
+
+	// a and b are still resolved to, by one domain name or the other
+	d.updateCandidates("ha.example.com", []string{"p:r:a", "p:r:b"})
+	if len(d.candidates) != 3 {
+		t.Fatalf("want the history of every candidate kept, got = %v", d.candidates)
+	}
+	d.updateCandidates("ha.example.com", []string{"p:r:d"})
+	if _, ok := d.candidates["p:r:a"]; ok {
+		t.Fatal("want the history of a candidate no longer resolved to dropped")
+	}
+	if _, ok := d.candidates["p:r:b"]; !ok {
+		t.Fatal("want the history of a candidate still resolved to kept")
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+
+	"cloud.google.com/go/cloudsqlconn/errtypes"
+	"cloud.google.com/go/cloudsqlconn/instance"
+)
+
+// RegisterDRReplica adds a disaster recovery replica, typically in another
+// region, to the replica set registered under name. Unlike the read replicas,
+// the DR replica never serves reads. It is refreshed in the background so that
+// it is ready to become the primary, which happens when Promote is called, or
+// automatically once the Cloud SQL Admin API reports that it has been promoted
+// to a primary instance. Either way, subsequent dials of name connect to it
+// without any change to application configuration.
+func (d *Dialer) RegisterDRReplica(name, dr string) error {
+	if err := instance.ValidateConnName(dr); err != nil {
+		return err
+	}
+	d.lock.RLock()
+	rs, ok := d.replicaSets[name]
+	d.lock.RUnlock()
+	if !ok {
+		return errtypes.NewConfigError("replica set is not registered", name)
+	}
+	rs.mu.Lock()
+	rs.dr = dr
+	rs.drType = ""
+	rs.mu.Unlock()
+	// start refreshing the DR replica so a switchover doesn't wait on it
+	_, err := d.instance(context.Background(), dr)
+	return err
+}
+
+// Promote switches the replica set registered under name over to its DR
+// replica: the DR replica becomes the primary, and the former primary becomes
+// the DR replica, so calling Promote again switches back. It only changes
+// where this Dialer connects and does not promote the instance in Cloud SQL.
+// Existing connections are not closed. The failover callback, if any, is
+// called with the switchover.
+func (d *Dialer) Promote(name string) error {
+	d.lock.RLock()
+	rs, ok := d.replicaSets[name]
+	d.lock.RUnlock()
+	if !ok {
+		return errtypes.NewConfigError("replica set is not registered", name)
+	}
+	rs.mu.Lock()
+	if rs.dr == "" {
+		rs.mu.Unlock()
+		return errtypes.NewConfigError("replica set has no DR replica", name)
+	}
+	e := d.switchToDR(name, rs)
+	rs.mu.Unlock()
+	if d.onFailover != nil {
+		d.onFailover(e)
+	}
+	return nil
+}
+
+// switchToDR makes the DR replica of rs its primary. rs.mu must be held.
+func (d *Dialer) switchToDR(name string, rs *replicaSet) FailoverEvent {
+	e := FailoverEvent{ReplicaSet: name, OldPrimary: rs.primary, NewPrimary: rs.dr}
+	rs.primary, rs.dr = rs.dr, rs.primary
+	// the type of the former primary is observed anew
+	rs.drType = ""
+	rs.failures = 0
+	return e
+}
+
+// observeDR switches any replica set whose DR replica is cn over to it once a
+// refresh reports that cn changed from a replica to a primary instance.
+func (d *Dialer) observeDR(cn, instanceType string) {
+	var events []FailoverEvent
+	d.lock.RLock()
+	for name, rs := range d.replicaSets {
+		rs.mu.Lock()
+		if rs.dr == cn {
+			prev := rs.drType
+			rs.drType = instanceType
+			if prev != "" && prev != instanceTypePrimary && instanceType == instanceTypePrimary {
+				events = append(events, d.switchToDR(name, rs))
+			}
+		}
+		rs.mu.Unlock()
+	}
+	d.lock.RUnlock()
+	if d.onFailover == nil {
+		return
+	}
+	for _, e := range events {
+		d.onFailover(e)
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/cloudsqlconn/errtypes"
+	"cloud.google.com/go/cloudsqlconn/internal/mock"
+)
+
+func TestPromoteSwitchesToDRReplica(t *testing.T) {
+	ctx := context.Background()
+	dr := mock.NewFakeCSQLInstance("my-project", "other-region", "dr",
+		mock.WithInstanceType("READ_REPLICA_INSTANCE"))
+	svc, cleanup, err := mock.NewSQLAdminService(
+		ctx,
+		mock.InstanceGetSuccess(dr, 1),
+		mock.CreateEphemeralSuccess(dr, 1),
+	)
+	if err != nil {
+		t.Fatalf("failed to create test SQL admin service: %s", err)
+	}
+	defer cleanup()
+
+	events := make(chan FailoverEvent, 2)
+	d, err := NewDialer(ctx,
+		WithTokenSource(mock.EmptyTokenSource{}),
+		WithReplicaFailover(1, func(e FailoverEvent) { events <- e }),
+	)
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	d.sqladmin = svc
+
+	var wantErr *errtypes.ConfigError
+	if err := d.Promote("my-db"); !errors.As(err, &wantErr) {
+		t.Fatalf("when replica set is not registered, want = %T, got = %v", wantErr, err)
+	}
+	err = d.RegisterReplicaSet("my-db", RoundRobin, "my-project:my-region:primary")
+	if err != nil {
+		t.Fatalf("RegisterReplicaSet failed: %v", err)
+	}
+	if err := d.Promote("my-db"); !errors.As(err, &wantErr) {
+		t.Fatalf("when replica set has no DR replica, want = %T, got = %v", wantErr, err)
+	}
+	if err := d.RegisterDRReplica("my-db", "my-project:other-region:dr"); err != nil {
+		t.Fatalf("RegisterDRReplica failed: %v", err)
+	}
+	if got := d.resolveReplicaSet("my-db", true); got != "my-project:my-region:primary" {
+		t.Fatalf("DR replica should not serve reads, got = %v", got)
+	}
+
+	if err := d.Promote("my-db"); err != nil {
+		t.Fatalf("Promote failed: %v", err)
+	}
+	want := FailoverEvent{
+		ReplicaSet: "my-db",
+		OldPrimary: "my-project:my-region:primary",
+		NewPrimary: "my-project:other-region:dr",
+	}
+	if e := <-events; e != want {
+		t.Fatalf("failover event mismatch, want = %v, got = %v", want, e)
+	}
+	if got := d.resolveReplicaSet("my-db", false); got != "my-project:other-region:dr" {
+		t.Fatalf("writes should go to the DR replica, got = %v", got)
+	}
+
+	// Promoting again switches back.
+	if err := d.Promote("my-db"); err != nil {
+		t.Fatalf("Promote failed: %v", err)
+	}
+	<-events
+	if got := d.resolveReplicaSet("my-db", false); got != "my-project:my-region:primary" {
+		t.Fatalf("writes should go back to the primary, got = %v", got)
+	}
+}
+
+func TestDRReplicaPromotedInCloudSQL(t *testing.T) {
+	ctx := context.Background()
+	replica := mock.NewFakeCSQLInstance("my-project", "other-region", "dr",
+		mock.WithInstanceType("READ_REPLICA_INSTANCE"))
+	promoted := mock.NewFakeCSQLInstance("my-project", "other-region", "dr")
+	svc, cleanup, err := mock.NewSQLAdminService(
+		ctx,
+		mock.InstanceGetSuccess(replica, 1),
+		mock.CreateEphemeralSuccess(replica, 2),
+		mock.InstanceGetSuccess(promoted, 1),
+	)
+	if err != nil {
+		t.Fatalf("failed to create test SQL admin service: %s", err)
+	}
+	defer cleanup()
+
+	events := make(chan FailoverEvent, 1)
+	d, err := NewDialer(ctx,
+		WithTokenSource(mock.EmptyTokenSource{}),
+		WithReplicaFailover(1, func(e FailoverEvent) { events <- e }),
+	)
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	d.sqladmin = svc
+
+	err = d.RegisterReplicaSet("my-db", RoundRobin, "my-project:my-region:primary")
+	if err != nil {
+		t.Fatalf("RegisterReplicaSet failed: %v", err)
+	}
+	if err := d.RegisterDRReplica("my-db", "my-project:other-region:dr"); err != nil {
+		t.Fatalf("RegisterDRReplica failed: %v", err)
+	}
+
+	// Wait until the DR replica has been observed as a replica.
+	rs := d.replicaSets["my-db"]
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		rs.mu.RLock()
+		observed := rs.drType != ""
+		rs.mu.RUnlock()
+		if observed {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("timed out waiting for the DR replica to refresh")
+		}
+	}
+
+	// The next refresh reports the DR replica as a primary instance.
+	i, err := d.instance(context.Background(), "my-project:other-region:dr")
+	if err != nil {
+		t.Fatalf("failed to get instance: %v", err)
+	}
+	i.ForceRefresh()
+
+	select {
+	case e := <-events:
+		if e.NewPrimary != "my-project:other-region:dr" {
+			t.Fatalf("want switchover to the DR replica, got = %v", e)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for switchover")
+	}
+	if got := d.resolveReplicaSet("my-db", false); got != "my-project:other-region:dr" {
+		t.Fatalf("writes should go to the DR replica, got = %v", got)
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// CertFiles names the PEM files that EmitCertificates writes an instance's
+// certificates to.
+type CertFiles struct {
+	// CertFile is the path of the client certificate.
+	CertFile string
+	// KeyFile is the path of the client certificate's PKCS #8 private key.
+	// It is readable only by the current user.
+	KeyFile string
+	// CAFile is the path of the server CA certificates.
+	CAFile string
+}
+
+// certEmitter writes the certificates of an instance to files after every
+// successful refresh until ctx is done.
+type certEmitter struct {
+	ctx   context.Context
+	files CertFiles
+}
+
+// EmitCertificates writes the current client certificate, its private key,
+// and the server CAs of the instance to files, and rewrites them after every
+// successful refresh of the instance's information until ctx is done or the
+// Dialer is closed. This lets service meshes, such as Envoy reading its
+// certificates from files, and processes not written in Go use the
+// certificates the Dialer keeps fresh; see Certificates for how to verify the
+// server's certificate. The instance argument is resolved as with
+// Certificates. EmitCertificates returns once the files are first written;
+// later failures to write them are reported to the logger configured with
+// WithLogger.
+//
+// Each file is replaced atomically, KeyFile first and CertFile last, so a
+// reader that reloads the files when CertFile changes reads a matching pair.
+// Files are only rewritten when the Dialer refreshes the instance's
+// information in the background, which the default RefreshStrategy does.
+func (d *Dialer) EmitCertificates(ctx context.Context, instance string, files CertFiles) error {
+	names, err := d.resolveDNS(ctx, d.resolveAlias(instance))
+	if err != nil {
+		return err
+	}
+	cn := d.resolveReplicaSet(names[0], false)
+	// hold the instance's write lock until the emitter is registered, so a
+	// refresh in the meantime rewrites the files after this first write
+	w := d.emitWriter(cn)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	certs, err := d.Certificates(ctx, cn)
+	if err != nil {
+		return err
+	}
+	if err := writeCertFiles(files, certs); err != nil {
+		return err
+	}
+	if certs.Expiry.After(w.expiry) {
+		w.expiry = certs.Expiry
+	}
+	d.emitLock.Lock()
+	if d.emitters == nil {
+		d.emitters = make(map[string][]certEmitter)
+	}
+	d.emitters[cn] = append(d.emitters[cn], certEmitter{ctx: ctx, files: files})
+	d.emitLock.Unlock()
+	return nil
+}
+
+// emitWrite serializes writing the files of an instance.
+type emitWrite struct {
+	mu sync.Mutex
+	// expiry is the expiry of the certificates last written, guarded by mu.
+	expiry time.Time
+}
+
+// emitWriter returns the write state of the instance with connection name cn.
+func (d *Dialer) emitWriter(cn string) *emitWrite {
+	d.emitLock.Lock()
+	defer d.emitLock.Unlock()
+	if d.emitWrites == nil {
+		d.emitWrites = make(map[string]*emitWrite)
+	}
+	w, ok := d.emitWrites[cn]
+	if !ok {
+		w = new(emitWrite)
+		d.emitWrites[cn] = w
+	}
+	return w
+}
+
+// emitCertificates rewrites the files of the emitters of the instance with
+// connection name cn with certs, the certificates of a refresh, dropping
+// emitters whose context is done. Writes for an instance are serialized, and
+// certificates that expire before those last written are skipped, so
+// the files end up with those of the latest refresh even if refreshes are
+// emitted out of order.
+func (d *Dialer) emitCertificates(cn string, certs InstanceCertificates) {
+	w := d.emitWriter(cn)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	select {
+	case <-d.done:
+		return
+	default:
+	}
+	if certs.Expiry.Before(w.expiry) {
+		return
+	}
+	d.emitLock.Lock()
+	var live []certEmitter
+	for _, e := range d.emitters[cn] {
+		if e.ctx.Err() == nil {
+			live = append(live, e)
+		}
+	}
+	if len(live) == 0 {
+		delete(d.emitters, cn)
+	} else {
+		d.emitters[cn] = live
+	}
+	d.emitLock.Unlock()
+	if len(live) == 0 {
+		return
+	}
+	w.expiry = certs.Expiry
+	for _, e := range live {
+		if err := writeCertFiles(e.files, certs); err != nil {
+			d.logf(cn, "failed to emit certificates: %v", err)
+		}
+	}
+}
+
+// writeCertFiles writes certs to files.
+func writeCertFiles(files CertFiles, certs InstanceCertificates) error {
+	key, err := x509.MarshalPKCS8PrivateKey(certs.ClientCert.PrivateKey)
+	if err != nil {
+		return fmt.Errorf("failed to encode client certificate's private key: %v", err)
+	}
+	if err := writePEMFile(files.KeyFile, 0600, &pem.Block{Type: "PRIVATE KEY", Bytes: key}); err != nil {
+		return err
+	}
+	var cas []*pem.Block
+	for _, c := range certs.ServerCAs {
+		cas = append(cas, &pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})
+	}
+	if err := writePEMFile(files.CAFile, 0644, cas...); err != nil {
+		return err
+	}
+	var chain []*pem.Block
+	for _, c := range certs.ClientCert.Certificate {
+		chain = append(chain, &pem.Block{Type: "CERTIFICATE", Bytes: c})
+	}
+	return writePEMFile(files.CertFile, 0644, chain...)
+}
+
+// writePEMFile replaces the file at path with blocks. As with writeKey, the
+// blocks are written to a temporary file that is renamed into place.
+func writePEMFile(path string, mode os.FileMode, blocks ...*pem.Block) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create %q: %v", path, err)
+	}
+	defer os.Remove(f.Name())
+	for _, b := range blocks {
+		if err = pem.Encode(f, b); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = f.Chmod(mode)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write %q: %v", path, err)
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("failed to write %q: %v", path, err)
+	}
+	return nil
+}
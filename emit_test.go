@@ -0,0 +1,152 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/cloudsqlconn/internal/mock"
+)
+
+func TestEmitCertificates(t *testing.T) {
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+	svc, cleanup, err := mock.NewSQLAdminService(
+		context.Background(),
+		mock.InstanceGetSuccess(inst, 2),
+		mock.CreateEphemeralSuccess(inst, 2),
+	)
+	if err != nil {
+		t.Fatalf("failed to create test SQL admin service: %s", err)
+	}
+	defer func() {
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	d, err := NewDialer(context.Background(), WithTokenSource(mock.EmptyTokenSource{}))
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	d.sqladmin = svc
+
+	dir, err := ioutil.TempDir("", "certs")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	files := CertFiles{
+		CertFile: filepath.Join(dir, "cert.pem"),
+		KeyFile:  filepath.Join(dir, "key.pem"),
+		CAFile:   filepath.Join(dir, "ca.pem"),
+	}
+	cn := "my-project:my-region:my-instance"
+	if err := d.EmitCertificates(context.Background(), cn, files); err != nil {
+		t.Fatalf("expected EmitCertificates to succeed, but got error: %v", err)
+	}
+
+	certPEM, err := ioutil.ReadFile(files.CertFile)
+	if err != nil {
+		t.Fatalf("failed to read certificate: %v", err)
+	}
+	keyPEM, err := ioutil.ReadFile(files.KeyFile)
+	if err != nil {
+		t.Fatalf("failed to read key: %v", err)
+	}
+	if _, err := tls.X509KeyPair(certPEM, keyPEM); err != nil {
+		t.Fatalf("want a matching certificate and key, got error: %v", err)
+	}
+	if fi, err := os.Stat(files.KeyFile); err != nil {
+		t.Fatalf("failed to stat key: %v", err)
+	} else if runtime.GOOS != "windows" && fi.Mode().Perm() != 0600 {
+		t.Fatalf("key file mode, want = %v, got = %v", os.FileMode(0600), fi.Mode().Perm())
+	}
+	caPEM, err := ioutil.ReadFile(files.CAFile)
+	if err != nil {
+		t.Fatalf("failed to read server CA: %v", err)
+	}
+	block, _ := pem.Decode(caPEM)
+	if block == nil {
+		t.Fatal("want a PEM encoded server CA")
+	}
+	if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+		t.Fatalf("failed to parse server CA: %v", err)
+	}
+
+	// a refresh rewrites the files
+	if err := os.Remove(files.CertFile); err != nil {
+		t.Fatalf("failed to remove certificate: %v", err)
+	}
+	if err := d.ForceRefresh(cn); err != nil {
+		t.Fatalf("ForceRefresh failed: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(files.CertFile); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("want the certificate to be rewritten after a refresh")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	certs, err := d.Certificates(context.Background(), cn)
+	if err != nil {
+		t.Fatalf("Certificates failed: %v", err)
+	}
+	// certificates older than those last written are not written
+	if err := os.Remove(files.CertFile); err != nil {
+		t.Fatalf("failed to remove certificate: %v", err)
+	}
+	stale := certs
+	stale.Expiry = certs.Expiry.Add(-time.Minute)
+	d.emitCertificates(cn, stale)
+	if _, err := os.Stat(files.CertFile); !os.IsNotExist(err) {
+		t.Fatalf("want no write of older certificates, got = %v", err)
+	}
+
+	// writes for the instance wait for one in progress
+	w := d.emitWriter(cn)
+	w.mu.Lock()
+	newer := certs
+	newer.Expiry = certs.Expiry.Add(time.Hour)
+	go d.emitCertificates(cn, newer)
+	time.Sleep(100 * time.Millisecond)
+	if _, err := os.Stat(files.CertFile); !os.IsNotExist(err) {
+		t.Fatalf("want no write while another is in progress, got = %v", err)
+	}
+	w.mu.Unlock()
+	deadline = time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(files.CertFile); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("want the certificate to be rewritten once the write in progress completes")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"fmt"
+
+	"cloud.google.com/go/cloudsqlconn/internal/cloudsql"
+	"cloud.google.com/go/cloudsqlconn/internal/sqladmin"
+)
+
+// adminClient returns the Cloud SQL Admin API client used for the instance
+// with connection name cn.
+//
+// The caller must hold the Dialer's write lock.
+func (d *Dialer) adminClient(cn string) (*sqladmin.Service, error) {
+	project, err := cloudsql.ProjectID(cn)
+	if err != nil {
+		// Leave it to cloudsql.NewInstance to report the invalid name.
+		return d.sqladmin, nil
+	}
+	return d.projectClient(project)
+}
+
+// projectClient returns the Cloud SQL Admin API client used for project.
+// Without an endpoint resolver or credentials for the project, or when the
+// resolver returns an empty string, this is the Dialer's default client.
+// Otherwise, a client is created for the resolved endpoint and the project's
+// credentials on first use and shared by every project with both in common.
+//
+// The caller must hold the Dialer's write lock.
+func (d *Dialer) projectClient(project string) (*sqladmin.Service, error) {
+	ep, key := d.projectClientKey(project)
+	if key == "" {
+		return d.sqladmin, nil
+	}
+	if c, ok := d.endpointClients[key]; ok {
+		return c, nil
+	}
+	creds := d.credentialOpts
+	if ts, ok := d.projectCreds[project]; ok {
+		creds = []sqladmin.Option{sqladmin.WithTokenSource(ts)}
+	}
+	opts := append(append([]sqladmin.Option{}, d.sqladminOpts...), creds...)
+	if ep != "" {
+		opts = append(opts, sqladmin.WithEndpoint(ep))
+	}
+	c, err := sqladmin.NewService(context.Background(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sqladmin client for project %q: %v", project, err)
+	}
+	d.endpointClients[key] = c
+	return c, nil
+}
+
+// cachedProjectClient returns the client used for project, and true, if it is
+// the Dialer's default client or has already been created.
+//
+// The caller must hold the Dialer's lock, for reading at least.
+func (d *Dialer) cachedProjectClient(project string) (*sqladmin.Service, bool) {
+	_, key := d.projectClientKey(project)
+	if key == "" {
+		return d.sqladmin, true
+	}
+	c, ok := d.endpointClients[key]
+	return c, ok
+}
+
+// projectClientKey returns the endpoint resolved for project and the key of
+// its client in endpointClients, which is empty for the default client.
+// Projects with credentials of their own get a client of their own.
+func (d *Dialer) projectClientKey(project string) (ep, key string) {
+	if d.resolveEndpoint != nil {
+		ep = d.resolveEndpoint(project)
+	}
+	if _, ok := d.projectCreds[project]; ok {
+		return ep, ep + " " + project
+	}
+	return ep, ep
+}
@@ -0,0 +1,183 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"cloud.google.com/go/cloudsqlconn/internal/mock"
+	"cloud.google.com/go/cloudsqlconn/internal/sqladmin"
+	"golang.org/x/oauth2"
+)
+
+func TestEndpointResolver(t *testing.T) {
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+	svc, cleanup, err := mock.NewSQLAdminService(
+		context.Background(),
+		mock.InstanceGetSuccess(inst, 1),
+		mock.CreateEphemeralSuccess(inst, 1),
+	)
+	if err != nil {
+		t.Fatalf("failed to create test SQL admin service: %s", err)
+	}
+	stop := mock.StartServerProxy(t, inst)
+	defer func() {
+		stop()
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	// staging records the requests made to a second Admin API endpoint.
+	var (
+		mu    sync.Mutex
+		paths []string
+	)
+	staging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+		http.Error(w, "staging is unavailable", http.StatusServiceUnavailable)
+	}))
+	defer staging.Close()
+
+	d, err := NewDialer(context.Background(),
+		WithTokenSource(mock.EmptyTokenSource{}),
+		WithEndpointResolver(func(project string) string {
+			if strings.HasPrefix(project, "staging-") {
+				return staging.URL + "/"
+			}
+			return ""
+		}),
+	)
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	d.sqladmin = svc
+
+	// Projects resolving to an empty endpoint use the default client.
+	conn, err := d.Dial(context.Background(), "my-project:my-region:my-instance")
+	if err != nil {
+		t.Fatalf("expected Dial to succeed, but got error: %v", err)
+	}
+	conn.Close()
+
+	if _, err := d.Dial(context.Background(), "staging-a:my-region:my-instance"); err == nil {
+		t.Fatal("want Dial through the unavailable staging endpoint to fail")
+	}
+	if _, err := d.Dial(context.Background(), "staging-b:my-region:my-instance"); err == nil {
+		t.Fatal("want Dial through the unavailable staging endpoint to fail")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, project := range []string{"staging-a", "staging-b"} {
+		var found bool
+		for _, p := range paths {
+			if strings.Contains(p, "/projects/"+project+"/") {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("want a request for %v at the staging endpoint, got = %v", project, paths)
+		}
+	}
+	if got := len(d.endpointClients); got != 1 {
+		t.Fatalf("want projects on the same endpoint to share a client, got %v clients", got)
+	}
+}
+
+func TestWithCredentialsForProject(t *testing.T) {
+	tcs := []struct {
+		desc     string
+		resolver bool
+	}{
+		{desc: "with an endpoint resolver", resolver: true},
+		// projects with credentials of their own get a client for the
+		// default endpoint
+		{desc: "without an endpoint resolver", resolver: false},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.desc, func(t *testing.T) {
+			// api records the token each project's requests are
+			// authenticated with.
+			var (
+				mu     sync.Mutex
+				tokens = make(map[string]string)
+			)
+			api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				parts := strings.Split(r.URL.Path, "/")
+				for i, p := range parts {
+					if p == "projects" && i+1 < len(parts) {
+						mu.Lock()
+						tokens[parts[i+1]] = r.Header.Get("Authorization")
+						mu.Unlock()
+					}
+				}
+				http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			}))
+			defer api.Close()
+
+			opts := []DialerOption{
+				WithTokenSource(oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "default"})),
+				WithCredentialsForProject("other-project", oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "other"})),
+			}
+			if tc.resolver {
+				opts = append(opts, WithEndpointResolver(func(string) string { return api.URL + "/" }))
+			}
+			d, err := NewDialer(context.Background(), opts...)
+			if err != nil {
+				t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+			}
+			defer d.Close()
+			if !tc.resolver {
+				// point the default endpoint at the test server
+				d.sqladminOpts = append(d.sqladminOpts, sqladmin.WithEndpoint(api.URL+"/"))
+				d.sqladmin, err = sqladmin.NewService(context.Background(),
+					append(d.sqladminOpts, d.credentialOpts...)...)
+				if err != nil {
+					t.Fatalf("failed to create sqladmin client: %v", err)
+				}
+			}
+
+			for _, cn := range []string{"my-project:my-region:my-instance", "other-project:my-region:my-instance"} {
+				if _, err := d.Dial(context.Background(), cn); err == nil {
+					t.Fatalf("want Dial to %v through the unavailable endpoint to fail", cn)
+				}
+			}
+			if _, err := d.ListInstances(context.Background(), "other-project", nil); err == nil {
+				t.Fatal("want ListInstances through the unavailable endpoint to fail")
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			want := map[string]string{
+				"my-project":    "Bearer default",
+				"other-project": "Bearer other",
+			}
+			for project, w := range want {
+				if got := tokens[project]; got != w {
+					t.Errorf("%v requests authenticated with, want = %q, got = %q", project, w, got)
+				}
+			}
+		})
+	}
+}
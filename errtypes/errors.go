@@ -14,7 +14,28 @@
 
 package errtypes
 
-import "fmt"
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"cloud.google.com/go/cloudsqlconn/internal/sqladmin"
+)
+
+// ErrInstanceNotRunning indicates the Cloud SQL instance is not accepting
+// connections because it is stopped, suspended, under maintenance, or has
+// failed. Use errors.Is to check for it.
+var ErrInstanceNotRunning = errors.New("instance is not running")
+
+// ErrDialerClosed is returned by Dial when the Dialer was closed before or
+// while dialing. Use errors.Is to check for it.
+var ErrDialerClosed = errors.New("dialer is closed")
+
+// ErrStaticCertExpired indicates that the client certificate provided with
+// an instance's static connect info has expired, so connections to the
+// instance are refused until new connect info is provisioned. Use errors.Is
+// to check for it.
+var ErrStaticCertExpired = errors.New("static client certificate has expired")
 
 type genericError struct {
 	Message  string
@@ -39,10 +60,12 @@ type ConfigError struct{ *genericError }
 
 // NewRefreshError initializes a RefreshError.
 func NewRefreshError(msg, cn string, err error) *RefreshError {
-	return &RefreshError{
+	e := &RefreshError{
 		genericError: &genericError{Message: msg, ConnName: cn},
 		Err:          err,
 	}
+	e.Hint = hintFor(e)
+	return e
 }
 
 // RefreshError means that an error occurred during the background
@@ -54,6 +77,9 @@ type RefreshError struct {
 	*genericError
 	// Err is the underlying error and may be nil.
 	Err error
+	// Hint suggests how to fix the error when the Cloud SQL Admin API
+	// rejected the refresh, and is nil otherwise.
+	Hint *Hint
 }
 
 func (e *RefreshError) Error() string {
@@ -65,6 +91,66 @@ func (e *RefreshError) Error() string {
 
 func (e *RefreshError) Unwrap() error { return e.Err }
 
+// apiError returns the Cloud SQL Admin API error that caused the refresh to
+// fail, or nil if it failed for another reason.
+func (e *RefreshError) apiError() *sqladmin.Error {
+	var apiErr *sqladmin.Error
+	if errors.As(e.Err, &apiErr) {
+		return apiErr
+	}
+	return nil
+}
+
+// HTTPStatusCode returns the HTTP status code of the Cloud SQL Admin API
+// response that caused the refresh to fail (e.g., 403 when the caller lacks
+// permission, or 404 when the instance does not exist). It returns 0 if the
+// refresh did not fail because of an API response.
+func (e *RefreshError) HTTPStatusCode() int {
+	if apiErr := e.apiError(); apiErr != nil {
+		return apiErr.Code
+	}
+	return 0
+}
+
+// Reason returns the reason of the Cloud SQL Admin API error that caused the
+// refresh to fail (e.g., accessNotConfigured or notAuthorized), or an empty
+// string if there is none.
+func (e *RefreshError) Reason() string {
+	if apiErr := e.apiError(); apiErr != nil {
+		for _, item := range apiErr.Errors {
+			if item.Reason != "" {
+				return item.Reason
+			}
+		}
+	}
+	return ""
+}
+
+// HelpLinks returns the URLs of any help links included in the Cloud SQL
+// Admin API error that caused the refresh to fail, such as the page for
+// enabling the API.
+func (e *RefreshError) HelpLinks() []string {
+	apiErr := e.apiError()
+	if apiErr == nil {
+		return nil
+	}
+	var links []string
+	for _, d := range apiErr.Details {
+		detail, ok := d.(map[string]interface{})
+		if !ok || detail["@type"] != "type.googleapis.com/google.rpc.Help" {
+			continue
+		}
+		ls, _ := detail["links"].([]interface{})
+		for _, l := range ls {
+			link, _ := l.(map[string]interface{})
+			if url, ok := link["url"].(string); ok {
+				links = append(links, url)
+			}
+		}
+	}
+	return links
+}
+
 // NewDialError initializes a DialError.
 func NewDialError(msg, cn string, err error) *DialError {
 	return &DialError{
@@ -90,3 +176,31 @@ func (e *DialError) Error() string {
 }
 
 func (e *DialError) Unwrap() error { return e.Err }
+
+// NewInitError initializes an InitError.
+func NewInitError(msg string, err error) *InitError {
+	return &InitError{Message: msg, Err: err}
+}
+
+// InitError means that a Dialer could not be created (e.g., because finding
+// credentials took longer than the context passed to NewDialer allowed).
+type InitError struct {
+	Message string
+	// Err is the underlying error and may be nil.
+	Err error
+}
+
+func (e *InitError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("Init error: %v", e.Message)
+	}
+	return fmt.Sprintf("Init error: %v: %v", e.Message, e.Err)
+}
+
+func (e *InitError) Unwrap() error { return e.Err }
+
+// Timeout reports whether the Dialer could not be created because the
+// deadline of the context passed to NewDialer was exceeded.
+func (e *InitError) Timeout() bool {
+	return errors.Is(e.Err, context.DeadlineExceeded)
+}
@@ -16,9 +16,11 @@ package errtypes_test
 
 import (
 	"errors"
+	"fmt"
 	"testing"
 
 	"cloud.google.com/go/cloudsqlconn/errtypes"
+	"cloud.google.com/go/cloudsqlconn/internal/sqladmin"
 )
 
 func TestErrorFormatting(t *testing.T) {
@@ -68,3 +70,39 @@ func TestErrorFormatting(t *testing.T) {
 		}
 	}
 }
+
+func TestRefreshErrorAPIDetails(t *testing.T) {
+	apiErr := &sqladmin.Error{
+		Code:   404,
+		Errors: []sqladmin.ErrorItem{{Reason: "instanceDoesNotExist"}},
+		Details: []interface{}{
+			map[string]interface{}{
+				"@type": "type.googleapis.com/google.rpc.Help",
+				"links": []interface{}{
+					map[string]interface{}{"url": "https://example.com/help"},
+				},
+			},
+		},
+	}
+	err := errtypes.NewRefreshError("msg", "proj:reg:inst", fmt.Errorf("wrapped: %w", apiErr))
+	if got := err.HTTPStatusCode(); got != 404 {
+		t.Errorf("HTTPStatusCode, got = %v, want = 404", got)
+	}
+	if got := err.Reason(); got != "instanceDoesNotExist" {
+		t.Errorf("Reason, got = %q, want = %q", got, "instanceDoesNotExist")
+	}
+	if got := err.HelpLinks(); len(got) != 1 || got[0] != "https://example.com/help" {
+		t.Errorf("HelpLinks, got = %v, want = [https://example.com/help]", got)
+	}
+
+	err = errtypes.NewRefreshError("msg", "proj:reg:inst", errors.New("inner-error"))
+	if got := err.HTTPStatusCode(); got != 0 {
+		t.Errorf("HTTPStatusCode without API error, got = %v, want = 0", got)
+	}
+	if got := err.Reason(); got != "" {
+		t.Errorf("Reason without API error, got = %q, want empty", got)
+	}
+	if got := err.HelpLinks(); got != nil {
+		t.Errorf("HelpLinks without API error, got = %v, want nil", got)
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errtypes
+
+import "net/http"
+
+// The actions that a Hint may suggest.
+const (
+	// ActionGrantClientRole suggests granting the Cloud SQL Client role
+	// (roles/cloudsql.client), which includes the cloudsql.instances.get and
+	// cloudsql.instances.connect permissions, to the caller.
+	ActionGrantClientRole = "grant_client_role"
+	// ActionEnableAdminAPI suggests enabling the Cloud SQL Admin API
+	// (sqladmin.googleapis.com) in the instance's project.
+	ActionEnableAdminAPI = "enable_admin_api"
+	// ActionRefreshCredentials suggests replacing credentials that have
+	// expired or been revoked.
+	ActionRefreshCredentials = "refresh_credentials"
+	// ActionCheckConnectionName suggests checking that the instance
+	// connection name refers to an existing instance.
+	ActionCheckConnectionName = "check_connection_name"
+)
+
+// Hint is a suggested fix for an error, structured so that a UI can render
+// it as a guided fix.
+type Hint struct {
+	// Action identifies the fix, e.g., ActionGrantClientRole.
+	Action string
+	// Message describes the fix.
+	Message string
+	// Links are URLs with more information, as provided by the Cloud SQL
+	// Admin API.
+	Links []string
+}
+
+// hintFor returns the Hint for a refresh that failed with e, or nil if there
+// is none.
+func hintFor(e *RefreshError) *Hint {
+	apiErr := e.apiError()
+	if apiErr == nil {
+		return nil
+	}
+	h := &Hint{Links: e.HelpLinks()}
+	switch reason := e.Reason(); {
+	case reason == "accessNotConfigured" || reason == "SERVICE_DISABLED":
+		h.Action = ActionEnableAdminAPI
+		h.Message = "enable the Cloud SQL Admin API (sqladmin.googleapis.com) in the instance's project, " +
+			"then wait a few minutes for it to take effect"
+	case apiErr.Code == http.StatusUnauthorized:
+		h.Action = ActionRefreshCredentials
+		h.Message = "the credentials were rejected, check that they have not expired or been revoked"
+	case apiErr.Code == http.StatusForbidden:
+		h.Action = ActionGrantClientRole
+		h.Message = "grant the Cloud SQL Client role (roles/cloudsql.client) to the caller " +
+			"on the instance's project"
+	case apiErr.Code == http.StatusNotFound:
+		h.Action = ActionCheckConnectionName
+		h.Message = "check that the instance connection name refers to an existing instance"
+	default:
+		return nil
+	}
+	return h
+}
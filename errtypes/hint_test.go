@@ -0,0 +1,87 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errtypes_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"cloud.google.com/go/cloudsqlconn/errtypes"
+	"cloud.google.com/go/cloudsqlconn/internal/sqladmin"
+)
+
+func TestRefreshErrorHint(t *testing.T) {
+	tcs := []struct {
+		desc string
+		err  error
+		want string
+	}{
+		{
+			desc: "API not enabled",
+			err: &sqladmin.Error{
+				Code:   403,
+				Errors: []sqladmin.ErrorItem{{Reason: "accessNotConfigured"}},
+			},
+			want: errtypes.ActionEnableAdminAPI,
+		},
+		{
+			desc: "missing permission",
+			err: &sqladmin.Error{
+				Code:   403,
+				Errors: []sqladmin.ErrorItem{{Reason: "notAuthorized"}},
+			},
+			want: errtypes.ActionGrantClientRole,
+		},
+		{
+			desc: "invalid credentials",
+			err:  &sqladmin.Error{Code: 401},
+			want: errtypes.ActionRefreshCredentials,
+		},
+		{
+			desc: "instance does not exist",
+			err: &sqladmin.Error{
+				Code:   404,
+				Errors: []sqladmin.ErrorItem{{Reason: "instanceDoesNotExist"}},
+			},
+			want: errtypes.ActionCheckConnectionName,
+		},
+		{
+			desc: "server error",
+			err:  &sqladmin.Error{Code: 503},
+		},
+		{
+			desc: "not an API error",
+			err:  errors.New("inner-error"),
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.desc, func(t *testing.T) {
+			err := errtypes.NewRefreshError("msg", "proj:reg:inst", fmt.Errorf("wrapped: %w", tc.err))
+			if tc.want == "" {
+				if err.Hint != nil {
+					t.Fatalf("want no hint, got = %+v", err.Hint)
+				}
+				return
+			}
+			if err.Hint == nil || err.Hint.Action != tc.want {
+				t.Fatalf("hint, want action = %v, got = %+v", tc.want, err.Hint)
+			}
+			if err.Hint.Message == "" {
+				t.Fatal("want the hint to have a message")
+			}
+		})
+	}
+}
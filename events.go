@@ -0,0 +1,209 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	"cloud.google.com/go/cloudsqlconn/internal/cloudsql"
+)
+
+// EventKind identifies what an Event reports.
+type EventKind int
+
+const (
+	// RefreshSucceeded reports that a refresh of an instance's connection
+	// info succeeded.
+	RefreshSucceeded EventKind = iota + 1
+	// RefreshFailed reports that a refresh of an instance's connection info
+	// failed. Connections may still be made with a previous result until
+	// it expires.
+	RefreshFailed
+	// CertNearExpiry reports that the client certificate used to connect to
+	// an instance expires within 10 minutes, which usually means that
+	// refreshes have been failing.
+	CertNearExpiry
+	// InstanceEvicted reports that the Dialer stopped refreshing an
+	// instance and discarded its connection info, which happens to every
+	// instance when the Dialer is closed.
+	InstanceEvicted
+	// DNSTargetChanged reports that a domain name resolves to different
+	// instance connection names than it did before.
+	DNSTargetChanged
+)
+
+// String returns the name of the event kind, e.g., "RefreshFailed".
+func (k EventKind) String() string {
+	switch k {
+	case RefreshSucceeded:
+		return "RefreshSucceeded"
+	case RefreshFailed:
+		return "RefreshFailed"
+	case CertNearExpiry:
+		return "CertNearExpiry"
+	case InstanceEvicted:
+		return "InstanceEvicted"
+	case DNSTargetChanged:
+		return "DNSTargetChanged"
+	}
+	return "EventKind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// Event is a change in the health of a Dialer's instances, as sent on the
+// channel returned by Events.
+type Event struct {
+	Kind EventKind
+	// Instance is the instance connection name, or, for DNSTargetChanged,
+	// the domain name.
+	Instance string
+	// Time is when the event occurred.
+	Time time.Time
+	// Err is the error of a RefreshFailed event.
+	Err error
+	// Expiry is when the client certificate expires, for RefreshSucceeded
+	// and CertNearExpiry events.
+	Expiry time.Time
+	// Targets and OldTargets are the instance connection names that the
+	// domain name of a DNSTargetChanged event resolves to now and resolved
+	// to before.
+	Targets, OldTargets []string
+}
+
+// eventBufferSize is the capacity of the channel returned by Events.
+const eventBufferSize = 64
+
+// certNearExpiry is how long before the client certificate expires that
+// CertNearExpiry is reported.
+const certNearExpiry = 10 * time.Minute
+
+// Events returns a channel on which the Dialer reports changes in the health
+// of its instances, e.g., so that an application can stop taking traffic
+// while its connection info can't be refreshed. Every call returns the same
+// channel, and only events that occur after the first call are reported. The
+// channel is buffered; events are dropped rather than delay the Dialer when it
+// is full, so it should be drained promptly. It is closed when the Dialer is
+// closed, after an InstanceEvicted event for each instance.
+func (d *Dialer) Events() <-chan Event {
+	d.eventsLock.Lock()
+	defer d.eventsLock.Unlock()
+	if d.events == nil {
+		d.events = make(chan Event, eventBufferSize)
+		if d.eventsClosed {
+			close(d.events)
+		}
+	}
+	return d.events
+}
+
+// sendEvent sends e on the events channel unless nobody has asked for events
+// or the channel is full. d.eventsLock must be held.
+func (d *Dialer) sendEvent(e Event) {
+	if d.events == nil || d.eventsClosed {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = d.clock.Now()
+	}
+	select {
+	case d.events <- e:
+	default:
+	}
+}
+
+// listening reports whether anybody has asked for events.
+func (d *Dialer) listening() bool {
+	d.eventsLock.Lock()
+	defer d.eventsLock.Unlock()
+	return d.events != nil && !d.eventsClosed
+}
+
+// reportRefresh reports the completed refresh of the instance with connection
+// name cn, and whether the certificate its connections use is near expiry.
+func (d *Dialer) reportRefresh(cn string, e cloudsql.RefreshEvent) {
+	if !d.listening() {
+		return
+	}
+	expiry := e.Expiry
+	if e.Err != nil {
+		// connections use the previous result while it is valid
+		expiry = time.Time{}
+		d.lock.RLock()
+		i, ok := d.instances[cn]
+		d.lock.RUnlock()
+		if ok {
+			expiry = i.Status().Expiry
+		}
+	}
+	now := d.clock.Now()
+	d.eventsLock.Lock()
+	defer d.eventsLock.Unlock()
+	if e.Err != nil {
+		d.sendEvent(Event{Kind: RefreshFailed, Instance: cn, Time: now, Err: e.Err})
+	} else {
+		d.sendEvent(Event{Kind: RefreshSucceeded, Instance: cn, Time: now, Expiry: e.Expiry})
+	}
+	if expiry.IsZero() || expiry.Sub(now) >= certNearExpiry || d.nearExpiry[cn].Equal(expiry) {
+		return
+	}
+	// report each certificate once, however many refreshes fail
+	if d.nearExpiry == nil {
+		d.nearExpiry = make(map[string]time.Time)
+	}
+	d.nearExpiry[cn] = expiry
+	d.sendEvent(Event{Kind: CertNearExpiry, Instance: cn, Time: now, Expiry: expiry})
+}
+
+// reportDNSTargets reports if the domain name name resolved to instance
+// connection names cns differs from the last time it was resolved.
+func (d *Dialer) reportDNSTargets(name string, cns []string) {
+	d.eventsLock.Lock()
+	defer d.eventsLock.Unlock()
+	if d.events == nil || d.eventsClosed {
+		return
+	}
+	targets := append([]string(nil), cns...)
+	sort.Strings(targets)
+	old, ok := d.dnsTargets[name]
+	if d.dnsTargets == nil {
+		d.dnsTargets = make(map[string][]string)
+	}
+	d.dnsTargets[name] = targets
+	if !ok || reflect.DeepEqual(old, targets) {
+		return
+	}
+	d.sendEvent(Event{Kind: DNSTargetChanged, Instance: name, Targets: targets, OldTargets: old})
+}
+
+// closeEvents reports that every instance was evicted and closes the events
+// channel. d.lock must be held.
+func (d *Dialer) closeEvents() {
+	d.eventsLock.Lock()
+	defer d.eventsLock.Unlock()
+	cns := make([]string, 0, len(d.instances))
+	for cn := range d.instances {
+		cns = append(cns, cn)
+	}
+	sort.Strings(cns)
+	for _, cn := range cns {
+		d.sendEvent(Event{Kind: InstanceEvicted, Instance: cn})
+	}
+	d.eventsClosed = true
+	if d.events != nil {
+		close(d.events)
+	}
+}
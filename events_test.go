@@ -0,0 +1,133 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/cloudsqlconn/internal/mock"
+)
+
+func TestEvents(t *testing.T) {
+	// the mock only answers the first refresh
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance",
+		mock.WithCertExpiry(time.Now().Add(5*time.Minute)),
+	)
+	svc, cleanup, err := mock.NewSQLAdminService(
+		context.Background(),
+		mock.InstanceGetSuccess(inst, 1),
+		mock.CreateEphemeralSuccess(inst, 1),
+	)
+	if err != nil {
+		t.Fatalf("failed to create test SQL admin service: %s", err)
+	}
+	stop := mock.StartServerProxy(t, inst)
+	defer func() {
+		stop()
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	d, err := NewDialer(context.Background(), WithTokenSource(mock.EmptyTokenSource{}))
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	d.sqladmin = svc
+	events := d.Events()
+	if d.Events() != events {
+		t.Fatal("want Events to return the same channel")
+	}
+
+	conn, err := d.Dial(context.Background(), "my-project:my-region:my-instance")
+	if err != nil {
+		t.Fatalf("expected Dial to succeed, but got error: %v", err)
+	}
+	conn.Close()
+	if err := d.ForceRefresh("my-project:my-region:my-instance"); err != nil {
+		t.Fatalf("ForceRefresh failed: %v", err)
+	}
+
+	var got []EventKind
+	timeout := time.After(10 * time.Second)
+	for len(got) == 0 || got[len(got)-1] != RefreshFailed {
+		select {
+		case e := <-events:
+			if e.Instance != "my-project:my-region:my-instance" {
+				t.Fatalf("want event for my-project:my-region:my-instance, got = %+v", e)
+			}
+			if e.Kind == RefreshFailed && e.Err == nil {
+				t.Fatalf("want RefreshFailed to have an error, got = %+v", e)
+			}
+			got = append(got, e.Kind)
+		case <-timeout:
+			t.Fatalf("timed out waiting for a failed refresh, got = %v", got)
+		}
+	}
+	if want := []EventKind{RefreshSucceeded, CertNearExpiry, RefreshFailed}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("want = %v, got = %v", want, got)
+	}
+
+	d.Close()
+	var last Event
+	for e := range events {
+		if e.Kind == CertNearExpiry {
+			t.Fatalf("want CertNearExpiry reported once, got = %+v", e)
+		}
+		last = e
+	}
+	if last.Kind != InstanceEvicted || last.Instance != "my-project:my-region:my-instance" {
+		t.Fatalf("want the instance evicted on Close, got = %+v", last)
+	}
+}
+
+func TestEventsDNSTargetChanged(t *testing.T) {
+	recs := map[string][]string{"orders.db.example.com.": {"p:r:orders"}}
+	d := &Dialer{dialerState: &dialerState{
+		clock:       realClock{},
+		dnsSuffixes: []string{".db.example.com"},
+		lookupTXT:   fakeTXT(recs),
+	}}
+	events := d.Events()
+	resolve := func() {
+		if _, err := d.resolveDNS(context.Background(), "orders"); err != nil {
+			t.Fatalf("resolveDNS failed: %v", err)
+		}
+	}
+
+	resolve()
+	resolve()
+	recs["orders.db.example.com."] = []string{"p:r:orders-replica"}
+	resolve()
+
+	select {
+	case e := <-events:
+		if e.Kind != DNSTargetChanged || e.Instance != "orders" ||
+			!reflect.DeepEqual(e.OldTargets, []string{"p:r:orders"}) ||
+			!reflect.DeepEqual(e.Targets, []string{"p:r:orders-replica"}) {
+			t.Fatalf("want the change from p:r:orders to p:r:orders-replica, got = %+v", e)
+		}
+	default:
+		t.Fatal("want a DNSTargetChanged event")
+	}
+	select {
+	case e := <-events:
+		t.Fatalf("want a single event, got = %+v", e)
+	default:
+	}
+}
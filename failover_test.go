@@ -0,0 +1,130 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd || solaris || illumos
+// +build linux darwin dragonfly freebsd netbsd openbsd solaris illumos
+
+package cloudsqlconn
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"reflect"
+	"sync"
+	"syscall"
+	"testing"
+
+	"cloud.google.com/go/cloudsqlconn/internal/mock"
+)
+
+func TestAddrUnreachable(t *testing.T) {
+	tcs := []struct {
+		desc string
+		err  error
+		want bool
+	}{
+		{
+			desc: "connection refused",
+			err:  &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)},
+			want: true,
+		},
+		{
+			desc: "no route to host",
+			err:  &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.EHOSTUNREACH)},
+			want: true,
+		},
+		{
+			desc: "network unreachable",
+			err:  &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ENETUNREACH)},
+			want: true,
+		},
+		{
+			desc: "timeout",
+			err:  &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ETIMEDOUT)},
+		},
+		{
+			desc: "other error",
+			err:  errors.New("connection refused"),
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.desc, func(t *testing.T) {
+			if got := addrUnreachable(tc.err); got != tc.want {
+				t.Fatalf("addrUnreachable(%v), want = %v, got = %v", tc.err, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestDialRetriesAfterFailover(t *testing.T) {
+	// before has the address the instance had before a failover, where
+	// connections are refused.
+	before := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance",
+		mock.WithPublicIP("10.0.0.1"))
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+	svc, cleanup, err := mock.NewSQLAdminService(
+		context.Background(),
+		mock.InstanceGetSuccess(before, 1),
+		mock.InstanceGetSuccess(inst, 1),
+		mock.CreateEphemeralSuccess(inst, 2),
+	)
+	if err != nil {
+		t.Fatalf("failed to create test SQL admin service: %s", err)
+	}
+	stop := mock.StartServerProxy(t, inst)
+	defer func() {
+		stop()
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	var (
+		mu     sync.Mutex
+		dialed []string
+	)
+	d, err := NewDialer(context.Background(),
+		WithTokenSource(mock.EmptyTokenSource{}),
+		WithDialFunc(func(ctx context.Context, network, addr string) (net.Conn, error) {
+			mu.Lock()
+			dialed = append(dialed, addr)
+			mu.Unlock()
+			if host, _, _ := net.SplitHostPort(addr); host == "10.0.0.1" {
+				return nil, &net.OpError{Op: "dial", Net: network,
+					Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}
+			}
+			var dl net.Dialer
+			return dl.DialContext(ctx, network, addr)
+		}),
+	)
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	d.sqladmin = svc
+
+	conn, err := d.Dial(context.Background(), "my-project:my-region:my-instance")
+	if err != nil {
+		t.Fatalf("expected Dial to succeed at the instance's new address, but got error: %v", err)
+	}
+	conn.Close()
+	want := []string{"10.0.0.1:3307", "0.0.0.0:3307"}
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(dialed, want) {
+		t.Fatalf("dialed addresses, want = %v, got = %v", want, dialed)
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// fallbackDelay is how long a dial attempt is given before an attempt to the
+// next candidate address is started in parallel. It matches the default of the
+// net package's Happy Eyeballs implementation.
+const fallbackDelay = 300 * time.Millisecond
+
+// dialFunc connects to addr on the named network.
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// dialParallel connects with dial to the first of addrs that accepts a
+// connection, in the style of Happy Eyeballs (RFC 8305). Attempts start in
+// order, each delay after the previous one or as soon as the previous one
+// fails. The connection and the address it was made to are returned. If every
+// attempt fails, the error of the first attempt is returned.
+func dialParallel(ctx context.Context, dial dialFunc, addrs []string, delay time.Duration) (net.Conn, string, error) {
+	if len(addrs) == 1 {
+		conn, err := dial(ctx, "tcp", addrs[0])
+		return conn, addrs[0], err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type dialResult struct {
+		conn net.Conn
+		addr string
+		err  error
+	}
+	results := make(chan dialResult)
+	start := func(addr string) {
+		go func() {
+			conn, err := dial(ctx, "tcp", addr)
+			select {
+			case results <- dialResult{conn: conn, addr: addr, err: err}:
+			case <-ctx.Done():
+				if conn != nil {
+					conn.Close()
+				}
+			}
+		}()
+	}
+
+	start(addrs[0])
+	next, pending := 1, 1
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	var firstErr error
+	for pending > 0 || next < len(addrs) {
+		select {
+		case <-timer.C:
+			if next < len(addrs) {
+				start(addrs[next])
+				next++
+				pending++
+				timer.Reset(delay)
+			}
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				return r.conn, r.addr, nil
+			}
+			if firstErr == nil {
+				firstErr = r.err
+			}
+			// don't wait out the delay once an attempt has failed
+			if next < len(addrs) {
+				start(addrs[next])
+				next++
+				pending++
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				timer.Reset(delay)
+			}
+		}
+	}
+	return nil, "", firstErr
+}
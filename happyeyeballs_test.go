@@ -0,0 +1,70 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+// closedAddr returns an address that refuses connections.
+func closedAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to start listener: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	return addr
+}
+
+func TestDialParallel(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to start listener: %v", err)
+	}
+	defer ln.Close()
+	open := ln.Addr().String()
+	closed := closedAddr(t)
+
+	conn, addr, err := dialParallel(context.Background(), (&net.Dialer{}).DialContext, []string{open, closed}, time.Hour)
+	if err != nil {
+		t.Fatalf("dialParallel failed: %v", err)
+	}
+	conn.Close()
+	if addr != open {
+		t.Fatalf("want first address to win, want = %v, got = %v", open, addr)
+	}
+
+	// A failed attempt starts the next one without waiting out the delay.
+	start := time.Now()
+	conn, addr, err = dialParallel(context.Background(), (&net.Dialer{}).DialContext, []string{closed, open}, time.Hour)
+	if err != nil {
+		t.Fatalf("dialParallel failed: %v", err)
+	}
+	conn.Close()
+	if addr != open {
+		t.Fatalf("want fallback address to win, want = %v, got = %v", open, addr)
+	}
+	if time.Since(start) > time.Minute {
+		t.Fatal("fallback attempt waited for the delay after a failure")
+	}
+
+	if _, _, err := dialParallel(context.Background(), (&net.Dialer{}).DialContext, []string{closed, closed}, time.Millisecond); err == nil {
+		t.Fatal("want dialParallel to fail when every attempt fails")
+	}
+}
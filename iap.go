@@ -0,0 +1,282 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/cloudsqlconn/internal/sqladmin"
+	"golang.org/x/net/websocket"
+	"golang.org/x/oauth2"
+)
+
+// iapTunnelURL is the endpoint of the IAP TCP forwarding service.
+var iapTunnelURL = "wss://tunnel.cloudproxy.app/v4/connect"
+
+const (
+	// iapSubprotocol is the WebSocket subprotocol spoken by the IAP TCP
+	// forwarding service.
+	iapSubprotocol = "relay.tunnel.cloudproxy.app"
+	// iapOrigin is the origin the IAP TCP forwarding service expects from
+	// clients that are not browsers.
+	iapOrigin = "bot:iap-tunneler"
+	// iapMaxDataFrame is the largest payload of a single data frame.
+	iapMaxDataFrame = 16 * 1024
+
+	// Tags of the frames of the subprotocol.
+	iapTagConnectSuccessSID   = 0x0001
+	iapTagReconnectSuccessAck = 0x0002
+	iapTagData                = 0x0004
+	iapTagAck                 = 0x0007
+)
+
+// iapTarget is a Compute Engine VM port to tunnel to through IAP.
+type iapTarget struct {
+	project, zone, vm string
+	port              int
+}
+
+// WithIAPTunnel returns a DialOption that connects to the instance through an
+// Identity-Aware Proxy TCP forwarding tunnel to port on the Compute Engine VM
+// vm in project and zone, for networks where IAP is the only ingress. The VM
+// must forward the port to port 3307 of one of the instance's IP addresses,
+// e.g., with a TCP proxy. The connection is still secured end to end with the
+// Dialer's ephemeral certificate, so the tunnel and the VM only see encrypted
+// traffic. The tunnel is authenticated with the Dialer's credentials, which
+// need the IAP-secured Tunnel User role on the VM. Any IP type DialOption is
+// ignored, or rejected with WithStrictDialOptions.
+func WithIAPTunnel(project, zone, vm string, port int) DialOption {
+	return func(cfg *dialCfg) {
+		cfg.iapTarget = &iapTarget{project: project, zone: zone, vm: vm, port: port}
+	}
+}
+
+// iapTokenSource returns the token source used to authenticate IAP tunnels,
+// which is derived from the Dialer's credentials on first use.
+func (d *Dialer) iapTokenSource(ctx context.Context) (oauth2.TokenSource, error) {
+	d.lock.RLock()
+	ts := d.iapTokens
+	opts := append(append([]sqladmin.Option{}, d.sqladminOpts...), d.credentialOpts...)
+	d.lock.RUnlock()
+	if ts != nil {
+		return ts, nil
+	}
+	src, err := sqladmin.TokenSource(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	ts = oauth2.ReuseTokenSource(nil, src)
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.iapTokens == nil {
+		d.iapTokens = ts
+	}
+	return d.iapTokens, nil
+}
+
+// dialIAP opens a tunnel to t and returns it once the IAP service has
+// connected it to the VM.
+func (d *Dialer) dialIAP(ctx context.Context, t *iapTarget) (net.Conn, error) {
+	ts, err := d.iapTokenSource(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get IAP credentials: %v", err)
+	}
+	tok, err := ts.Token()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get IAP token: %v", err)
+	}
+
+	q := url.Values{}
+	q.Set("project", t.project)
+	q.Set("zone", t.zone)
+	q.Set("instance", t.vm)
+	q.Set("interface", "nic0")
+	q.Set("port", strconv.Itoa(t.port))
+	q.Set("newWebsocket", "true")
+	cfg, err := websocket.NewConfig(iapTunnelURL+"?"+q.Encode(), "http://localhost")
+	if err != nil {
+		return nil, err
+	}
+	// the IAP service expects the origin verbatim, which is not a valid URL
+	cfg.Origin = &url.URL{Opaque: iapOrigin}
+	cfg.Protocol = []string{iapSubprotocol}
+	cfg.Header = http.Header{}
+	cfg.Header.Set("Authorization", tok.Type()+" "+tok.AccessToken)
+	cfg.Header.Set("User-Agent", d.userAgent)
+
+	host := cfg.Location.Host
+	if cfg.Location.Port() == "" {
+		port := "443"
+		if cfg.Location.Scheme == "ws" {
+			port = "80"
+		}
+		host = net.JoinHostPort(cfg.Location.Hostname(), port)
+	}
+	conn, err := d.netDial(ctx, "tcp", host)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Location.Scheme == "wss" {
+		tc := tls.Client(conn, &tls.Config{ServerName: cfg.Location.Hostname()})
+		conn = tc
+	}
+	// the WebSocket and tunnel handshakes don't take a context
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	stop := closeOnCancel(ctx, conn)
+	ws, err := websocket.NewClient(cfg, conn)
+	if err == nil {
+		err = readConnectSuccess(ws)
+	}
+	stop()
+	if err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("failed to open IAP tunnel: %v", err)
+	}
+	conn.SetDeadline(time.Time{})
+	return &iapConn{ws: ws}, nil
+}
+
+// closeOnCancel closes conn if ctx is done before the returned func is
+// called.
+func closeOnCancel(ctx context.Context, conn net.Conn) func() {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
+
+// errIAPFrame is returned when the IAP service sends a malformed frame.
+var errIAPFrame = errors.New("malformed IAP tunnel frame")
+
+// readConnectSuccess reads frames from ws until the IAP service reports that
+// the tunnel is connected.
+func readConnectSuccess(ws *websocket.Conn) error {
+	for {
+		var msg []byte
+		if err := websocket.Message.Receive(ws, &msg); err != nil {
+			return err
+		}
+		if len(msg) < 2 {
+			return errIAPFrame
+		}
+		if binary.BigEndian.Uint16(msg) == iapTagConnectSuccessSID {
+			return nil
+		}
+	}
+}
+
+// iapConn is a connection through an IAP tunnel. Data is carried in data
+// frames, and received data is acknowledged with ack frames.
+type iapConn struct {
+	ws *websocket.Conn
+
+	// readMu guards the fields below and serializes reads.
+	readMu sync.Mutex
+	// buf holds received data that has not been read yet.
+	buf []byte
+	// received and acked are the number of bytes received and the number
+	// acknowledged to the IAP service.
+	received, acked uint64
+}
+
+func (c *iapConn) Read(b []byte) (int, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+	for len(c.buf) == 0 {
+		var msg []byte
+		if err := websocket.Message.Receive(c.ws, &msg); err != nil {
+			return 0, err
+		}
+		if len(msg) < 2 {
+			return 0, errIAPFrame
+		}
+		if binary.BigEndian.Uint16(msg) != iapTagData {
+			// acks and session frames need no response
+			continue
+		}
+		if len(msg) < 6 || uint32(len(msg)-6) < binary.BigEndian.Uint32(msg[2:]) {
+			return 0, errIAPFrame
+		}
+		c.buf = msg[6 : 6+binary.BigEndian.Uint32(msg[2:])]
+		c.received += uint64(len(c.buf))
+		if c.received-c.acked > 2*iapMaxDataFrame {
+			if err := c.ack(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	n := copy(b, c.buf)
+	c.buf = c.buf[n:]
+	return n, nil
+}
+
+// ack acknowledges the data received so far. The caller must hold readMu.
+func (c *iapConn) ack() error {
+	frame := make([]byte, 10)
+	binary.BigEndian.PutUint16(frame, iapTagAck)
+	binary.BigEndian.PutUint64(frame[2:], c.received)
+	if err := websocket.Message.Send(c.ws, frame); err != nil {
+		return err
+	}
+	c.acked = c.received
+	return nil
+}
+
+func (c *iapConn) Write(b []byte) (int, error) {
+	var n int
+	for len(b) > 0 {
+		size := len(b)
+		if size > iapMaxDataFrame {
+			size = iapMaxDataFrame
+		}
+		frame := make([]byte, 6+size)
+		binary.BigEndian.PutUint16(frame, iapTagData)
+		binary.BigEndian.PutUint32(frame[2:], uint32(size))
+		copy(frame[6:], b[:size])
+		if err := websocket.Message.Send(c.ws, frame); err != nil {
+			return n, err
+		}
+		n += size
+		b = b[size:]
+	}
+	return n, nil
+}
+
+func (c *iapConn) Close() error                       { return c.ws.Close() }
+func (c *iapConn) LocalAddr() net.Addr                { return c.ws.LocalAddr() }
+func (c *iapConn) RemoteAddr() net.Addr               { return c.ws.RemoteAddr() }
+func (c *iapConn) SetDeadline(t time.Time) error      { return c.ws.SetDeadline(t) }
+func (c *iapConn) SetReadDeadline(t time.Time) error  { return c.ws.SetReadDeadline(t) }
+func (c *iapConn) SetWriteDeadline(t time.Time) error { return c.ws.SetWriteDeadline(t) }
@@ -0,0 +1,232 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/cloudsqlconn/errtypes"
+	"cloud.google.com/go/cloudsqlconn/internal/mock"
+	"golang.org/x/net/websocket"
+	"golang.org/x/oauth2"
+)
+
+// startFakeIAP starts a fake IAP TCP forwarding service that relays tunnels
+// to the fake server proxy and points the Dialer at it.
+func startFakeIAP(t *testing.T) func() {
+	srv := httptest.NewServer(websocket.Server{
+		Handshake: func(cfg *websocket.Config, r *http.Request) error {
+			q := r.URL.Query()
+			if r.Header.Get("Authorization") != "Bearer iap-token" ||
+				r.Header.Get("Origin") != iapOrigin ||
+				q.Get("project") != "vm-project" || q.Get("zone") != "vm-zone" ||
+				q.Get("instance") != "my-vm" || q.Get("port") != "3307" {
+				return errors.New("unexpected tunnel request")
+			}
+			cfg.Protocol = []string{iapSubprotocol}
+			return nil
+		},
+		Handler: func(ws *websocket.Conn) {
+			defer ws.Close()
+			backend, err := net.Dial("tcp", "localhost:3307")
+			if err != nil {
+				return
+			}
+			defer backend.Close()
+			frame := []byte{0, iapTagConnectSuccessSID, 0, 0, 0, 3, 's', 'i', 'd'}
+			if err := websocket.Message.Send(ws, frame); err != nil {
+				return
+			}
+			go func() {
+				defer backend.Close()
+				for {
+					var msg []byte
+					if err := websocket.Message.Receive(ws, &msg); err != nil {
+						return
+					}
+					if binary.BigEndian.Uint16(msg) == iapTagData {
+						backend.Write(msg[6:])
+					}
+				}
+			}()
+			buf := make([]byte, 4096)
+			for {
+				n, err := backend.Read(buf)
+				if n > 0 {
+					frame := make([]byte, 6+n)
+					binary.BigEndian.PutUint16(frame, iapTagData)
+					binary.BigEndian.PutUint32(frame[2:], uint32(n))
+					copy(frame[6:], buf[:n])
+					if err := websocket.Message.Send(ws, frame); err != nil {
+						return
+					}
+				}
+				if err != nil {
+					return
+				}
+			}
+		},
+	})
+	prev := iapTunnelURL
+	iapTunnelURL = "ws" + strings.TrimPrefix(srv.URL, "http") + "/v4/connect"
+	return func() {
+		iapTunnelURL = prev
+		srv.Close()
+	}
+}
+
+func TestDialerWithIAPTunnel(t *testing.T) {
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+	svc, cleanup, err := mock.NewSQLAdminService(
+		context.Background(),
+		mock.InstanceGetSuccess(inst, 1),
+		mock.CreateEphemeralSuccess(inst, 1),
+	)
+	if err != nil {
+		t.Fatalf("failed to create SQL Admin service: %v", err)
+	}
+	stop := mock.StartServerProxy(t, inst)
+	stopIAP := startFakeIAP(t)
+	defer func() {
+		stopIAP()
+		stop()
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	d, err := NewDialer(context.Background(),
+		WithTokenSource(oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "iap-token"})),
+	)
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	d.sqladmin = svc
+
+	// the instance only has a public IP, which the IP type must not exclude
+	conn, err := d.Dial(context.Background(), "my-project:my-region:my-instance",
+		WithPrivateIP(), WithIAPTunnel("vm-project", "vm-zone", "my-vm", 3307))
+	if err != nil {
+		t.Fatalf("expected Dial to succeed, but got error: %v", err)
+	}
+	defer conn.Close()
+	data, err := ioutil.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("expected ReadAll to succeed, got error %v", err)
+	}
+	if string(data) != "my-instance" {
+		t.Fatalf("expected known response from the server, but got %v", string(data))
+	}
+}
+
+func TestDialerWithIAPTunnelRejected(t *testing.T) {
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+	svc, cleanup, err := mock.NewSQLAdminService(
+		context.Background(),
+		mock.InstanceGetSuccess(inst, 1),
+		mock.CreateEphemeralSuccess(inst, 1),
+	)
+	if err != nil {
+		t.Fatalf("failed to create SQL Admin service: %v", err)
+	}
+	stopIAP := startFakeIAP(t)
+	defer func() {
+		stopIAP()
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	d, err := NewDialer(context.Background(),
+		WithTokenSource(oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "wrong-token"})),
+	)
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	d.sqladmin = svc
+
+	_, err = d.Dial(context.Background(), "my-project:my-region:my-instance",
+		WithIAPTunnel("vm-project", "vm-zone", "my-vm", 3307))
+	var wantErr *errtypes.DialError
+	if !errors.As(err, &wantErr) {
+		t.Fatalf("when the tunnel is rejected, want = %T, got = %v", wantErr, err)
+	}
+}
+
+func TestIAPConnFraming(t *testing.T) {
+	acks := make(chan uint64, 10)
+	srv := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		defer ws.Close()
+		for {
+			var msg []byte
+			if err := websocket.Message.Receive(ws, &msg); err != nil {
+				return
+			}
+			switch binary.BigEndian.Uint16(msg) {
+			case iapTagAck:
+				acks <- binary.BigEndian.Uint64(msg[2:])
+			case iapTagData:
+				if len(msg)-6 > iapMaxDataFrame {
+					t.Errorf("data frame too large, got = %v bytes", len(msg)-6)
+				}
+				// echo the data frame
+				if err := websocket.Message.Send(ws, msg); err != nil {
+					return
+				}
+			}
+		}
+	}))
+	defer srv.Close()
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), "", "http://localhost")
+	if err != nil {
+		t.Fatalf("websocket.Dial failed: %v", err)
+	}
+	conn := &iapConn{ws: ws}
+	defer conn.Close()
+
+	want := make([]byte, 3*iapMaxDataFrame+1)
+	for i := range want {
+		want[i] = byte(i)
+	}
+	go conn.Write(want)
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(conn, got); err != nil {
+		t.Fatalf("ReadFull failed: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatal("echoed data does not match the data written")
+	}
+	select {
+	case n := <-acks:
+		if n <= 2*iapMaxDataFrame {
+			t.Errorf("ack, got = %v, want more than %v", n, 2*iapMaxDataFrame)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("want the received data to be acknowledged")
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/cloudsqlconn/errtypes"
+	"cloud.google.com/go/cloudsqlconn/internal/sqladmin"
+	"golang.org/x/oauth2"
+)
+
+// detachedContext has the values of its embedded context but is never
+// canceled, so that token sources created with it outlive the context passed
+// to NewDialer.
+type detachedContext struct{ context.Context }
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+// newAdminClient creates the Cloud SQL Admin API client configured by cfg,
+// giving up when ctx is done. Credential discovery continues in the
+// background after NewDialer gives up and its result is discarded.
+func newAdminClient(ctx context.Context, cfg *dialerConfig) (*sqladmin.Service, error) {
+	type result struct {
+		client *sqladmin.Service
+		err    error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		dctx := detachedContext{ctx}
+		client, err := sqladmin.NewService(dctx, append(cfg.sqladminOpts, cfg.credentialOpts...)...)
+		if err != nil && len(cfg.staticInfo) > 0 {
+			// Without credentials, the Dialer can still connect to the
+			// instances with static connect info.
+			client, err = sqladmin.NewService(dctx, append(cfg.sqladminOpts, sqladmin.WithTokenSource(oauth2.StaticTokenSource(&oauth2.Token{})))...)
+		}
+		ch <- result{client: client, err: err}
+	}()
+	select {
+	case r := <-ch:
+		if r.err != nil {
+			return nil, fmt.Errorf("failed to create sqladmin client: %v", r.err)
+		}
+		return r.client, nil
+	case <-ctx.Done():
+		return nil, errtypes.NewInitError("context done before credentials were found", ctx.Err())
+	}
+}
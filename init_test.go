@@ -0,0 +1,40 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"cloud.google.com/go/cloudsqlconn/errtypes"
+	"cloud.google.com/go/cloudsqlconn/internal/mock"
+)
+
+func TestNewDialerCanceledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := NewDialer(ctx, WithTokenSource(mock.EmptyTokenSource{}))
+	var iErr *errtypes.InitError
+	if !errors.As(err, &iErr) {
+		t.Fatalf("want = *errtypes.InitError, got = %v", err)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("want = context.Canceled, got = %v", err)
+	}
+	if iErr.Timeout() {
+		t.Error("Timeout() = true, want = false")
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+// +build linux darwin dragonfly freebsd netbsd openbsd
+
+package cloudsqlconn
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/cloudsqlconn/errtypes"
+)
+
+func TestNewDialerDeadline(t *testing.T) {
+	// Reading a FIFO blocks until it has a writer, like credential
+	// discovery stuck on an unreachable metadata server.
+	creds := filepath.Join(t.TempDir(), "creds.json")
+	if err := syscall.Mkfifo(creds, 0600); err != nil {
+		t.Fatalf("Mkfifo failed: %v", err)
+	}
+	defer func() {
+		// unblock the abandoned read
+		if f, err := os.OpenFile(creds, os.O_WRONLY, 0); err == nil {
+			f.Close()
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := NewDialer(ctx, WithCredentialsFile(creds))
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("NewDialer took %v, want it to return at the deadline", elapsed)
+	}
+	var iErr *errtypes.InitError
+	if !errors.As(err, &iErr) {
+		t.Fatalf("want = *errtypes.InitError, got = %v", err)
+	}
+	if !iErr.Timeout() {
+		t.Error("Timeout() = false, want = true")
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("want = context.DeadlineExceeded, got = %v", err)
+	}
+}
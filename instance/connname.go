@@ -0,0 +1,134 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package instance
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"cloud.google.com/go/cloudsqlconn/errtypes"
+)
+
+// ConnNameFormat is the format of an instance connection name. The project may
+// be a legacy "domain-scoped" project, e.g., "google.com:my-project".
+const ConnNameFormat = "PROJECT:REGION:INSTANCE"
+
+var (
+	// Instance connection name is the format <PROJECT>:<REGION>:<INSTANCE>
+	// Additionally, we have to support legacy "domain-scoped" projects (e.g. "google.com:PROJECT")
+	connNameRegex = regexp.MustCompile("([^:]+(:[^:]+)?):([^:]+):([^:]+)")
+)
+
+// ConnName is an instance connection name. Use ParseConnName or NewConnName to
+// initialize one.
+type ConnName struct {
+	project string
+	region  string
+	name    string
+}
+
+// ParseConnName parses an instance connection name in the format
+// PROJECT:REGION:INSTANCE. It returns an *errtypes.ConfigError if cn is
+// invalid.
+func ParseConnName(cn string) (ConnName, error) {
+	m := connNameRegex.FindStringSubmatch(cn)
+	if m == nil {
+		err := errtypes.NewConfigError(
+			"invalid instance connection name, expected "+ConnNameFormat,
+			cn,
+		)
+		return ConnName{}, err
+	}
+	return ConnName{project: m[1], region: m[3], name: m[4]}, nil
+}
+
+// NewConnName returns the connection name of the instance name in project and
+// region. It returns an *errtypes.ConfigError if any of them is invalid, so
+// that the result is always accepted by ParseConnName.
+func NewConnName(project, region, name string) (ConnName, error) {
+	cn := fmt.Sprintf("%s:%s:%s", project, region, name)
+	if err := ValidateProject(project); err != nil {
+		return ConnName{}, errtypes.NewConfigError(err.Error(), cn)
+	}
+	if err := ValidateRegion(region); err != nil {
+		return ConnName{}, errtypes.NewConfigError(err.Error(), cn)
+	}
+	if err := ValidateName(name); err != nil {
+		return ConnName{}, errtypes.NewConfigError(err.Error(), cn)
+	}
+	return ConnName{project: project, region: region, name: name}, nil
+}
+
+// ValidateConnName returns an *errtypes.ConfigError if cn is not a valid
+// instance connection name.
+func ValidateConnName(cn string) error {
+	_, err := ParseConnName(cn)
+	return err
+}
+
+// ValidateProject returns an error if project cannot be the project of an
+// instance connection name. It must not be empty, and may contain a single
+// colon only as a domain-scoped project.
+func ValidateProject(project string) error {
+	parts := strings.Split(project, ":")
+	if len(parts) > 2 {
+		return fmt.Errorf("invalid project %q, expected PROJECT or DOMAIN:PROJECT", project)
+	}
+	for _, p := range parts {
+		if p == "" {
+			return fmt.Errorf("invalid project %q, expected PROJECT or DOMAIN:PROJECT", project)
+		}
+	}
+	return nil
+}
+
+// ValidateRegion returns an error if region cannot be the region of an
+// instance connection name. It must not be empty or contain a colon.
+func ValidateRegion(region string) error {
+	return validatePart("region", region)
+}
+
+// ValidateName returns an error if name cannot be the instance name of an
+// instance connection name. It must not be empty or contain a colon.
+func ValidateName(name string) error {
+	return validatePart("instance name", name)
+}
+
+// validatePart returns an error if the part of a connection name is empty or
+// contains a colon.
+func validatePart(kind, s string) error {
+	if s == "" {
+		return fmt.Errorf("%s is empty", kind)
+	}
+	if strings.Contains(s, ":") {
+		return fmt.Errorf("invalid %s %q, must not contain a colon", kind, s)
+	}
+	return nil
+}
+
+// Project returns the project of the instance, including any domain.
+func (c ConnName) Project() string { return c.project }
+
+// Region returns the region of the instance.
+func (c ConnName) Region() string { return c.region }
+
+// Name returns the name of the instance.
+func (c ConnName) Name() string { return c.name }
+
+// String returns the connection name in the format PROJECT:REGION:INSTANCE.
+func (c ConnName) String() string {
+	return fmt.Sprintf("%s:%s:%s", c.project, c.region, c.name)
+}
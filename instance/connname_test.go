@@ -0,0 +1,100 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package instance_test
+
+import (
+	"errors"
+	"testing"
+
+	"cloud.google.com/go/cloudsqlconn/errtypes"
+	"cloud.google.com/go/cloudsqlconn/instance"
+)
+
+func TestParseConnName(t *testing.T) {
+	tcs := []struct {
+		cn                    string
+		project, region, name string
+	}{
+		{"project:region:instance", "project", "region", "instance"},
+		{"google.com:project:region:instance", "google.com:project", "region", "instance"},
+	}
+	for _, tc := range tcs {
+		c, err := instance.ParseConnName(tc.cn)
+		if err != nil {
+			t.Fatalf("ParseConnName(%q) failed: %v", tc.cn, err)
+		}
+		if c.Project() != tc.project || c.Region() != tc.region || c.Name() != tc.name {
+			t.Fatalf("ParseConnName(%q), want = %v:%v:%v, got = %v:%v:%v",
+				tc.cn, tc.project, tc.region, tc.name, c.Project(), c.Region(), c.Name())
+		}
+		if got := c.String(); got != tc.cn {
+			t.Fatalf("String(), want = %v, got = %v", tc.cn, got)
+		}
+	}
+}
+
+func TestParseConnNameInvalid(t *testing.T) {
+	for _, cn := range []string{"", "project:instance", "project::instance"} {
+		_, err := instance.ParseConnName(cn)
+		var wantErr *errtypes.ConfigError
+		if !errors.As(err, &wantErr) {
+			t.Fatalf("ParseConnName(%q), want = %T, got = %v", cn, wantErr, err)
+		}
+		if err := instance.ValidateConnName(cn); err == nil {
+			t.Fatalf("ValidateConnName(%q), want error, got nil", cn)
+		}
+	}
+}
+
+func TestNewConnName(t *testing.T) {
+	tcs := []struct {
+		desc                  string
+		project, region, name string
+		wantErr               bool
+	}{
+		{desc: "valid", project: "p", region: "r", name: "i"},
+		{desc: "domain-scoped project", project: "google.com:p", region: "r", name: "i"},
+		{desc: "empty project", project: "", region: "r", name: "i", wantErr: true},
+		{desc: "empty project domain", project: ":p", region: "r", name: "i", wantErr: true},
+		{desc: "project with two colons", project: "a:b:c", region: "r", name: "i", wantErr: true},
+		{desc: "empty region", project: "p", region: "", name: "i", wantErr: true},
+		{desc: "region with colon", project: "p", region: "r:x", name: "i", wantErr: true},
+		{desc: "empty name", project: "p", region: "r", name: "", wantErr: true},
+		{desc: "name with colon", project: "p", region: "r", name: "i:x", wantErr: true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.desc, func(t *testing.T) {
+			c, err := instance.NewConnName(tc.project, tc.region, tc.name)
+			if tc.wantErr {
+				var wantErr *errtypes.ConfigError
+				if !errors.As(err, &wantErr) {
+					t.Fatalf("want = %T, got = %v", wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewConnName failed: %v", err)
+			}
+			// the connection name parses back to the same parts
+			p, err := instance.ParseConnName(c.String())
+			if err != nil {
+				t.Fatalf("ParseConnName(%q) failed: %v", c, err)
+			}
+			if p != c {
+				t.Fatalf("ParseConnName(%q), want = %v, got = %v", c, c, p)
+			}
+		})
+	}
+}
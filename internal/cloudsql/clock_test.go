@@ -0,0 +1,127 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsql
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/cloudsqlconn/internal/mock"
+)
+
+// fakeClock is a Clock whose time only moves when advanced.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	c    *fakeClock
+	at   time.Time
+	f    func()
+	done bool
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{c: c, at: c.now.Add(d), f: f}
+	c.timers = append(c.timers, t)
+	c.fireLocked()
+	return t
+}
+
+// Advance moves the clock forward by d and runs the functions that are due.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	c.fireLocked()
+}
+
+func (c *fakeClock) fireLocked() {
+	for _, t := range c.timers {
+		if !t.done && !t.at.After(c.now) {
+			t.done = true
+			go t.f()
+		}
+	}
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.c.mu.Lock()
+	defer t.c.mu.Unlock()
+	if t.done {
+		return false
+	}
+	t.done = true
+	return true
+}
+
+func TestInstanceUsesClock(t *testing.T) {
+	ctx := context.Background()
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+	client, cleanup, err := mock.NewSQLAdminService(
+		ctx,
+		mock.InstanceGetSuccess(inst, 2),
+		mock.CreateEphemeralSuccess(inst, 2),
+	)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer func() {
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	clock := &fakeClock{now: time.Now()}
+	im, err := NewInstance("my-project:my-region:my-instance", client, RSAKey, 30*time.Second,
+		WithClock(clock))
+	if err != nil {
+		t.Fatalf("failed to initialize Instance: %v", err)
+	}
+	defer im.Close()
+	if _, _, err := im.ConnectInfo(ctx, PublicIP); err != nil {
+		t.Fatalf("failed to retrieve connect info: %v", err)
+	}
+	s := waitForNextRefresh(t, im)
+	if s.LastRefresh != clock.Now() {
+		t.Fatalf("want last refresh at the clock's time %v, got = %v", clock.Now(), s.LastRefresh)
+	}
+
+	// Nothing happens until the clock reaches the next refresh.
+	clock.Advance(s.NextRefresh.Sub(clock.Now()) - time.Second)
+	time.Sleep(100 * time.Millisecond)
+	if got := im.Status().LastRefresh; got != s.LastRefresh {
+		t.Fatalf("want no refresh before the scheduled time, got last refresh = %v", got)
+	}
+	clock.Advance(time.Second)
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		if im.Status().LastRefresh.After(s.LastRefresh) {
+			return
+		}
+	}
+	t.Fatal("want a refresh once the clock reaches the scheduled time")
+}
@@ -0,0 +1,38 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsql
+
+import "context"
+
+// valuesContext is a context that is canceled with its embedded context but
+// has the values of another, e.g., of the request that triggered a refresh
+// shared with other requests.
+type valuesContext struct {
+	context.Context
+	values context.Context
+}
+
+func (c valuesContext) Value(key interface{}) interface{} {
+	return c.values.Value(key)
+}
+
+// withValues returns ctx with the values of values in place of its own, or
+// ctx itself if values is nil.
+func withValues(ctx, values context.Context) context.Context {
+	if values == nil {
+		return ctx
+	}
+	return valuesContext{Context: ctx, values: values}
+}
@@ -18,26 +18,93 @@ import (
 	"context"
 	"crypto/rsa"
 	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
-	"regexp"
+	"math/rand"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"cloud.google.com/go/cloudsqlconn/errtypes"
-	sqladmin "google.golang.org/api/sqladmin/v1beta4"
+	"cloud.google.com/go/cloudsqlconn/instance"
+	"cloud.google.com/go/cloudsqlconn/internal/sqladmin"
 )
 
 const (
 	// refreshBuffer is the amount of time before a result expires to start a new refresh attempt.
 	refreshBuffer = 5 * time.Minute
+	// retryBaseDelay is the delay before retrying a failed refresh. Each
+	// consecutive failure doubles the delay, up to retryMaxDelay.
+	retryBaseDelay = time.Second
+	retryMaxDelay  = time.Minute
+	// maxJitter is the most that a scheduled refresh is moved earlier to
+	// spread out refreshes that would otherwise happen at the same time.
+	maxJitter = time.Minute
+	// throttleThreshold is how late a scheduled refresh may start before the
+	// instance assumes its CPU is throttled between requests (e.g., on Cloud
+	// Run) and stops relying on background refreshes.
+	throttleThreshold = time.Minute
+	// handshakeMargin is how long a client certificate must remain valid for
+	// a connection attempt to use it without refreshing first, so that it
+	// does not expire before the TLS handshake completes.
+	handshakeMargin = 30 * time.Second
 )
 
+// refreshDelay returns how long to wait before refreshing a result that
+// expires at expiry, given that the refresh that produced it took latency.
+// The refresh is scheduled refreshBuffer before expiry, plus twice the
+// observed latency to leave headroom for a slow Admin API. Results that are
+// valid for less than twice that are refreshed halfway through their
+// remaining validity instead.
+func refreshDelay(now, expiry time.Time, latency time.Duration) time.Duration {
+	valid := expiry.Sub(now)
+	if valid <= 0 {
+		return 0
+	}
+	buffer := refreshBuffer + 2*latency
+	if valid < 2*buffer {
+		return valid / 2
+	}
+	return valid - buffer
+}
+
 var (
-	// Instance connection name is the format <PROJECT>:<REGION>:<INSTANCE>
-	// Additionally, we have to support legacy "domain-scoped" projects (e.g. "google.com:PROJECT")
-	connNameRegex = regexp.MustCompile("([^:]+(:[^:]+)?):([^:]+):([^:]+)")
+	jitterMu sync.Mutex
+	// jitterRand is seeded per process so that processes started together
+	// do not refresh together.
+	jitterRand = rand.New(rand.NewSource(time.Now().UnixNano()))
 )
 
+// jitter returns d reduced by a random amount of up to a tenth of d, and no
+// more than maxJitter.
+func jitter(d time.Duration) time.Duration {
+	max := d / 10
+	if max > maxJitter {
+		max = maxJitter
+	}
+	if max <= 0 {
+		return d
+	}
+	jitterMu.Lock()
+	defer jitterMu.Unlock()
+	return d - time.Duration(jitterRand.Int63n(int64(max)))
+}
+
+// retryDelay returns how long to wait before retrying after the given number
+// of consecutive failed refreshes.
+func retryDelay(failures int) time.Duration {
+	d := retryBaseDelay
+	for n := 1; n < failures && d < retryMaxDelay; n++ {
+		d *= 2
+	}
+	if d > retryMaxDelay {
+		d = retryMaxDelay
+	}
+	return d
+}
+
 // connName represents the "instance connection name", in the format "project:region:name". Use the
 // "parseConnName" method to initialize this struct.
 type connName struct {
@@ -50,24 +117,22 @@ func (c *connName) String() string {
 	return fmt.Sprintf("%s:%s:%s", c.project, c.region, c.name)
 }
 
+// ProjectID returns the project of the instance connection name cn.
+func ProjectID(cn string) (string, error) {
+	c, err := parseConnName(cn)
+	if err != nil {
+		return "", err
+	}
+	return c.project, nil
+}
+
 // parseConnName initializes a new connName struct.
 func parseConnName(cn string) (connName, error) {
-	b := []byte(cn)
-	m := connNameRegex.FindSubmatch(b)
-	if m == nil {
-		err := errtypes.NewConfigError(
-			"invalid instance connection name, expected PROJECT:REGION:INSTANCE",
-			cn,
-		)
+	c, err := instance.ParseConnName(cn)
+	if err != nil {
 		return connName{}, err
 	}
-
-	c := connName{
-		project: string(m[1]),
-		region:  string(m[3]),
-		name:    string(m[4]),
-	}
-	return c, nil
+	return connName{project: c.Project(), region: c.Region(), name: c.Name()}, nil
 }
 
 // refreshResult is a pending result of a refresh operation of data used to connect securely. It should
@@ -77,11 +142,15 @@ type refreshResult struct {
 	tlsCfg *tls.Config
 	expiry time.Time
 	err    error
+	// completed is when the refresh operation completed.
+	completed time.Time
 
 	// timer that triggers refresh, can be used to cancel.
-	timer *time.Timer
+	timer Timer
 	// indicates the struct is ready to read from
 	ready chan struct{}
+	// clock is the clock of the Instance that scheduled the refresh.
+	clock Clock
 }
 
 // Cancel prevents the instanceInfo from starting, if it hasn't already started. Returns true if timer
@@ -100,6 +169,16 @@ func (r *refreshResult) Wait(ctx context.Context) error {
 	}
 }
 
+// done reports whether the refresh operation has completed.
+func (r *refreshResult) done() bool {
+	select {
+	case <-r.ready:
+		return true
+	default:
+		return false
+	}
+}
+
 // IsValid returns true if this result is complete, successful, and is still valid.
 func (r *refreshResult) IsValid() bool {
 	// verify the result has finished running
@@ -107,20 +186,121 @@ func (r *refreshResult) IsValid() bool {
 	default:
 		return false
 	case <-r.ready:
-		if r.err != nil || time.Now().After(r.expiry) {
+		if r.err != nil || r.clock.Now().After(r.expiry) {
 			return false
 		}
 		return true
 	}
 }
 
+// RefreshEvent describes the outcome of a completed refresh operation.
+type RefreshEvent struct {
+	// Err is the error that caused the refresh to fail, if any.
+	Err error
+	// Expiry is the time at which the refreshed certificate expires.
+	Expiry time.Time
+	// ClientCert and ServerCAs are the refreshed client certificate, with
+	// its private key, and server CA certificates, if the refresh
+	// succeeded. They are set before the instance uses them, so a handler
+	// must not read them through Certificates.
+	ClientCert tls.Certificate
+	ServerCAs  []*x509.Certificate
+	// MaintenanceStart is the start of the instance's next scheduled
+	// maintenance, or the zero time if none is scheduled.
+	MaintenanceStart time.Time
+	// InstanceType is the type of the instance (e.g., CLOUD_SQL_INSTANCE or
+	// READ_REPLICA_INSTANCE).
+	InstanceType string
+	// MaxConnections is the instance's connection limit, or 0 if unknown.
+	MaxConnections int
+	// Late is how long after its scheduled time the refresh started.
+	Late time.Duration
+	// Throttled is true if the refresh started so late that the CPU is
+	// likely throttled between requests. The instance then stops background
+	// refreshes and only refreshes when a connection needs it, as if Pause
+	// had been called, until a refresh starts on time again.
+	Throttled bool
+}
+
+// An InstanceOption is an option for configuring an Instance.
+type InstanceOption func(i *Instance)
+
+// WithContextValues returns an InstanceOption that makes the values of ctx,
+// but not its deadline or cancellation, visible to the initial refresh
+// operation, e.g., to the Admin API's HTTP transport and the certificate
+// provider.
+func WithContextValues(ctx context.Context) InstanceOption {
+	return func(i *Instance) {
+		i.initValues = ctx
+	}
+}
+
+// WithServerValidation returns an InstanceOption that sets how the server's
+// certificate is verified (i.e., LegacyServerValidation or
+// CASServerValidation).
+func WithServerValidation(mode string) InstanceOption {
+	return func(i *Instance) {
+		i.r.validation = mode
+	}
+}
+
+// CertProvider returns a client certificate for the instance with the given
+// connection name.
+type CertProvider func(ctx context.Context, instance string) (tls.Certificate, error)
+
+// WithCertProvider returns an InstanceOption that obtains client certificates
+// from provider rather than requesting ephemeral certificates from the Cloud
+// SQL Admin API. Certificates are refreshed before they expire.
+func WithCertProvider(provider CertProvider) InstanceOption {
+	return func(i *Instance) {
+		i.r.certProvider = provider
+	}
+}
+
+// WithClock returns an InstanceOption that uses c to schedule refresh
+// operations and to check whether results have expired.
+func WithClock(c Clock) InstanceOption {
+	return func(i *Instance) {
+		i.clock = c
+	}
+}
+
+// WithRefreshLimiter returns an InstanceOption that waits for l before every
+// refresh operation, so that instances sharing l refresh at most as many at a
+// time as it allows.
+func WithRefreshLimiter(l *RefreshLimiter) InstanceOption {
+	return func(i *Instance) {
+		i.limiter = l
+	}
+}
+
+// WithRefreshHandler returns an InstanceOption that calls fn after every
+// completed refresh operation. fn is called from the refresh goroutine and
+// should not block.
+func WithRefreshHandler(fn func(RefreshEvent)) InstanceOption {
+	return func(i *Instance) {
+		i.onRefresh = fn
+	}
+}
+
+// WithAPICallHandler returns an InstanceOption that calls fn before every call
+// the instance makes to the Cloud SQL Admin API with the name of the method
+// (i.e., GetInstanceMethod or CreateEphemeralMethod). fn is called from the
+// refresh goroutines and should not block.
+func WithAPICallHandler(fn func(method string)) InstanceOption {
+	return func(i *Instance) {
+		i.onAPICall = fn
+	}
+}
+
 // Instance manages the information used to connect to the Cloud SQL instance by periodically calling
 // the Cloud SQL Admin API. It automatically refreshes the required information approximately 5 minutes
 // before the previous certificate expires (every 55 minutes).
 type Instance struct {
 	connName
-	key *rsa.PrivateKey
-	r   refresher
+	key   *rsa.PrivateKey
+	r     refresher
+	clock Clock
 
 	resultGuard sync.RWMutex
 	// cur represents the current refreshResult that will be used to create connections. If a valid complete
@@ -129,6 +309,54 @@ type Instance struct {
 	// next represents a future or ongoing refreshResult. Once complete, it will replace cur and schedule a
 	// replacement to occur.
 	next *refreshResult
+	// lastGood is the most recent successful refreshResult. While it remains
+	// valid, it is used in place of a failed cur.
+	lastGood *refreshResult
+	// failures is the number of consecutive failed refresh operations.
+	failures int
+	// lastErr is the error of the most recent failed refresh operation.
+	lastErr error
+	// lastRefresh is when the most recent refresh operation completed.
+	lastRefresh time.Time
+	// nextRefresh is when the next refresh operation is scheduled to start.
+	nextRefresh time.Time
+	// paused is true while background refreshes are paused. When paused, next
+	// is either in progress or complete, and no further refresh is
+	// scheduled.
+	paused bool
+	// throttled is true if background refreshes were paused because a
+	// refresh started too late. Unlike Pause, the next refresh that starts
+	// on time resumes them.
+	throttled bool
+	// lazy is true while the refresh strategy has scheduled no background
+	// refresh, so that connection attempts refresh as needed, as when
+	// paused. A connection attempt consults the strategy again.
+	lazy bool
+
+	// strategy schedules refresh operations, and use records when
+	// connection attempts use the instance for it.
+	strategy RefreshStrategy
+	use      *useTracker
+	// static, if set, is used in place of the Cloud SQL Admin API.
+	static *StaticInfo
+
+	// limiter, if set, bounds concurrent refresh operations across
+	// instances.
+	limiter *RefreshLimiter
+
+	// onRefresh is called after every completed refresh operation.
+	onRefresh func(RefreshEvent)
+	// onAPICall is called before every Cloud SQL Admin API call.
+	onAPICall func(method string)
+
+	apiCallsMu sync.Mutex
+	// apiCalls map Cloud SQL Admin API methods to the number of times they
+	// have been called.
+	apiCalls map[string]int64
+
+	// initValues, if set, provides the values of the context of the initial
+	// refresh operation.
+	initValues context.Context
 
 	// ctx is the default ctx for refresh operations. Canceling it prevents new refresh
 	// operations from being triggered.
@@ -137,7 +365,7 @@ type Instance struct {
 }
 
 // NewInstance initializes a new Instance given an instance connection name
-func NewInstance(instance string, client *sqladmin.Service, key *rsa.PrivateKey, refreshTimeout time.Duration) (*Instance, error) {
+func NewInstance(instance string, client *sqladmin.Service, key *rsa.PrivateKey, refreshTimeout time.Duration, opts ...InstanceOption) (*Instance, error) {
 	cn, err := parseConnName(instance)
 	if err != nil {
 		return nil, err
@@ -152,18 +380,36 @@ func NewInstance(instance string, client *sqladmin.Service, key *rsa.PrivateKey,
 			2,
 			client,
 		),
-		ctx:    ctx,
-		cancel: cancel,
+		clock:    realClock{},
+		strategy: RefreshAhead,
+		use:      &useTracker{},
+		apiCalls: make(map[string]int64),
+		ctx:      ctx,
+		cancel:   cancel,
 	}
+	for _, opt := range opts {
+		opt(i)
+	}
+	i.r.onAPICall = i.recordAPICall
 	// For the initial refresh operation, set cur = next so that connection requests block
 	// until the first refresh is complete.
 	i.resultGuard.Lock()
-	i.cur = i.scheduleRefresh(0)
+	i.cur = i.scheduleRefresh(0, i.initValues)
 	i.next = i.cur
 	i.resultGuard.Unlock()
 	return i, nil
 }
 
+// recordAPICall counts a call to the Cloud SQL Admin API method.
+func (i *Instance) recordAPICall(method string) {
+	i.apiCallsMu.Lock()
+	i.apiCalls[method]++
+	i.apiCallsMu.Unlock()
+	if i.onAPICall != nil {
+		i.onAPICall(method)
+	}
+}
+
 // Close closes the instance; it stops the refresh cycle and prevents it from making
 // additional calls to the Cloud SQL Admin API.
 func (i *Instance) Close() {
@@ -174,61 +420,509 @@ func (i *Instance) Close() {
 // private) and a TLS config that can be used to connect to a Cloud SQL
 // instance.
 func (i *Instance) ConnectInfo(ctx context.Context, ipType string) (string, *tls.Config, error) {
-	i.resultGuard.RLock()
-	res := i.cur
-	i.resultGuard.RUnlock()
-	err := res.Wait(ctx)
+	addrs, tlsCfg, err := i.ConnectAddrs(ctx, ipType)
 	if err != nil {
 		return "", nil, err
 	}
-	addr, ok := res.md.ipAddrs[ipType]
-	if !ok {
+	return addrs[ipType], tlsCfg, nil
+}
+
+// ConnectAddrs returns a map of IP type to IP address for each of ipTypes that
+// the instance has, and a TLS config that can be used to connect to a Cloud
+// SQL instance. It returns an error if the instance has none of them.
+func (i *Instance) ConnectAddrs(ctx context.Context, ipTypes ...string) (map[string]string, *tls.Config, error) {
+	res, err := i.usableResult(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := res.md.checkServerValidation(i.String(), i.r.validation); err != nil {
+		return nil, nil, err
+	}
+	addrs := make(map[string]string)
+	for _, t := range ipTypes {
+		if addr, ok := res.md.ipAddrs[t]; ok {
+			addrs[t] = addr
+		}
+	}
+	if len(addrs) == 0 {
+		has := make([]string, 0, len(res.md.ipAddrs))
+		for t := range res.md.ipAddrs {
+			has = append(has, t)
+		}
+		sort.Strings(has)
 		err := errtypes.NewConfigError(
-			fmt.Sprintf("instance does not have IP of type %q", ipType),
+			fmt.Sprintf("instance does not have IP of type %q (it has %q)",
+				strings.Join(ipTypes, ", "), strings.Join(has, ", ")),
 			i.String(),
 		)
-		return "", nil, err
+		return nil, nil, err
+	}
+	return addrs, res.tlsCfg, nil
+}
+
+// Certificates returns the client certificate, with its private key, and the
+// server CA certificates that connections to the instance use, and when the
+// client certificate expires.
+func (i *Instance) Certificates(ctx context.Context) (tls.Certificate, []*x509.Certificate, time.Time, error) {
+	res, err := i.usableResult(ctx)
+	if err != nil {
+		return tls.Certificate{}, nil, time.Time{}, err
+	}
+	cas := make([]*x509.Certificate, len(res.md.serverCaCerts))
+	copy(cas, res.md.serverCaCerts)
+	return res.tlsCfg.Certificates[0], cas, res.expiry, nil
+}
+
+// usableResult waits for the current refresh, refreshing first if the
+// current result has expired, and returns its result, or the most recent
+// successful result if the refresh failed and that result may be used in its
+// place.
+func (i *Instance) usableResult(ctx context.Context) (*refreshResult, error) {
+	i.refreshIfExpired(ctx)
+	i.resultGuard.RLock()
+	res := i.cur
+	i.resultGuard.RUnlock()
+	err := res.Wait(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		good := i.fallback(res)
+		if good == nil {
+			return nil, err
+		}
+		res = good
+	}
+	return res, nil
+}
+
+// Wait blocks until the current refresh operation completes and returns its
+// error, if any.
+func (i *Instance) Wait(ctx context.Context) error {
+	i.resultGuard.RLock()
+	res := i.cur
+	i.resultGuard.RUnlock()
+	return res.Wait(ctx)
+}
+
+// InstanceType returns the type of the instance (e.g., CLOUD_SQL_INSTANCE or
+// READ_REPLICA_INSTANCE) as reported by the most recent refresh.
+func (i *Instance) InstanceType(ctx context.Context) (string, error) {
+	i.resultGuard.RLock()
+	res := i.cur
+	i.resultGuard.RUnlock()
+	if err := res.Wait(ctx); err != nil {
+		return "", err
+	}
+	return res.md.instanceType, nil
+}
+
+// State returns the state of the instance (e.g., RUNNABLE, STOPPED or
+// MAINTENANCE) as reported by the most recent refresh.
+func (i *Instance) State(ctx context.Context) (string, error) {
+	i.resultGuard.RLock()
+	res := i.cur
+	i.resultGuard.RUnlock()
+	if err := res.Wait(ctx); err != nil && res.md.state == "" {
+		return "", err
+	}
+	return res.md.state, nil
+}
+
+// fallback returns the most recent successful result if it may be used in
+// place of the failed result res, or nil otherwise.
+func (i *Instance) fallback(res *refreshResult) *refreshResult {
+	if errors.Is(res.err, errtypes.ErrInstanceNotRunning) {
+		return nil
+	}
+	i.resultGuard.RLock()
+	good := i.lastGood
+	i.resultGuard.RUnlock()
+	if good == nil || !good.IsValid() {
+		return nil
+	}
+	return good
+}
+
+// Healthy reports whether the instance is able to provide connection info. An
+// instance whose refresh is still in progress is considered healthy; only a
+// completed refresh that failed or has since expired is not, unless a
+// previous result is still valid.
+func (i *Instance) Healthy() bool {
+	i.resultGuard.RLock()
+	res := i.cur
+	i.resultGuard.RUnlock()
+	select {
+	case <-res.ready:
+		return res.IsValid() || i.fallback(res) != nil
+	default:
+		return true
+	}
+}
+
+// Degraded reports whether the most recent refresh failed and connections are
+// being made with a previous, still valid, result.
+func (i *Instance) Degraded() bool {
+	i.resultGuard.RLock()
+	defer i.resultGuard.RUnlock()
+	return i.failures > 0 && i.lastGood != nil && i.lastGood.IsValid()
+}
+
+// Status is a snapshot of an Instance's refresh state.
+type Status struct {
+	// Expiry is when the certificate used for new connections expires, or
+	// the zero time if there is none.
+	Expiry time.Time
+	// LastRefresh is when the most recent refresh operation completed, or the
+	// zero time if none has.
+	LastRefresh time.Time
+	// NextRefresh is when the next refresh operation is scheduled to start.
+	// It is computed from the certificate's expiration and the latency of the
+	// previous refresh, or from the retry backoff after a failure. It is the
+	// zero time while refreshes are paused.
+	NextRefresh time.Time
+	// Paused reports whether background refreshes are paused.
+	Paused bool
+	// Throttled reports whether background refreshes were paused because a
+	// refresh started too late, which indicates CPU throttling.
+	Throttled bool
+	// LastErr is the error of the most recent failed refresh operation, if
+	// any.
+	LastErr error
+	// Failures is the number of consecutive failed refresh operations.
+	Failures int
+	// Degraded reports whether connections are being made with a previous
+	// result because the most recent refresh failed.
+	Degraded bool
+	// State and InstanceType are as reported by the most recent successful
+	// refresh.
+	State        string
+	InstanceType string
+	// IPAddrs maps IP types to IP addresses as reported by the most recent
+	// successful refresh.
+	IPAddrs map[string]string
+	// IAMAuthN reports whether the instance has IAM database authentication
+	// enabled.
+	IAMAuthN bool
+	// CASServerCerts reports whether the instance's server certificates are
+	// issued by Certificate Authority Service.
+	CASServerCerts bool
+	// MaxConnections is the instance's connection limit as set by its
+	// database flags, or 0 if unknown.
+	MaxConnections int
+	// APICalls maps Cloud SQL Admin API methods to the number of times the
+	// instance has called them.
+	APICalls map[string]int64
+}
+
+// Status returns a snapshot of the instance's refresh state. It does not wait
+// for an ongoing refresh to complete.
+func (i *Instance) Status() Status {
+	i.resultGuard.RLock()
+	defer i.resultGuard.RUnlock()
+	s := Status{
+		LastRefresh: i.lastRefresh,
+		NextRefresh: i.nextRefresh,
+		Paused:      i.paused,
+		Throttled:   i.throttled,
+		LastErr:     i.lastErr,
+		Failures:    i.failures,
+		Degraded:    i.failures > 0 && i.lastGood != nil && i.lastGood.IsValid(),
+	}
+	s.APICalls = make(map[string]int64)
+	i.apiCallsMu.Lock()
+	for k, v := range i.apiCalls {
+		s.APICalls[k] = v
+	}
+	i.apiCallsMu.Unlock()
+	good := i.lastGood
+	if i.cur.IsValid() {
+		good = i.cur
+	}
+	if good != nil {
+		s.Expiry = good.expiry
+		s.State = good.md.state
+		s.InstanceType = good.md.instanceType
+		s.IAMAuthN = good.md.iamAuthN
+		s.CASServerCerts = good.md.casCA()
+		s.MaxConnections = good.md.maxConns
+		s.IPAddrs = make(map[string]string)
+		for k, v := range good.md.ipAddrs {
+			s.IPAddrs[k] = v
+		}
+	}
+	return s
+}
+
+// SetClient replaces the client used to call the Cloud SQL Admin API for
+// subsequent refresh operations.
+func (i *Instance) SetClient(client *sqladmin.Service) {
+	i.resultGuard.Lock()
+	defer i.resultGuard.Unlock()
+	i.r.client = client
+}
+
+// SetRefreshTimeout sets the timeout of subsequent refresh operations.
+func (i *Instance) SetRefreshTimeout(timeout time.Duration) {
+	i.resultGuard.Lock()
+	defer i.resultGuard.Unlock()
+	i.r.timeout = timeout
+}
+
+// RotateKey replaces the RSA key used for client certificates and waits for a
+// refresh that obtains a certificate for it. Until that refresh completes,
+// connections continue to use the current certificate, and established
+// connections are unaffected. If the refresh fails, a certificate for the old
+// key remains in use while it is valid, and the new key is used by later
+// refreshes.
+func (i *Instance) RotateKey(ctx context.Context, k *rsa.PrivateKey) error {
+	for {
+		i.resultGuard.Lock()
+		if err := i.ctx.Err(); err != nil {
+			i.resultGuard.Unlock()
+			return err
+		}
+		i.key = k
+		// A refresh that has already started uses the old key, so wait for
+		// it to complete and schedule its successor.
+		if i.next.Cancel() || ((i.paused || i.lazy) && i.next.done()) {
+			res := i.scheduleRefresh(0, ctx)
+			i.next = res
+			i.resultGuard.Unlock()
+			return res.Wait(ctx)
+		}
+		next := i.next
+		i.resultGuard.Unlock()
+		if err := next.Wait(ctx); err != nil && ctx.Err() != nil {
+			return ctx.Err()
+		}
 	}
-	return addr, res.tlsCfg, nil
 }
 
 // ForceRefresh triggers an immediate refresh operation to be scheduled and used for future connection attempts.
 func (i *Instance) ForceRefresh() {
+	i.forceRefresh(nil)
+}
+
+// ForceRefreshContext is like ForceRefresh, but a refresh operation it starts
+// sees the values of ctx. The refresh is not bound to the deadline or
+// cancellation of ctx, as other connection attempts share its result.
+func (i *Instance) ForceRefreshContext(ctx context.Context) {
+	i.forceRefresh(ctx)
+}
+
+// forceRefresh implements ForceRefresh and ForceRefreshContext. values may be
+// nil.
+func (i *Instance) forceRefresh(values context.Context) {
 	i.resultGuard.Lock()
 	defer i.resultGuard.Unlock()
-	// If the next refresh hasn't started yet, we can cancel it and start an immediate one
-	if i.next.Cancel() {
-		i.next = i.scheduleRefresh(0)
-	}
+	i.refreshNow(values)
 	// block all sequential connection attempts on the next refresh result
 	i.cur = i.next
 }
 
+// refreshNow starts an immediate refresh operation with the values of values,
+// which may be nil, unless one is already in progress. resultGuard must be
+// held.
+func (i *Instance) refreshNow(values context.Context) {
+	// If the next refresh hasn't started yet, we can cancel it and start an
+	// immediate one. While paused or lazy, the next refresh may already be
+	// complete.
+	if i.next.Cancel() || ((i.paused || i.lazy) && i.next.done()) {
+		i.next = i.scheduleRefresh(0, values)
+	}
+}
+
+// Pause stops background refresh operations, so the instance makes no calls
+// to the Cloud SQL Admin API until Resume is called. A refresh that is already
+// in progress completes. Connections continue to use the most recent result;
+// once it has failed or its certificate has expired, each connection attempt
+// triggers a single refresh.
+func (i *Instance) Pause() {
+	i.resultGuard.Lock()
+	defer i.resultGuard.Unlock()
+	// An on-time refresh must not lift a pause requested by the caller.
+	i.throttled = false
+	if i.paused {
+		return
+	}
+	i.paused = true
+	// Only cancel a pending refresh when there's a completed result to fall
+	// back on, so that next always completes.
+	if i.next != i.cur && i.next.Cancel() {
+		i.next = i.cur
+		i.nextRefresh = time.Time{}
+	}
+}
+
+// Resume restarts background refresh operations stopped by Pause with an
+// immediate refresh. Connection attempts block on the refresh only if the
+// current result is no longer valid.
+func (i *Instance) Resume() {
+	i.resultGuard.Lock()
+	defer i.resultGuard.Unlock()
+	if !i.paused {
+		return
+	}
+	i.refreshNow(nil)
+	i.paused = false
+	i.throttled = false
+	if !i.cur.IsValid() {
+		i.cur = i.next
+	}
+}
+
+// refreshIfExpired records that a connection attempt is using the instance
+// and, if the current result is stale, starts a refresh with the values of
+// ctx, or joins one in progress, for the attempt to wait on. Otherwise, if the
+// refresh strategy scheduled no background refresh, it schedules one if the
+// strategy now decides to, e.g., because the instance is in use again.
+func (i *Instance) refreshIfExpired(ctx context.Context) {
+	i.use.used(i.clock.Now())
+	i.resultGuard.RLock()
+	stale := i.stale()
+	var resume bool
+	if !stale {
+		_, resume = i.resumeLazy()
+	}
+	i.resultGuard.RUnlock()
+	if !stale && !resume {
+		return
+	}
+	i.resultGuard.Lock()
+	defer i.resultGuard.Unlock()
+	if i.stale() {
+		i.refreshNow(ctx)
+		i.cur = i.next
+		return
+	}
+	if d, ok := i.resumeLazy(); ok {
+		i.lazy = false
+		i.next = i.scheduleRefresh(d, nil)
+	}
+}
+
+// resumeLazy returns how long from now to refresh in the background, and
+// true, if the refresh strategy scheduled no background refresh after the
+// last one completed but decides to now. resultGuard must be held, for
+// reading at least.
+func (i *Instance) resumeLazy() (time.Duration, bool) {
+	if !i.lazy || i.paused || !i.next.done() {
+		return 0, false
+	}
+	return i.strategy(i.refreshInfo(0))
+}
+
+// stale reports whether the current result must be refreshed before a
+// connection attempt uses it: its certificate expires within handshakeMargin,
+// which happens when the scheduled refresh was delayed, e.g., while the
+// process was suspended, or the result failed and background refreshes are
+// paused or the refresh strategy scheduled none. Refreshing first turns what
+// would be a confusing handshake failure into a refresh. A certificate that
+// was already about to expire when the refresh completed, e.g., because the
+// local clock is wrong, is used as is, as refreshing again wouldn't help.
+// resultGuard must be held.
+func (i *Instance) stale() bool {
+	if !i.cur.done() {
+		return false
+	}
+	if i.cur.err != nil {
+		return i.paused || i.lazy
+	}
+	if i.cur.expiry.Sub(i.cur.completed) <= handshakeMargin {
+		return (i.paused || i.lazy) && !i.clock.Now().Before(i.cur.expiry)
+	}
+	return !i.clock.Now().Add(handshakeMargin).Before(i.cur.expiry)
+}
+
 // scheduleRefresh schedules a refresh operation to be triggered after a given duration. The returned refreshResult
-// can be used to either Cancel or Wait for the operations result.
-func (i *Instance) scheduleRefresh(d time.Duration) *refreshResult {
-	res := &refreshResult{}
+// can be used to either Cancel or Wait for the operations result. The
+// refresh sees the values of values, if not nil, for example those of the
+// connection attempt that triggered it.
+func (i *Instance) scheduleRefresh(d time.Duration, values context.Context) *refreshResult {
+	res := &refreshResult{clock: i.clock}
 	res.ready = make(chan struct{})
-	res.timer = time.AfterFunc(d, func() {
-		res.md, res.tlsCfg, res.expiry, res.err = i.r.performRefresh(i.ctx, i.connName, i.key)
+	i.nextRefresh = i.clock.Now().Add(d)
+	// Lateness is measured on the monotonic wall clock rather than i.clock,
+	// so that an injected clock jumping ahead isn't taken for throttling.
+	armed := time.Now()
+	res.timer = i.clock.AfterFunc(d, func() {
+		late := time.Since(armed) - d
+		if late < 0 {
+			late = 0
+		}
+		throttled := late > throttleThreshold
+		i.resultGuard.RLock()
+		r, key := i.r, i.key
+		i.resultGuard.RUnlock()
+		var latency time.Duration
+		if i.static != nil {
+			res.md, res.tlsCfg, res.expiry, res.err = i.staticRefresh(r)
+		} else if err := i.limiter.acquire(i.ctx); err != nil {
+			res.err = errtypes.NewRefreshError("refresh canceled while waiting to start", i.String(), err)
+		} else {
+			start := i.clock.Now()
+			res.md, res.tlsCfg, res.expiry, res.err = r.performRefresh(withValues(i.ctx, values), i.connName, key)
+			latency = i.clock.Now().Sub(start)
+			i.limiter.release()
+		}
+		res.completed = i.clock.Now()
 		close(res.ready)
+		if i.onRefresh != nil {
+			e := RefreshEvent{
+				Err:              res.err,
+				Expiry:           res.expiry,
+				MaintenanceStart: res.md.maintenanceStart,
+				InstanceType:     res.md.instanceType,
+				MaxConnections:   res.md.maxConns,
+				Late:             late,
+				Throttled:        throttled,
+			}
+			if res.err == nil {
+				e.ClientCert = res.tlsCfg.Certificates[0]
+				e.ServerCAs = make([]*x509.Certificate, len(res.md.serverCaCerts))
+				copy(e.ServerCAs, res.md.serverCaCerts)
+			}
+			i.onRefresh(e)
+		}
 
 		// Once the refresh is complete, update "current" with working result and schedule a new refresh
 		i.resultGuard.Lock()
 		defer i.resultGuard.Unlock()
-		// if failed, scheduled the next refresh immediately
+		i.lastRefresh = i.clock.Now()
+		if throttled {
+			// Background refreshes can't be relied upon to run on time, so
+			// refresh only when a connection needs it.
+			i.paused = true
+			i.throttled = true
+		} else if i.throttled {
+			// The CPU is available again, e.g., for a connection attempt, so
+			// resume background refreshes.
+			i.paused = false
+			i.throttled = false
+		}
+		// if failed, retry the refresh with an exponential backoff
 		if res.err != nil {
-			i.next = i.scheduleRefresh(0)
+			i.failures++
+			i.lastErr = res.err
+			select {
+			case <-i.ctx.Done():
+				// instance has been closed, don't schedule anything
+			default:
+				i.scheduleNext(latency)
+			}
 			// If the latest result is bad, avoid replacing the used result while it's
 			// still valid and potentially able to provide successful connections.
-			// TODO: This means that errors while the current result is still valid are
-			// surpressed. We should try to surface errors in a more meaningful way.
-			if !i.cur.IsValid() {
+			// An instance that is no longer running won't accept connections, so
+			// surface that error immediately.
+			if !i.cur.IsValid() || errors.Is(res.err, errtypes.ErrInstanceNotRunning) {
 				i.cur = res
 			}
 			return
 		}
 		// Update the current results, and schedule the next refresh in the future
+		i.failures = 0
+		i.lastGood = res
 		i.cur = res
 		select {
 		case <-i.ctx.Done():
@@ -236,8 +930,41 @@ func (i *Instance) scheduleRefresh(d time.Duration) *refreshResult {
 			return
 		default:
 		}
-		nextRefresh := i.cur.expiry.Add(-refreshBuffer)
-		i.next = i.scheduleRefresh(time.Until(nextRefresh))
+		i.scheduleNext(latency)
 	})
 	return res
 }
+
+// scheduleNext schedules the refresh that follows a completed one, which took
+// latency, as decided by the refresh strategy, unless background refreshes
+// are paused. resultGuard must be held.
+func (i *Instance) scheduleNext(latency time.Duration) {
+	i.lazy = false
+	if i.paused {
+		i.nextRefresh = time.Time{}
+		return
+	}
+	d, ok := i.strategy(i.refreshInfo(latency))
+	if !ok {
+		i.lazy = true
+		i.nextRefresh = time.Time{}
+		return
+	}
+	i.next = i.scheduleRefresh(d, nil)
+}
+
+// refreshInfo returns the RefreshInfo for the refresh strategy as of now,
+// after a refresh that took latency. resultGuard must be held, for reading
+// at least.
+func (i *Instance) refreshInfo(latency time.Duration) RefreshInfo {
+	info := RefreshInfo{
+		Now:      i.clock.Now(),
+		Latency:  latency,
+		Failures: i.failures,
+		LastUsed: i.use.lastUsed(),
+	}
+	if good := i.lastGood; good != nil {
+		info.Expiry = good.expiry
+	}
+	return info
+}
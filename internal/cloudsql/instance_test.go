@@ -18,12 +18,16 @@ import (
 	"context"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/tls"
 	"errors"
+	"reflect"
+	"sync"
 	"testing"
 	"time"
 
 	"cloud.google.com/go/cloudsqlconn/errtypes"
 	"cloud.google.com/go/cloudsqlconn/internal/mock"
+	"golang.org/x/time/rate"
 )
 
 // genRSAKey generates an RSA key used for test.
@@ -112,6 +116,44 @@ func TestConnectInfo(t *testing.T) {
 	}
 }
 
+func TestCertificates(t *testing.T) {
+	ctx := context.Background()
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+	client, cleanup, err := mock.NewSQLAdminService(
+		ctx,
+		mock.InstanceGetSuccess(inst, 1),
+		mock.CreateEphemeralSuccess(inst, 1),
+	)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer func() {
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	i, err := NewInstance("my-project:my-region:my-instance", client, RSAKey, 30*time.Second)
+	if err != nil {
+		t.Fatalf("failed to create mock instance: %v", err)
+	}
+	defer i.Close()
+
+	cert, cas, expiry, err := i.Certificates(ctx)
+	if err != nil {
+		t.Fatalf("failed to retrieve certificates: %v", err)
+	}
+	if len(cert.Certificate) == 0 || cert.PrivateKey == nil {
+		t.Fatal("want a client certificate with its private key")
+	}
+	if cert.Leaf == nil || !cert.Leaf.NotAfter.Equal(expiry) {
+		t.Fatalf("want the client certificate to expire at %v, got = %v", expiry, cert.Leaf)
+	}
+	if len(cas) != 1 || cas[0].Subject.CommonName != inst.Cert.Subject.CommonName {
+		t.Fatalf("want the instance's server CA, got = %v", cas)
+	}
+}
+
 func TestConnectInfoErrors(t *testing.T) {
 	ctx := context.Background()
 
@@ -161,3 +203,819 @@ func TestClose(t *testing.T) {
 		t.Fatalf("failed to retrieve connect info: %v", err)
 	}
 }
+
+func TestHealthy(t *testing.T) {
+	ctx := context.Background()
+
+	client, cleanup, err := mock.NewSQLAdminService(ctx)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer cleanup()
+
+	// Use a timeout that should fail instantly
+	im, err := NewInstance("my-project:my-region:my-instance", client, RSAKey, 0)
+	if err != nil {
+		t.Fatalf("failed to initialize Instance: %v", err)
+	}
+	defer im.Close()
+
+	if _, _, err := im.ConnectInfo(ctx, PublicIP); err == nil {
+		t.Fatal("expected ConnectInfo to fail")
+	}
+	if im.Healthy() {
+		t.Fatal("want instance with failed refresh to be unhealthy")
+	}
+}
+
+func TestConnectInfoWhenInstanceNotRunning(t *testing.T) {
+	ctx := context.Background()
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance",
+		mock.WithState("MAINTENANCE"))
+	// A failed refresh is retried immediately, so allow for a second call.
+	client, cleanup, err := mock.NewSQLAdminService(
+		ctx,
+		mock.InstanceGetSuccess(inst, 2),
+	)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer cleanup()
+
+	im, err := NewInstance("my-project:my-region:my-instance", client, RSAKey, 30*time.Second)
+	if err != nil {
+		t.Fatalf("failed to initialize Instance: %v", err)
+	}
+	defer im.Close()
+
+	_, _, err = im.ConnectInfo(ctx, PublicIP)
+	if !errors.Is(err, errtypes.ErrInstanceNotRunning) {
+		t.Fatalf("when instance is not running, want = %v, got = %v", errtypes.ErrInstanceNotRunning, err)
+	}
+	state, err := im.State(ctx)
+	if err != nil {
+		t.Fatalf("State failed: %v", err)
+	}
+	if state != "MAINTENANCE" {
+		t.Fatalf("State mismatch, want = MAINTENANCE, got = %v", state)
+	}
+}
+
+func TestSetClient(t *testing.T) {
+	ctx := context.Background()
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+
+	oldClient, oldCleanup, err := mock.NewSQLAdminService(
+		ctx,
+		mock.InstanceGetSuccess(inst, 1),
+		mock.CreateEphemeralSuccess(inst, 1),
+	)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer oldCleanup()
+	newClient, newCleanup, err := mock.NewSQLAdminService(
+		ctx,
+		mock.InstanceGetSuccess(inst, 1),
+		mock.CreateEphemeralSuccess(inst, 1),
+	)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+
+	im, err := NewInstance("my-project:my-region:my-instance", oldClient, RSAKey, 30*time.Second)
+	if err != nil {
+		t.Fatalf("failed to initialize Instance: %v", err)
+	}
+	defer im.Close()
+	if _, _, err := im.ConnectInfo(ctx, PublicIP); err != nil {
+		t.Fatalf("failed to retrieve connect info: %v", err)
+	}
+
+	im.SetClient(newClient)
+	im.ForceRefresh()
+	if _, _, err := im.ConnectInfo(ctx, PublicIP); err != nil {
+		t.Fatalf("failed to retrieve connect info: %v", err)
+	}
+	if err := newCleanup(); err != nil {
+		t.Fatalf("expected refresh to use the new client: %v", err)
+	}
+}
+
+func TestSetRefreshTimeout(t *testing.T) {
+	ctx := context.Background()
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+	client, cleanup, err := mock.NewSQLAdminService(
+		ctx,
+		mock.InstanceGetSuccess(inst, 1),
+		mock.CreateEphemeralSuccess(inst, 1),
+	)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer cleanup()
+
+	im, err := NewInstance("my-project:my-region:my-instance", client, RSAKey, 30*time.Second)
+	if err != nil {
+		t.Fatalf("failed to initialize Instance: %v", err)
+	}
+	defer im.Close()
+	if err := im.Wait(ctx); err != nil {
+		t.Fatalf("failed to refresh: %v", err)
+	}
+
+	im.SetRefreshTimeout(time.Second)
+	im.resultGuard.RLock()
+	got := im.r.timeout
+	im.resultGuard.RUnlock()
+	if got != time.Second {
+		t.Fatalf("refresh timeout, want = %v, got = %v", time.Second, got)
+	}
+}
+
+func TestConnectInfoUsesLastGoodResult(t *testing.T) {
+	ctx := context.Background()
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+	client, cleanup, err := mock.NewSQLAdminService(
+		ctx,
+		mock.InstanceGetSuccess(inst, 1),
+		mock.CreateEphemeralSuccess(inst, 1),
+	)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer cleanup()
+
+	im, err := NewInstance("my-project:my-region:my-instance", client, RSAKey, 30*time.Second)
+	if err != nil {
+		t.Fatalf("failed to initialize Instance: %v", err)
+	}
+	defer im.Close()
+	if _, _, err := im.ConnectInfo(ctx, PublicIP); err != nil {
+		t.Fatalf("failed to retrieve connect info: %v", err)
+	}
+
+	// The mock has no more responses, so the forced refresh fails.
+	im.ForceRefresh()
+	if _, _, err := im.ConnectInfo(ctx, PublicIP); err != nil {
+		t.Fatalf("expected ConnectInfo to use the previous result, got = %v", err)
+	}
+	if !im.Degraded() {
+		t.Fatal("want instance to be degraded after a failed refresh")
+	}
+	if !im.Healthy() {
+		t.Fatal("want degraded instance to be healthy")
+	}
+}
+
+func TestConnectInfoServerValidationMismatch(t *testing.T) {
+	tcs := []struct {
+		desc string
+		inst mock.FakeCSQLInstance
+		mode string
+	}{
+		{
+			desc: "CAS validation with legacy instance",
+			inst: mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance",
+				mock.WithServerCAMode("GOOGLE_MANAGED_INTERNAL_CA")),
+			mode: CASServerValidation,
+		},
+		{
+			desc: "legacy validation with CAS instance",
+			inst: mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance", mock.WithCASServerCert()),
+			mode: LegacyServerValidation,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.desc, func(t *testing.T) {
+			ctx := context.Background()
+			client, cleanup, err := mock.NewSQLAdminService(
+				ctx,
+				mock.InstanceGetSuccess(tc.inst, 1),
+				mock.CreateEphemeralSuccess(tc.inst, 1),
+			)
+			if err != nil {
+				t.Fatalf("%s", err)
+			}
+			defer cleanup()
+
+			im, err := NewInstance(
+				"my-project:my-region:my-instance", client, RSAKey, 30*time.Second,
+				WithServerValidation(tc.mode),
+			)
+			if err != nil {
+				t.Fatalf("failed to initialize Instance: %v", err)
+			}
+			defer im.Close()
+
+			_, _, err = im.ConnectInfo(ctx, PublicIP)
+			var wantErr *errtypes.ConfigError
+			if !errors.As(err, &wantErr) {
+				t.Fatalf("want = %T, got = %v", wantErr, err)
+			}
+		})
+	}
+}
+
+func TestConnectInfoLegacyServerCARotation(t *testing.T) {
+	ctx := context.Background()
+	// A legacy instance whose CA is being rotated reports two CAs, and the
+	// Admin API may not report its server CA mode.
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance",
+		mock.WithServerCARotation())
+	client, cleanup, err := mock.NewSQLAdminService(
+		ctx,
+		mock.InstanceGetSuccess(inst, 1),
+		mock.CreateEphemeralSuccess(inst, 1),
+	)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer cleanup()
+
+	im, err := NewInstance("my-project:my-region:my-instance", client, RSAKey, 30*time.Second)
+	if err != nil {
+		t.Fatalf("failed to initialize Instance: %v", err)
+	}
+	defer im.Close()
+	if _, _, err := im.ConnectInfo(ctx, PublicIP); err != nil {
+		t.Fatalf("want legacy validation to be allowed during a CA rotation, got = %v", err)
+	}
+}
+
+func TestStatusReportsCapabilities(t *testing.T) {
+	ctx := context.Background()
+	inst := mock.NewFakeCSQLInstance(
+		"my-project", "my-region", "my-instance",
+		mock.WithCASServerCert(),
+		mock.WithDatabaseFlags(map[string]string{"cloudsql.iam_authentication": "on"}),
+	)
+	client, cleanup, err := mock.NewSQLAdminService(
+		ctx,
+		mock.InstanceGetSuccess(inst, 1),
+		mock.CreateEphemeralSuccess(inst, 1),
+	)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer cleanup()
+
+	im, err := NewInstance(
+		"my-project:my-region:my-instance", client, RSAKey, 30*time.Second,
+		WithServerValidation(CASServerValidation),
+	)
+	if err != nil {
+		t.Fatalf("failed to initialize Instance: %v", err)
+	}
+	defer im.Close()
+	if _, _, err := im.ConnectInfo(ctx, PublicIP); err != nil {
+		t.Fatalf("failed to retrieve connect info: %v", err)
+	}
+
+	s := im.Status()
+	if !s.IAMAuthN {
+		t.Error("want IAMAuthN to be true")
+	}
+	if !s.CASServerCerts {
+		t.Error("want CASServerCerts to be true")
+	}
+}
+
+func TestStatusCountsAPICalls(t *testing.T) {
+	ctx := context.Background()
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+	client, cleanup, err := mock.NewSQLAdminService(
+		ctx,
+		mock.InstanceGetSuccess(inst, 1),
+		mock.CreateEphemeralSuccess(inst, 1),
+	)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer cleanup()
+
+	var mu sync.Mutex
+	handled := make(map[string]int64)
+	im, err := NewInstance(
+		"my-project:my-region:my-instance", client, RSAKey, 30*time.Second,
+		WithAPICallHandler(func(method string) {
+			mu.Lock()
+			handled[method]++
+			mu.Unlock()
+		}),
+	)
+	if err != nil {
+		t.Fatalf("failed to initialize Instance: %v", err)
+	}
+	defer im.Close()
+	if _, _, err := im.ConnectInfo(ctx, PublicIP); err != nil {
+		t.Fatalf("failed to retrieve connect info: %v", err)
+	}
+
+	want := map[string]int64{GetInstanceMethod: 1, CreateEphemeralMethod: 1}
+	if got := im.Status().APICalls; !reflect.DeepEqual(got, want) {
+		t.Fatalf("APICalls mismatch, want = %v, got = %v", want, got)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(handled, want) {
+		t.Fatalf("handler calls mismatch, want = %v, got = %v", want, handled)
+	}
+}
+
+func TestRefreshDelay(t *testing.T) {
+	now := time.Now()
+	tcs := []struct {
+		desc    string
+		expiry  time.Time
+		latency time.Duration
+		want    time.Duration
+	}{
+		{
+			desc:   "hour long cert",
+			expiry: now.Add(time.Hour),
+			want:   55 * time.Minute,
+		},
+		{
+			desc:    "slow refresh starts earlier",
+			expiry:  now.Add(time.Hour),
+			latency: 30 * time.Second,
+			want:    54 * time.Minute,
+		},
+		{
+			desc:   "short lived cert",
+			expiry: now.Add(8 * time.Minute),
+			want:   4 * time.Minute,
+		},
+		{
+			desc:   "expired cert",
+			expiry: now.Add(-time.Minute),
+			want:   0,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.desc, func(t *testing.T) {
+			if got := refreshDelay(now, tc.expiry, tc.latency); got != tc.want {
+				t.Fatalf("refreshDelay mismatch, want = %v, got = %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestJitter(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		if got := jitter(55 * time.Minute); got > 55*time.Minute || got <= 54*time.Minute {
+			t.Fatalf("jitter(55m) = %v, want in (54m, 55m]", got)
+		}
+		if got := jitter(time.Minute); got > time.Minute || got <= 54*time.Second {
+			t.Fatalf("jitter(1m) = %v, want in (54s, 1m]", got)
+		}
+	}
+	if got := jitter(0); got != 0 {
+		t.Fatalf("jitter(0) = %v, want 0", got)
+	}
+}
+
+func TestStatusReportsNextRefresh(t *testing.T) {
+	ctx := context.Background()
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+	client, cleanup, err := mock.NewSQLAdminService(
+		ctx,
+		mock.InstanceGetSuccess(inst, 1),
+		mock.CreateEphemeralSuccess(inst, 1),
+	)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer cleanup()
+
+	im, err := NewInstance("my-project:my-region:my-instance", client, RSAKey, 30*time.Second)
+	if err != nil {
+		t.Fatalf("failed to initialize Instance: %v", err)
+	}
+	defer im.Close()
+	if _, _, err := im.ConnectInfo(ctx, PublicIP); err != nil {
+		t.Fatalf("failed to retrieve connect info: %v", err)
+	}
+
+	// ConnectInfo returns before the next refresh is scheduled.
+	var s Status
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		s = im.Status()
+		if s.NextRefresh.After(s.LastRefresh) {
+			break
+		}
+	}
+	if !s.NextRefresh.Before(s.Expiry.Add(-refreshBuffer)) {
+		t.Fatalf("want next refresh %v before %v", s.NextRefresh, s.Expiry.Add(-refreshBuffer))
+	}
+	if !s.NextRefresh.After(s.LastRefresh) {
+		t.Fatalf("want next refresh %v after last refresh %v", s.NextRefresh, s.LastRefresh)
+	}
+}
+
+func TestPauseAndResume(t *testing.T) {
+	ctx := context.Background()
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+	client, cleanup, err := mock.NewSQLAdminService(
+		ctx,
+		mock.InstanceGetSuccess(inst, 2),
+		mock.CreateEphemeralSuccess(inst, 2),
+	)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer func() {
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	im, err := NewInstance("my-project:my-region:my-instance", client, RSAKey, 30*time.Second)
+	if err != nil {
+		t.Fatalf("failed to initialize Instance: %v", err)
+	}
+	defer im.Close()
+	if _, _, err := im.ConnectInfo(ctx, PublicIP); err != nil {
+		t.Fatalf("failed to retrieve connect info: %v", err)
+	}
+	first := waitForNextRefresh(t, im).LastRefresh
+
+	im.Pause()
+	s := im.Status()
+	if !s.Paused || !s.NextRefresh.IsZero() {
+		t.Fatalf("want paused with no next refresh, got paused = %v, next refresh = %v", s.Paused, s.NextRefresh)
+	}
+	// The cached result is still used.
+	if _, _, err := im.ConnectInfo(ctx, PublicIP); err != nil {
+		t.Fatalf("failed to retrieve connect info while paused: %v", err)
+	}
+
+	im.Resume()
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		if s = im.Status(); s.LastRefresh.After(first) {
+			break
+		}
+	}
+	if s.Paused || !s.LastRefresh.After(first) {
+		t.Fatalf("want an immediate refresh after Resume, got paused = %v, last refresh = %v", s.Paused, s.LastRefresh)
+	}
+}
+
+func TestPausedInstanceRefreshesExpiredCert(t *testing.T) {
+	ctx := context.Background()
+	expiry := time.Now().Add(time.Second)
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance",
+		mock.WithCertExpiry(expiry))
+	client, cleanup, err := mock.NewSQLAdminService(
+		ctx,
+		mock.InstanceGetSuccess(inst, 2),
+		mock.CreateEphemeralSuccess(inst, 2),
+	)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer func() {
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	im, err := NewInstance("my-project:my-region:my-instance", client, RSAKey, 30*time.Second)
+	if err != nil {
+		t.Fatalf("failed to initialize Instance: %v", err)
+	}
+	defer im.Close()
+	im.Pause()
+	if _, _, err := im.ConnectInfo(ctx, PublicIP); err != nil {
+		t.Fatalf("failed to retrieve connect info: %v", err)
+	}
+	first := im.Status().LastRefresh
+
+	time.Sleep(time.Until(expiry.Add(100 * time.Millisecond)))
+	if _, _, err := im.ConnectInfo(ctx, PublicIP); err != nil {
+		t.Fatalf("failed to retrieve connect info: %v", err)
+	}
+	s := im.Status()
+	if !s.Paused || !s.LastRefresh.After(first) {
+		t.Fatalf("want a single refresh while paused, got paused = %v, last refresh = %v", s.Paused, s.LastRefresh)
+	}
+}
+
+func TestDelayedRefreshRefreshesBeforeHandshake(t *testing.T) {
+	ctx := context.Background()
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance",
+		mock.WithCertExpiry(time.Now().Add(time.Hour)))
+	client, cleanup, err := mock.NewSQLAdminService(
+		ctx,
+		mock.InstanceGetSuccess(inst, 2),
+		mock.CreateEphemeralSuccess(inst, 2),
+	)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer func() {
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	// the scheduled refresh is late, as if the process had been suspended
+	clock := &fakeClock{now: time.Now()}
+	late := func(RefreshInfo) (time.Duration, bool) { return 2 * time.Hour, true }
+	im, err := NewInstance("my-project:my-region:my-instance", client, RSAKey, 30*time.Second,
+		WithClock(clock), WithRefreshStrategy(late))
+	if err != nil {
+		t.Fatalf("failed to initialize Instance: %v", err)
+	}
+	defer im.Close()
+	if _, _, err := im.ConnectInfo(ctx, PublicIP); err != nil {
+		t.Fatalf("failed to retrieve connect info: %v", err)
+	}
+	first := waitForNextRefresh(t, im).LastRefresh
+
+	// a certificate with more time left is used as is
+	clock.Advance(time.Hour - time.Minute)
+	if _, _, err := im.ConnectInfo(ctx, PublicIP); err != nil {
+		t.Fatalf("failed to retrieve connect info: %v", err)
+	}
+	if got := im.Status().LastRefresh; got != first {
+		t.Fatalf("want no refresh, got last refresh = %v", got)
+	}
+
+	// one that may expire during the handshake is refreshed first
+	clock.Advance(45 * time.Second)
+	if _, _, err := im.ConnectInfo(ctx, PublicIP); err != nil {
+		t.Fatalf("failed to retrieve connect info: %v", err)
+	}
+	if got := im.Status().LastRefresh; !got.After(first) {
+		t.Fatalf("want a refresh before connecting, got last refresh = %v", got)
+	}
+}
+
+// waitForNextRefresh waits until the refresh that follows a completed refresh
+// has been scheduled and returns the instance's status.
+func waitForNextRefresh(t *testing.T, im *Instance) Status {
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		if s := im.Status(); s.NextRefresh.After(s.LastRefresh) {
+			return s
+		}
+	}
+	t.Fatal("timed out waiting for the next refresh to be scheduled")
+	return Status{}
+}
+
+func TestLateRefreshPausesInstance(t *testing.T) {
+	ctx := context.Background()
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+	client, cleanup, err := mock.NewSQLAdminService(
+		ctx,
+		mock.InstanceGetSuccess(inst, 3),
+		mock.CreateEphemeralSuccess(inst, 3),
+	)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer func() {
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	events := make(chan RefreshEvent, 3)
+	im, err := NewInstance("my-project:my-region:my-instance", client, RSAKey, 30*time.Second,
+		WithRefreshHandler(func(e RefreshEvent) { events <- e }),
+	)
+	if err != nil {
+		t.Fatalf("failed to initialize Instance: %v", err)
+	}
+	defer im.Close()
+	throttleInstance(t, im, events)
+	if _, _, err := im.ConnectInfo(ctx, PublicIP); err != nil {
+		t.Fatalf("failed to retrieve connect info: %v", err)
+	}
+	if s := im.Status(); !s.Throttled || !s.Paused || !s.NextRefresh.IsZero() {
+		t.Fatalf("want background refreshes paused, got throttled = %v, paused = %v, next refresh = %v",
+			s.Throttled, s.Paused, s.NextRefresh)
+	}
+
+	// A refresh that starts on time resumes background refreshes.
+	im.ForceRefresh()
+	if e := <-events; e.Throttled {
+		t.Fatalf("want refresh not to be throttled, got late = %v", e.Late)
+	}
+	if s := waitForNextRefresh(t, im); s.Throttled || s.Paused {
+		t.Fatalf("want background refreshes resumed, got throttled = %v, paused = %v", s.Throttled, s.Paused)
+	}
+}
+
+func TestPauseOutlastsThrottling(t *testing.T) {
+	ctx := context.Background()
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+	client, cleanup, err := mock.NewSQLAdminService(
+		ctx,
+		mock.InstanceGetSuccess(inst, 3),
+		mock.CreateEphemeralSuccess(inst, 3),
+	)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer func() {
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	events := make(chan RefreshEvent, 3)
+	im, err := NewInstance("my-project:my-region:my-instance", client, RSAKey, 30*time.Second,
+		WithRefreshHandler(func(e RefreshEvent) { events <- e }),
+	)
+	if err != nil {
+		t.Fatalf("failed to initialize Instance: %v", err)
+	}
+	defer im.Close()
+	throttleInstance(t, im, events)
+
+	// Once paused by the caller, an on-time refresh doesn't resume
+	// background refreshes.
+	im.Pause()
+	im.ForceRefresh()
+	<-events
+	if _, _, err := im.ConnectInfo(ctx, PublicIP); err != nil {
+		t.Fatalf("failed to retrieve connect info: %v", err)
+	}
+	if s := im.Status(); s.Throttled || !s.Paused || !s.NextRefresh.IsZero() {
+		t.Fatalf("want background refreshes paused, got throttled = %v, paused = %v, next refresh = %v",
+			s.Throttled, s.Paused, s.NextRefresh)
+	}
+}
+
+// throttleInstance waits for the initial refresh of im, whose refresh handler
+// sends to events, then runs a refresh that starts long after its scheduled
+// time and waits until background refreshes are paused.
+func throttleInstance(t *testing.T, im *Instance, events <-chan RefreshEvent) {
+	if e := <-events; e.Throttled {
+		t.Fatalf("want initial refresh not to be throttled, got late = %v", e.Late)
+	}
+	waitForNextRefresh(t, im)
+
+	im.resultGuard.Lock()
+	// Let later refreshes run without waiting on the rate limit.
+	im.r.clientLimiter = rate.NewLimiter(rate.Inf, 0)
+	im.next.Cancel()
+	im.next = im.scheduleRefresh(-2*throttleThreshold, nil)
+	im.cur = im.next
+	im.resultGuard.Unlock()
+
+	e := <-events
+	if !e.Throttled || e.Late < 2*throttleThreshold {
+		t.Fatalf("want throttled refresh, got throttled = %v, late = %v", e.Throttled, e.Late)
+	}
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		if im.Status().Throttled {
+			return
+		}
+	}
+	t.Fatal("timed out waiting for background refreshes to be paused")
+}
+
+func TestClockJumpDoesNotPauseInstance(t *testing.T) {
+	ctx := context.Background()
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+	client, cleanup, err := mock.NewSQLAdminService(
+		ctx,
+		mock.InstanceGetSuccess(inst, 2),
+		mock.CreateEphemeralSuccess(inst, 2),
+	)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer func() {
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	events := make(chan RefreshEvent, 2)
+	clock := &fakeClock{now: time.Now()}
+	im, err := NewInstance("my-project:my-region:my-instance", client, RSAKey, 30*time.Second,
+		WithClock(clock),
+		WithRefreshHandler(func(e RefreshEvent) { events <- e }),
+	)
+	if err != nil {
+		t.Fatalf("failed to initialize Instance: %v", err)
+	}
+	defer im.Close()
+	<-events
+	s := waitForNextRefresh(t, im)
+
+	// The clock moves well past the scheduled refresh at once, which isn't
+	// a sign of throttling.
+	clock.Advance(s.NextRefresh.Sub(clock.Now()) + 2*throttleThreshold)
+	if e := <-events; e.Throttled || e.Late != 0 {
+		t.Fatalf("want refresh not to be throttled, got throttled = %v, late = %v", e.Throttled, e.Late)
+	}
+	if s := waitForNextRefresh(t, im); s.Paused || s.Throttled {
+		t.Fatalf("want background refreshes to continue, got paused = %v, throttled = %v", s.Paused, s.Throttled)
+	}
+}
+
+func TestRotateKey(t *testing.T) {
+	ctx := context.Background()
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+	client, cleanup, err := mock.NewSQLAdminService(
+		ctx,
+		mock.InstanceGetSuccess(inst, 2),
+		mock.CreateEphemeralSuccess(inst, 2),
+	)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer func() {
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	im, err := NewInstance("my-project:my-region:my-instance", client, RSAKey, 30*time.Second)
+	if err != nil {
+		t.Fatalf("failed to initialize Instance: %v", err)
+	}
+	defer im.Close()
+	if _, _, err := im.ConnectInfo(ctx, PublicIP); err != nil {
+		t.Fatalf("failed to retrieve connect info: %v", err)
+	}
+
+	newKey := genRSAKey()
+	if err := im.RotateKey(ctx, newKey); err != nil {
+		t.Fatalf("RotateKey failed: %v", err)
+	}
+	_, cfg, err := im.ConnectInfo(ctx, PublicIP)
+	if err != nil {
+		t.Fatalf("failed to retrieve connect info: %v", err)
+	}
+	c := cfg.Certificates[0]
+	if c.PrivateKey != newKey || !reflect.DeepEqual(c.Leaf.PublicKey, &newKey.PublicKey) {
+		t.Fatal("want the client certificate to be issued for the new key")
+	}
+
+	im.Close()
+	if err := im.RotateKey(ctx, newKey); err == nil {
+		t.Fatal("want RotateKey to fail after Close")
+	}
+}
+
+func TestRefreshSeesContextValues(t *testing.T) {
+	type key struct{}
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+	client, cleanup, err := mock.NewSQLAdminService(
+		context.Background(),
+		mock.InstanceGetSuccess(inst, 2),
+	)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer func() {
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	type call struct {
+		value interface{}
+		err   error
+	}
+	calls := make(chan call, 10)
+	provider := func(ctx context.Context, _ string) (tls.Certificate, error) {
+		calls <- call{value: ctx.Value(key{}), err: ctx.Err()}
+		return tls.Certificate{}, errors.New("pki unavailable")
+	}
+	im, err := NewInstance("my-project:my-region:my-instance", client, RSAKey, 30*time.Second,
+		WithCertProvider(provider),
+		WithContextValues(context.WithValue(context.Background(), key{}, "first")),
+	)
+	if err != nil {
+		t.Fatalf("failed to initialize Instance: %v", err)
+	}
+	defer im.Close()
+	if c := <-calls; c.value != "first" {
+		t.Fatalf("initial refresh, got value = %v, want = first", c.value)
+	}
+
+	im.Wait(context.Background())
+	waitForNextRefresh(t, im)
+
+	// The refresh must not be bound to the caller's cancellation.
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), key{}, "second"))
+	cancel()
+	im.ForceRefreshContext(ctx)
+	c := <-calls
+	// let the refresh finish its Admin API call
+	im.Wait(context.Background())
+	if c.value != "second" {
+		t.Fatalf("forced refresh, got value = %v, want = second", c.value)
+	}
+	if c.err != nil {
+		t.Fatalf("forced refresh, got ctx error = %v, want nil", c.err)
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsql
+
+import "context"
+
+// RefreshLimiter bounds the number of refresh operations that run at the same
+// time across every Instance sharing it. Refreshes beyond the limit wait for a
+// running one to complete, which spreads out the Cloud SQL Admin API calls of
+// instances whose certificates expire at about the same time.
+//
+// Use NewRefreshLimiter to initialize a RefreshLimiter.
+type RefreshLimiter struct {
+	sem chan struct{}
+}
+
+// NewRefreshLimiter returns a RefreshLimiter that allows at most n concurrent
+// refresh operations.
+func NewRefreshLimiter(n int) *RefreshLimiter {
+	return &RefreshLimiter{sem: make(chan struct{}, n)}
+}
+
+// acquire blocks until a refresh may start or ctx is done. A nil
+// RefreshLimiter never blocks.
+func (l *RefreshLimiter) acquire(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	select {
+	case l.sem <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release marks a refresh started after acquire as complete.
+func (l *RefreshLimiter) release() {
+	if l == nil {
+		return
+	}
+	<-l.sem
+}
@@ -0,0 +1,84 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsql
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/cloudsqlconn/internal/mock"
+)
+
+func TestRefreshLimiter(t *testing.T) {
+	l := NewRefreshLimiter(1)
+	if err := l.acquire(context.Background()); err != nil {
+		t.Fatalf("acquire failed: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.acquire(ctx); err == nil {
+		t.Fatal("want acquire beyond the limit to block until ctx is done")
+	}
+	l.release()
+	if err := l.acquire(context.Background()); err != nil {
+		t.Fatalf("acquire after release failed: %v", err)
+	}
+
+	var nilLimiter *RefreshLimiter
+	if err := nilLimiter.acquire(context.Background()); err != nil {
+		t.Fatalf("want a nil RefreshLimiter to never block, got error: %v", err)
+	}
+	nilLimiter.release()
+}
+
+func TestInstanceWaitsForRefreshLimiter(t *testing.T) {
+	ctx := context.Background()
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+	client, cleanup, err := mock.NewSQLAdminService(
+		ctx,
+		mock.InstanceGetSuccess(inst, 1),
+		mock.CreateEphemeralSuccess(inst, 1),
+	)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer cleanup()
+
+	// Take the only slot so the instance's first refresh has to wait.
+	l := NewRefreshLimiter(1)
+	if err := l.acquire(ctx); err != nil {
+		t.Fatalf("acquire failed: %v", err)
+	}
+	im, err := NewInstance(
+		"my-project:my-region:my-instance", client, RSAKey, 30*time.Second,
+		WithRefreshLimiter(l),
+	)
+	if err != nil {
+		t.Fatalf("failed to initialize Instance: %v", err)
+	}
+	defer im.Close()
+
+	waitCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, _, err := im.ConnectInfo(waitCtx, PublicIP); err == nil {
+		t.Fatal("want ConnectInfo to wait while the limiter is full")
+	}
+
+	l.release()
+	if _, _, err := im.ConnectInfo(ctx, PublicIP); err != nil {
+		t.Fatalf("failed to retrieve connect info: %v", err)
+	}
+}
@@ -21,24 +21,187 @@ import (
 	"crypto/x509"
 	"encoding/pem"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"cloud.google.com/go/cloudsqlconn/errtypes"
+	"cloud.google.com/go/cloudsqlconn/internal/sqladmin"
 	"cloud.google.com/go/cloudsqlconn/internal/trace"
 	"golang.org/x/time/rate"
-	sqladmin "google.golang.org/api/sqladmin/v1beta4"
 )
 
 const (
 	PublicIP  = "PUBLIC"
 	PrivateIP = "PRIVATE"
+	// PublicIPv6 is the instance's public IPv6 address.
+	PublicIPv6 = "PUBLIC_IPV6"
+	// AutoIP is not an IP type itself. It selects among the instance's
+	// public and private IP addresses.
+	AutoIP = "AUTO"
+
+	// StateRunnable is the state of an instance that accepts connections.
+	StateRunnable = "RUNNABLE"
+	// StateStopped is reported for a runnable instance whose activation
+	// policy prevents it from running.
+	StateStopped = "STOPPED"
+
+	// LegacyServerValidation verifies that the server certificate was issued
+	// by the instance's CA and that its Common Name is the instance name.
+	LegacyServerValidation = "LEGACY"
+	// CASServerValidation verifies the server certificate's chain up to the
+	// instance's CA and verifies its SANs against the instance's addresses
+	// and DNS name.
+	// It is used for instances whose server certificates are issued by
+	// Certificate Authority Service.
+	CASServerValidation = "CAS"
+
+	// GetInstanceMethod and CreateEphemeralMethod are the Cloud SQL Admin
+	// API methods called by a refresh operation.
+	GetInstanceMethod     = "sql.instances.get"
+	CreateEphemeralMethod = "sql.sslCerts.createEphemeral"
 )
 
+// sessionCacheSize is the number of TLS sessions cached for resumption per
+// refresh result.
+const sessionCacheSize = 16
+
 // metadata contains information about a Cloud SQL instance needed to create connections.
 type metadata struct {
-	ipAddrs      map[string]string
-	serverCaCert *x509.Certificate
-	version      string
+	ipAddrs map[string]string
+	// serverCaCerts is the instance's server CA chain.
+	serverCaCerts []*x509.Certificate
+	version       string
+	instanceType  string
+	// state is the instance's state (e.g., RUNNABLE or MAINTENANCE).
+	state string
+	// maintenanceStart is the start of the next scheduled maintenance, if
+	// any.
+	maintenanceStart time.Time
+	// iamAuthN reports whether the instance has IAM database authentication
+	// enabled.
+	iamAuthN bool
+	// maxConns is the instance's connection limit, or 0 if unknown.
+	maxConns int
+	// serverCAMode is the kind of CA that the Admin API reports issues the
+	// instance's server certificates, or "" if it reports none.
+	serverCAMode string
+	// dnsName is the instance's DNS name, which the server certificates of
+	// instances using Certificate Authority Service carry as a SAN, or "" if
+	// the Admin API reports none.
+	dnsName string
+}
+
+// Server CA modes reported by the Admin API.
+const (
+	serverCAModeInternal   = "GOOGLE_MANAGED_INTERNAL_CA"
+	serverCAModeCAS        = "GOOGLE_MANAGED_CAS_CA"
+	serverCAModeCustomerCA = "CUSTOMER_MANAGED_CAS_CA"
+)
+
+// knownCAMode reports whether the Admin API reported a server CA mode that
+// tells whether the instance uses Certificate Authority Service.
+func (m metadata) knownCAMode() bool {
+	switch m.serverCAMode {
+	case serverCAModeInternal, serverCAModeCAS, serverCAModeCustomerCA:
+		return true
+	}
+	return false
+}
+
+// casCA reports whether the instance's server CA is issued by Certificate
+// Authority Service. Without a server CA mode from the Admin API, it guesses
+// from the CA chain: such instances report the CA along with the chain that
+// issued it, while legacy instances usually report a single self-signed
+// certificate.
+func (m metadata) casCA() bool {
+	if m.knownCAMode() {
+		return m.serverCAMode != serverCAModeInternal
+	}
+	return len(m.serverCaCerts) > 1
+}
+
+// checkServerValidation returns a ConfigError if the Admin API reports that
+// the instance's server certificates cannot be verified with the validation
+// mode. Without a reported server CA mode, no error is returned, as a legacy
+// instance whose CA is being rotated also reports several certificates; the
+// TLS handshake verifies the certificates instead.
+func (m metadata) checkServerValidation(inst string, validation string) error {
+	if !m.knownCAMode() {
+		return nil
+	}
+	switch {
+	case validation == CASServerValidation && !m.casCA():
+		return errtypes.NewConfigError(
+			"instance does not use Certificate Authority Service server certificates, use WithLegacyServerValidation instead",
+			inst,
+		)
+	case validation != CASServerValidation && m.casCA():
+		return errtypes.NewConfigError(
+			"instance uses Certificate Authority Service server certificates, use WithCASServerValidation instead",
+			inst,
+		)
+	}
+	return nil
+}
+
+// running reports whether the instance is able to accept connections. An
+// unknown state is assumed to be running.
+func (m metadata) running() bool {
+	return m.state == "" || m.state == StateRunnable
+}
+
+// IPAddrs returns a map of IP type to IP address for each address of db that
+// can be used to connect.
+func IPAddrs(db *sqladmin.DatabaseInstance) map[string]string {
+	ipAddrs := make(map[string]string)
+	for _, ip := range db.IpAddresses {
+		switch ip.Type {
+		case "PRIMARY":
+			ipAddrs[PublicIP] = ip.IpAddress
+		case "PRIVATE":
+			ipAddrs[PrivateIP] = ip.IpAddress
+		}
+	}
+	if db.Ipv6Address != "" {
+		ipAddrs[PublicIPv6] = db.Ipv6Address
+	}
+	return ipAddrs
+}
+
+// IAMAuthN reports whether db has IAM database authentication enabled.
+func IAMAuthN(db *sqladmin.DatabaseInstance) bool {
+	if db.Settings == nil {
+		return false
+	}
+	for _, f := range db.Settings.DatabaseFlags {
+		if (f.Name == "cloudsql.iam_authentication" || f.Name == "cloudsql_iam_authentication") &&
+			strings.EqualFold(f.Value, "on") {
+			return true
+		}
+	}
+	return false
+}
+
+// MaxConnections returns the connection limit set by db's database flags
+// (max_connections for MySQL and PostgreSQL, user connections for SQL
+// Server), or 0 if no flag sets one. Instances without the flag have a limit
+// that depends on their machine type, which the Admin API doesn't report.
+func MaxConnections(db *sqladmin.DatabaseInstance) int {
+	if db.Settings == nil {
+		return 0
+	}
+	for _, f := range db.Settings.DatabaseFlags {
+		if f.Name != "max_connections" && f.Name != "user connections" {
+			continue
+		}
+		n, err := strconv.Atoi(f.Value)
+		if err != nil || n < 0 {
+			return 0
+		}
+		return n
+	}
+	return 0
 }
 
 // fetchMetadata uses the Cloud SQL Admin APIs get method to retreive the information about a Cloud SQL instance
@@ -47,7 +210,7 @@ func fetchMetadata(ctx context.Context, client *sqladmin.Service, inst connName)
 	var end trace.EndSpanFunc
 	ctx, end = trace.StartSpan(ctx, "cloud.google.com/go/cloudsqlconn/internal.FetchMetadata")
 	defer func() { end(err) }()
-	db, err := client.Instances.Get(inst.project, inst.name).Context(ctx).Do()
+	db, err := client.GetInstance(ctx, inst.project, inst.name)
 	if err != nil {
 		return metadata{}, errtypes.NewRefreshError("failed to get instance metadata", inst.String(), err)
 	}
@@ -64,15 +227,7 @@ func fetchMetadata(ctx context.Context, client *sqladmin.Service, inst connName)
 	}
 
 	// parse any ip addresses that might be used to connect
-	ipAddrs := make(map[string]string)
-	for _, ip := range db.IpAddresses {
-		switch ip.Type {
-		case "PRIMARY":
-			ipAddrs[PublicIP] = ip.IpAddress
-		case "PRIVATE":
-			ipAddrs[PrivateIP] = ip.IpAddress
-		}
-	}
+	ipAddrs := IPAddrs(db)
 	if len(ipAddrs) == 0 {
 		return metadata{}, errtypes.NewConfigError(
 			"cannot connect to instance - it has no supported IP addresses",
@@ -80,24 +235,60 @@ func fetchMetadata(ctx context.Context, client *sqladmin.Service, inst connName)
 		)
 	}
 
-	// parse the server-side CA certificate
-	b, _ := pem.Decode([]byte(db.ServerCaCert.Cert))
-	if b == nil {
+	// parse the server-side CA certificates; instances using Certificate
+	// Authority Service return the full chain
+	var certs []*x509.Certificate
+	rest := []byte(db.ServerCaCert.Cert)
+	for {
+		var b *pem.Block
+		b, rest = pem.Decode(rest)
+		if b == nil {
+			break
+		}
+		cert, err := x509.ParseCertificate(b.Bytes)
+		if err != nil {
+			return metadata{}, errtypes.NewRefreshError(
+				fmt.Sprintf("failed to parse as X.509 certificate: %v", err),
+				inst.String(),
+				nil,
+			)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
 		return metadata{}, errtypes.NewRefreshError("failed to decode valid PEM cert", inst.String(), nil)
 	}
-	cert, err := x509.ParseCertificate(b.Bytes)
-	if err != nil {
-		return metadata{}, errtypes.NewRefreshError(
-			fmt.Sprintf("failed to parse as X.509 certificate: %v", err),
-			inst.String(),
-			nil,
-		)
+
+	state := db.State
+	if state == StateRunnable && db.Settings != nil && db.Settings.ActivationPolicy == "NEVER" {
+		state = StateStopped
+	}
+
+	var maintenanceStart time.Time
+	if db.ScheduledMaintenance != nil && db.ScheduledMaintenance.StartTime != "" {
+		maintenanceStart, err = time.Parse(time.RFC3339, db.ScheduledMaintenance.StartTime)
+		if err != nil {
+			return metadata{}, errtypes.NewRefreshError("failed to parse scheduled maintenance time", inst.String(), err)
+		}
+	}
+
+	var caMode string
+	if db.Settings != nil && db.Settings.IpConfiguration != nil {
+		caMode = db.Settings.IpConfiguration.ServerCaMode
 	}
 
 	m = metadata{
-		ipAddrs:      ipAddrs,
-		serverCaCert: cert,
-		version:      db.DatabaseVersion,
+		ipAddrs:       ipAddrs,
+		serverCaCerts: certs,
+		version:       db.DatabaseVersion,
+		instanceType:  db.InstanceType,
+		state:         state,
+
+		maintenanceStart: maintenanceStart,
+		iamAuthN:         IAMAuthN(db),
+		maxConns:         MaxConnections(db),
+		serverCAMode:     caMode,
+		dnsName:          strings.TrimSuffix(db.DnsName, "."),
 	}
 
 	return m, nil
@@ -118,7 +309,7 @@ func fetchEphemeralCert(ctx context.Context, client *sqladmin.Service, inst conn
 	req := sqladmin.SslCertsCreateEphemeralRequest{
 		PublicKey: string(pem.EncodeToMemory(&pem.Block{Bytes: clientPubKey, Type: "RSA PUBLIC KEY"})),
 	}
-	resp, err := client.SslCerts.CreateEphemeral(inst.project, inst.name, &req).Context(ctx).Do()
+	resp, err := client.CreateEphemeral(ctx, inst.project, inst.name, &req)
 	if err != nil {
 		return tls.Certificate{}, errtypes.NewRefreshError(
 			"create ephemeral cert failed",
@@ -153,10 +344,48 @@ func fetchEphemeralCert(ctx context.Context, client *sqladmin.Service, inst conn
 	return c, nil
 }
 
+// fetchProvidedCert obtains a client certificate from provider in place of an
+// ephemeral certificate. The certificate's leaf is parsed if the provider did
+// not set it, because its expiration determines when to refresh.
+func fetchProvidedCert(ctx context.Context, provider CertProvider, inst connName) (c tls.Certificate, err error) {
+	c, err = provider(ctx, inst.String())
+	if err != nil {
+		return tls.Certificate{}, errtypes.NewRefreshError("client certificate provider failed", inst.String(), err)
+	}
+	if len(c.Certificate) == 0 {
+		return tls.Certificate{}, errtypes.NewRefreshError("client certificate provider returned no certificate", inst.String(), nil)
+	}
+	if c.Leaf == nil {
+		c.Leaf, err = x509.ParseCertificate(c.Certificate[0])
+		if err != nil {
+			return tls.Certificate{}, errtypes.NewRefreshError(
+				fmt.Sprintf("failed to parse as X.509 certificate: %v", err),
+				inst.String(),
+				nil,
+			)
+		}
+	}
+	return c, nil
+}
+
 // createTLSConfig returns a *tls.Config for connecting securely to the Cloud SQL instance.
-func createTLSConfig(inst connName, m metadata, cert tls.Certificate) *tls.Config {
+// validation selects how the server's certificate is verified.
+func createTLSConfig(inst connName, m metadata, cert tls.Certificate, validation string) *tls.Config {
 	certs := x509.NewCertPool()
-	certs.AddCert(m.serverCaCert)
+	for _, c := range m.serverCaCerts {
+		certs.AddCert(c)
+	}
+	verify := genVerifyPeerCertificateFunc(inst, certs)
+	if validation == CASServerValidation {
+		var names []string
+		for _, a := range m.ipAddrs {
+			names = append(names, a)
+		}
+		if m.dnsName != "" {
+			names = append(names, m.dnsName)
+		}
+		verify = genCASVerifyPeerCertificateFunc(inst, certs, names)
+	}
 
 	cfg := &tls.Config{
 		ServerName:   inst.String(),
@@ -170,7 +399,11 @@ func createTLSConfig(inst connName, m metadata, cert tls.Certificate) *tls.Confi
 		// certificates, we instead need to implement our own VerifyPeerCertificate function
 		// that will verify that the certificate is OK.
 		InsecureSkipVerify:    true,
-		VerifyPeerCertificate: genVerifyPeerCertificateFunc(inst, certs),
+		VerifyPeerCertificate: verify,
+		// Cache sessions so that repeated connections resume them with an
+		// abbreviated handshake. Each refresh creates a new cache, so a
+		// session is never resumed with a different client certificate.
+		ClientSessionCache: tls.NewLRUClientSessionCache(sessionCacheSize),
 	}
 	return cfg
 }
@@ -208,12 +441,55 @@ func genVerifyPeerCertificateFunc(cn connName, pool *x509.CertPool) func(rawCert
 	}
 }
 
+// genCASVerifyPeerCertificateFunc creates a VerifyPeerCertificate func for
+// instances whose server certificates are issued by Certificate Authority
+// Service. The peer's chain is verified against the pool, and the leaf
+// certificate's SANs must match one of names, the instance's IP addresses and
+// DNS name.
+func genCASVerifyPeerCertificateFunc(cn connName, pool *x509.CertPool, names []string) func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errtypes.NewDialError("no certificate to verify", cn.String(), nil)
+		}
+
+		var certs []*x509.Certificate
+		for _, raw := range rawCerts {
+			c, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return errtypes.NewDialError("failed to parse X.509 certificate", cn.String(), err)
+			}
+			certs = append(certs, c)
+		}
+
+		intermediates := x509.NewCertPool()
+		for _, c := range certs[1:] {
+			intermediates.AddCert(c)
+		}
+		opts := x509.VerifyOptions{Roots: pool, Intermediates: intermediates}
+		if _, err := certs[0].Verify(opts); err != nil {
+			return errtypes.NewDialError("failed to verify certificate", cn.String(), err)
+		}
+
+		for _, n := range names {
+			if certs[0].VerifyHostname(n) == nil {
+				return nil
+			}
+		}
+		return errtypes.NewDialError(
+			fmt.Sprintf("certificate is not valid for any of the instance's names %v", names),
+			cn.String(),
+			nil,
+		)
+	}
+}
+
 // newRefresher creates a Refresher.
 func newRefresher(timeout time.Duration, interval time.Duration, burst int, svc *sqladmin.Service) refresher {
 	return refresher{
 		timeout:       timeout,
 		clientLimiter: rate.NewLimiter(rate.Every(interval), burst),
 		client:        svc,
+		validation:    LegacyServerValidation,
 	}
 }
 
@@ -225,6 +501,22 @@ type refresher struct {
 
 	clientLimiter *rate.Limiter
 	client        *sqladmin.Service
+	// validation is the server certificate validation mode (i.e., LEGACY or
+	// CAS).
+	validation string
+	// certProvider, if set, supplies the client certificate instead of the
+	// Cloud SQL Admin API's ephemeral certificates.
+	certProvider CertProvider
+	// onAPICall, if set, is called before each Cloud SQL Admin API call with
+	// the method's name.
+	onAPICall func(method string)
+}
+
+// apiCall reports a call to the Cloud SQL Admin API method.
+func (r refresher) apiCall(method string) {
+	if r.onAPICall != nil {
+		r.onAPICall(method)
+	}
 }
 
 // performRefresh immediately performs a full refresh operation using the Cloud SQL Admin API.
@@ -258,6 +550,7 @@ func (r refresher) performRefresh(ctx context.Context, cn connName, k *rsa.Priva
 	mdC := make(chan mdRes, 1)
 	go func() {
 		defer close(mdC)
+		r.apiCall(GetInstanceMethod)
 		md, err := fetchMetadata(ctx, r.client, cn)
 		mdC <- mdRes{md, err}
 	}()
@@ -270,6 +563,12 @@ func (r refresher) performRefresh(ctx context.Context, cn connName, k *rsa.Priva
 	ecC := make(chan ecRes, 1)
 	go func() {
 		defer close(ecC)
+		if r.certProvider != nil {
+			ec, err := fetchProvidedCert(ctx, r.certProvider, cn)
+			ecC <- ecRes{ec, err}
+			return
+		}
+		r.apiCall(CreateEphemeralMethod)
 		ec, err := fetchEphemeralCert(ctx, r.client, cn, k)
 		ecC <- ecRes{ec, err}
 	}()
@@ -284,6 +583,13 @@ func (r refresher) performRefresh(ctx context.Context, cn connName, k *rsa.Priva
 	case <-ctx.Done():
 		return md, nil, time.Time{}, fmt.Errorf("refresh failed: %w", ctx.Err())
 	}
+	if !md.running() {
+		return md, nil, time.Time{}, errtypes.NewRefreshError(
+			fmt.Sprintf("instance state is %s", md.state),
+			cn.String(),
+			errtypes.ErrInstanceNotRunning,
+		)
+	}
 	var ec tls.Certificate
 	select {
 	case r := <-ecC:
@@ -295,7 +601,7 @@ func (r refresher) performRefresh(ctx context.Context, cn connName, k *rsa.Priva
 		return md, nil, time.Time{}, fmt.Errorf("refresh failed: %w", ctx.Err())
 	}
 
-	c = createTLSConfig(cn, md, ec)
+	c = createTLSConfig(cn, md, ec, r.validation)
 	// This should never not be the case, but we check to avoid a potential nil-pointer
 	if len(c.Certificates) > 0 {
 		expiry = c.Certificates[0].Leaf.NotAfter
@@ -18,14 +18,18 @@ import (
 	"bytes"
 	"context"
 	"crypto/rsa"
+	"crypto/tls"
 	"crypto/x509"
 	"encoding/pem"
 	"errors"
+	"net/http"
+	"reflect"
 	"testing"
 	"time"
 
 	"cloud.google.com/go/cloudsqlconn/errtypes"
 	"cloud.google.com/go/cloudsqlconn/internal/mock"
+	"cloud.google.com/go/cloudsqlconn/internal/sqladmin"
 )
 
 func TestRefresh(t *testing.T) {
@@ -110,7 +114,8 @@ func TestRefreshFailsFast(t *testing.T) {
 	}
 
 	// force the rate limiter to throttle with a timed out context
-	ctx, _ = context.WithTimeout(context.Background(), time.Millisecond)
+	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
 	_, _, _, err = r.performRefresh(ctx, cn, RSAKey)
 
 	var wantErr *errtypes.DialError
@@ -124,20 +129,20 @@ func TestRefreshWithFailedMetadataCall(t *testing.T) {
 
 	testCases := []struct {
 		req     *mock.Request
-		wantErr error
+		wantErr interface{}
 		desc    string
 	}{
 		{
 			req: mock.CreateEphemeralSuccess(
 				mock.NewFakeCSQLInstance(cn.project, cn.region, cn.name), 1),
-			wantErr: &errtypes.RefreshError{},
+			wantErr: new(*errtypes.RefreshError),
 			desc:    "When the Metadata call fails",
 		},
 		{
 			req: mock.InstanceGetSuccess(
 				mock.NewFakeCSQLInstance(cn.project, cn.region, cn.name,
 					mock.WithRegion("some-other-region")), 1),
-			wantErr: &errtypes.RefreshError{},
+			wantErr: new(*errtypes.RefreshError),
 			desc:    "When the region does not match",
 		},
 		{
@@ -147,7 +152,7 @@ func TestRefreshWithFailedMetadataCall(t *testing.T) {
 					mock.WithRegion("my-region"),
 					mock.WithFirstGenBackend(),
 				), 1),
-			wantErr: &errtypes.ConfigError{},
+			wantErr: new(*errtypes.ConfigError),
 			desc:    "When the instance isn't Second generation",
 		},
 		{
@@ -157,7 +162,7 @@ func TestRefreshWithFailedMetadataCall(t *testing.T) {
 					mock.WithRegion("my-region"),
 					mock.WithMissingIPAddrs(),
 				), 1),
-			wantErr: &errtypes.ConfigError{},
+			wantErr: new(*errtypes.ConfigError),
 			desc:    "When the instance has no supported IP addresses",
 		},
 		{
@@ -169,7 +174,7 @@ func TestRefreshWithFailedMetadataCall(t *testing.T) {
 						return nil, nil
 					}),
 				), 1),
-			wantErr: &errtypes.RefreshError{},
+			wantErr: new(*errtypes.RefreshError),
 			desc:    "When the server cert does not decode",
 		},
 		{
@@ -186,7 +191,7 @@ func TestRefreshWithFailedMetadataCall(t *testing.T) {
 						return certPEM.Bytes(), nil
 					}),
 				), 1),
-			wantErr: &errtypes.RefreshError{},
+			wantErr: new(*errtypes.RefreshError),
 			desc:    "When the cert is not a valid X.509 cert",
 		},
 	}
@@ -204,7 +209,7 @@ func TestRefreshWithFailedMetadataCall(t *testing.T) {
 			r := newRefresher(time.Hour, 30*time.Second, 1, client)
 			_, _, _, err = r.performRefresh(context.Background(), cn, RSAKey)
 
-			if !errors.As(err, &tc.wantErr) {
+			if !errors.As(err, tc.wantErr) {
 				t.Errorf("[%v] PerformRefresh failed with unexpected error, want = %T, got = %v", i, tc.wantErr, err)
 			}
 		})
@@ -217,12 +222,12 @@ func TestRefreshWithFailedEphemeralCertCall(t *testing.T) {
 
 	testCases := []struct {
 		reqs    []*mock.Request
-		wantErr error
+		wantErr interface{}
 		desc    string
 	}{
 		{
 			reqs:    []*mock.Request{mock.InstanceGetSuccess(inst, 1)}, // no ephemeral cert call registered
-			wantErr: &errtypes.RefreshError{},
+			wantErr: new(*errtypes.RefreshError),
 			desc:    "When the CreateEphemeralCert call fails",
 		},
 		{
@@ -235,7 +240,7 @@ func TestRefreshWithFailedEphemeralCertCall(t *testing.T) {
 							}),
 					), 1),
 			},
-			wantErr: &errtypes.RefreshError{},
+			wantErr: new(*errtypes.RefreshError),
 			desc:    "When decoding the cert fails", // SQL Admin API fail
 		},
 		{
@@ -253,7 +258,7 @@ func TestRefreshWithFailedEphemeralCertCall(t *testing.T) {
 							}),
 					), 1),
 			},
-			wantErr: &errtypes.RefreshError{},
+			wantErr: new(*errtypes.RefreshError),
 			desc:    "When parsing the cert fails", // SQL Admin API fail
 		},
 	}
@@ -270,7 +275,7 @@ func TestRefreshWithFailedEphemeralCertCall(t *testing.T) {
 		r := newRefresher(time.Hour, 30*time.Second, 1, client)
 		_, _, _, err = r.performRefresh(context.Background(), cn, RSAKey)
 
-		if !errors.As(err, &tc.wantErr) {
+		if !errors.As(err, tc.wantErr) {
 			t.Errorf("[%v] PerformRefresh failed with unexpected error, want = %T, got = %v", i, tc.wantErr, err)
 		}
 	}
@@ -362,3 +367,149 @@ func TestRefreshBuildsTLSConfig(t *testing.T) {
 		t.Fatalf("when certification fails, want = %T, got = %v", wantErr, err)
 	}
 }
+
+func TestRefreshBuildsCASTLSConfig(t *testing.T) {
+	cn, _ := parseConnName("my-project:my-region:my-instance")
+	inst := mock.NewFakeCSQLInstance(cn.project, cn.region, cn.name,
+		mock.WithPublicIP("10.0.0.1"), mock.WithDNSName("abc123.my-region.sql.goog."))
+	client, cleanup, err := mock.NewSQLAdminService(
+		context.Background(),
+		mock.InstanceGetSuccess(inst, 1),
+		mock.CreateEphemeralSuccess(inst, 1),
+	)
+	if err != nil {
+		t.Fatalf("failed to create test SQL admin service: %s", err)
+	}
+	defer cleanup()
+
+	r := newRefresher(time.Hour, 30*time.Second, 1, client)
+	r.validation = CASServerValidation
+	_, tlsCfg, _, err := r.performRefresh(context.Background(), cn, RSAKey)
+	if err != nil {
+		t.Fatalf("expected no error, got = %v", err)
+	}
+	verifyPeerCert := tlsCfg.VerifyPeerCertificate
+
+	good := mock.GenerateCertWithSANs(inst, nil, []string{"10.0.0.1"})
+	if err := verifyPeerCert([][]byte{good}, nil); err != nil {
+		t.Fatalf("expected to verify peer cert, got error: %v", err)
+	}
+	// instances reached by DNS name present it as a SAN
+	byName := mock.GenerateCertWithSANs(inst, []string{"abc123.my-region.sql.goog"}, nil)
+	if err := verifyPeerCert([][]byte{byName}, nil); err != nil {
+		t.Fatalf("expected to verify peer cert with a DNS name SAN, got error: %v", err)
+	}
+
+	var wantErr *errtypes.DialError
+	wrongSAN := mock.GenerateCertWithSANs(inst, []string{"other.sql.goog"}, []string{"10.0.0.2"})
+	if err := verifyPeerCert([][]byte{wrongSAN}, nil); !errors.As(err, &wantErr) {
+		t.Fatalf("when SANs mismatch, want = %T, got = %v", wantErr, err)
+	}
+
+	other := mock.NewFakeCSQLInstance(cn.project, cn.region, cn.name)
+	untrusted := mock.GenerateCertWithSANs(other, nil, []string{"10.0.0.1"})
+	if err := verifyPeerCert([][]byte{untrusted}, nil); !errors.As(err, &wantErr) {
+		t.Fatalf("when certification fails, want = %T, got = %v", wantErr, err)
+	}
+
+	if err := verifyPeerCert(nil, nil); !errors.As(err, &wantErr) {
+		t.Fatalf("when no certificate is presented, want = %T, got = %v", wantErr, err)
+	}
+}
+
+func TestRefreshWithCertProviderErrors(t *testing.T) {
+	cn, _ := parseConnName("my-project:my-region:my-instance")
+	inst := mock.NewFakeCSQLInstance(cn.project, cn.region, cn.name)
+	testCases := []struct {
+		provider CertProvider
+		desc     string
+	}{
+		{
+			provider: func(context.Context, string) (tls.Certificate, error) {
+				return tls.Certificate{}, errors.New("pki unavailable")
+			},
+			desc: "When the provider fails",
+		},
+		{
+			provider: func(context.Context, string) (tls.Certificate, error) {
+				return tls.Certificate{}, nil
+			},
+			desc: "When the provider returns no certificate",
+		},
+		{
+			provider: func(context.Context, string) (tls.Certificate, error) {
+				return tls.Certificate{Certificate: [][]byte{[]byte("not a cert")}}, nil
+			},
+			desc: "When the certificate cannot be parsed",
+		},
+	}
+	for _, tc := range testCases {
+		client, cleanup, err := mock.NewSQLAdminService(
+			context.Background(),
+			mock.InstanceGetSuccess(inst, 1),
+		)
+		if err != nil {
+			t.Fatalf("failed to create test SQL admin service: %s", err)
+		}
+		defer cleanup()
+
+		r := newRefresher(time.Hour, 30*time.Second, 1, client)
+		r.certProvider = tc.provider
+		_, _, _, err = r.performRefresh(context.Background(), cn, RSAKey)
+		var wantErr *errtypes.RefreshError
+		if !errors.As(err, &wantErr) {
+			t.Errorf("[%v] want = %T, got = %v", tc.desc, wantErr, err)
+		}
+	}
+}
+
+func TestRefreshPreservesAPIErrorDetails(t *testing.T) {
+	cn, _ := parseConnName("my-project:my-region:my-instance")
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+	client, cleanup, err := mock.NewSQLAdminService(
+		context.Background(),
+		mock.InstanceGetError(inst, http.StatusForbidden, "accessNotConfigured", 1),
+		mock.CreateEphemeralSuccess(inst, 1),
+	)
+	if err != nil {
+		t.Fatalf("failed to create test SQL admin service: %s", err)
+	}
+	defer cleanup()
+
+	r := newRefresher(time.Hour, 30*time.Second, 1, client)
+	_, _, _, err = r.performRefresh(context.Background(), cn, RSAKey)
+	var refreshErr *errtypes.RefreshError
+	if !errors.As(err, &refreshErr) {
+		t.Fatalf("want = %T, got = %v", refreshErr, err)
+	}
+	if got := refreshErr.HTTPStatusCode(); got != http.StatusForbidden {
+		t.Errorf("HTTPStatusCode mismatch, want = %v, got = %v", http.StatusForbidden, got)
+	}
+	if got := refreshErr.Reason(); got != "accessNotConfigured" {
+		t.Errorf("Reason mismatch, want = accessNotConfigured, got = %v", got)
+	}
+	want := []string{"https://example.com/help"}
+	if got := refreshErr.HelpLinks(); !reflect.DeepEqual(got, want) {
+		t.Errorf("HelpLinks mismatch, want = %v, got = %v", want, got)
+	}
+}
+
+func TestMaxConnections(t *testing.T) {
+	tcs := []struct {
+		desc  string
+		flags []*sqladmin.DatabaseFlags
+		want  int
+	}{
+		{desc: "no flags"},
+		{desc: "MySQL or PostgreSQL", flags: []*sqladmin.DatabaseFlags{{Name: "max_connections", Value: "500"}}, want: 500},
+		{desc: "SQL Server", flags: []*sqladmin.DatabaseFlags{{Name: "user connections", Value: "200"}}, want: 200},
+		{desc: "invalid value", flags: []*sqladmin.DatabaseFlags{{Name: "max_connections", Value: "many"}}},
+		{desc: "other flags", flags: []*sqladmin.DatabaseFlags{{Name: "log_connections", Value: "on"}}},
+	}
+	for _, tc := range tcs {
+		db := &sqladmin.DatabaseInstance{Settings: &sqladmin.Settings{DatabaseFlags: tc.flags}}
+		if got := MaxConnections(db); got != tc.want {
+			t.Errorf("%s: want = %d, got = %d", tc.desc, tc.want, got)
+		}
+	}
+}
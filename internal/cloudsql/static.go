@@ -0,0 +1,75 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsql
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/cloudsqlconn/errtypes"
+)
+
+// StaticInfo is the information used to connect to an instance when it is
+// provisioned out-of-band rather than retrieved from the Cloud SQL Admin API.
+type StaticInfo struct {
+	// IPAddrs maps IP types to the instance's addresses.
+	IPAddrs map[string]string
+	// ServerCACerts is the instance's server CA chain.
+	ServerCACerts []*x509.Certificate
+	// ClientCert is the client certificate, with its private key.
+	ClientCert tls.Certificate
+}
+
+// WithStaticInfo returns an InstanceOption that connects with info and never
+// calls the Cloud SQL Admin API. Refreshes fail with
+// errtypes.ErrStaticCertExpired once the client certificate expires.
+func WithStaticInfo(info StaticInfo) InstanceOption {
+	return func(i *Instance) {
+		i.static = &info
+	}
+}
+
+// staticRefresh performs a refresh operation from the instance's static
+// information, verifying server certificates as r does.
+func (i *Instance) staticRefresh(r refresher) (metadata, *tls.Config, time.Time, error) {
+	cert := i.static.ClientCert
+	if len(cert.Certificate) == 0 {
+		return metadata{}, nil, time.Time{}, errtypes.NewConfigError("static connect info has no client certificate", i.String())
+	}
+	if cert.Leaf == nil {
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return metadata{}, nil, time.Time{}, errtypes.NewConfigError(
+				fmt.Sprintf("failed to parse static client certificate: %v", err),
+				i.String(),
+			)
+		}
+		cert.Leaf = leaf
+	}
+	if i.clock.Now().After(cert.Leaf.NotAfter) {
+		return metadata{}, nil, time.Time{}, errtypes.NewRefreshError(
+			fmt.Sprintf("static client certificate expired at %v", cert.Leaf.NotAfter.Format(time.RFC3339)),
+			i.String(),
+			errtypes.ErrStaticCertExpired,
+		)
+	}
+	md := metadata{
+		ipAddrs:       i.static.IPAddrs,
+		serverCaCerts: i.static.ServerCACerts,
+	}
+	return md, createTLSConfig(i.connName, md, cert, r.validation), cert.Leaf.NotAfter, nil
+}
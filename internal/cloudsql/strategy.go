@@ -0,0 +1,82 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsql
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// RefreshInfo describes an instance when a refresh operation completes, or
+// when a connection attempt uses an instance with no background refresh
+// scheduled, for a RefreshStrategy to schedule the next one.
+type RefreshInfo struct {
+	// Now is when the refresh completed or the connection attempt started.
+	Now time.Time
+	// Expiry is when the certificate of the most recent successful refresh
+	// expires, or the zero time if none has succeeded.
+	Expiry time.Time
+	// Latency is how long the refresh took, or zero for a connection
+	// attempt.
+	Latency time.Duration
+	// Failures is the number of consecutive failed refreshes, including
+	// this one. It is zero if the refresh succeeded.
+	Failures int
+	// LastUsed is when a connection attempt last used the instance's
+	// information, or the zero time if none has.
+	LastUsed time.Time
+}
+
+// RefreshStrategy returns how long after info.Now to start the next refresh
+// in the background, or false to refresh only when a connection attempt finds
+// that the current result failed or its certificate expired.
+type RefreshStrategy func(info RefreshInfo) (time.Duration, bool)
+
+// RefreshAhead is the default RefreshStrategy. It refreshes in the background
+// well before the certificate expires and retries failed refreshes with an
+// exponential backoff, so that connection attempts never wait on a refresh.
+func RefreshAhead(info RefreshInfo) (time.Duration, bool) {
+	if info.Failures > 0 {
+		return retryDelay(info.Failures), true
+	}
+	return jitter(refreshDelay(info.Now, info.Expiry, info.Latency)), true
+}
+
+// WithRefreshStrategy returns an InstanceOption that schedules refresh
+// operations with s in place of RefreshAhead.
+func WithRefreshStrategy(s RefreshStrategy) InstanceOption {
+	return func(i *Instance) {
+		i.strategy = s
+	}
+}
+
+// useTracker records when an instance was last used. It is allocated
+// separately so that last is 64-bit aligned for atomic access.
+type useTracker struct {
+	// last is the Unix time in nanoseconds of the last use, or zero.
+	last int64
+}
+
+func (u *useTracker) used(now time.Time) {
+	atomic.StoreInt64(&u.last, now.UnixNano())
+}
+
+func (u *useTracker) lastUsed() time.Time {
+	n := atomic.LoadInt64(&u.last)
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
@@ -0,0 +1,142 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsql
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/cloudsqlconn/internal/mock"
+)
+
+func TestRefreshAhead(t *testing.T) {
+	now := time.Now()
+	d, ok := RefreshAhead(RefreshInfo{Now: now, Expiry: now.Add(time.Hour)})
+	if !ok || d < 45*time.Minute || d > 55*time.Minute {
+		t.Fatalf("after a successful refresh, want about 55m in the background, got = %v, %v", d, ok)
+	}
+	d, ok = RefreshAhead(RefreshInfo{Now: now, Failures: 3})
+	if !ok || d != retryDelay(3) {
+		t.Fatalf("after failed refreshes, want = %v in the background, got = %v, %v", retryDelay(3), d, ok)
+	}
+}
+
+func TestLazyRefreshStrategy(t *testing.T) {
+	ctx := context.Background()
+	expiry := time.Now().Add(time.Second)
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance",
+		mock.WithCertExpiry(expiry))
+	client, cleanup, err := mock.NewSQLAdminService(
+		ctx,
+		mock.InstanceGetSuccess(inst, 2),
+		mock.CreateEphemeralSuccess(inst, 2),
+	)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer func() {
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	var (
+		mu    sync.Mutex
+		infos []RefreshInfo
+	)
+	lazy := func(info RefreshInfo) (time.Duration, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		infos = append(infos, info)
+		return 0, false
+	}
+	im, err := NewInstance("my-project:my-region:my-instance", client, RSAKey, 30*time.Second,
+		WithRefreshStrategy(lazy))
+	if err != nil {
+		t.Fatalf("failed to initialize Instance: %v", err)
+	}
+	defer im.Close()
+	if _, _, err := im.ConnectInfo(ctx, PublicIP); err != nil {
+		t.Fatalf("failed to retrieve connect info: %v", err)
+	}
+
+	// the result expires without a background refresh
+	time.Sleep(time.Until(expiry.Add(100 * time.Millisecond)))
+	if s := im.Status(); !s.NextRefresh.IsZero() {
+		t.Fatalf("want no background refresh to be scheduled, got = %v", s.NextRefresh)
+	}
+	if _, _, err := im.ConnectInfo(ctx, PublicIP); err != nil {
+		t.Fatalf("failed to retrieve connect info: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(infos) < 2 {
+		t.Fatalf("want the strategy to be consulted after each of 2 refreshes, got = %v", infos)
+	}
+	if last := infos[len(infos)-1]; last.LastUsed.IsZero() || last.Expiry.IsZero() {
+		t.Fatalf("want the second refresh to see the instance's use and expiry, got = %+v", last)
+	}
+}
+
+func TestLazyInstanceRefreshesInBackgroundOnceUsed(t *testing.T) {
+	ctx := context.Background()
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+	client, cleanup, err := mock.NewSQLAdminService(
+		ctx,
+		mock.InstanceGetSuccess(inst, 1),
+		mock.CreateEphemeralSuccess(inst, 1),
+	)
+	if err != nil {
+		t.Fatalf("%s", err)
+	}
+	defer func() {
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	// refresh in the background only once the instance is in use
+	hybrid := func(info RefreshInfo) (time.Duration, bool) {
+		if info.LastUsed.IsZero() {
+			return 0, false
+		}
+		return time.Hour, true
+	}
+	im, err := NewInstance("my-project:my-region:my-instance", client, RSAKey, 30*time.Second,
+		WithRefreshStrategy(hybrid))
+	if err != nil {
+		t.Fatalf("failed to initialize Instance: %v", err)
+	}
+	defer im.Close()
+	// wait for the initial refresh to complete
+	for start := time.Now(); im.Status().LastRefresh.IsZero(); time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("timed out waiting for the initial refresh")
+		}
+	}
+	if s := im.Status(); !s.NextRefresh.IsZero() {
+		t.Fatalf("want no background refresh before the instance is used, got = %v", s.NextRefresh)
+	}
+
+	if _, _, err := im.ConnectInfo(ctx, PublicIP); err != nil {
+		t.Fatalf("failed to retrieve connect info: %v", err)
+	}
+	if s := im.Status(); s.NextRefresh.IsZero() {
+		t.Fatal("want a background refresh to be scheduled once the instance is used")
+	}
+}
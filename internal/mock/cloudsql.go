@@ -25,6 +25,7 @@ import (
 	"encoding/pem"
 	"fmt"
 	"math/big"
+	"net"
 	"testing"
 	"time"
 
@@ -47,6 +48,31 @@ type FakeCSQLInstance struct {
 	region    string
 	name      string
 	dbVersion string
+	// instanceType is the instance's type (e.g., CLOUD_SQL_INSTANCE).
+	instanceType string
+	// state is the instance's state (e.g., RUNNABLE).
+	state string
+	// maintenanceStart is the start of the instance's scheduled maintenance.
+	maintenanceStart time.Time
+	// labels are the instance's user labels.
+	labels map[string]string
+	// flags are the instance's database flags.
+	flags map[string]string
+	// casServerCert is true when the server proxy presents a leaf
+	// certificate issued by the instance's CA, as instances using
+	// Certificate Authority Service do.
+	casServerCert bool
+	// casRoot and casRootKey are the root CA that issued the instance's CA
+	// when casServerCert is true.
+	casRoot    *x509.Certificate
+	casRootKey *rsa.PrivateKey
+	// serverCAMode is the server CA mode reported by the Admin API, if any.
+	serverCAMode string
+	// dnsName is the instance's DNS name reported by the Admin API, if any.
+	dnsName string
+	// nextCA is a second self-signed CA reported along with the instance's
+	// CA, as during a CA rotation.
+	nextCA []byte
 	// ipAddrs is a map of IP type (PUBLIC or PRIVATE) to IP address.
 	ipAddrs      map[string]string
 	backendType  string
@@ -57,7 +83,27 @@ type FakeCSQLInstance struct {
 }
 
 func (f FakeCSQLInstance) signedCert() ([]byte, error) {
-	return f.signer(f.Cert, f.Key)
+	if f.casRoot == nil {
+		c, err := f.signer(f.Cert, f.Key)
+		if err != nil || f.nextCA == nil {
+			return c, err
+		}
+		return append(append([]byte(nil), c...), f.nextCA...), nil
+	}
+	// Certificate Authority Service instances report the full chain: the
+	// instance's CA, signed by the root, followed by the root.
+	ca, err := x509.CreateCertificate(rand.Reader, f.Cert, f.casRoot, &f.Key.PublicKey, f.casRootKey)
+	if err != nil {
+		return nil, err
+	}
+	chain := new(bytes.Buffer)
+	pem.Encode(chain, &pem.Block{Type: "CERTIFICATE", Bytes: ca})
+	root, err := SelfSign(f.casRoot, f.casRootKey)
+	if err != nil {
+		return nil, err
+	}
+	chain.Write(root)
+	return chain.Bytes(), nil
 }
 
 func (f FakeCSQLInstance) clientCert(pubKey *rsa.PublicKey) ([]byte, error) {
@@ -81,6 +127,13 @@ func WithPrivateIP(addr string) FakeCSQLInstanceOption {
 	}
 }
 
+// WithPublicIPv6 sets the public IPv6 address to addr.
+func WithPublicIPv6(addr string) FakeCSQLInstanceOption {
+	return func(f *FakeCSQLInstance) {
+		f.ipAddrs["PUBLIC_IPV6"] = addr
+	}
+}
+
 // WithCertExpiry sets the server certificate's expiration to t.
 func WithCertExpiry(t time.Time) FakeCSQLInstanceOption {
 	return func(f *FakeCSQLInstance) {
@@ -95,6 +148,91 @@ func WithRegion(region string) FakeCSQLInstanceOption {
 	}
 }
 
+// WithInstanceType sets the instance's type (e.g., READ_REPLICA_INSTANCE).
+func WithInstanceType(t string) FakeCSQLInstanceOption {
+	return func(f *FakeCSQLInstance) {
+		f.instanceType = t
+	}
+}
+
+// WithState sets the instance's state (e.g., MAINTENANCE).
+func WithState(s string) FakeCSQLInstanceOption {
+	return func(f *FakeCSQLInstance) {
+		f.state = s
+	}
+}
+
+// WithScheduledMaintenance schedules maintenance for the instance starting at
+// t.
+func WithScheduledMaintenance(t time.Time) FakeCSQLInstanceOption {
+	return func(f *FakeCSQLInstance) {
+		f.maintenanceStart = t
+	}
+}
+
+// WithCASServerCert configures the instance like one using Certificate
+// Authority Service: the instance's CA is issued by a separate root CA, the
+// Admin API reports both, and the server proxy presents a certificate issued
+// by the instance's CA with SANs for the instance's IP addresses.
+func WithCASServerCert() FakeCSQLInstanceOption {
+	return func(f *FakeCSQLInstance) {
+		key, cert, err := generateCerts("cas", "root")
+		if err != nil {
+			panic(err)
+		}
+		f.casServerCert = true
+		f.casRoot = cert
+		f.casRootKey = key
+		f.serverCAMode = "GOOGLE_MANAGED_CAS_CA"
+	}
+}
+
+// WithServerCAMode sets the server CA mode that the Admin API reports for the
+// instance, e.g., GOOGLE_MANAGED_INTERNAL_CA.
+func WithServerCAMode(mode string) FakeCSQLInstanceOption {
+	return func(f *FakeCSQLInstance) {
+		f.serverCAMode = mode
+	}
+}
+
+// WithDNSName sets the DNS name that the Admin API reports for the instance.
+func WithDNSName(name string) FakeCSQLInstanceOption {
+	return func(f *FakeCSQLInstance) {
+		f.dnsName = name
+	}
+}
+
+// WithServerCARotation configures the instance like one whose self-signed CA
+// is being rotated: the Admin API reports a second CA after the instance's
+// CA, which the server proxy does not use.
+func WithServerCARotation() FakeCSQLInstanceOption {
+	return func(f *FakeCSQLInstance) {
+		key, cert, err := generateCerts(f.project, f.name+"-next")
+		if err != nil {
+			panic(err)
+		}
+		next, err := SelfSign(cert, key)
+		if err != nil {
+			panic(err)
+		}
+		f.nextCA = next
+	}
+}
+
+// WithUserLabels sets the instance's user labels.
+func WithUserLabels(labels map[string]string) FakeCSQLInstanceOption {
+	return func(f *FakeCSQLInstance) {
+		f.labels = labels
+	}
+}
+
+// WithDatabaseFlags sets the instance's database flags.
+func WithDatabaseFlags(flags map[string]string) FakeCSQLInstanceOption {
+	return func(f *FakeCSQLInstance) {
+		f.flags = flags
+	}
+}
+
 // WithFirstGenBackend sets the server backend type to FIRST_GEN.
 func WithFirstGenBackend() FakeCSQLInstanceOption {
 	return func(f *FakeCSQLInstance) {
@@ -149,6 +287,8 @@ func NewFakeCSQLInstance(project, region, name string, opts ...FakeCSQLInstanceO
 		name:         name,
 		ipAddrs:      map[string]string{"PUBLIC": "0.0.0.0"},
 		dbVersion:    "POSTGRES_12", // default of no particular importance
+		instanceType: "CLOUD_SQL_INSTANCE",
+		state:        "RUNNABLE",
 		backendType:  "SECOND_GEN",
 		signer:       SelfSign,
 		clientSigner: SignWithClientKey,
@@ -227,6 +367,33 @@ func GenerateCertWithCommonName(i FakeCSQLInstance, cn string) []byte {
 	return signed
 }
 
+// GenerateCertWithSANs produces a server certificate signed by the Fake Cloud
+// SQL instance's CA with the specified DNS names and IP addresses as SANs.
+func GenerateCertWithSANs(i FakeCSQLInstance, dnsNames []string, ips []string) []byte {
+	var ipAddrs []net.IP
+	for _, ip := range ips {
+		ipAddrs = append(ipAddrs, net.ParseIP(ip))
+	}
+	cert := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{
+			CommonName: fmt.Sprintf("%s.%s.sql.goog", i.name, i.region),
+		},
+		NotBefore:   time.Now(),
+		NotAfter:    time.Now().AddDate(0, 0, 1),
+		DNSNames:    dnsNames,
+		IPAddresses: ipAddrs,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+	}
+	signed, err := x509.CreateCertificate(
+		rand.Reader, cert, i.Cert, &i.Key.PublicKey, i.Key)
+	if err != nil {
+		panic(err)
+	}
+	return signed
+}
+
 // generateCerts generates a private key, an X.509 certificate, and a TLS
 // certificate for a particular fake Cloud SQL database instance.
 func generateCerts(project, name string) (*rsa.PrivateKey, *x509.Certificate, error) {
@@ -274,6 +441,19 @@ func StartServerProxy(t *testing.T, i FakeCSQLInstance) func() {
 	if err != nil {
 		t.Fatalf("failed to create X.509 Key Pair: %v", err)
 	}
+	if i.casServerCert {
+		var ips []string
+		for _, ip := range i.ipAddrs {
+			ips = append(ips, ip)
+		}
+		leaf := GenerateCertWithSANs(i, []string{fmt.Sprintf("%s.%s.sql.goog", i.name, i.region)}, ips)
+		ca, err := x509.CreateCertificate(rand.Reader, i.Cert, i.casRoot, &i.Key.PublicKey, i.casRootKey)
+		if err != nil {
+			t.Fatalf("failed to create CA certificate: %v", err)
+		}
+		serverCert.Certificate = [][]byte{leaf, ca}
+		serverCert.Leaf = nil
+	}
 	ln, err := tls.Listen("tcp", ":3307", &tls.Config{
 		Certificates: []tls.Certificate{serverCert},
 	})
@@ -27,8 +27,7 @@ import (
 	"sync"
 	"time"
 
-	"google.golang.org/api/option"
-	sqladmin "google.golang.org/api/sqladmin/v1beta4"
+	"cloud.google.com/go/cloudsqlconn/internal/sqladmin"
 )
 
 // httpClient returns an *http.Client, URL, and cleanup function. The http.Client is
@@ -97,11 +96,8 @@ func (r *Request) matches(hR *http.Request) bool {
 	return true
 }
 
-// InstanceGetSuccess returns a Request that responds to the `instance.get` SQL Admin
-// endpoint. It responds with a "StatusOK" and a DatabaseInstance object.
-//
-// https://cloud.google.com/sql/docs/mysql/admin-api/rest/v1beta4/instances/get
-func InstanceGetSuccess(i FakeCSQLInstance, ct int) *Request {
+// databaseInstance returns the Admin API representation of the instance.
+func (i FakeCSQLInstance) databaseInstance() *sqladmin.DatabaseInstance {
 	var ips []*sqladmin.IpMapping
 	for ipType, addr := range i.ipAddrs {
 		if ipType == "PUBLIC" {
@@ -120,19 +116,71 @@ func InstanceGetSuccess(i FakeCSQLInstance, ct int) *Request {
 		BackendType:     i.backendType,
 		ConnectionName:  fmt.Sprintf("%s:%s:%s", i.project, i.region, i.name),
 		DatabaseVersion: i.dbVersion,
+		DnsName:         i.dnsName,
+		InstanceType:    i.instanceType,
+		State:           i.state,
 		Project:         i.project,
 		Region:          i.region,
 		Name:            i.name,
 		IpAddresses:     ips,
 		ServerCaCert:    &sqladmin.SslCert{Cert: string(certBytes)},
+		Ipv6Address:     i.ipAddrs["PUBLIC_IPV6"],
+	}
+	if len(i.labels) > 0 || len(i.flags) > 0 || i.serverCAMode != "" {
+		db.Settings = &sqladmin.Settings{UserLabels: i.labels}
+		for name, value := range i.flags {
+			db.Settings.DatabaseFlags = append(db.Settings.DatabaseFlags, &sqladmin.DatabaseFlags{Name: name, Value: value})
+		}
+		if i.serverCAMode != "" {
+			db.Settings.IpConfiguration = &sqladmin.IpConfiguration{ServerCaMode: i.serverCAMode}
+		}
+	}
+	if !i.maintenanceStart.IsZero() {
+		db.ScheduledMaintenance = &sqladmin.SqlScheduledMaintenance{
+			StartTime: i.maintenanceStart.Format(time.RFC3339),
+		}
+	}
+	return db
+}
+
+// InstancesListSuccess returns a Request that responds to the `instances.list`
+// SQL Admin endpoint. It responds with a "StatusOK" and an
+// InstancesListResponse containing insts.
+//
+// https://cloud.google.com/sql/docs/mysql/admin-api/rest/v1beta4/instances/list
+func InstancesListSuccess(project string, insts []FakeCSQLInstance, ct int) *Request {
+	resp := &sqladmin.InstancesListResponse{}
+	for _, i := range insts {
+		resp.Items = append(resp.Items, i.databaseInstance())
+	}
+	return &Request{
+		reqMethod: http.MethodGet,
+		reqPath:   fmt.Sprintf("/sql/v1beta4/projects/%s/instances", project),
+		reqCt:     ct,
+		handle: func(w http.ResponseWriter, req *http.Request) {
+			b, err := json.Marshal(resp)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+			w.Write(b)
+		},
 	}
+}
 
+// InstanceGetSuccess returns a Request that responds to the `instance.get` SQL Admin
+// endpoint. It responds with a "StatusOK" and a DatabaseInstance object.
+//
+// https://cloud.google.com/sql/docs/mysql/admin-api/rest/v1beta4/instances/get
+func InstanceGetSuccess(i FakeCSQLInstance, ct int) *Request {
+	db := i.databaseInstance()
 	r := &Request{
 		reqMethod: http.MethodGet,
 		reqPath:   fmt.Sprintf("/sql/v1beta4/projects/%s/instances/%s", i.project, i.name),
 		reqCt:     ct,
 		handle: func(resp http.ResponseWriter, req *http.Request) {
-			b, err := db.MarshalJSON()
+			b, err := json.Marshal(db)
 			if err != nil {
 				http.Error(resp, err.Error(), http.StatusInternalServerError)
 				return
@@ -144,6 +192,31 @@ func InstanceGetSuccess(i FakeCSQLInstance, ct int) *Request {
 	return r
 }
 
+// InstanceGetError returns a Request that responds to the `instances.get` SQL
+// Admin endpoint with an error with the given HTTP status code and reason, and
+// a help link.
+func InstanceGetError(i FakeCSQLInstance, code int, reason string, ct int) *Request {
+	r := &Request{
+		reqMethod: http.MethodGet,
+		reqPath:   fmt.Sprintf("/sql/v1beta4/projects/%s/instances/%s", i.project, i.name),
+		reqCt:     ct,
+		handle: func(resp http.ResponseWriter, req *http.Request) {
+			resp.Header().Set("Content-Type", "application/json")
+			resp.WriteHeader(code)
+			fmt.Fprintf(resp, `{"error": {
+				"code": %d,
+				"message": "fake error",
+				"errors": [{"reason": %q, "message": "fake error"}],
+				"details": [{
+					"@type": "type.googleapis.com/google.rpc.Help",
+					"links": [{"description": "Help", "url": "https://example.com/help"}]
+				}]
+			}}`, code, reason)
+		},
+	}
+	return r
+}
+
 // CreateEphemeralSuccess returns a Request that responds to the
 // `sslCerts.createEphemeral` SQL Admin endpoint. It responds with a "StatusOK" and a
 // SslCerts object.
@@ -194,7 +267,7 @@ func CreateEphemeralSuccess(i FakeCSQLInstance, ct int) *Request {
 				ExpirationTime: i.Cert.NotAfter.Format(time.RFC3339),
 				Instance:       i.name,
 			}
-			b, err = c.MarshalJSON()
+			b, err = json.Marshal(c)
 			if err != nil {
 				http.Error(resp, fmt.Errorf("unable to encode response: %w", err).Error(), http.StatusInternalServerError)
 				return
@@ -206,6 +279,27 @@ func CreateEphemeralSuccess(i FakeCSQLInstance, ct int) *Request {
 	return r
 }
 
+// CreateEphemeralError returns a Request that responds to the
+// `sslCerts.createEphemeral` SQL Admin endpoint with an error with the given
+// HTTP status code and reason.
+func CreateEphemeralError(i FakeCSQLInstance, code int, reason string, ct int) *Request {
+	r := &Request{
+		reqMethod: http.MethodPost,
+		reqPath:   fmt.Sprintf("/sql/v1beta4/projects/%s/instances/%s/createEphemeral", i.project, i.name),
+		reqCt:     ct,
+		handle: func(resp http.ResponseWriter, req *http.Request) {
+			resp.Header().Set("Content-Type", "application/json")
+			resp.WriteHeader(code)
+			fmt.Fprintf(resp, `{"error": {
+				"code": %d,
+				"message": "fake error",
+				"errors": [{"reason": %q, "message": "fake error"}]
+			}}`, code, reason)
+		},
+	}
+	return r
+}
+
 // NewSQLAdminService creates a SQL Admin API service backed by a mock HTTP
 // backend. Callers should use the cleanup function to close down the server. If
 // the cleanup function returns an error, a caller has not exercised all the
@@ -214,8 +308,8 @@ func NewSQLAdminService(ctx context.Context, reqs ...*Request) (*sqladmin.Servic
 	mc, url, cleanup := httpClient(reqs...)
 	client, err := sqladmin.NewService(
 		ctx,
-		option.WithHTTPClient(mc),
-		option.WithEndpoint(url),
+		sqladmin.WithHTTPClient(mc),
+		sqladmin.WithEndpoint(url),
 	)
 	return client, cleanup, err
 }
@@ -0,0 +1,18 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sqladmin is a minimal client for the Cloud SQL Admin API (v1beta4).
+// It covers only the methods and fields the connector uses, in place of the
+// full generated client, to keep the connector's dependencies small.
+package sqladmin // import "cloud.google.com/go/cloudsqlconn/internal/sqladmin"
@@ -0,0 +1,79 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqladmin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// Error is an error response from the Cloud SQL Admin API.
+type Error struct {
+	// Code is the HTTP status code of the response.
+	Code int `json:"code"`
+	// Message is the server's description of the error.
+	Message string `json:"message"`
+	// Errors are the individual errors, each with a reason (e.g.,
+	// notAuthorized).
+	Errors []ErrorItem `json:"errors"`
+	// Details are additional details in the format of google.rpc.Status
+	// details (e.g., google.rpc.Help).
+	Details []interface{} `json:"details"`
+	// Body is the raw response body.
+	Body string `json:"-"`
+}
+
+// ErrorItem is a single error within an Error.
+type ErrorItem struct {
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("sqladmin: got HTTP response code %d with body: %v", e.Code, e.Body)
+	}
+	var reasons []string
+	for _, item := range e.Errors {
+		if item.Reason != "" {
+			reasons = append(reasons, item.Reason)
+		}
+	}
+	if len(reasons) == 0 {
+		return fmt.Sprintf("sqladmin: Error %d: %s", e.Code, e.Message)
+	}
+	return fmt.Sprintf("sqladmin: Error %d: %s, %s", e.Code, e.Message, strings.Join(reasons, ", "))
+}
+
+// checkResponse returns an *Error if resp is not a successful response.
+func checkResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return nil
+	}
+	b, _ := ioutil.ReadAll(resp.Body)
+	var body struct {
+		Error *Error `json:"error"`
+	}
+	e := &Error{}
+	if json.Unmarshal(b, &body) == nil && body.Error != nil {
+		e = body.Error
+	}
+	e.Code = resp.StatusCode
+	e.Body = string(b)
+	return e
+}
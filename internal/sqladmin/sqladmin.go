@@ -0,0 +1,331 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqladmin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// DefaultEndpoint is the base URL of the Cloud SQL Admin API.
+const DefaultEndpoint = "https://sqladmin.googleapis.com/"
+
+// quotaProjectEnv is the environment variable that overrides the quota
+// project of the credentials.
+const quotaProjectEnv = "GOOGLE_CLOUD_QUOTA_PROJECT"
+
+// apiClientHeader is the value of the x-goog-api-client header sent with every
+// request, which identifies the client's language version to the API.
+var apiClientHeader = "gl-go/" + strings.TrimPrefix(runtime.Version(), "go")
+
+// scopes are the OAuth2 scopes requested for default and JSON credentials.
+var scopes = []string{
+	"https://www.googleapis.com/auth/cloud-platform",
+	"https://www.googleapis.com/auth/sqlservice.admin",
+}
+
+// An Option is an option for configuring a Service.
+type Option func(c *config)
+
+type config struct {
+	httpClient      *http.Client
+	endpoint        string
+	userAgent       string
+	tokenSource     oauth2.TokenSource
+	credentialsFile string
+	credentialsJSON []byte
+	dialContext     func(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// WithHTTPClient returns an Option that sends requests with c as is. It
+// takes precedence over all credentials options.
+func WithHTTPClient(c *http.Client) Option {
+	return func(cfg *config) {
+		cfg.httpClient = c
+	}
+}
+
+// WithEndpoint returns an Option that sends requests to the API at the base
+// URL ep in place of DefaultEndpoint.
+func WithEndpoint(ep string) Option {
+	return func(cfg *config) {
+		cfg.endpoint = ep
+	}
+}
+
+// WithUserAgent returns an Option that sets the User-Agent header of every
+// request to ua.
+func WithUserAgent(ua string) Option {
+	return func(cfg *config) {
+		cfg.userAgent = ua
+	}
+}
+
+// WithTokenSource returns an Option that authenticates requests with tokens
+// from ts.
+func WithTokenSource(ts oauth2.TokenSource) Option {
+	return func(cfg *config) {
+		cfg.tokenSource = ts
+	}
+}
+
+// WithCredentialsFile returns an Option that authenticates requests with the
+// service account or refresh token JSON credentials in filename.
+func WithCredentialsFile(filename string) Option {
+	return func(cfg *config) {
+		cfg.credentialsFile = filename
+	}
+}
+
+// WithCredentialsJSON returns an Option that authenticates requests with the
+// service account or refresh token JSON credentials p.
+func WithCredentialsJSON(p []byte) Option {
+	return func(cfg *config) {
+		cfg.credentialsJSON = p
+	}
+}
+
+// WithDialContext returns an Option that makes the network connections for
+// API and token requests with dial, which is also responsible for resolving
+// host names. It has no effect with WithHTTPClient.
+func WithDialContext(dial func(ctx context.Context, network, addr string) (net.Conn, error)) Option {
+	return func(cfg *config) {
+		cfg.dialContext = dial
+	}
+}
+
+// Service calls the Cloud SQL Admin API.
+//
+// Use NewService to initialize a Service.
+type Service struct {
+	client       *http.Client
+	endpoint     string
+	userAgent    string
+	quotaProject string
+}
+
+// NewService returns a Service configured by opts. Unless an HTTP client or
+// credentials are provided, requests are authenticated with Application
+// Default Credentials. Credentials are used in order of precedence: JSON
+// credentials, a credentials file, and then a token source. Requests are
+// billed to the quota project of JSON or default credentials, which the
+// GOOGLE_CLOUD_QUOTA_PROJECT environment variable overrides, unless an HTTP
+// client is provided.
+func NewService(ctx context.Context, opts ...Option) (*Service, error) {
+	cfg := &config{endpoint: DefaultEndpoint}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	client := cfg.httpClient
+	var quota string
+	if client == nil {
+		ctx = cfg.oauth2Context(ctx)
+		ts, q, err := tokenSource(ctx, cfg)
+		if err != nil {
+			return nil, err
+		}
+		client = oauth2.NewClient(ctx, ts)
+		quota = q
+		if env := os.Getenv(quotaProjectEnv); env != "" {
+			quota = env
+		}
+	}
+	return &Service{
+		client:       client,
+		endpoint:     strings.TrimSuffix(cfg.endpoint, "/") + "/",
+		userAgent:    cfg.userAgent,
+		quotaProject: quota,
+	}, nil
+}
+
+// TokenSource returns the token source that NewService would authenticate
+// requests with given the credentials options in opts. Token requests are
+// made with any WithDialContext option, and other options, including
+// WithHTTPClient, are ignored.
+func TokenSource(ctx context.Context, opts ...Option) (oauth2.TokenSource, error) {
+	cfg := &config{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	ts, _, err := tokenSource(cfg.oauth2Context(ctx), cfg)
+	return ts, err
+}
+
+// oauth2Context returns ctx with the HTTP client that the oauth2 package
+// should make token requests with and wrap to authenticate requests.
+func (cfg *config) oauth2Context(ctx context.Context) context.Context {
+	if cfg.dialContext == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, oauth2.HTTPClient, &http.Client{
+		Transport: newTransport(cfg.dialContext),
+	})
+}
+
+// newTransport returns a transport like http.DefaultTransport that makes
+// connections with dial.
+func newTransport(dial func(ctx context.Context, network, addr string) (net.Conn, error)) *http.Transport {
+	return &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dial,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
+
+// tokenSource returns the token source described by cfg and the quota project
+// of its credentials, if any.
+func tokenSource(ctx context.Context, cfg *config) (oauth2.TokenSource, string, error) {
+	b := cfg.credentialsJSON
+	if b == nil && cfg.credentialsFile != "" {
+		var err error
+		b, err = ioutil.ReadFile(cfg.credentialsFile)
+		if err != nil {
+			return nil, "", fmt.Errorf("cannot read credentials file: %v", err)
+		}
+	}
+	if b != nil {
+		creds, err := google.CredentialsFromJSON(ctx, b, scopes...)
+		if err != nil {
+			return nil, "", err
+		}
+		return creds.TokenSource, quotaProject(creds.JSON), nil
+	}
+	if cfg.tokenSource != nil {
+		return cfg.tokenSource, "", nil
+	}
+	creds, err := google.FindDefaultCredentials(ctx, scopes...)
+	if err != nil {
+		return nil, "", err
+	}
+	return creds.TokenSource, quotaProject(creds.JSON), nil
+}
+
+// quotaProject returns the quota project of the JSON credentials b, or "" if
+// there is none, e.g., for credentials from the metadata server.
+func quotaProject(b []byte) string {
+	var f struct {
+		QuotaProjectID string `json:"quota_project_id"`
+	}
+	if len(b) == 0 || json.Unmarshal(b, &f) != nil {
+		return ""
+	}
+	return f.QuotaProjectID
+}
+
+// GetInstance calls instances.get for the instance in project.
+//
+// https://cloud.google.com/sql/docs/mysql/admin-api/rest/v1beta4/instances/get
+func (s *Service) GetInstance(ctx context.Context, project, instance string) (*DatabaseInstance, error) {
+	var db DatabaseInstance
+	p := fmt.Sprintf("sql/v1beta4/projects/%s/instances/%s", url.PathEscape(project), url.PathEscape(instance))
+	if err := s.do(ctx, http.MethodGet, p, nil, nil, &db); err != nil {
+		return nil, err
+	}
+	return &db, nil
+}
+
+// CreateEphemeral calls sslCerts.createEphemeral to obtain a client
+// certificate for the public key in req.
+//
+// https://cloud.google.com/sql/docs/mysql/admin-api/rest/v1beta4/sslCerts/createEphemeral
+func (s *Service) CreateEphemeral(ctx context.Context, project, instance string, req *SslCertsCreateEphemeralRequest) (*SslCert, error) {
+	var c SslCert
+	p := fmt.Sprintf("sql/v1beta4/projects/%s/instances/%s/createEphemeral", url.PathEscape(project), url.PathEscape(instance))
+	if err := s.do(ctx, http.MethodPost, p, nil, req, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// ListInstances calls instances.list for project and calls f with each page of
+// results until there are no more pages or f returns an error.
+//
+// https://cloud.google.com/sql/docs/mysql/admin-api/rest/v1beta4/instances/list
+func (s *Service) ListInstances(ctx context.Context, project string, f func(*InstancesListResponse) error) error {
+	p := fmt.Sprintf("sql/v1beta4/projects/%s/instances", url.PathEscape(project))
+	q := url.Values{}
+	for {
+		var resp InstancesListResponse
+		if err := s.do(ctx, http.MethodGet, p, q, nil, &resp); err != nil {
+			return err
+		}
+		if err := f(&resp); err != nil {
+			return err
+		}
+		if resp.NextPageToken == "" {
+			return nil
+		}
+		q.Set("pageToken", resp.NextPageToken)
+	}
+}
+
+// do sends a request to the API method at path with query parameters q and
+// the JSON encoding of body, if any, and decodes the response into out.
+func (s *Service) do(ctx context.Context, method, path string, q url.Values, body, out interface{}) error {
+	params := url.Values{"alt": {"json"}, "prettyPrint": {"false"}}
+	for k, v := range q {
+		params[k] = v
+	}
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, s.endpoint+path+"?"+params.Encode(), r)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if s.userAgent != "" {
+		req.Header.Set("User-Agent", s.userAgent)
+	}
+	req.Header.Set("x-goog-api-client", apiClientHeader)
+	if s.quotaProject != "" {
+		req.Header.Set("X-Goog-User-Project", s.quotaProject)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := checkResponse(resp); err != nil {
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,253 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqladmin_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/cloudsqlconn/internal/sqladmin"
+	"golang.org/x/oauth2"
+)
+
+func newService(t *testing.T, h http.HandlerFunc) *sqladmin.Service {
+	ts := httptest.NewServer(h)
+	t.Cleanup(ts.Close)
+	s, err := sqladmin.NewService(
+		context.Background(),
+		sqladmin.WithHTTPClient(ts.Client()),
+		sqladmin.WithEndpoint(ts.URL),
+		sqladmin.WithUserAgent("test-agent"),
+	)
+	if err != nil {
+		t.Fatalf("NewService failed: %v", err)
+	}
+	return s
+}
+
+func TestGetInstance(t *testing.T) {
+	s := newService(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/sql/v1beta4/projects/my-project/instances/my-instance" {
+			t.Errorf("unexpected request: %v %v", r.Method, r.URL.Path)
+		}
+		if got := r.URL.Query().Get("alt"); got != "json" {
+			t.Errorf("alt, got = %q, want = %q", got, "json")
+		}
+		if got := r.Header.Get("User-Agent"); got != "test-agent" {
+			t.Errorf("User-Agent, got = %q, want = %q", got, "test-agent")
+		}
+		if got := r.Header.Get("x-goog-api-client"); !strings.HasPrefix(got, "gl-go/") {
+			t.Errorf("x-goog-api-client, got = %q, want gl-go/<version>", got)
+		}
+		if got := r.Header.Get("X-Goog-User-Project"); got != "" {
+			t.Errorf("X-Goog-User-Project, got = %q, want none", got)
+		}
+		fmt.Fprint(w, `{"backendType": "SECOND_GEN", "region": "my-region",
+			"ipAddresses": [{"ipAddress": "127.0.0.1", "type": "PRIMARY"}]}`)
+	})
+
+	db, err := s.GetInstance(context.Background(), "my-project", "my-instance")
+	if err != nil {
+		t.Fatalf("GetInstance failed: %v", err)
+	}
+	if db.BackendType != "SECOND_GEN" || db.Region != "my-region" {
+		t.Errorf("GetInstance, got = %+v", db)
+	}
+	if len(db.IpAddresses) != 1 || db.IpAddresses[0].IpAddress != "127.0.0.1" {
+		t.Errorf("IpAddresses, got = %+v", db.IpAddresses)
+	}
+}
+
+func TestCreateEphemeral(t *testing.T) {
+	s := newService(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/sql/v1beta4/projects/my-project/instances/my-instance/createEphemeral" {
+			t.Errorf("unexpected request: %v %v", r.Method, r.URL.Path)
+		}
+		var req sqladmin.SslCertsCreateEphemeralRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		fmt.Fprintf(w, `{"cert": %q}`, "cert-for-"+req.PublicKey)
+	})
+
+	c, err := s.CreateEphemeral(context.Background(), "my-project", "my-instance",
+		&sqladmin.SslCertsCreateEphemeralRequest{PublicKey: "key"})
+	if err != nil {
+		t.Fatalf("CreateEphemeral failed: %v", err)
+	}
+	if want := "cert-for-key"; c.Cert != want {
+		t.Errorf("Cert, got = %q, want = %q", c.Cert, want)
+	}
+}
+
+func TestListInstancesPages(t *testing.T) {
+	s := newService(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("pageToken") {
+		case "":
+			fmt.Fprint(w, `{"items": [{"name": "a"}], "nextPageToken": "next"}`)
+		case "next":
+			fmt.Fprint(w, `{"items": [{"name": "b"}]}`)
+		default:
+			t.Errorf("unexpected page token: %q", r.URL.Query().Get("pageToken"))
+		}
+	})
+
+	var names []string
+	err := s.ListInstances(context.Background(), "my-project", func(resp *sqladmin.InstancesListResponse) error {
+		for _, db := range resp.Items {
+			names = append(names, db.Name)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ListInstances failed: %v", err)
+	}
+	if len(names) != 2 || names[0] != "a" || names[1] != "b" {
+		t.Errorf("ListInstances, got = %v, want = [a b]", names)
+	}
+}
+
+func TestErrorResponse(t *testing.T) {
+	s := newService(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"error": {"code": 403, "message": "denied",
+			"errors": [{"reason": "notAuthorized", "message": "denied"}]}}`)
+	})
+
+	_, err := s.GetInstance(context.Background(), "my-project", "my-instance")
+	var apiErr *sqladmin.Error
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("GetInstance, got = %v, want *sqladmin.Error", err)
+	}
+	if apiErr.Code != http.StatusForbidden || apiErr.Message != "denied" {
+		t.Errorf("Error, got = %+v", apiErr)
+	}
+	if len(apiErr.Errors) != 1 || apiErr.Errors[0].Reason != "notAuthorized" {
+		t.Errorf("Errors, got = %+v", apiErr.Errors)
+	}
+	if want := "sqladmin: Error 403: denied, notAuthorized"; err.Error() != want {
+		t.Errorf("Error(), got = %q, want = %q", err.Error(), want)
+	}
+}
+
+func TestErrorResponseWithoutJSON(t *testing.T) {
+	s := newService(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad gateway", http.StatusBadGateway)
+	})
+
+	_, err := s.GetInstance(context.Background(), "my-project", "my-instance")
+	var apiErr *sqladmin.Error
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("GetInstance, got = %v, want *sqladmin.Error", err)
+	}
+	if apiErr.Code != http.StatusBadGateway || apiErr.Body != "bad gateway\n" {
+		t.Errorf("Error, got = %+v", apiErr)
+	}
+}
+
+func TestWithDialContext(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer my-token" {
+			t.Errorf("Authorization, got = %q, want = %q", got, "Bearer my-token")
+		}
+		fmt.Fprint(w, `{"name": "my-instance"}`)
+	}))
+	defer ts.Close()
+
+	var dialed []string
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialed = append(dialed, addr)
+		var d net.Dialer
+		return d.DialContext(ctx, network, addr)
+	}
+	s, err := sqladmin.NewService(
+		context.Background(),
+		sqladmin.WithEndpoint(ts.URL),
+		sqladmin.WithTokenSource(oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "my-token"})),
+		sqladmin.WithDialContext(dial),
+	)
+	if err != nil {
+		t.Fatalf("NewService failed: %v", err)
+	}
+	if _, err := s.GetInstance(context.Background(), "my-project", "my-instance"); err != nil {
+		t.Fatalf("GetInstance failed: %v", err)
+	}
+	if want := strings.TrimPrefix(ts.URL, "http://"); len(dialed) != 1 || dialed[0] != want {
+		t.Fatalf("dialed, got = %v, want = [%v]", dialed, want)
+	}
+}
+
+func TestQuotaProject(t *testing.T) {
+	var quota []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"access_token": "my-token", "token_type": "Bearer", "expires_in": 3600}`)
+			return
+		}
+		quota = append(quota, r.Header.Get("X-Goog-User-Project"))
+		fmt.Fprint(w, `{"name": "my-instance"}`)
+	}))
+	defer ts.Close()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	creds, err := json.Marshal(map[string]string{
+		"type":             "service_account",
+		"client_email":     "sa@my-project.iam.gserviceaccount.com",
+		"private_key_id":   "my-key",
+		"private_key":      string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})),
+		"token_uri":        ts.URL + "/token",
+		"quota_project_id": "creds-project",
+	})
+	if err != nil {
+		t.Fatalf("failed to encode credentials: %v", err)
+	}
+	get := func() {
+		s, err := sqladmin.NewService(
+			context.Background(),
+			sqladmin.WithEndpoint(ts.URL),
+			sqladmin.WithCredentialsJSON(creds),
+		)
+		if err != nil {
+			t.Fatalf("NewService failed: %v", err)
+		}
+		if _, err := s.GetInstance(context.Background(), "my-project", "my-instance"); err != nil {
+			t.Fatalf("GetInstance failed: %v", err)
+		}
+	}
+
+	get()
+	os.Setenv("GOOGLE_CLOUD_QUOTA_PROJECT", "env-project")
+	defer os.Unsetenv("GOOGLE_CLOUD_QUOTA_PROJECT")
+	get()
+	if want := []string{"creds-project", "env-project"}; strings.Join(quota, ",") != strings.Join(want, ",") {
+		t.Fatalf("X-Goog-User-Project, got = %v, want = %v", quota, want)
+	}
+}
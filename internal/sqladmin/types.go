@@ -0,0 +1,90 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqladmin
+
+// DatabaseInstance is a Cloud SQL instance resource. Only the fields used by
+// the connector are included.
+type DatabaseInstance struct {
+	BackendType          string                   `json:"backendType,omitempty"`
+	ConnectionName       string                   `json:"connectionName,omitempty"`
+	DatabaseVersion      string                   `json:"databaseVersion,omitempty"`
+	DnsName              string                   `json:"dnsName,omitempty"`
+	InstanceType         string                   `json:"instanceType,omitempty"`
+	IpAddresses          []*IpMapping             `json:"ipAddresses,omitempty"`
+	Ipv6Address          string                   `json:"ipv6Address,omitempty"`
+	Name                 string                   `json:"name,omitempty"`
+	Project              string                   `json:"project,omitempty"`
+	Region               string                   `json:"region,omitempty"`
+	ScheduledMaintenance *SqlScheduledMaintenance `json:"scheduledMaintenance,omitempty"`
+	ServerCaCert         *SslCert                 `json:"serverCaCert,omitempty"`
+	Settings             *Settings                `json:"settings,omitempty"`
+	State                string                   `json:"state,omitempty"`
+}
+
+// IpMapping is an IP address assigned to an instance and its type (e.g.,
+// PRIMARY or PRIVATE).
+type IpMapping struct {
+	IpAddress string `json:"ipAddress,omitempty"`
+	Type      string `json:"type,omitempty"`
+}
+
+// Settings are the user settings of an instance.
+type Settings struct {
+	ActivationPolicy string            `json:"activationPolicy,omitempty"`
+	DatabaseFlags    []*DatabaseFlags  `json:"databaseFlags,omitempty"`
+	IpConfiguration  *IpConfiguration  `json:"ipConfiguration,omitempty"`
+	UserLabels       map[string]string `json:"userLabels,omitempty"`
+}
+
+// IpConfiguration is an instance's IP management settings.
+type IpConfiguration struct {
+	// ServerCaMode is the kind of CA that issues the instance's server
+	// certificates, e.g., GOOGLE_MANAGED_INTERNAL_CA or
+	// GOOGLE_MANAGED_CAS_CA.
+	ServerCaMode string `json:"serverCaMode,omitempty"`
+}
+
+// DatabaseFlags is a database flag set on an instance.
+type DatabaseFlags struct {
+	Name  string `json:"name,omitempty"`
+	Value string `json:"value,omitempty"`
+}
+
+// SqlScheduledMaintenance describes an instance's upcoming maintenance.
+type SqlScheduledMaintenance struct {
+	StartTime string `json:"startTime,omitempty"`
+}
+
+// SslCert is a PEM encoded certificate, such as an instance's server CA or an
+// ephemeral client certificate.
+type SslCert struct {
+	Cert           string `json:"cert,omitempty"`
+	CommonName     string `json:"commonName,omitempty"`
+	CreateTime     string `json:"createTime,omitempty"`
+	ExpirationTime string `json:"expirationTime,omitempty"`
+	Instance       string `json:"instance,omitempty"`
+}
+
+// SslCertsCreateEphemeralRequest is the request body of
+// sslCerts.createEphemeral.
+type SslCertsCreateEphemeralRequest struct {
+	PublicKey string `json:"public_key,omitempty"`
+}
+
+// InstancesListResponse is a page of the response to instances.list.
+type InstancesListResponse struct {
+	Items         []*DatabaseInstance `json:"items,omitempty"`
+	NextPageToken string              `json:"nextPageToken,omitempty"`
+}
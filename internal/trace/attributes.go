@@ -0,0 +1,67 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trace
+
+// EndSpanFunc is a function that ends a span, reporting an error if necessary.
+type EndSpanFunc func(error)
+
+// Attribute annotates a span with additional data.
+type Attribute struct {
+	key   string
+	value interface{}
+}
+
+// AddInstanceName creates an attribute with the Cloud SQL instance name.
+func AddInstanceName(name string) Attribute {
+	return Attribute{key: "/cloudsql/instance", value: name}
+}
+
+// AddDialerID creates an attribute to identify a particular dialer.
+func AddDialerID(dialerID string) Attribute {
+	return Attribute{key: "/cloudsql/dialer_id", value: dialerID}
+}
+
+// AddLocalAddr creates an attribute with a connection's local address.
+func AddLocalAddr(addr string) Attribute {
+	return Attribute{key: "/cloudsql/local_addr", value: addr}
+}
+
+// AddRemoteAddr creates an attribute with a connection's remote address.
+func AddRemoteAddr(addr string) Attribute {
+	return Attribute{key: "/cloudsql/remote_addr", value: addr}
+}
+
+// Dial segments are the parts of a Dial whose latency is recorded separately.
+const (
+	// DialSegmentInstanceInfo is the time spent waiting for the instance's
+	// metadata and certificates.
+	DialSegmentInstanceInfo = "instance_info"
+	// DialSegmentTCPConnect is the time spent establishing the TCP
+	// connection.
+	DialSegmentTCPConnect = "tcp_connect"
+	// DialSegmentTLSHandshake is the time spent on the TLS handshake.
+	DialSegmentTLSHandshake = "tls_handshake"
+)
+
+// DNS cache results are the outcomes of looking up a domain name in the DNS
+// cache.
+const (
+	// DNSCacheHit is a lookup answered with cached records.
+	DNSCacheHit = "hit"
+	// DNSCacheNegativeHit is a lookup answered with a cached "not found".
+	DNSCacheNegativeHit = "negative_hit"
+	// DNSCacheMiss is a lookup that queried DNS.
+	DNSCacheMiss = "miss"
+)
@@ -14,4 +14,8 @@
 
 // Package trace provides an interface for tracing internal operations and
 // reporting various metrics. Metrics are recorded on a package-global basis.
+//
+// Tracing and metrics are backed by OpenCensus. Building with the
+// cloudsqlconn_noopencensus tag replaces them with no-ops, so this package
+// neither imports OpenCensus nor registers any views.
 package trace // import "cloud.google.com/go/cloudsqlconn/internal/trace"
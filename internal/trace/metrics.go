@@ -1,8 +1,26 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !cloudsqlconn_noopencensus
+// +build !cloudsqlconn_noopencensus
+
 package trace
 
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"go.opencensus.io/stats"
 	"go.opencensus.io/stats/view"
@@ -10,8 +28,13 @@ import (
 )
 
 var (
-	keyInstance, _ = tag.NewKey("cloudsql_instance")
-	keyDialerID, _ = tag.NewKey("cloudsql_dialer_id")
+	keyInstance, _       = tag.NewKey("cloudsql_instance")
+	keyDialerID, _       = tag.NewKey("cloudsql_dialer_id")
+	keyRefreshStatus, _  = tag.NewKey("cloudsql_refresh_status")
+	keyIPType, _         = tag.NewKey("cloudsql_ip_type")
+	keyAPIMethod, _      = tag.NewKey("cloudsql_api_method")
+	keyDialSegment, _    = tag.NewKey("cloudsql_dial_segment")
+	keyDNSCacheResult, _ = tag.NewKey("cloudsql_dns_cache_result")
 )
 
 var (
@@ -30,6 +53,36 @@ var (
 	}
 )
 
+var (
+	mSegmentLatencyMS = stats.Int64(
+		"/cloudsqlconn/dial_segment_latency",
+		"The latency in milliseconds of a segment of Dial",
+		stats.UnitMilliseconds,
+	)
+	segmentLatencyView = &view.View{
+		Name:        "/cloudsqlconn/dial_segment_latency",
+		Measure:     mSegmentLatencyMS,
+		Description: "The distribution of latencies (ms) of each segment of Dial",
+		Aggregation: view.Distribution(0, 5, 25, 100, 250, 500, 1000, 2000, 5000, 30000),
+		TagKeys:     []tag.Key{keyInstance, keyDialerID, keyDialSegment},
+	}
+)
+
+var (
+	mCertExpiry = stats.Int64(
+		"/cloudsqlconn/cert_expiry",
+		"The expiration of the client certificate in use, in seconds since the Unix epoch",
+		stats.UnitSeconds,
+	)
+	certExpiryView = &view.View{
+		Name:        "/cloudsqlconn/cert_expiry_seconds",
+		Measure:     mCertExpiry,
+		Description: "The expiration of each instance's client certificate (seconds since the Unix epoch)",
+		Aggregation: view.LastValue(),
+		TagKeys:     []tag.Key{keyInstance, keyDialerID},
+	}
+)
+
 var (
 	mConnections = stats.Int64(
 		"/cloudsqlconn/connection",
@@ -43,6 +96,88 @@ var (
 		Aggregation: view.Sum(),
 		TagKeys:     []tag.Key{keyInstance, keyDialerID},
 	}
+	connectionsByIPTypeView = &view.View{
+		Name:        "/cloudsqlconn/open_connections_by_ip_type",
+		Measure:     mConnections,
+		Description: "The sum of Cloud SQL connections by the IP type they were dialed over",
+		Aggregation: view.Sum(),
+		TagKeys:     []tag.Key{keyInstance, keyDialerID, keyIPType},
+	}
+)
+
+var (
+	mRefreshes = stats.Int64(
+		"/cloudsqlconn/refresh",
+		"A completed refresh of the information used to connect to Cloud SQL",
+		stats.UnitDimensionless,
+	)
+	refreshCountView = &view.View{
+		Name:        "/cloudsqlconn/refresh_count",
+		Measure:     mRefreshes,
+		Description: "The number of refresh operations by status (success or failure)",
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{keyInstance, keyDialerID, keyRefreshStatus},
+	}
+)
+
+var (
+	mDialPaths = stats.Int64(
+		"/cloudsqlconn/dial_path",
+		"The IP type a Dial connected over when several were raced",
+		stats.UnitDimensionless,
+	)
+	dialPathView = &view.View{
+		Name:        "/cloudsqlconn/dial_path_count",
+		Measure:     mDialPaths,
+		Description: "The number of raced Dials won by each IP type",
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{keyInstance, keyDialerID, keyIPType},
+	}
+)
+
+var (
+	mAdminAPICalls = stats.Int64(
+		"/cloudsqlconn/admin_api_call",
+		"A call to the Cloud SQL Admin API",
+		stats.UnitDimensionless,
+	)
+	adminAPICallView = &view.View{
+		Name:        "/cloudsqlconn/admin_api_call_count",
+		Measure:     mAdminAPICalls,
+		Description: "The number of Cloud SQL Admin API calls by method",
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{keyInstance, keyDialerID, keyAPIMethod},
+	}
+)
+
+var (
+	mDNSCacheLookups = stats.Int64(
+		"/cloudsqlconn/dns_cache_lookup",
+		"A lookup of a domain name in the DNS cache",
+		stats.UnitDimensionless,
+	)
+	dnsCacheLookupView = &view.View{
+		Name:        "/cloudsqlconn/dns_cache_lookup_count",
+		Measure:     mDNSCacheLookups,
+		Description: "The number of DNS cache lookups by result",
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{keyDialerID, keyDNSCacheResult},
+	}
+)
+
+var (
+	mConnLimitWarnings = stats.Int64(
+		"/cloudsqlconn/conn_limit_warning",
+		"The open connections to an instance reached the warning fraction of its connection limit",
+		stats.UnitDimensionless,
+	)
+	connLimitWarningView = &view.View{
+		Name:        "/cloudsqlconn/conn_limit_warning_count",
+		Measure:     mConnLimitWarnings,
+		Description: "The number of times the open connections to an instance reached the warning fraction of its connection limit",
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{keyInstance, keyDialerID},
+	}
 )
 
 // RecordDialLatency records a latency value for a call to dial.
@@ -55,25 +190,123 @@ func RecordDialLatency(ctx context.Context, instance, dialerID string, latency i
 	stats.Record(ctx, mLatencyMS.M(latency))
 }
 
-// RecordConnectionOpen reports a connection event.
-func RecordConnectionOpen(ctx context.Context, instance, dialerID string) {
+// RecordDialSegmentLatency records the latency of a segment of a call to dial
+// (e.g., DialSegmentTLSHandshake).
+func RecordDialSegmentLatency(ctx context.Context, instance, dialerID, segment string, latency int64) {
+	// Why are we ignoring this error? See above under RecordDialLatency.
+	ctx, _ = tag.New(ctx,
+		tag.Upsert(keyInstance, instance),
+		tag.Upsert(keyDialerID, dialerID),
+		tag.Upsert(keyDialSegment, segment),
+	)
+	stats.Record(ctx, mSegmentLatencyMS.M(latency))
+}
+
+// ConnRecorder records the connections opened and closed to an instance over
+// an IP type. Its tags are computed once, so that recording a connection does
+// not allocate them.
+type ConnRecorder struct {
+	ctx context.Context
+}
+
+// NewConnRecorder returns a ConnRecorder for connections to instance made by
+// the Dialer with dialerID over ipType (e.g., PUBLIC or PRIVATE).
+func NewConnRecorder(instance, dialerID, ipType string) ConnRecorder {
+	// Why are we ignoring this error? See above under RecordDialLatency.
+	ctx, _ := tag.New(context.Background(),
+		tag.Upsert(keyInstance, instance),
+		tag.Upsert(keyDialerID, dialerID),
+		tag.Upsert(keyIPType, ipType),
+	)
+	return ConnRecorder{ctx: ctx}
+}
+
+// RecordOpen records a connect event.
+func (r ConnRecorder) RecordOpen() {
+	stats.Record(r.ctx, mConnections.M(1))
+}
+
+// RecordClose records a disconnect event.
+func (r ConnRecorder) RecordClose() {
+	stats.Record(r.ctx, mConnections.M(-1))
+}
+
+// RecordRefreshResult records the outcome of a refresh operation. A failed
+// refresh is one that completed with a non-nil err.
+func RecordRefreshResult(ctx context.Context, instance, dialerID string, err error) {
+	status := "success"
+	if err != nil {
+		status = "failure"
+	}
+	// Why are we ignoring this error? See above under RecordDialLatency.
+	ctx, _ = tag.New(ctx,
+		tag.Upsert(keyInstance, instance),
+		tag.Upsert(keyDialerID, dialerID),
+		tag.Upsert(keyRefreshStatus, status),
+	)
+	stats.Record(ctx, mRefreshes.M(1))
+}
+
+// RecordCertExpiry records the expiration of the client certificate that a
+// successful refresh obtained for instance.
+func RecordCertExpiry(ctx context.Context, instance, dialerID string, expiry time.Time) {
 	// Why are we ignoring this error? See above under RecordDialLatency.
 	ctx, _ = tag.New(ctx, tag.Upsert(keyInstance, instance), tag.Upsert(keyDialerID, dialerID))
-	stats.Record(ctx, mConnections.M(1))
+	stats.Record(ctx, mCertExpiry.M(expiry.Unix()))
+}
+
+// RecordDialPath records the IP type (e.g., PUBLIC or PRIVATE) of the
+// connection that won a race between several candidate addresses.
+func RecordDialPath(ctx context.Context, instance, dialerID, ipType string) {
+	// Why are we ignoring this error? See above under RecordDialLatency.
+	ctx, _ = tag.New(ctx,
+		tag.Upsert(keyInstance, instance),
+		tag.Upsert(keyDialerID, dialerID),
+		tag.Upsert(keyIPType, ipType),
+	)
+	stats.Record(ctx, mDialPaths.M(1))
+}
+
+// RecordAdminAPICall records a call to the Cloud SQL Admin API method (e.g.,
+// sql.instances.get) made on behalf of instance.
+func RecordAdminAPICall(ctx context.Context, instance, dialerID, method string) {
+	// Why are we ignoring this error? See above under RecordDialLatency.
+	ctx, _ = tag.New(ctx,
+		tag.Upsert(keyInstance, instance),
+		tag.Upsert(keyDialerID, dialerID),
+		tag.Upsert(keyAPIMethod, method),
+	)
+	stats.Record(ctx, mAdminAPICalls.M(1))
 }
 
-// RecordConnectionClose records a disconnect event.
-func RecordConnectionClose(ctx context.Context, instance, dialerID string) {
+// RecordConnLimitWarning records that the open connections to instance
+// reached the warning fraction of its connection limit.
+func RecordConnLimitWarning(ctx context.Context, instance, dialerID string) {
 	// Why are we ignoring this error? See above under RecordDialLatency.
 	ctx, _ = tag.New(ctx, tag.Upsert(keyInstance, instance), tag.Upsert(keyDialerID, dialerID))
-	stats.Record(ctx, mConnections.M(-1))
+	stats.Record(ctx, mConnLimitWarnings.M(1))
+}
+
+// RecordDNSCacheLookup records the result of looking up a domain name in the
+// DNS cache: DNSCacheHit, DNSCacheNegativeHit, or DNSCacheMiss.
+func RecordDNSCacheLookup(ctx context.Context, dialerID, result string) {
+	// Why are we ignoring this error? See above under RecordDialLatency.
+	ctx, _ = tag.New(ctx,
+		tag.Upsert(keyDialerID, dialerID),
+		tag.Upsert(keyDNSCacheResult, result),
+	)
+	stats.Record(ctx, mDNSCacheLookups.M(1))
 }
 
 // InitMetrics registers all views. Without registering views, metrics will not
 // be reported. If any names of the registered views conflict, this function
 // returns an error to indicate a configuration problem.
 func InitMetrics() error {
-	if err := view.Register(latencyView, connectionsView); err != nil {
+	if err := view.Register(
+		latencyView, segmentLatencyView, connectionsView, connectionsByIPTypeView,
+		refreshCountView, dialPathView, adminAPICallView, certExpiryView,
+		dnsCacheLookupView, connLimitWarningView,
+	); err != nil {
 		return fmt.Errorf("failed to initialize metrics: %v", err)
 	}
 	return nil
@@ -1,9 +1,15 @@
+//go:build !cloudsqlconn_noopencensus
+// +build !cloudsqlconn_noopencensus
+
 package trace_test
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	"cloud.google.com/go/cloudsqlconn/internal/trace"
+	"go.opencensus.io/stats/view"
 )
 
 func TestMetricsInitializes(t *testing.T) {
@@ -11,3 +17,67 @@ func TestMetricsInitializes(t *testing.T) {
 		t.Fatalf("want no error, got = %v", err)
 	}
 }
+
+func TestRecordDialSegmentLatency(t *testing.T) {
+	if err := trace.InitMetrics(); err != nil {
+		t.Fatalf("want no error, got = %v", err)
+	}
+	trace.RecordDialSegmentLatency(context.Background(), "p:r:i", "dialer", trace.DialSegmentTLSHandshake, 42)
+
+	var rows []*view.Row
+	for start := time.Now(); len(rows) == 0 && time.Since(start) < 5*time.Second; {
+		var err error
+		rows, err = view.RetrieveData("/cloudsqlconn/dial_segment_latency")
+		if err != nil {
+			t.Fatalf("failed to retrieve data: %v", err)
+		}
+	}
+	if len(rows) != 1 {
+		t.Fatalf("want 1 row, got = %v", rows)
+	}
+	if len(rows[0].Tags) != 3 {
+		t.Fatalf("want instance, dialer, and segment tags, got = %v", rows[0].Tags)
+	}
+}
+
+func TestRecordCertExpiry(t *testing.T) {
+	if err := trace.InitMetrics(); err != nil {
+		t.Fatalf("want no error, got = %v", err)
+	}
+	expiry := time.Now().Add(time.Hour)
+	trace.RecordCertExpiry(context.Background(), "p:r:i", "dialer", expiry.Add(-time.Minute))
+	trace.RecordCertExpiry(context.Background(), "p:r:i", "dialer", expiry)
+
+	var rows []*view.Row
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		var err error
+		rows, err = view.RetrieveData("/cloudsqlconn/cert_expiry_seconds")
+		if err != nil {
+			t.Fatalf("failed to retrieve data: %v", err)
+		}
+		if len(rows) == 1 && rows[0].Data.(*view.LastValueData).Value == float64(expiry.Unix()) {
+			return
+		}
+	}
+	t.Fatalf("want the last recorded expiry %v, got = %v", expiry.Unix(), rows)
+}
+
+func TestRecordDNSCacheLookup(t *testing.T) {
+	if err := trace.InitMetrics(); err != nil {
+		t.Fatalf("want no error, got = %v", err)
+	}
+	trace.RecordDNSCacheLookup(context.Background(), "dialer", trace.DNSCacheHit)
+	trace.RecordDNSCacheLookup(context.Background(), "dialer", trace.DNSCacheMiss)
+
+	var rows []*view.Row
+	for start := time.Now(); len(rows) < 2 && time.Since(start) < 5*time.Second; {
+		var err error
+		rows, err = view.RetrieveData("/cloudsqlconn/dns_cache_lookup_count")
+		if err != nil {
+			t.Fatalf("failed to retrieve data: %v", err)
+		}
+	}
+	if len(rows) != 2 {
+		t.Fatalf("want a row for each result, got = %v", rows)
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build cloudsqlconn_noopencensus
+// +build cloudsqlconn_noopencensus
+
+package trace
+
+import (
+	"context"
+	"time"
+)
+
+// This file replaces the OpenCensus backed implementation when the cloudsqlconn_noopencensus
+// build tag is set. Every function keeps its signature but does nothing, so
+// that the connector neither imports OpenCensus nor registers its views.
+
+// StartSpan returns ctx unchanged and a function that does nothing.
+func StartSpan(ctx context.Context, name string, attrs ...Attribute) (context.Context, EndSpanFunc) {
+	return ctx, func(error) {}
+}
+
+// AnnotateSpan does nothing.
+func AnnotateSpan(ctx context.Context, attrs ...Attribute) {}
+
+// RecordDialLatency does nothing.
+func RecordDialLatency(ctx context.Context, instance, dialerID string, latency int64) {}
+
+// RecordDialSegmentLatency does nothing.
+func RecordDialSegmentLatency(ctx context.Context, instance, dialerID, segment string, latency int64) {
+}
+
+// ConnRecorder records nothing.
+type ConnRecorder struct{}
+
+// NewConnRecorder returns a ConnRecorder.
+func NewConnRecorder(instance, dialerID, ipType string) ConnRecorder { return ConnRecorder{} }
+
+// RecordOpen does nothing.
+func (ConnRecorder) RecordOpen() {}
+
+// RecordClose does nothing.
+func (ConnRecorder) RecordClose() {}
+
+// RecordRefreshResult does nothing.
+func RecordRefreshResult(ctx context.Context, instance, dialerID string, err error) {}
+
+// RecordCertExpiry does nothing.
+func RecordCertExpiry(ctx context.Context, instance, dialerID string, expiry time.Time) {}
+
+// RecordConnLimitWarning does nothing.
+func RecordConnLimitWarning(ctx context.Context, instance, dialerID string) {}
+
+// RecordDialPath does nothing.
+func RecordDialPath(ctx context.Context, instance, dialerID, ipType string) {}
+
+// RecordAdminAPICall does nothing.
+func RecordAdminAPICall(ctx context.Context, instance, dialerID, method string) {}
+
+// RecordDNSCacheLookup does nothing.
+func RecordDNSCacheLookup(ctx context.Context, dialerID, result string) {}
+
+// InitMetrics registers no views and always succeeds.
+func InitMetrics() error { return nil }
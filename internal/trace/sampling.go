@@ -0,0 +1,31 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trace
+
+import "context"
+
+type noSpansKey struct{}
+
+// WithoutSpans returns a copy of ctx in which StartSpan starts no spans, e.g.,
+// for a dial that was not sampled.
+func WithoutSpans(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noSpansKey{}, true)
+}
+
+// spansDisabled reports whether ctx was returned by WithoutSpans.
+func spansDisabled(ctx context.Context) bool {
+	v, _ := ctx.Value(noSpansKey{}).(bool)
+	return v
+}
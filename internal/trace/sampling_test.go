@@ -0,0 +1,61 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !cloudsqlconn_noopencensus
+// +build !cloudsqlconn_noopencensus
+
+package trace_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"cloud.google.com/go/cloudsqlconn/internal/trace"
+	octrace "go.opencensus.io/trace"
+)
+
+// spanRecorder records the names of the spans it exports.
+type spanRecorder struct {
+	mu    sync.Mutex
+	names []string
+}
+
+func (r *spanRecorder) ExportSpan(s *octrace.SpanData) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.names = append(r.names, s.Name)
+}
+
+func TestWithoutSpans(t *testing.T) {
+	r := &spanRecorder{}
+	octrace.RegisterExporter(r)
+	defer octrace.UnregisterExporter(r)
+	octrace.ApplyConfig(octrace.Config{DefaultSampler: octrace.AlwaysSample()})
+	defer octrace.ApplyConfig(octrace.Config{DefaultSampler: octrace.ProbabilitySampler(1e-4)})
+
+	ctx := trace.WithoutSpans(context.Background())
+	ctx, end := trace.StartSpan(ctx, "unsampled")
+	_, endChild := trace.StartSpan(ctx, "unsampled-child")
+	endChild(nil)
+	end(nil)
+	_, end = trace.StartSpan(context.Background(), "sampled")
+	end(nil)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.names) != 1 || r.names[0] != "sampled" {
+		t.Fatalf("exported spans, want = [sampled], got = %v", r.names)
+	}
+}
@@ -12,45 +12,33 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+//go:build !cloudsqlconn_noopencensus
+// +build !cloudsqlconn_noopencensus
+
 package trace
 
 import (
 	"context"
 
+	"cloud.google.com/go/cloudsqlconn/internal/sqladmin"
 	"go.opencensus.io/trace"
-	"google.golang.org/api/googleapi"
 	"google.golang.org/genproto/googleapis/rpc/code"
 	"google.golang.org/grpc/status"
 )
 
-// EndSpanFunc is a function that ends a span, reporting an error if necessary.
-type EndSpanFunc func(error)
-
-// Attribute annotates a span with additional data.
-type Attribute struct {
-	key   string
-	value interface{}
-}
-
 func (a Attribute) traceAttr() trace.Attribute {
 	// always use a string attribute for now
 	// if need for additional types arise, this can be expanded.
 	return trace.StringAttribute(a.key, a.value.(string))
 }
 
-// AddInstanceName creates an attribute with the Cloud SQL instance name.
-func AddInstanceName(name string) Attribute {
-	return Attribute{key: "/cloudsql/instance", value: name}
-}
-
-// AddDialerID creates an attribute to identify a particular dialer.
-func AddDialerID(dialerID string) Attribute {
-	return Attribute{key: "/cloudsql/dialer_id", value: dialerID}
-}
-
 // StartSpan begins a span with the provided name and returns a context and a
-// function to end the created span.
+// function to end the created span. If ctx was returned by WithoutSpans, no
+// span is started and ctx is returned unchanged.
 func StartSpan(ctx context.Context, name string, attrs ...Attribute) (context.Context, EndSpanFunc) {
+	if spansDisabled(ctx) {
+		return ctx, func(error) {}
+	}
 	var span *trace.Span
 	ctx, span = trace.StartSpan(ctx, name)
 	as := make([]trace.Attribute, 0, len(attrs))
@@ -66,12 +54,29 @@ func StartSpan(ctx context.Context, name string, attrs ...Attribute) (context.Co
 	}
 }
 
+// AnnotateSpan adds attrs to the span started by StartSpan in ctx. It does
+// nothing if ctx was returned by WithoutSpans.
+func AnnotateSpan(ctx context.Context, attrs ...Attribute) {
+	if spansDisabled(ctx) {
+		return
+	}
+	span := trace.FromContext(ctx)
+	if span == nil {
+		return
+	}
+	as := make([]trace.Attribute, 0, len(attrs))
+	for _, a := range attrs {
+		as = append(as, a.traceAttr())
+	}
+	span.AddAttributes(as...)
+}
+
 // toStatus interrogates an error and converts it to an appropriate
 // OpenCensus status.
 // Note: this function is borrowed from
 // https://github.com/googleapis/google-cloud-go/blob/master/internal/trace/trace.go
 func toStatus(err error) trace.Status {
-	if err2, ok := err.(*googleapi.Error); ok {
+	if err2, ok := err.(*sqladmin.Error); ok {
 		return trace.Status{Code: httpStatusCodeToOCCode(err2.Code), Message: err2.Message}
 	} else if s, ok := status.FromError(err); ok {
 		return trace.Status{Code: int32(s.Code()), Message: s.Message()}
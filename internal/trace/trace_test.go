@@ -0,0 +1,66 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !cloudsqlconn_noopencensus
+// +build !cloudsqlconn_noopencensus
+
+package trace_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"cloud.google.com/go/cloudsqlconn/internal/trace"
+	octrace "go.opencensus.io/trace"
+)
+
+// attrRecorder records the attributes of the spans it exports by span name.
+type attrRecorder struct {
+	mu    sync.Mutex
+	attrs map[string]map[string]interface{}
+}
+
+func (r *attrRecorder) ExportSpan(s *octrace.SpanData) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.attrs[s.Name] = s.Attributes
+}
+
+func TestAnnotateSpan(t *testing.T) {
+	r := &attrRecorder{attrs: make(map[string]map[string]interface{})}
+	octrace.RegisterExporter(r)
+	defer octrace.UnregisterExporter(r)
+	octrace.ApplyConfig(octrace.Config{DefaultSampler: octrace.AlwaysSample()})
+	defer octrace.ApplyConfig(octrace.Config{DefaultSampler: octrace.ProbabilitySampler(1e-4)})
+
+	ctx, end := trace.StartSpan(context.Background(), "connect")
+	trace.AnnotateSpan(ctx, trace.AddLocalAddr("10.0.0.2:50000"), trace.AddRemoteAddr("10.0.0.1:3307"))
+	end(nil)
+
+	// a parent's span is left alone when spans are disabled
+	parent, endParent := trace.StartSpan(context.Background(), "parent")
+	trace.AnnotateSpan(trace.WithoutSpans(parent), trace.AddRemoteAddr("10.0.0.1:3307"))
+	endParent(nil)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	got := r.attrs["connect"]
+	if got["/cloudsql/local_addr"] != "10.0.0.2:50000" || got["/cloudsql/remote_addr"] != "10.0.0.1:3307" {
+		t.Fatalf("want the span annotated with the addresses, got = %v", got)
+	}
+	if _, ok := r.attrs["parent"]["/cloudsql/remote_addr"]; ok {
+		t.Fatalf("want the parent span unannotated, got = %v", r.attrs["parent"])
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// loadOrCreateKey loads the PEM encoded RSA key in the file at path. If the
+// file does not exist, it generates a key and writes it to path.
+func loadOrCreateKey(path string) (*rsa.PrivateKey, error) {
+	key, err := loadKey(path)
+	if err == nil || !os.IsNotExist(err) {
+		return key, err
+	}
+	key, err = rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate RSA keys: %v", err)
+	}
+	if err := writeKey(path, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// loadKey reads a PKCS #1 or PKCS #8 encoded RSA key from the PEM file at path.
+// The returned error satisfies os.IsNotExist if the file does not exist.
+func loadKey(path string) (*rsa.PrivateKey, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	// Windows does not report Unix permissions.
+	if runtime.GOOS != "windows" && fi.Mode().Perm()&0077 != 0 {
+		return nil, fmt.Errorf("RSA key file %q must not be accessible by other users, has mode %v", path, fi.Mode().Perm())
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("RSA key file %q does not contain a PEM block", path)
+	}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse RSA key file %q: %v", path, err)
+		}
+		return key, nil
+	case "PRIVATE KEY":
+		k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse RSA key file %q: %v", path, err)
+		}
+		key, ok := k.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("key file %q does not contain an RSA key", path)
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("RSA key file %q has unsupported PEM block type %q", path, block.Type)
+	}
+}
+
+// writeKey writes key to path as a PKCS #1 PEM file readable only by the
+// current user. The key is written to a temporary file that is renamed into
+// place, so a concurrent loadKey never reads a partial key.
+func writeKey(path string, key *rsa.PrivateKey) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create RSA key file: %v", err)
+	}
+	// TempFile creates the file with mode 0600.
+	defer os.Remove(f.Name())
+	err = pem.Encode(f, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write RSA key file: %v", err)
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("failed to write RSA key file: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"runtime/debug"
+	"time"
+)
+
+// watchLeak reports the connection described by info as leaked if it is still
+// open once the leak threshold has passed. The caller's stack is captured now
+// so that the report shows where the connection was dialed. The returned
+// timer must be stopped when the connection is closed. It returns nil when
+// leak detection is disabled.
+func (d *Dialer) watchLeak(info ConnInfo) *time.Timer {
+	if d.leakThreshold <= 0 || d.onLeak == nil {
+		return nil
+	}
+	stack := debug.Stack()
+	return time.AfterFunc(d.leakThreshold, func() {
+		d.onLeak(info, stack)
+	})
+}
@@ -0,0 +1,89 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/cloudsqlconn/internal/mock"
+)
+
+func TestLeakDetectionReportsOpenConns(t *testing.T) {
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+	svc, cleanup, err := mock.NewSQLAdminService(
+		context.Background(),
+		mock.InstanceGetSuccess(inst, 1),
+		mock.CreateEphemeralSuccess(inst, 1),
+	)
+	if err != nil {
+		t.Fatalf("failed to create test SQL admin service: %s", err)
+	}
+	stop := mock.StartServerProxy(t, inst)
+	defer func() {
+		stop()
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	type leak struct {
+		info  ConnInfo
+		stack []byte
+	}
+	leaks := make(chan leak, 2)
+	d, err := NewDialer(context.Background(),
+		WithTokenSource(mock.EmptyTokenSource{}),
+		WithLeakDetection(100*time.Millisecond, func(info ConnInfo, stack []byte) {
+			leaks <- leak{info, stack}
+		}),
+	)
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	d.sqladmin = svc
+
+	cn := "my-project:my-region:my-instance"
+	closed, err := d.Dial(context.Background(), cn)
+	if err != nil {
+		t.Fatalf("expected Dial to succeed, but got error: %v", err)
+	}
+	closed.Close()
+	leaked, err := d.Dial(context.Background(), cn)
+	if err != nil {
+		t.Fatalf("expected Dial to succeed, but got error: %v", err)
+	}
+	defer leaked.Close()
+
+	select {
+	case l := <-leaks:
+		if l.info.LocalAddr.String() != leaked.LocalAddr().String() {
+			t.Fatalf("wrong connection reported, want = %v, got = %v", leaked.LocalAddr(), l.info.LocalAddr)
+		}
+		if !strings.Contains(string(l.stack), "TestLeakDetectionReportsOpenConns") {
+			t.Fatalf("want stack trace of the dialing goroutine, got = %s", l.stack)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for leak report")
+	}
+	select {
+	case l := <-leaks:
+		t.Fatalf("closed connection reported as leaked: %+v", l.info)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// probeConns periodically checks all open connections and reports those that
+// have been closed by the server. It runs until the Dialer is closed.
+func (d *Dialer) probeConns() {
+	t := time.NewTicker(d.livenessInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-d.done:
+			return
+		case <-t.C:
+		}
+		d.connLock.Lock()
+		conns := make(map[*instrumentedConn]string)
+		for inst, cs := range d.conns {
+			for c := range cs {
+				conns[c] = inst
+			}
+		}
+		d.connLock.Unlock()
+
+		for c, inst := range conns {
+			if connCheck(c.netConn) == nil {
+				continue
+			}
+			if !atomic.CompareAndSwapInt32(&c.dead, 0, 1) {
+				continue
+			}
+			if d.onDeadConn != nil {
+				d.onDeadConn(inst, c)
+			}
+		}
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// Logger receives messages about background operations of a Dialer. A
+// *log.Logger satisfies Logger.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// logInterval is the minimum time between messages about the same instance.
+const logInterval = time.Minute
+
+// WithLogger returns a DialerOption that logs failed background refreshes to
+// l, which would otherwise go unnoticed until a Dial uses the failed result.
+// At most one message per instance is logged each minute, and the number of
+// failures that were not logged is included in the next message. Access
+// tokens, private keys, and other credentials are redacted from messages.
+func WithLogger(l Logger) DialerOption {
+	return func(d *dialerConfig) {
+		d.logger = l
+	}
+}
+
+// logState tracks the messages logged about an instance.
+type logState struct {
+	// last is when the most recent message was logged.
+	last time.Time
+	// suppressed is the number of messages dropped since then.
+	suppressed int
+}
+
+// logf logs a message about the instance with connection name cn, unless a
+// message about it was logged less than logInterval ago.
+func (d *Dialer) logf(cn, format string, v ...interface{}) {
+	if d.logger == nil {
+		return
+	}
+	now := d.clock.Now()
+	d.logLock.Lock()
+	if d.logStates == nil {
+		d.logStates = make(map[string]*logState)
+	}
+	s, ok := d.logStates[cn]
+	if !ok {
+		s = &logState{}
+		d.logStates[cn] = s
+	}
+	if !s.last.IsZero() && now.Sub(s.last) < logInterval {
+		s.suppressed++
+		d.logLock.Unlock()
+		return
+	}
+	suppressed := s.suppressed
+	s.last, s.suppressed = now, 0
+	d.logLock.Unlock()
+
+	msg := redact(fmt.Sprintf(format, v...))
+	if suppressed > 0 {
+		msg = fmt.Sprintf("%s (%d similar messages suppressed)", msg, suppressed)
+	}
+	d.logger.Printf("cloudsqlconn: [%s] %s", cn, msg)
+}
+
+// secretPatterns match credentials that may appear in error messages, such as
+// the raw body of a Cloud SQL Admin API response, and the text that replaces
+// them.
+var secretPatterns = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	{
+		re:   regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`),
+		repl: "[REDACTED PRIVATE KEY]",
+	},
+	{
+		re:   regexp.MustCompile(`(?i)\bBearer\s+[A-Za-z0-9._~+/=-]+`),
+		repl: "Bearer [REDACTED]",
+	},
+	{
+		re:   regexp.MustCompile(`\bya29\.[A-Za-z0-9._-]+`),
+		repl: "[REDACTED]",
+	},
+	{
+		re:   regexp.MustCompile(`"(access_token|refresh_token|id_token|private_key|client_secret)"\s*:\s*"[^"]*"`),
+		repl: `"$1": "[REDACTED]"`,
+	},
+}
+
+// redact replaces the credentials in s.
+func redact(s string) string {
+	for _, p := range secretPatterns {
+		s = p.re.ReplaceAllString(s, p.repl)
+	}
+	return s
+}
@@ -0,0 +1,54 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import "time"
+
+// observeMaintenance records the start of an instance's next scheduled
+// maintenance. When the start time changes, the caller is notified and, if
+// draining is enabled, the instance's connections are scheduled to be closed
+// before maintenance begins.
+func (d *Dialer) observeMaintenance(cn string, start time.Time) {
+	if start.IsZero() {
+		return
+	}
+	d.connLock.Lock()
+	if prev, ok := d.maintenance[cn]; ok && prev.Equal(start) {
+		d.connLock.Unlock()
+		return
+	}
+	d.maintenance[cn] = start
+	if t, ok := d.drainTimers[cn]; ok {
+		t.Stop()
+		delete(d.drainTimers, cn)
+	}
+	if d.maintenanceDrain > 0 && time.Now().Before(start) {
+		d.drainTimers[cn] = time.AfterFunc(time.Until(start.Add(-d.maintenanceDrain)), func() {
+			d.drain(cn)
+		})
+	}
+	d.connLock.Unlock()
+
+	if d.onMaintenance != nil {
+		d.onMaintenance(cn, start)
+	}
+}
+
+// drain closes all open connections to the instance with connection name cn.
+func (d *Dialer) drain(cn string) {
+	for _, c := range d.openConnsFor(cn) {
+		_ = c.Close() // best effort close attempt
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/cloudsqlconn/internal/mock"
+)
+
+func TestMaintenanceDrainsConnections(t *testing.T) {
+	drainBefore := time.Hour
+	start := time.Now().Add(drainBefore + 2*time.Second).Truncate(time.Second)
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance",
+		mock.WithScheduledMaintenance(start))
+	svc, cleanup, err := mock.NewSQLAdminService(
+		context.Background(),
+		mock.InstanceGetSuccess(inst, 1),
+		mock.CreateEphemeralSuccess(inst, 1),
+	)
+	if err != nil {
+		t.Fatalf("failed to create test SQL admin service: %s", err)
+	}
+	stop := mock.StartServerProxy(t, inst)
+	defer func() {
+		stop()
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	notified := make(chan time.Time, 1)
+	d, err := NewDialer(context.Background(),
+		WithTokenSource(mock.EmptyTokenSource{}),
+		WithMaintenanceNotifier(func(_ string, start time.Time) { notified <- start }),
+		WithMaintenanceDrain(drainBefore),
+	)
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	d.sqladmin = svc
+
+	cn := "my-project:my-region:my-instance"
+	conn, err := d.Dial(context.Background(), cn)
+	if err != nil {
+		t.Fatalf("expected Dial to succeed, but got error: %v", err)
+	}
+	defer conn.Close()
+
+	select {
+	case got := <-notified:
+		if !got.Equal(start) {
+			t.Fatalf("maintenance start mismatch, want = %v, got = %v", start, got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for maintenance notification")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for d.openConnCount(cn) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for connections to drain")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"hash/fnv"
+	"strconv"
+	"sync"
+)
+
+// InstanceLabeler maps an instance connection name to the value of the
+// cloudsql_instance tag of the metrics recorded about the instance. It must
+// return the same value each time it is called with the same name, and may be
+// called concurrently.
+type InstanceLabeler func(instance string) string
+
+// WithInstanceMetricLabels returns a DialerOption that tags the OpenCensus
+// metrics recorded about each instance with l(instance) in place of the
+// instance's connection name. Applications that connect to thousands of
+// instances can use it to bound the number of series that a metrics backend
+// has to store, e.g., with AggregateInstances, HashInstances, or
+// LimitInstances. Metrics of instances that share a label are combined; for a
+// view that keeps the last value, such as /cloudsqlconn/cert_expiry_seconds,
+// that is the value of whichever instance was recorded last. Spans, Stats,
+// and the values passed to hooks keep the connection names.
+func WithInstanceMetricLabels(l InstanceLabeler) DialerOption {
+	return func(d *dialerConfig) {
+		d.metricLabel = l
+	}
+}
+
+// AggregateInstances returns an InstanceLabeler that labels every instance
+// "all", so that metrics are aggregated across instances.
+func AggregateInstances() InstanceLabeler {
+	return func(string) string { return "all" }
+}
+
+// HashInstances returns an InstanceLabeler that assigns each instance to one
+// of n buckets by a hash of its connection name, labeling it, e.g.,
+// "bucket-3", so that each metric has at most n series per Dialer. It treats
+// an n of less than 1 as 1.
+func HashInstances(n int) InstanceLabeler {
+	if n < 1 {
+		n = 1
+	}
+	return func(instance string) string {
+		h := fnv.New32a()
+		h.Write([]byte(instance))
+		return "bucket-" + strconv.Itoa(int(h.Sum32()%uint32(n)))
+	}
+}
+
+// LimitInstances returns an InstanceLabeler that keeps the connection names
+// of the first n instances that it labels and labels all others "other", so
+// that the instances an application uses most, which it usually connects to
+// first, keep metrics of their own.
+func LimitInstances(n int) InstanceLabeler {
+	var (
+		mu    sync.Mutex
+		named = make(map[string]bool)
+	)
+	return func(instance string) string {
+		mu.Lock()
+		defer mu.Unlock()
+		if named[instance] {
+			return instance
+		}
+		if len(named) < n {
+			named[instance] = true
+			return instance
+		}
+		return "other"
+	}
+}
+
+// metricInstance returns the value of the instance tag of metrics recorded
+// about the instance with connection name cn.
+func (d *Dialer) metricInstance(cn string) string {
+	if d.metricLabel == nil {
+		return cn
+	}
+	return d.metricLabel(cn)
+}
@@ -0,0 +1,133 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/cloudsqlconn/internal/mock"
+	"go.opencensus.io/stats/view"
+)
+
+func TestInstanceLabelers(t *testing.T) {
+	if got := AggregateInstances()("p:r:a"); got != "all" {
+		t.Errorf("AggregateInstances, want = all, got = %v", got)
+	}
+
+	hash := HashInstances(4)
+	buckets := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		cn := fmt.Sprintf("p:r:instance-%d", i)
+		l := hash(cn)
+		if l != hash(cn) {
+			t.Fatalf("HashInstances, want the same label for %v each time", cn)
+		}
+		buckets[l] = true
+	}
+	if len(buckets) > 4 {
+		t.Errorf("HashInstances, want at most 4 labels, got = %v", buckets)
+	}
+
+	limit := LimitInstances(2)
+	for _, tc := range []struct{ cn, want string }{
+		{"p:r:a", "p:r:a"},
+		{"p:r:b", "p:r:b"},
+		{"p:r:c", "other"},
+		{"p:r:a", "p:r:a"},
+		{"p:r:c", "other"},
+	} {
+		if got := limit(tc.cn); got != tc.want {
+			t.Errorf("LimitInstances(%v), want = %v, got = %v", tc.cn, tc.want, got)
+		}
+	}
+}
+
+func TestWithInstanceMetricLabels(t *testing.T) {
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+	svc, cleanup, err := mock.NewSQLAdminService(
+		context.Background(),
+		mock.InstanceGetSuccess(inst, 1),
+		mock.CreateEphemeralSuccess(inst, 1),
+	)
+	if err != nil {
+		t.Fatalf("failed to create test SQL admin service: %s", err)
+	}
+	stop := mock.StartServerProxy(t, inst)
+	defer func() {
+		stop()
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	d, err := NewDialer(context.Background(),
+		WithTokenSource(mock.EmptyTokenSource{}),
+		WithInstanceMetricLabels(AggregateInstances()),
+	)
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	d.sqladmin = svc
+	if got := d.metricInstance("my-project:my-region:my-instance"); got != "all" {
+		t.Fatalf("want = all, got = %v", got)
+	}
+
+	conn, err := d.Dial(context.Background(), "my-project:my-region:my-instance")
+	if err != nil {
+		t.Fatalf("expected Dial to succeed, but got error: %v", err)
+	}
+	conn.Close()
+	// without OpenCensus, no views are registered
+	if view.Find("/cloudsqlconn/dial_latency") != nil {
+		if got := dialLatencyInstance(t, d.dialerID); got != "all" {
+			t.Fatalf("dial latency recorded for instance, want = all, got = %v", got)
+		}
+	}
+
+	d, err = NewDialer(context.Background(), WithTokenSource(mock.EmptyTokenSource{}))
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	if got := d.metricInstance("my-project:my-region:my-instance"); got != "my-project:my-region:my-instance" {
+		t.Fatalf("want the connection name by default, got = %v", got)
+	}
+}
+
+// dialLatencyInstance waits for the dial latency of the Dialer with ID
+// dialerID to be recorded and returns the instance it is tagged with.
+func dialLatencyInstance(t *testing.T, dialerID string) string {
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		rows, err := view.RetrieveData("/cloudsqlconn/dial_latency")
+		if err != nil {
+			t.Fatalf("failed to retrieve data: %v", err)
+		}
+		for _, r := range rows {
+			tags := make(map[string]string)
+			for _, tg := range r.Tags {
+				tags[tg.Key.Name()] = tg.Value
+			}
+			if tags["cloudsql_dialer_id"] == dialerID {
+				return tags["cloudsql_instance"]
+			}
+		}
+	}
+	t.Fatal("timed out waiting for the dial latency to be recorded")
+	return ""
+}
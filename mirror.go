@@ -0,0 +1,75 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"crypto/tls"
+	"io"
+	"sync"
+)
+
+// WithUnsafeTrafficMirror returns a DialOption that copies the decrypted bytes
+// written to the connection to sent and the decrypted bytes read from it to
+// received, for debugging database protocol issues in development. Either
+// may be nil. The same writer may be passed for both, and to several Dials;
+// each copy is written whole. Errors writing the copies are ignored.
+//
+// The copies contain everything sent over the connection in the clear,
+// including passwords and query results, so this option must never be used
+// in production.
+func WithUnsafeTrafficMirror(sent, received io.Writer) DialOption {
+	m := &trafficMirror{sent: sent, received: received}
+	return func(cfg *dialCfg) {
+		cfg.mirror = m
+	}
+}
+
+// trafficMirror holds the writers of WithUnsafeTrafficMirror.
+type trafficMirror struct {
+	// mu serializes writes to sent and received, which may be the same
+	// writer, across connections.
+	mu       sync.Mutex
+	sent     io.Writer
+	received io.Writer
+}
+
+// copy writes b to w, if set.
+func (m *trafficMirror) copy(w io.Writer, b []byte) {
+	if w == nil || len(b) == 0 {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, _ = w.Write(b) // a failed copy must not affect the connection
+}
+
+// mirrorConn is a TLS connection whose decrypted traffic is copied to a
+// trafficMirror.
+type mirrorConn struct {
+	*tls.Conn
+	m *trafficMirror
+}
+
+func (c *mirrorConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.m.copy(c.m.received, b[:n])
+	return n, err
+}
+
+func (c *mirrorConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.m.copy(c.m.sent, b[:n])
+	return n, err
+}
@@ -15,22 +15,67 @@
 package cloudsqlconn
 
 import (
+	"context"
 	"crypto/rsa"
+	"crypto/tls"
+	"net"
+	"net/http"
 	"time"
 
 	"cloud.google.com/go/cloudsqlconn/internal/cloudsql"
+	"cloud.google.com/go/cloudsqlconn/internal/sqladmin"
 	"golang.org/x/oauth2"
-	apiopt "google.golang.org/api/option"
 )
 
 // A DialerOption is an option for configuring a Dialer.
 type DialerOption func(d *dialerConfig)
 
 type dialerConfig struct {
-	rsaKey         *rsa.PrivateKey
-	sqladminOpts   []apiopt.ClientOption
-	dialOpts       []DialOption
-	refreshTimeout time.Duration
+	rsaKey            *rsa.PrivateKey
+	sqladminOpts      []sqladmin.Option
+	credentialOpts    []sqladmin.Option
+	dialOpts          []DialOption
+	refreshTimeout    time.Duration
+	failoverThreshold int
+	onFailover        func(FailoverEvent)
+	maintenanceDrain  time.Duration
+	onMaintenance     func(instance string, start time.Time)
+	livenessInterval  time.Duration
+	onDeadConn        func(instance string, conn net.Conn)
+	serverValidation  string
+	certProvider      func(ctx context.Context, instance string) (tls.Certificate, error)
+	staticInfo        map[string]StaticConnectInfo
+	auditPrincipal    string
+	onAudit           func(AuditEvent)
+	onConnOpen        func(ConnInfo)
+	onConnClose       func(ConnInfo)
+	leakThreshold     time.Duration
+	onLeak            func(info ConnInfo, stack []byte)
+	userAgents        []string
+	onThrottle        func(instance string, late time.Duration)
+	clock             Clock
+	resolveEndpoint   func(project string) string
+	projectCreds      map[string]oauth2.TokenSource
+	maxDials          int
+	refreshLimit      int
+	httpClient        *http.Client
+	warmConns         int
+	warmMaxIdle       time.Duration
+	rsaKeyFile        string
+	sshJumpHost       *sshJumpHost
+	dialFunc          dialFunc
+	dnsResolver       bool
+	dnsSuffixes       []string
+	dnsServer         string
+	strictStartup     bool
+	startupInstances  []string
+	logger            Logger
+	traceSampling     int
+	inlineMetrics     bool
+	refreshStrategy   RefreshStrategy
+	strictDials       bool
+	connLimit         float64
+	metricLabel       InstanceLabeler
 }
 
 // DialerOptions turns a list of DialerOption instances into an DialerOption.
@@ -45,18 +90,21 @@ func DialerOptions(opts ...DialerOption) DialerOption {
 // WithCredentialsFile returns a DialerOption that specifies a service account or refresh token JSON credentials file to be used as the basis for authentication.
 func WithCredentialsFile(filename string) DialerOption {
 	return func(d *dialerConfig) {
-		d.sqladminOpts = append(d.sqladminOpts, apiopt.WithCredentialsFile(filename))
+		d.credentialOpts = append(d.credentialOpts, sqladmin.WithCredentialsFile(filename))
 	}
 }
 
 // WithCredentialsJSON returns a DialerOption that specifies a service account or refresh token JSON credentials to be used as the basis for authentication.
 func WithCredentialsJSON(p []byte) DialerOption {
 	return func(d *dialerConfig) {
-		d.sqladminOpts = append(d.sqladminOpts, apiopt.WithCredentialsJSON(p))
+		d.credentialOpts = append(d.credentialOpts, sqladmin.WithCredentialsJSON(p))
 	}
 }
 
-// WithDefaultDialOption returns a DialerOption that specifies the default DialOptions used.
+// WithDefaultDialOptions returns a DialerOption that specifies the DialOptions
+// applied to every Dial, such as WithTCPKeepAlive or WithPrivateIP, so that
+// they need not be repeated at each call. DialOptions passed to Dial are
+// applied after these and take precedence.
 func WithDefaultDialOptions(opts ...DialOption) DialerOption {
 	return func(d *dialerConfig) {
 		d.dialOpts = append(d.dialOpts, opts...)
@@ -66,7 +114,42 @@ func WithDefaultDialOptions(opts ...DialOption) DialerOption {
 // WithTokenSource returns a DialerOption that specifies an OAuth2 token source to be used as the basis for authentication.
 func WithTokenSource(s oauth2.TokenSource) DialerOption {
 	return func(d *dialerConfig) {
-		d.sqladminOpts = append(d.sqladminOpts, apiopt.WithTokenSource(s))
+		d.credentialOpts = append(d.credentialOpts, sqladmin.WithTokenSource(s))
+	}
+}
+
+// WithCredentialsForProject returns a DialerOption that authenticates the
+// Cloud SQL Admin API calls for instances in project with ts in place of the
+// Dialer's credentials, so that a single Dialer can connect to instances in
+// projects that each grant access to a different service account. It may be
+// given once for each project.
+func WithCredentialsForProject(project string, ts oauth2.TokenSource) DialerOption {
+	return func(d *dialerConfig) {
+		if d.projectCreds == nil {
+			d.projectCreds = make(map[string]oauth2.TokenSource)
+		}
+		d.projectCreds[project] = ts
+	}
+}
+
+// WithHTTPClient returns a DialerOption that sends Cloud SQL Admin API
+// requests with c, e.g., to use a custom transport or root CAs. The client is
+// used as is: it must authenticate requests itself, and any credentials set
+// with WithTokenSource, WithCredentialsFile, WithCredentialsJSON,
+// WithCredentialsForProject, or SetTokenSource are ignored. The Dialer's user
+// agent is still sent.
+func WithHTTPClient(c *http.Client) DialerOption {
+	return func(d *dialerConfig) {
+		d.httpClient = c
+	}
+}
+
+// WithUserAgent returns a DialerOption that appends ua, a product token such
+// as "my-service/2.3", to the user agent sent to the Cloud SQL Admin API. It
+// may be used more than once.
+func WithUserAgent(ua string) DialerOption {
+	return func(d *dialerConfig) {
+		d.userAgents = append(d.userAgents, ua)
 	}
 }
 
@@ -77,19 +160,239 @@ func WithRSAKey(k *rsa.PrivateKey) DialerOption {
 	}
 }
 
+// WithRSAKeyFile returns a DialerOption that loads the RSA key used to
+// represent the client from the PEM file at path, avoiding the cost of
+// generating a key each time a process starts. If the file does not exist, a
+// key is generated and written to it, readable only by the current user. A
+// file that other users can access is rejected. WithRSAKey takes precedence.
+func WithRSAKeyFile(path string) DialerOption {
+	return func(d *dialerConfig) {
+		d.rsaKeyFile = path
+	}
+}
+
 // WithRefreshTimeout returns a DialerOption that sets a timeout on refresh operations. Defaults to 30s.
+// Use Dialer.Configure to override it for an instance.
 func WithRefreshTimeout(t time.Duration) DialerOption {
 	return func(d *dialerConfig) {
 		d.refreshTimeout = t
 	}
 }
 
+// WithReplicaFailover returns a DialerOption that enables automatic failover
+// for replica sets registered with RegisterReplicaSet. After threshold
+// consecutive failed dials to a replica set's primary, its replicas are
+// checked and the first one that has been promoted to a primary instance
+// replaces it. The optional fn is called after each failover. Dialer.Close
+// stops failovers and waits for one in progress, so fn must not call Close.
+func WithReplicaFailover(threshold int, fn func(FailoverEvent)) DialerOption {
+	return func(d *dialerConfig) {
+		d.failoverThreshold = threshold
+		d.onFailover = fn
+	}
+}
+
+// WithMaintenanceNotifier returns a DialerOption that calls fn whenever a
+// refresh observes newly scheduled maintenance for an instance. The instance
+// argument is the instance's connection name and start is the beginning of
+// the maintenance window.
+func WithMaintenanceNotifier(fn func(instance string, start time.Time)) DialerOption {
+	return func(d *dialerConfig) {
+		d.onMaintenance = fn
+	}
+}
+
+// WithThrottleNotifier returns a DialerOption that calls fn when a background
+// refresh of an instance starts so late that the CPU is likely throttled
+// between requests, as on Cloud Run or Cloud Functions. The instance argument
+// is the instance's connection name and late is how long after its scheduled
+// time the refresh started. Detection is always on: the instance then stops
+// refreshing in the background and only refreshes when a Dial needs it, as if
+// PauseRefresh had been called, until a refresh starts on time again, e.g.,
+// one triggered by a Dial. ResumeRefresh restores background refreshes at
+// once.
+func WithThrottleNotifier(fn func(instance string, late time.Duration)) DialerOption {
+	return func(d *dialerConfig) {
+		d.onThrottle = fn
+	}
+}
+
+// WithEndpointResolver returns a DialerOption that selects the Cloud SQL Admin
+// API endpoint used for each project. It is called with the project of every
+// instance the Dialer connects to and returns the endpoint's base URL (e.g.,
+// "https://sqladmin.example.com/"), or an empty string to use the default
+// endpoint. Projects resolving to the same endpoint share a client.
+func WithEndpointResolver(fn func(project string) string) DialerOption {
+	return func(d *dialerConfig) {
+		d.resolveEndpoint = fn
+	}
+}
+
+// WithRefreshConcurrency returns a DialerOption that allows at most n refresh
+// operations to run at the same time across all of the Dialer's instances.
+// Together with the random jitter already applied to scheduled refreshes, it
+// keeps a process that dials many instances from sending a burst of Cloud SQL
+// Admin API calls whenever their certificates expire together. Refreshes
+// beyond the limit, including those a Dial is waiting for, start as running
+// ones complete. Zero, the default, places no limit.
+func WithRefreshConcurrency(n int) DialerOption {
+	return func(d *dialerConfig) {
+		d.refreshLimit = n
+	}
+}
+
+// WithWarmConnections returns a DialerOption that keeps n TLS connections to
+// each instance established in advance, so that bursty workloads get a
+// connection without waiting for TCP and TLS setup. The
+// first Dial to an instance starts filling its pool, and each Dial that uses a
+// warm connection starts a replacement. Warm connections are only used by
+// Dials with no DialOptions beyond the defaults, and are discarded once they
+// have been idle for maxIdle, as the server may have closed them.
+func WithWarmConnections(n int, maxIdle time.Duration) DialerOption {
+	return func(d *dialerConfig) {
+		d.warmConns = n
+		d.warmMaxIdle = maxIdle
+	}
+}
+
+// WithClock returns a DialerOption that uses c in place of the system clock
+// to schedule refreshes, to decide when cached certificates have expired, and
+// to measure the latencies reported as metrics. It lets tests simulate
+// certificate expiry and refresh timing deterministically. Certificate
+// verification during the TLS handshake and timeouts still use the system
+// clock.
+func WithClock(c Clock) DialerOption {
+	return func(d *dialerConfig) {
+		d.clock = c
+	}
+}
+
+// WithMaintenanceDrain returns a DialerOption that closes all connections to
+// an instance the specified duration before its scheduled maintenance, so
+// that applications can reconnect before the server restarts.
+func WithMaintenanceDrain(before time.Duration) DialerOption {
+	return func(d *dialerConfig) {
+		d.maintenanceDrain = before
+	}
+}
+
+// WithLivenessProbe returns a DialerOption that checks every interval whether
+// the connections returned by Dial have been closed by the server. When a
+// connection is found to be dead, fn is called once with the connection so
+// that it can be evicted from a pool. Probing is only supported on Unix
+// platforms.
+func WithLivenessProbe(interval time.Duration, fn func(instance string, conn net.Conn)) DialerOption {
+	return func(d *dialerConfig) {
+		d.livenessInterval = interval
+		d.onDeadConn = fn
+	}
+}
+
+// WithConnectionHooks returns a DialerOption that calls onOpen each time Dial
+// returns a connection and onClose each time one of those connections is
+// closed. Either may be nil. onClose is called from a separate goroutine.
+// The hooks should not block. They are useful for pool metrics, per-tenant
+// accounting, or leak detection.
+func WithConnectionHooks(onOpen, onClose func(ConnInfo)) DialerOption {
+	return func(d *dialerConfig) {
+		d.onConnOpen = onOpen
+		d.onConnClose = onClose
+	}
+}
+
+// WithLeakDetection returns a DialerOption that reports connections returned
+// by Dial that are still open after threshold. fn is called once for each
+// such connection with a description of it and the stack trace of the
+// goroutine that dialed it, which helps find code paths that never close
+// their connections. Capturing the stack trace adds a small cost to every
+// Dial.
+func WithLeakDetection(threshold time.Duration, fn func(info ConnInfo, stack []byte)) DialerOption {
+	return func(d *dialerConfig) {
+		d.leakThreshold = threshold
+		d.onLeak = fn
+	}
+}
+
+// WithLegacyServerValidation returns a DialerOption that verifies server
+// certificates the way instances with a per-instance CA require: the
+// certificate must be issued by the instance's CA and its Common Name must be
+// the instance name. This is the default.
+func WithLegacyServerValidation() DialerOption {
+	return func(d *dialerConfig) {
+		d.serverValidation = cloudsql.LegacyServerValidation
+	}
+}
+
+// WithCASServerValidation returns a DialerOption that verifies server
+// certificates issued by Certificate Authority Service, either Google-managed
+// or customer-managed. The certificate's chain is verified up to the CA chain
+// reported by the Cloud SQL Admin API, and its SANs are verified against the
+// instance's IP addresses and the DNS name the Admin API reports for it.
+func WithCASServerValidation() DialerOption {
+	return func(d *dialerConfig) {
+		d.serverValidation = cloudsql.CASServerValidation
+	}
+}
+
+// WithClientCertProvider returns a DialerOption that uses fn to obtain the
+// client certificate for an instance instead of requesting an ephemeral
+// certificate from the Cloud SQL Admin API. This supports certificates issued
+// by an external PKI that the server has been configured to accept. fn is
+// called again shortly before the returned certificate expires. When a call to
+// Dial triggers the refresh, ctx has the values, but not the deadline, of the
+// context passed to Dial.
+func WithClientCertProvider(fn func(ctx context.Context, instance string) (tls.Certificate, error)) DialerOption {
+	return func(d *dialerConfig) {
+		d.certProvider = fn
+	}
+}
+
+// WithDialFunc returns a DialerOption that makes all of the Dialer's network
+// connections with dial, e.g., a dialer backed by a userspace network stack
+// such as gVisor's netstack or WireGuard for processes without kernel network
+// access to the VPC. This covers connections to instances, to the Cloud SQL
+// Admin API, to token endpoints when the Dialer loads the credentials, to IAP
+// tunnels, and to SSH bastions. Addresses are passed to dial unresolved, so
+// dial also handles DNS; connections to instances are made to IP addresses.
+// Connections to the Admin API are not made with dial when WithHTTPClient is
+// used, nor are token requests made by a user-supplied token source or the
+// Compute Engine metadata server client. When connecting to an instance, the
+// context passed to dial has the values and deadline of the context passed to
+// Dial.
+func WithDialFunc(dial func(ctx context.Context, network, addr string) (net.Conn, error)) DialerOption {
+	return func(d *dialerConfig) {
+		d.dialFunc = dial
+	}
+}
+
 // A DialOption is an option for configuring how a Dialer's Dial call is executed.
 type DialOption func(d *dialCfg)
 
 type dialCfg struct {
 	tcpKeepAlive time.Duration
 	ipType       string
+	// ipTypeSet is set when an IP type DialOption was given to the Dial,
+	// rather than as a default.
+	ipTypeSet     bool
+	ipv6Preferred bool
+	readOnly      bool
+	// bandwidthLimit is the maximum bytes per second in each direction, or 0
+	// for no limit.
+	bandwidthLimit int
+	// iapTarget, if set, is the VM port to tunnel to through IAP.
+	iapTarget *iapTarget
+	// preConn, if set, holds the connection to the instance's server-side
+	// proxy that the caller established.
+	preConn *providedConn
+	// dialRetries is how many times a failed dial is retried, waiting
+	// dialBackoff before the first retry.
+	dialRetries int
+	dialBackoff time.Duration
+	// priority orders the dial among those waiting for admission.
+	priority Priority
+	// mirror, if set, receives a copy of the connection's decrypted
+	// traffic.
+	mirror *trafficMirror
 }
 
 // DialOptions turns a list of DialOption instances into an DialOption.
@@ -112,12 +415,59 @@ func WithTCPKeepAlive(d time.Duration) DialOption {
 func WithPublicIP() DialOption {
 	return func(cfg *dialCfg) {
 		cfg.ipType = cloudsql.PublicIP
+		cfg.ipTypeSet = true
 	}
 }
 
 // WithPrivateIP returns a DialOption that specifies a private IP (VPC) will be used to connect.
+// If the instance has no private IP address, Dial returns an
+// *errtypes.ConfigError once it has the instance's information, without
+// attempting to connect.
 func WithPrivateIP() DialOption {
 	return func(cfg *dialCfg) {
 		cfg.ipType = cloudsql.PrivateIP
+		cfg.ipTypeSet = true
+	}
+}
+
+// WithAutoIP returns a DialOption that connects over whichever of the
+// instance's public and private IP addresses is reachable. When the instance
+// has both, connections are raced, with the private IP attempt starting
+// shortly after the public IP one, and the first to succeed is used.
+func WithAutoIP() DialOption {
+	return func(cfg *dialCfg) {
+		cfg.ipType = cloudsql.AutoIP
+		cfg.ipTypeSet = true
+	}
+}
+
+// WithIPv6Preferred returns a DialOption that prefers the instance's public
+// IPv6 address when it has one. Connections to the IPv6 and IPv4 addresses are
+// raced, with the IPv4 attempt starting shortly after the IPv6 one, and the
+// first to succeed is used. It has no effect when connecting over private IP.
+func WithIPv6Preferred() DialOption {
+	return func(cfg *dialCfg) {
+		cfg.ipv6Preferred = true
+	}
+}
+
+// WithReadOnlyIntent returns a DialOption that specifies the connection will
+// only be used for reads. When dialing a replica set registered with
+// RegisterReplicaSet, the connection is made to one of its replicas rather
+// than the primary. It has no effect when dialing an instance directly.
+func WithReadOnlyIntent() DialOption {
+	return func(cfg *dialCfg) {
+		cfg.readOnly = true
+	}
+}
+
+// WithBandwidthLimit returns a DialOption that limits the connection's
+// throughput to bytesPerSec in each direction using a token bucket. The limit
+// applies to encrypted traffic, so it includes TLS overhead. This is useful
+// for bulk jobs that must not saturate shared links. A value of 0 or less
+// disables the limit.
+func WithBandwidthLimit(bytesPerSec int) DialOption {
+	return func(cfg *dialCfg) {
+		cfg.bandwidthLimit = bytesPerSec
 	}
 }
@@ -0,0 +1,42 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+// PauseRefresh stops the background refreshes of every instance, so the
+// Dialer makes no calls to the Cloud SQL Admin API while a workload is idle.
+// Dials continue to use the cached connection info. Once an instance's
+// certificate has expired, each dial to it refreshes it once, without
+// restarting background refreshes. Instances first dialed while paused are
+// refreshed once when dialed.
+func (d *Dialer) PauseRefresh() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.refreshPaused = true
+	for _, i := range d.instances {
+		i.Pause()
+	}
+}
+
+// ResumeRefresh restarts the background refreshes stopped by PauseRefresh,
+// starting with an immediate refresh of every instance. Dials block on the
+// refresh only if an instance's cached connection info is no longer valid.
+func (d *Dialer) ResumeRefresh() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.refreshPaused = false
+	for _, i := range d.instances {
+		i.Resume()
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/cloudsqlconn/internal/mock"
+)
+
+func TestPauseAndResumeRefresh(t *testing.T) {
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+	svc, cleanup, err := mock.NewSQLAdminService(
+		context.Background(),
+		mock.InstanceGetSuccess(inst, 2),
+		mock.CreateEphemeralSuccess(inst, 2),
+	)
+	if err != nil {
+		t.Fatalf("failed to create test SQL admin service: %s", err)
+	}
+	stop := mock.StartServerProxy(t, inst)
+	defer func() {
+		stop()
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	d, err := NewDialer(context.Background(), WithTokenSource(mock.EmptyTokenSource{}))
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	d.sqladmin = svc
+
+	// An instance first dialed while paused is refreshed once.
+	d.PauseRefresh()
+	conn, err := d.Dial(context.Background(), "my-project:my-region:my-instance")
+	if err != nil {
+		t.Fatalf("expected Dial to succeed, but got error: %v", err)
+	}
+	conn.Close()
+	i, err := d.instance(context.Background(), "my-project:my-region:my-instance")
+	if err != nil {
+		t.Fatalf("failed to get instance: %v", err)
+	}
+	var first time.Time
+	for start := time.Now(); first.IsZero() && time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		first = i.Status().LastRefresh
+	}
+	if !i.Status().Paused {
+		t.Fatal("want instance refreshes to be paused")
+	}
+
+	d.ResumeRefresh()
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		if i.Status().LastRefresh.After(first) {
+			break
+		}
+	}
+	if s := i.Status(); s.Paused || !s.LastRefresh.After(first) {
+		t.Fatalf("want an immediate refresh after ResumeRefresh, got paused = %v, last refresh = %v", s.Paused, s.LastRefresh)
+	}
+}
@@ -0,0 +1,227 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pgxv4
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/cloudsqlconn"
+)
+
+// DSN parameters that configure the connector instead of being passed to
+// Postgres.
+const (
+	// paramInstance is the instance connection name. It takes precedence over
+	// the DSN's host.
+	paramInstance = "instance"
+	// paramIPType is the IP type to connect with: public, private, or auto.
+	paramIPType = "ipType"
+	// paramIAMAuthN enables IAM database authentication.
+	paramIAMAuthN = "iamAuthn"
+	// paramDialTimeout bounds acquiring a connection to the instance from
+	// the Dialer, including any Cloud SQL Admin API calls, e.g., "10s".
+	paramDialTimeout = "dialTimeout"
+	// paramAuthTimeout bounds the Postgres startup and authentication once
+	// the instance is connected, e.g., "5s".
+	paramAuthTimeout = "authTimeout"
+	// paramKeepaliveInterval enables sending an empty query on connections
+	// that have been idle for the interval, e.g., "5m".
+	paramKeepaliveInterval = "keepaliveInterval"
+)
+
+// dsnConfig holds the connector settings parsed from a DSN.
+type dsnConfig struct {
+	instance string
+	dialOpts []cloudsqlconn.DialOption
+	// dialTimeout and authTimeout are zero when unset.
+	dialTimeout time.Duration
+	authTimeout time.Duration
+	// keepaliveInterval is zero when keepalives are disabled.
+	keepaliveInterval time.Duration
+}
+
+// parseDSN removes the connector's parameters from dsn, which may be a URL or
+// a list of key=value settings, and returns the remaining DSN for pgx along
+// with the settings.
+func parseDSN(dsn string) (string, dsnConfig, error) {
+	var (
+		rest   string
+		params map[string]string
+		err    error
+	)
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		rest, params, err = extractURLParams(dsn)
+	} else {
+		rest, params, err = extractKVParams(dsn)
+	}
+	if err != nil {
+		return "", dsnConfig{}, err
+	}
+
+	cfg := dsnConfig{instance: params[paramInstance]}
+	if v, ok := params[paramIPType]; ok {
+		switch strings.ToLower(v) {
+		case "public":
+			cfg.dialOpts = append(cfg.dialOpts, cloudsqlconn.WithPublicIP())
+		case "private":
+			cfg.dialOpts = append(cfg.dialOpts, cloudsqlconn.WithPrivateIP())
+		case "auto":
+			cfg.dialOpts = append(cfg.dialOpts, cloudsqlconn.WithAutoIP())
+		default:
+			return "", dsnConfig{}, fmt.Errorf("cloudsqlconn: invalid %s %q, want public, private, or auto", paramIPType, v)
+		}
+	}
+	if v, ok := params[paramIAMAuthN]; ok {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return "", dsnConfig{}, fmt.Errorf("cloudsqlconn: invalid %s %q: %v", paramIAMAuthN, v, err)
+		}
+		if enabled {
+			return "", dsnConfig{}, fmt.Errorf("cloudsqlconn: %s is not supported", paramIAMAuthN)
+		}
+	}
+	if cfg.dialTimeout, err = parseTimeout(params, paramDialTimeout); err != nil {
+		return "", dsnConfig{}, err
+	}
+	if cfg.authTimeout, err = parseTimeout(params, paramAuthTimeout); err != nil {
+		return "", dsnConfig{}, err
+	}
+	if cfg.keepaliveInterval, err = parseTimeout(params, paramKeepaliveInterval); err != nil {
+		return "", dsnConfig{}, err
+	}
+	return rest, cfg, nil
+}
+
+// parseTimeout returns the duration of the parameter key, or zero if it is
+// unset.
+func parseTimeout(params map[string]string, key string) (time.Duration, error) {
+	v, ok := params[key]
+	if !ok {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("cloudsqlconn: invalid %s %q: %v", key, v, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("cloudsqlconn: invalid %s %q, want a positive duration", key, v)
+	}
+	return d, nil
+}
+
+// isParam reports whether key is one of the connector's DSN parameters.
+func isParam(key string) bool {
+	switch key {
+	case paramInstance, paramIPType, paramIAMAuthN, paramDialTimeout, paramAuthTimeout,
+		paramKeepaliveInterval:
+		return true
+	}
+	return false
+}
+
+// extractURLParams removes the connector's parameters from the query of a
+// URL DSN.
+func extractURLParams(dsn string) (string, map[string]string, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return "", nil, fmt.Errorf("cloudsqlconn: failed to parse DSN: %v", err)
+	}
+	q := u.Query()
+	params := make(map[string]string)
+	for k := range q {
+		if isParam(k) {
+			params[k] = q.Get(k)
+			q.Del(k)
+		}
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), params, nil
+}
+
+// extractKVParams removes the connector's parameters from a DSN of
+// space-separated key=value settings, where values may be single-quoted and
+// use backslash escapes.
+func extractKVParams(dsn string) (string, map[string]string, error) {
+	params := make(map[string]string)
+	var kept []string
+	s := strings.TrimSpace(dsn)
+	for len(s) > 0 {
+		eq := strings.IndexRune(s, '=')
+		if eq < 0 {
+			return "", nil, fmt.Errorf("cloudsqlconn: invalid DSN, missing = after %q", s)
+		}
+		key := strings.TrimSpace(s[:eq])
+		s = strings.TrimLeft(s[eq+1:], " \t\n\r")
+
+		var val string
+		var n int
+		if strings.HasPrefix(s, "'") {
+			var b strings.Builder
+			n = 1
+			closed := false
+			for n < len(s) {
+				c := s[n]
+				n++
+				if c == '\\' && n < len(s) {
+					b.WriteByte(s[n])
+					n++
+					continue
+				}
+				if c == '\'' {
+					closed = true
+					break
+				}
+				b.WriteByte(c)
+			}
+			if !closed {
+				return "", nil, fmt.Errorf("cloudsqlconn: invalid DSN, unterminated quoted value for %q", key)
+			}
+			val = b.String()
+		} else {
+			var b strings.Builder
+			for n < len(s) && !isSpace(s[n]) {
+				if s[n] == '\\' && n+1 < len(s) {
+					n++
+				}
+				b.WriteByte(s[n])
+				n++
+			}
+			val = b.String()
+		}
+		s = strings.TrimLeft(s[n:], " \t\n\r")
+
+		if isParam(key) {
+			params[key] = val
+			continue
+		}
+		kept = append(kept, key+"="+quoteValue(val))
+	}
+	return strings.Join(kept, " "), params, nil
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// quoteValue quotes v for use in a key=value DSN.
+func quoteValue(v string) string {
+	v = strings.Replace(v, `\`, `\\`, -1)
+	v = strings.Replace(v, `'`, `\'`, -1)
+	return "'" + v + "'"
+}
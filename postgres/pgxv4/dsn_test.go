@@ -0,0 +1,116 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pgxv4
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+func TestParseDSN(t *testing.T) {
+	tcs := []struct {
+		desc         string
+		dsn          string
+		wantDSN      string
+		wantInstance string
+		wantOpts     int
+	}{
+		{
+			desc:    "key-value DSN without connector parameters",
+			dsn:     "host=p:r:i user=u dbname=db",
+			wantDSN: "host='p:r:i' user='u' dbname='db'",
+		},
+		{
+			desc:         "key-value DSN with connector parameters",
+			dsn:          "user=u password='it\\'s quoted' instance=p:r:i ipType=private iamAuthn=false",
+			wantDSN:      "user='u' password='it\\'s quoted'",
+			wantInstance: "p:r:i",
+			wantOpts:     1,
+		},
+		{
+			desc:         "URL DSN with connector parameters",
+			dsn:          "postgres://u:pw@/db?sslmode=disable&instance=p:r:i&ipType=auto",
+			wantDSN:      "postgres://u:pw@/db?sslmode=disable",
+			wantInstance: "p:r:i",
+			wantOpts:     1,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.desc, func(t *testing.T) {
+			gotDSN, cfg, err := parseDSN(tc.dsn)
+			if err != nil {
+				t.Fatalf("parseDSN failed: %v", err)
+			}
+			if gotDSN != tc.wantDSN {
+				t.Fatalf("DSN mismatch, want = %v, got = %v", tc.wantDSN, gotDSN)
+			}
+			if cfg.instance != tc.wantInstance {
+				t.Fatalf("instance mismatch, want = %v, got = %v", tc.wantInstance, cfg.instance)
+			}
+			if len(cfg.dialOpts) != tc.wantOpts {
+				t.Fatalf("dial options mismatch, want = %v, got = %v", tc.wantOpts, len(cfg.dialOpts))
+			}
+			if _, err := pgx.ParseConfig(gotDSN); err != nil {
+				t.Fatalf("pgx failed to parse the remaining DSN: %v", err)
+			}
+		})
+	}
+}
+
+func TestParseDSNTimeouts(t *testing.T) {
+	for _, dsn := range []string{
+		"user=u dialTimeout=10s authTimeout=500ms keepaliveInterval=5m",
+		"postgres://u@/db?dialTimeout=10s&authTimeout=500ms&keepaliveInterval=5m",
+	} {
+		gotDSN, cfg, err := parseDSN(dsn)
+		if err != nil {
+			t.Fatalf("parseDSN(%q) failed: %v", dsn, err)
+		}
+		if strings.Contains(gotDSN, "Timeout") || strings.Contains(gotDSN, "keepalive") {
+			t.Errorf("parseDSN(%q) kept the timeouts, got = %v", dsn, gotDSN)
+		}
+		if cfg.dialTimeout != 10*time.Second {
+			t.Errorf("dialTimeout, want = %v, got = %v", 10*time.Second, cfg.dialTimeout)
+		}
+		if cfg.authTimeout != 500*time.Millisecond {
+			t.Errorf("authTimeout, want = %v, got = %v", 500*time.Millisecond, cfg.authTimeout)
+		}
+		if cfg.keepaliveInterval != 5*time.Minute {
+			t.Errorf("keepaliveInterval, want = %v, got = %v", 5*time.Minute, cfg.keepaliveInterval)
+		}
+	}
+}
+
+func TestParseDSNErrors(t *testing.T) {
+	for _, dsn := range []string{
+		"user=u ipType=bogus",
+		"user=u iamAuthn=maybe",
+		"user=u iamAuthn=true",
+		"user=u password='unterminated",
+		"user",
+		"postgres://u@/db?ipType=bogus",
+		"user=u dialTimeout=soon",
+		"user=u authTimeout=-1s",
+		"postgres://u@/db?dialTimeout=0s",
+		"user=u keepaliveInterval=often",
+	} {
+		if _, _, err := parseDSN(dsn); err == nil {
+			t.Errorf("want parseDSN(%q) to fail", dsn)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pgxv4
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// emptyQuery is a Postgres simple Query message with an empty query string,
+// which the server answers with EmptyQueryResponse and ReadyForQuery.
+var emptyQuery = []byte{'Q', 0, 0, 0, 5, 0}
+
+// keepaliveTimeout bounds the exchange of a single keepalive.
+const keepaliveTimeout = 30 * time.Second
+
+// keepaliveConn is a net.Conn carrying the Postgres protocol that sends an
+// empty query once it has been idle for interval, so that server-side idle
+// timeouts and middleboxes do not drop connections waiting in a pool.
+//
+// A keepalive is sent only when the server's last message was ReadyForQuery
+// outside a transaction and pgx has written nothing since, i.e., when no
+// query is in progress. Messages the server sends unprompted while the
+// keepalive is in flight, such as notices, are kept and returned by the next
+// Read.
+type keepaliveConn struct {
+	net.Conn
+	interval time.Duration
+
+	mu   sync.Mutex
+	cond *sync.Cond
+	// last is when the connection was last used by pgx or a keepalive.
+	last time.Time
+	// reading and writing count the Reads and Writes in progress.
+	reading, writing int
+	// pinging is set while a keepalive is in flight. Reads and Writes wait
+	// for it to finish.
+	pinging bool
+	// idle reports whether the server's last complete message was
+	// ReadyForQuery outside a transaction with no Write since.
+	idle bool
+	// pending holds messages read by a keepalive that pgx has not read.
+	pending []byte
+	// hdr, hdrN, msgType, and remaining track the position in the stream
+	// of server messages read by pgx.
+	hdr       [5]byte
+	hdrN      int
+	msgType   byte
+	remaining int
+	closed    bool
+	timer     *time.Timer
+}
+
+// newKeepaliveConn returns conn sending keepalives when idle for interval.
+func newKeepaliveConn(conn net.Conn, interval time.Duration) *keepaliveConn {
+	c := &keepaliveConn{Conn: conn, interval: interval, last: time.Now()}
+	c.cond = sync.NewCond(&c.mu)
+	c.timer = time.AfterFunc(interval, c.keepalive)
+	return c
+}
+
+// Read reads server messages, returning any kept by a keepalive first.
+func (c *keepaliveConn) Read(b []byte) (int, error) {
+	c.mu.Lock()
+	for c.pinging {
+		c.cond.Wait()
+	}
+	if len(c.pending) > 0 {
+		n := copy(b, c.pending)
+		c.pending = c.pending[n:]
+		c.last = time.Now()
+		c.mu.Unlock()
+		return n, nil
+	}
+	c.reading++
+	c.mu.Unlock()
+
+	n, err := c.Conn.Read(b)
+
+	c.mu.Lock()
+	c.reading--
+	c.parse(b[:n])
+	c.last = time.Now()
+	c.mu.Unlock()
+	return n, err
+}
+
+// Write writes client messages once any keepalive in flight is finished.
+func (c *keepaliveConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	for c.pinging {
+		c.cond.Wait()
+	}
+	c.writing++
+	c.idle = false
+	c.mu.Unlock()
+
+	n, err := c.Conn.Write(b)
+
+	c.mu.Lock()
+	c.writing--
+	c.last = time.Now()
+	c.mu.Unlock()
+	return n, err
+}
+
+// Close stops sending keepalives and closes the connection.
+func (c *keepaliveConn) Close() error {
+	c.mu.Lock()
+	c.closed = true
+	c.timer.Stop()
+	c.mu.Unlock()
+	return c.Conn.Close()
+}
+
+// parse follows the server messages in b, which pgx has read. c.mu must be
+// held.
+func (c *keepaliveConn) parse(b []byte) {
+	for len(b) > 0 {
+		if c.hdrN < len(c.hdr) {
+			n := copy(c.hdr[c.hdrN:], b)
+			c.hdrN += n
+			b = b[n:]
+			if c.hdrN < len(c.hdr) {
+				return
+			}
+			c.msgType = c.hdr[0]
+			c.remaining = int(binary.BigEndian.Uint32(c.hdr[1:])) - 4
+			if !isAsyncMessage(c.msgType) {
+				c.idle = false
+			}
+			if c.remaining <= 0 {
+				c.hdrN = 0
+			}
+			continue
+		}
+		n := c.remaining
+		if n > len(b) {
+			n = len(b)
+		}
+		if c.msgType == 'Z' && n > 0 {
+			// ReadyForQuery's only field is the transaction status
+			c.idle = b[n-1] == 'I' && c.writing == 0
+		}
+		c.remaining -= n
+		b = b[n:]
+		if c.remaining == 0 {
+			c.hdrN = 0
+		}
+	}
+}
+
+// isAsyncMessage reports whether the server may send messages of type t at
+// any time, including between queries.
+func isAsyncMessage(t byte) bool {
+	// NoticeResponse, ParameterStatus, and NotificationResponse
+	return t == 'N' || t == 'S' || t == 'A'
+}
+
+// keepalive sends a keepalive if the connection has been idle for the
+// interval and schedules the next check.
+func (c *keepaliveConn) keepalive() {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	wait := c.interval - time.Since(c.last)
+	busy := c.reading > 0 || c.writing > 0 || !c.idle || c.hdrN != 0 || len(c.pending) > 0
+	if wait > 0 || busy {
+		if wait <= 0 {
+			wait = c.interval
+		}
+		c.timer.Reset(wait)
+		c.mu.Unlock()
+		return
+	}
+	c.pinging = true
+	c.mu.Unlock()
+
+	kept, err := c.ping()
+
+	c.mu.Lock()
+	c.pinging = false
+	c.pending = append(c.pending, kept...)
+	c.last = time.Now()
+	if err != nil {
+		// the connection is broken, so stop sending keepalives
+		c.closed = true
+	}
+	if !c.closed {
+		c.timer.Reset(c.interval)
+	}
+	c.cond.Broadcast()
+	c.mu.Unlock()
+	if err != nil {
+		// closing the connection makes pgx report an error on its next use,
+		// and database/sql discards it
+		c.Conn.Close()
+	}
+}
+
+// ping sends an empty query and reads the response, returning the messages
+// that are not part of it.
+func (c *keepaliveConn) ping() ([]byte, error) {
+	if err := c.Conn.SetDeadline(time.Now().Add(keepaliveTimeout)); err != nil {
+		return nil, err
+	}
+	defer c.Conn.SetDeadline(time.Time{})
+	if _, err := c.Conn.Write(emptyQuery); err != nil {
+		return nil, err
+	}
+	var kept []byte
+	for {
+		var hdr [5]byte
+		if _, err := io.ReadFull(c.Conn, hdr[:]); err != nil {
+			return kept, err
+		}
+		n := int(binary.BigEndian.Uint32(hdr[1:])) - 4
+		if n < 0 {
+			n = 0
+		}
+		body := make([]byte, n)
+		if _, err := io.ReadFull(c.Conn, body); err != nil {
+			return kept, err
+		}
+		switch {
+		case hdr[0] == 'Z':
+			return kept, nil
+		case isAsyncMessage(hdr[0]):
+			kept = append(kept, hdr[:]...)
+			kept = append(kept, body...)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pgxv4
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+var (
+	readyIdle  = []byte{'Z', 0, 0, 0, 5, 'I'}
+	readyInTx  = []byte{'Z', 0, 0, 0, 5, 'T'}
+	emptyResp  = []byte{'I', 0, 0, 0, 4}
+	noticeResp = []byte{'N', 0, 0, 0, 6, 'M', 0}
+)
+
+// serverSends writes msg to server and reads it from c as pgx would.
+func serverSends(t *testing.T, c net.Conn, server net.Conn, msg []byte) {
+	t.Helper()
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := server.Write(msg)
+		errCh <- err
+	}()
+	got := make([]byte, len(msg))
+	if _, err := io.ReadFull(c, got); err != nil {
+		t.Fatalf("failed to read server message: %v", err)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("failed to write server message: %v", err)
+	}
+}
+
+func TestKeepaliveSendsEmptyQueryWhenIdle(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	c := newKeepaliveConn(client, 20*time.Millisecond)
+	defer c.Close()
+
+	serverSends(t, c, server, readyIdle)
+
+	server.SetDeadline(time.Now().Add(5 * time.Second))
+	got := make([]byte, len(emptyQuery))
+	if _, err := io.ReadFull(server, got); err != nil {
+		t.Fatalf("want a keepalive, got error: %v", err)
+	}
+	if !bytes.Equal(got, emptyQuery) {
+		t.Fatalf("keepalive, want = %v, got = %v", emptyQuery, got)
+	}
+	var resp []byte
+	resp = append(resp, emptyResp...)
+	resp = append(resp, noticeResp...)
+	resp = append(resp, readyIdle...)
+	if _, err := server.Write(resp); err != nil {
+		t.Fatalf("failed to write keepalive response: %v", err)
+	}
+
+	// the notice is returned to pgx, the keepalive's response is not
+	got = make([]byte, len(noticeResp))
+	if _, err := io.ReadFull(c, got); err != nil {
+		t.Fatalf("failed to read the notice: %v", err)
+	}
+	if !bytes.Equal(got, noticeResp) {
+		t.Fatalf("message after keepalive, want = %v, got = %v", noticeResp, got)
+	}
+}
+
+func TestKeepaliveStopsWhenPingFails(t *testing.T) {
+	client, server := net.Pipe()
+	c := newKeepaliveConn(client, 20*time.Millisecond)
+	defer c.Close()
+
+	serverSends(t, c, server, readyIdle)
+	server.SetDeadline(time.Now().Add(5 * time.Second))
+	got := make([]byte, len(emptyQuery))
+	if _, err := io.ReadFull(server, got); err != nil {
+		t.Fatalf("want a keepalive, got error: %v", err)
+	}
+	// the connection breaks before the keepalive is answered
+	server.Close()
+
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		c.mu.Lock()
+		closed, pinging := c.closed, c.pinging
+		c.mu.Unlock()
+		if closed && !pinging {
+			break
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed {
+		t.Fatal("want a failed keepalive to mark the connection closed")
+	}
+	if c.timer.Stop() {
+		t.Fatal("want no keepalive scheduled after a failed one")
+	}
+}
+
+func TestKeepaliveNotSentWhenBusy(t *testing.T) {
+	tcs := []struct {
+		desc string
+		// use is how pgx uses the connection after its startup
+		use func(t *testing.T, c, server net.Conn)
+	}{
+		{
+			desc: "in a transaction",
+			use: func(t *testing.T, c, server net.Conn) {
+				serverSends(t, c, server, readyInTx)
+			},
+		},
+		{
+			desc: "query in progress",
+			use: func(t *testing.T, c, server net.Conn) {
+				query := []byte{'Q', 0, 0, 0, 13, 's', 'e', 'l', 'e', 'c', 't', ' ', '1', 0}
+				go c.Write(query)
+				got := make([]byte, len(query))
+				if _, err := io.ReadFull(server, got); err != nil {
+					t.Fatalf("failed to read query: %v", err)
+				}
+			},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.desc, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer server.Close()
+			c := newKeepaliveConn(client, 50*time.Millisecond)
+			defer c.Close()
+
+			serverSends(t, c, server, readyIdle)
+			tc.use(t, c, server)
+
+			server.SetReadDeadline(time.Now().Add(250 * time.Millisecond))
+			b := make([]byte, 1)
+			if n, err := server.Read(b); err == nil {
+				t.Fatalf("want no keepalive, got = %v", b[:n])
+			}
+		})
+	}
+}
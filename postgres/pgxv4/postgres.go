@@ -0,0 +1,381 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pgxv4 provides a Cloud SQL Postgres driver based on
+// github.com/jackc/pgx/v4 for use with database/sql.
+//
+// Register a driver and use the instance connection name as the host in the
+// DSN:
+//
+//	cleanup, err := pgxv4.RegisterDriver("cloudsql-postgres")
+//	if err != nil {
+//	    // handle error
+//	}
+//	// call cleanup when you're done with the database connection
+//	defer cleanup()
+//	db, err := sql.Open(
+//	    "cloudsql-postgres",
+//	    "host=my-project:my-region:my-instance user=myuser password=mypass dbname=mydb",
+//	)
+//
+// The dialTimeout parameter bounds how long acquiring a connection to the
+// instance may take, including any Cloud SQL Admin API calls, and the
+// authTimeout parameter bounds the Postgres startup and authentication that
+// follow. Both take a duration such as "10s". A slow Admin API then fails with
+// a *errtypes.DialError instead of a driver timeout:
+//
+//	db, err := sql.Open(
+//	    "cloudsql-postgres",
+//	    "host=my-project:my-region:my-instance user=myuser dbname=mydb dialTimeout=10s authTimeout=5s",
+//	)
+//
+// The keepaliveInterval parameter, e.g., "5m", sends an empty query on
+// connections that have been idle for the interval. This keeps idle
+// connections in the sql.DB pool from being closed by server-side idle
+// timeouts, such as idle_session_timeout, or by network devices that TCP
+// keepalives alone do not satisfy. A connection whose keepalive fails is
+// closed and discarded by database/sql on its next use.
+//
+// Several drivers may be registered under different names, each with its own
+// Dialer configuration. Alternatively, create a Connector and pass it to
+// sql.OpenDB:
+//
+//	c, err := pgxv4.NewConnector(
+//	    "my-project:my-region:my-instance",
+//	    "user=myuser password=mypass dbname=mydb",
+//	)
+//	if err != nil {
+//	    // handle error
+//	}
+//	db := sql.OpenDB(c)
+//	defer db.Close()
+package pgxv4
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/cloudsqlconn"
+	"cloud.google.com/go/cloudsqlconn/errtypes"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/stdlib"
+)
+
+// Connector is a driver.Connector that connects to a Cloud SQL instance
+// through a cloudsqlconn.Dialer. Use NewConnector to create one.
+type Connector struct {
+	c driver.Connector
+
+	mu sync.Mutex
+	// d is nil once the Connector is closed.
+	d *cloudsqlconn.Dialer
+}
+
+// NewConnector returns a Connector for the Cloud SQL instance with the
+// connection name instance. dsn is a pgx connection string with the user,
+// password, database, and any other connection parameters; its TLS settings
+// are ignored, as the Dialer provides an encrypted connection to the
+// instance. The instance, ipType, dialTimeout, authTimeout, and
+// keepaliveInterval parameters described in RegisterDriver are supported. If
+// instance is empty, the DSN names the instance as it does for RegisterDriver,
+// with the instance parameter or the host; otherwise, the DSN's host is
+// ignored and an instance parameter must match. The Connector creates its own
+// Dialer configured with opts, which is closed by Close.
+func NewConnector(instance, dsn string, opts ...cloudsqlconn.DialerOption) (*Connector, error) {
+	dsn, dc, err := parseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	config, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case instance == "" && dc.instance != "":
+		instance = dc.instance
+	case instance == "":
+		instance = config.Host
+	case dc.instance != "" && dc.instance != instance:
+		return nil, fmt.Errorf("cloudsqlconn: DSN %s %q does not match instance %q", paramInstance, dc.instance, instance)
+	}
+	d, err := cloudsqlconn.NewDialer(context.Background(), opts...)
+	if err != nil {
+		return nil, err
+	}
+	c := &Connector{d: d}
+	c.c, err = openConnector(c.dial, instance, config, dc)
+	if err != nil {
+		d.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// dialFunc connects to the instance with the given connection name.
+type dialFunc func(ctx context.Context, instance string, opts ...cloudsqlconn.DialOption) (net.Conn, error)
+
+// openConnector configures config to connect to instance with dial, using the
+// dial options and timeouts in dc, and returns a pgx connector for it.
+//
+// The config stays registered with pgx, because pgx v4 names registered
+// configs by their count and unregistering one can cause a later
+// registration to replace another. Once closed, dial rejects new
+// connections instead.
+func openConnector(dial dialFunc, instance string, config *pgx.ConnConfig, dc dsnConfig) (driver.Connector, error) {
+	// the host may be an instance connection name, which must not be
+	// resolved
+	config.LookupFunc = func(_ context.Context, host string) ([]string, error) {
+		return []string{host}, nil
+	}
+	config.DialFunc = func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return dialWithTimeouts(ctx, dial, instance, dc)
+	}
+	if dc.authTimeout > 0 {
+		// clear the deadline set by dialWithTimeouts once the connection
+		// is ready for use
+		afterConnect := config.AfterConnect
+		config.AfterConnect = func(ctx context.Context, pgConn *pgconn.PgConn) error {
+			if err := pgConn.Conn().SetDeadline(time.Time{}); err != nil {
+				return err
+			}
+			if afterConnect != nil {
+				return afterConnect(ctx, pgConn)
+			}
+			return nil
+		}
+	}
+	// the Dialer has already secured the connection
+	config.TLSConfig = nil
+	config.Fallbacks = nil
+
+	connStr := stdlib.RegisterConnConfig(config)
+	return stdlib.GetDefaultDriver().(driver.DriverContext).OpenConnector(connStr)
+}
+
+// dialWithTimeouts connects to instance with dial, giving up after
+// dc.dialTimeout, and sets a deadline of dc.authTimeout on the connection for
+// the Postgres startup. The connection sends keepalives if
+// dc.keepaliveInterval is set.
+func dialWithTimeouts(ctx context.Context, dial dialFunc, instance string, dc dsnConfig) (net.Conn, error) {
+	dialCtx := ctx
+	if dc.dialTimeout > 0 {
+		var cancel context.CancelFunc
+		dialCtx, cancel = context.WithTimeout(ctx, dc.dialTimeout)
+		defer cancel()
+	}
+	conn, err := dial(dialCtx, instance, dc.dialOpts...)
+	if err != nil {
+		// report the dial timeout unless the caller's context ended first
+		if dialCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+			msg := fmt.Sprintf("failed to acquire connection within dialTimeout (%v)", dc.dialTimeout)
+			return nil, errtypes.NewDialError(msg, instance, err)
+		}
+		return nil, err
+	}
+	if dc.keepaliveInterval > 0 {
+		conn = newKeepaliveConn(conn, dc.keepaliveInterval)
+	}
+	if dc.authTimeout > 0 {
+		if err := conn.SetDeadline(time.Now().Add(dc.authTimeout)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// Connect returns a connection to the instance. The context bounds both
+// dialing the instance and the Postgres startup, in addition to any
+// dialTimeout and authTimeout set in the DSN.
+func (c *Connector) Connect(ctx context.Context) (driver.Conn, error) {
+	return c.c.Connect(ctx)
+}
+
+// Driver returns the underlying pgx driver.
+func (c *Connector) Driver() driver.Driver {
+	return c.c.Driver()
+}
+
+// dial connects to instance unless the Connector is closed.
+func (c *Connector) dial(ctx context.Context, instance string, opts ...cloudsqlconn.DialOption) (net.Conn, error) {
+	c.mu.Lock()
+	d := c.d
+	c.mu.Unlock()
+	if d == nil {
+		return nil, errClosed
+	}
+	return d.Dial(ctx, instance, opts...)
+}
+
+// Close closes the Connector's Dialer. database/sql calls Close when the
+// sql.DB created by sql.OpenDB is closed.
+func (c *Connector) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.d != nil {
+		c.d.Close()
+		c.d = nil
+	}
+	return nil
+}
+
+// errClosed is returned when connecting with a closed Connector or driver.
+var errClosed = errors.New("cloudsqlconn: connector is closed")
+
+var (
+	driversMu sync.Mutex
+	// drivers holds the drivers registered by RegisterDriver by name.
+	drivers = make(map[string]*pgDriver)
+)
+
+// RegisterDriver registers a Postgres driver with database/sql under name,
+// using a Dialer configured with opts. The DSNs passed to sql.Open name the
+// instance with either the host or the instance parameter, e.g.,
+// "host=my-project:my-region:my-instance user=myuser dbname=mydb" or
+// "postgres://myuser@/mydb?instance=my-project:my-region:my-instance".
+//
+// DSNs may also set the IP type with the ipType parameter (public, private,
+// or auto), and the dialTimeout, authTimeout, and keepaliveInterval
+// parameters described in the package documentation. These parameters are removed before the DSN is
+// parsed by pgx.
+//
+// The returned cleanup func closes the driver's Dialer, after which opening
+// new connections fails. Because database/sql does not support unregistering
+// drivers, a closed driver's name may be registered again with a new
+// configuration.
+func RegisterDriver(name string, opts ...cloudsqlconn.DialerOption) (func() error, error) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+	drv, ok := drivers[name]
+	if ok && !drv.closed() {
+		return nil, fmt.Errorf("cloudsqlconn: driver %q is already registered", name)
+	}
+	if !ok {
+		for _, n := range sql.Drivers() {
+			if n == name {
+				return nil, fmt.Errorf("cloudsqlconn: driver name %q is in use by another package", name)
+			}
+		}
+	}
+
+	d, err := cloudsqlconn.NewDialer(context.Background(), opts...)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		drv.reset(d)
+	} else {
+		drv = &pgDriver{d: d, connectors: make(map[string]driver.Connector)}
+		sql.Register(name, drv)
+		drivers[name] = drv
+	}
+	return func() error { return drv.release(d) }, nil
+}
+
+// pgDriver is a database/sql driver that connects through a Dialer.
+type pgDriver struct {
+	mu sync.Mutex
+	// d is nil once the driver is closed.
+	d *cloudsqlconn.Dialer
+	// connectors maps DSNs to their connectors.
+	connectors map[string]driver.Connector
+}
+
+// Open returns a new connection to the instance named by the host in dsn.
+func (p *pgDriver) Open(dsn string) (driver.Conn, error) {
+	c, err := p.OpenConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return c.Connect(context.Background())
+}
+
+// OpenConnector returns a connector for dsn, which database/sql uses in place
+// of Open so that connecting respects the caller's context.
+func (p *pgDriver) OpenConnector(dsn string) (driver.Connector, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.d == nil {
+		return nil, errClosed
+	}
+	if c, ok := p.connectors[dsn]; ok {
+		return c, nil
+	}
+	pgDSN, dc, err := parseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	config, err := pgx.ParseConfig(pgDSN)
+	if err != nil {
+		return nil, err
+	}
+	instance := dc.instance
+	if instance == "" {
+		instance = config.Host
+	}
+	c, err := openConnector(p.dial, instance, config, dc)
+	if err != nil {
+		return nil, err
+	}
+	p.connectors[dsn] = c
+	return c, nil
+}
+
+// dial connects to instance with the driver's current Dialer, so that
+// connectors created before the driver was closed and registered again use
+// the new Dialer.
+func (p *pgDriver) dial(ctx context.Context, instance string, opts ...cloudsqlconn.DialOption) (net.Conn, error) {
+	p.mu.Lock()
+	d := p.d
+	p.mu.Unlock()
+	if d == nil {
+		return nil, errClosed
+	}
+	return d.Dial(ctx, instance, opts...)
+}
+
+// release closes the driver if d is still its Dialer. A cleanup func from an
+// earlier registration therefore never closes the Dialer of a later one, and
+// calling a cleanup func more than once has no effect.
+func (p *pgDriver) release(d *cloudsqlconn.Dialer) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.d != d {
+		return nil
+	}
+	p.d.Close()
+	p.d = nil
+	return nil
+}
+
+// closed reports whether the driver has been closed.
+func (p *pgDriver) closed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.d == nil
+}
+
+// reset reopens a closed driver with d.
+func (p *pgDriver) reset(d *cloudsqlconn.Dialer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.d = d
+}
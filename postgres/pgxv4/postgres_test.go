@@ -0,0 +1,209 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pgxv4
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/cloudsqlconn"
+	"cloud.google.com/go/cloudsqlconn/errtypes"
+	"cloud.google.com/go/cloudsqlconn/internal/mock"
+	"github.com/jackc/pgx/v4"
+)
+
+func TestConnectorDialsInstance(t *testing.T) {
+	c, err := NewConnector("bad-instance-name", "user=u password=p dbname=db",
+		cloudsqlconn.WithTokenSource(mock.EmptyTokenSource{}))
+	if err != nil {
+		t.Fatalf("NewConnector failed: %v", err)
+	}
+	db := sql.OpenDB(c)
+	defer db.Close()
+
+	// The invalid instance name shows the Dialer was used to connect.
+	err = db.PingContext(context.Background())
+	var wantErr *errtypes.ConfigError
+	if !errors.As(err, &wantErr) {
+		t.Fatalf("when instance name is invalid, want = %T, got = %v", wantErr, err)
+	}
+}
+
+func TestNewConnectorInstanceParam(t *testing.T) {
+	c, err := NewConnector("", "user=u password=p dbname=db instance=bad-instance-name",
+		cloudsqlconn.WithTokenSource(mock.EmptyTokenSource{}))
+	if err != nil {
+		t.Fatalf("NewConnector failed: %v", err)
+	}
+	db := sql.OpenDB(c)
+	defer db.Close()
+
+	// The invalid instance name shows the DSN's instance was dialed.
+	err = db.PingContext(context.Background())
+	var wantErr *errtypes.ConfigError
+	if !errors.As(err, &wantErr) {
+		t.Fatalf("when instance name is invalid, want = %T, got = %v", wantErr, err)
+	}
+	if !strings.Contains(err.Error(), "bad-instance-name") {
+		t.Fatalf("want error for the DSN's instance, got = %v", err)
+	}
+}
+
+func TestNewConnectorErrors(t *testing.T) {
+	_, err := NewConnector("my-project:my-region:my-instance", "port=not-a-number",
+		cloudsqlconn.WithTokenSource(mock.EmptyTokenSource{}))
+	if err == nil {
+		t.Fatal("want NewConnector to fail when the DSN is invalid")
+	}
+
+	_, err = NewConnector("my-project:my-region:my-instance",
+		"user=u instance=my-project:my-region:other-instance",
+		cloudsqlconn.WithTokenSource(mock.EmptyTokenSource{}))
+	if err == nil {
+		t.Fatal("want NewConnector to fail when the DSN names another instance")
+	}
+
+	_, err = NewConnector("my-project:my-region:my-instance", "user=u",
+		cloudsqlconn.WithCredentialsFile("bogus-file.json"))
+	if err == nil {
+		t.Fatal("want NewConnector to fail when the Dialer cannot be created")
+	}
+}
+
+func TestRegisterDriver(t *testing.T) {
+	cleanup, err := RegisterDriver("cloudsql-postgres-test",
+		cloudsqlconn.WithTokenSource(mock.EmptyTokenSource{}))
+	if err != nil {
+		t.Fatalf("RegisterDriver failed: %v", err)
+	}
+	if _, err := RegisterDriver("cloudsql-postgres-test"); err == nil {
+		t.Fatal("want RegisterDriver to fail when the name is already registered")
+	}
+	if _, err := RegisterDriver("pgx"); err == nil {
+		t.Fatal("want RegisterDriver to fail when another package uses the name")
+	}
+
+	db, err := sql.Open("cloudsql-postgres-test", "host=bad-instance-name user=u dbname=db")
+	if err != nil {
+		t.Fatalf("sql.Open failed: %v", err)
+	}
+	defer db.Close()
+	// The invalid instance name shows the Dialer was used to connect.
+	err = db.PingContext(context.Background())
+	var wantErr *errtypes.ConfigError
+	if !errors.As(err, &wantErr) {
+		t.Fatalf("when instance name is invalid, want = %T, got = %v", wantErr, err)
+	}
+
+	if err := cleanup(); err != nil {
+		t.Fatalf("cleanup failed: %v", err)
+	}
+	if err := db.PingContext(context.Background()); !errors.Is(err, errClosed) {
+		t.Fatalf("after cleanup, want = %v, got = %v", errClosed, err)
+	}
+
+	// A closed driver's name can be registered again.
+	cleanup2, err := RegisterDriver("cloudsql-postgres-test",
+		cloudsqlconn.WithTokenSource(mock.EmptyTokenSource{}))
+	if err != nil {
+		t.Fatalf("RegisterDriver after cleanup failed: %v", err)
+	}
+	defer cleanup2()
+	// The stale cleanup func must not close the new registration's Dialer.
+	if err := cleanup(); err != nil {
+		t.Fatalf("cleanup failed: %v", err)
+	}
+	if err := db.PingContext(context.Background()); !errors.As(err, &wantErr) {
+		t.Fatalf("after registering again, want = %T, got = %v", wantErr, err)
+	}
+}
+
+func TestConnectorDialTimeout(t *testing.T) {
+	// dial blocks like a Dialer waiting on a slow Admin API.
+	dial := func(ctx context.Context, _ string, _ ...cloudsqlconn.DialOption) (net.Conn, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	config, err := pgx.ParseConfig("user=u dbname=db")
+	if err != nil {
+		t.Fatalf("pgx.ParseConfig failed: %v", err)
+	}
+	c, err := openConnector(dial, "p:r:i", config, dsnConfig{dialTimeout: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("openConnector failed: %v", err)
+	}
+
+	_, err = c.Connect(context.Background())
+	var wantErr *errtypes.DialError
+	if !errors.As(err, &wantErr) {
+		t.Fatalf("when the dial times out, want = %T, got = %v", wantErr, err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("when the dial times out, want error wrapping %v, got = %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestConnectorAuthTimeout(t *testing.T) {
+	// the server accepts the connection but never answers the startup.
+	var server net.Conn
+	dial := func(context.Context, string, ...cloudsqlconn.DialOption) (net.Conn, error) {
+		var client net.Conn
+		client, server = net.Pipe()
+		go func() {
+			buf := make([]byte, 1024)
+			for {
+				if _, err := server.Read(buf); err != nil {
+					return
+				}
+			}
+		}()
+		return client, nil
+	}
+	defer func() {
+		if server != nil {
+			server.Close()
+		}
+	}()
+	config, err := pgx.ParseConfig("user=u dbname=db")
+	if err != nil {
+		t.Fatalf("pgx.ParseConfig failed: %v", err)
+	}
+	c, err := openConnector(dial, "p:r:i", config, dsnConfig{authTimeout: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("openConnector failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = c.Connect(ctx)
+	if err == nil {
+		t.Fatal("want Connect to fail when the startup times out")
+	}
+	if ctx.Err() != nil {
+		t.Fatalf("want authTimeout to end the startup before the context, got = %v", err)
+	}
+	var dialErr *errtypes.DialError
+	if errors.As(err, &dialErr) {
+		t.Fatalf("want a driver error when the startup times out, got = %v", err)
+	}
+	if !strings.Contains(err.Error(), "timeout") {
+		t.Fatalf("want a timeout error, got = %v", err)
+	}
+}
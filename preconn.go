@@ -0,0 +1,42 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import "net"
+
+// providedConn holds a connection given with WithPreconnectedConn. It is
+// referred to by pointer so that dialCfg stays comparable whatever the
+// connection's type.
+type providedConn struct {
+	conn net.Conn
+}
+
+// WithPreconnectedConn returns a DialOption that makes Dial use conn, which
+// the caller has already connected to the instance's server-side proxy
+// (port 3307 of one of its IP addresses), in place of dialing the instance,
+// e.g., for networks that are only reachable through a custom NAT traversal
+// library. Dial still retrieves the instance's information and secures the
+// connection with TLS and the Dialer's ephemeral certificate, but leaves the
+// connection's transport settings, such as TCP keep-alive, to the caller. As
+// conn can only be used once, the dial is not retried and, when a domain name
+// resolves to several instances, only the first is tried. The Dialer takes
+// ownership of conn: it is closed if Dial fails and when the connection Dial
+// returns is closed. It must not be used as a default DialOption or with
+// DialReconnecting.
+func WithPreconnectedConn(conn net.Conn) DialOption {
+	return func(cfg *dialCfg) {
+		cfg.preConn = &providedConn{conn: conn}
+	}
+}
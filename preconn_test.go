@@ -0,0 +1,100 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+
+	"cloud.google.com/go/cloudsqlconn/errtypes"
+	"cloud.google.com/go/cloudsqlconn/internal/mock"
+)
+
+func TestDialWithPreconnectedConn(t *testing.T) {
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+	svc, cleanup, err := mock.NewSQLAdminService(
+		context.Background(),
+		mock.InstanceGetSuccess(inst, 1),
+		mock.CreateEphemeralSuccess(inst, 1),
+	)
+	if err != nil {
+		t.Fatalf("failed to create test SQL admin service: %s", err)
+	}
+	stop := mock.StartServerProxy(t, inst)
+	defer func() {
+		stop()
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	var infos []ConnInfo
+	d, err := NewDialer(context.Background(),
+		WithTokenSource(mock.EmptyTokenSource{}),
+		WithConnectionHooks(func(info ConnInfo) { infos = append(infos, info) }, nil),
+	)
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	d.sqladmin = svc
+
+	raw, err := net.Dial("tcp", "127.0.0.1:3307")
+	if err != nil {
+		t.Fatalf("failed to connect to the server proxy: %v", err)
+	}
+	conn, err := d.Dial(context.Background(), "my-project:my-region:my-instance",
+		WithPreconnectedConn(raw))
+	if err != nil {
+		t.Fatalf("expected Dial to succeed, but got error: %v", err)
+	}
+	defer conn.Close()
+	data, err := ioutil.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("expected ReadAll to succeed, got error %v", err)
+	}
+	if string(data) != "my-instance" {
+		t.Fatalf("expected known response from the server, but got %v", string(data))
+	}
+	if len(infos) != 1 || infos[0].IPType != "PROVIDED" || infos[0].LocalAddr.String() != raw.LocalAddr().String() {
+		t.Fatalf("want the provided connection reported, got = %+v", infos)
+	}
+}
+
+func TestDialWithPreconnectedConnClosesOnError(t *testing.T) {
+	d, err := NewDialer(context.Background(), WithTokenSource(mock.EmptyTokenSource{}))
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+
+	client, server := net.Pipe()
+	defer server.Close()
+	_, err = d.Dial(context.Background(), "my-project:my-region:my-instance",
+		WithPreconnectedConn(client),
+		WithIAPTunnel("vm-project", "vm-zone", "my-vm", 3307),
+	)
+	var cErr *errtypes.ConfigError
+	if !errors.As(err, &cErr) {
+		t.Fatalf("want = *errtypes.ConfigError, got = %v", err)
+	}
+	if _, err := client.Write([]byte("x")); !errors.Is(err, io.ErrClosedPipe) {
+		t.Fatalf("want the provided connection closed, got = %v", err)
+	}
+}
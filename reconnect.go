@@ -0,0 +1,352 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// errReconnectingConnClosed is returned by operations on a ReconnectingConn
+// that has been closed.
+var errReconnectingConnClosed = errors.New("use of closed ReconnectingConn")
+
+// A ReconnectOption is an option for configuring a ReconnectingConn.
+type ReconnectOption func(c *ReconnectingConn)
+
+// WithReconnectDialOptions returns a ReconnectOption that passes opts to every
+// Dial, including the first.
+func WithReconnectDialOptions(opts ...DialOption) ReconnectOption {
+	return func(c *ReconnectingConn) {
+		c.dialOpts = append(c.dialOpts, opts...)
+	}
+}
+
+// WithReconnectHandshake returns a ReconnectOption that calls fn with every
+// new connection, including the first, before it is used. It lets an
+// application replay its own handshake (e.g., authentication) after
+// reconnecting. If fn returns an error, the connection is closed and the
+// attempt counts as failed.
+func WithReconnectHandshake(fn func(conn net.Conn) error) ReconnectOption {
+	return func(c *ReconnectingConn) {
+		c.handshake = fn
+	}
+}
+
+// WithReconnectBackoff returns a ReconnectOption that waits base after the
+// first failed reconnect attempt, doubling the wait after each further
+// failure up to max. Defaults to 1s and 1m.
+func WithReconnectBackoff(base, max time.Duration) ReconnectOption {
+	return func(c *ReconnectingConn) {
+		c.baseDelay = base
+		c.maxDelay = max
+	}
+}
+
+// WithMaxReconnectAttempts returns a ReconnectOption that gives up after n
+// consecutive failed reconnect attempts, after which every operation returns
+// the last error. Zero, the default, retries until the connection is closed
+// or an attempt fails with an error that IsRetryable reports cannot succeed.
+func WithMaxReconnectAttempts(n int) ReconnectOption {
+	return func(c *ReconnectingConn) {
+		c.maxAttempts = n
+	}
+}
+
+// ReconnectingConn is a net.Conn to a Cloud SQL instance that transparently
+// re-dials the instance when a read or write fails, for streaming protocols
+// that can resume on a new connection. Timeouts from deadlines are returned
+// to the caller and do not cause a reconnect.
+//
+// Data is not buffered across connections: a write that fails partway is
+// retried from the first byte that the failed connection did not accept,
+// which the server may never have received, and data in flight toward the
+// caller when a connection fails is lost. Protocols that need stronger
+// guarantees should resynchronize in the handshake set with
+// WithReconnectHandshake.
+//
+// Use Dialer.DialReconnecting to initialize a ReconnectingConn.
+type ReconnectingConn struct {
+	d        *Dialer
+	instance string
+	dialOpts []DialOption
+
+	handshake   func(net.Conn) error
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+	maxAttempts int
+
+	// ctx is canceled by Close to stop reconnect attempts.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// reconnectMu serializes reconnects.
+	reconnectMu sync.Mutex
+
+	mu sync.Mutex
+	// conn is the current connection and gen counts the connections made so
+	// far, so that concurrent failures of the same connection reconnect
+	// once.
+	conn net.Conn
+	gen  int
+	// err is set once reconnecting has failed permanently or the
+	// ReconnectingConn has been closed.
+	err error
+	// readDeadline and writeDeadline are reapplied to new connections.
+	readDeadline  time.Time
+	writeDeadline time.Time
+}
+
+// DialReconnecting returns a ReconnectingConn connected to the instance. The
+// instance argument is interpreted as by Dial. ctx applies only to the first
+// Dial; reconnects continue until the ReconnectingConn is closed, or until a
+// Dial fails with an error that IsRetryable reports cannot succeed, such as
+// errtypes.ErrDialerClosed once the Dialer is closed. Every operation then
+// returns that error.
+func (d *Dialer) DialReconnecting(ctx context.Context, instance string, opts ...ReconnectOption) (*ReconnectingConn, error) {
+	c := &ReconnectingConn{
+		d:         d,
+		instance:  instance,
+		baseDelay: time.Second,
+		maxDelay:  time.Minute,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.conn = conn
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	return c, nil
+}
+
+// dial connects to the instance and runs the handshake, if any.
+func (c *ReconnectingConn) dial(ctx context.Context) (net.Conn, error) {
+	conn, err := c.d.Dial(ctx, c.instance, c.dialOpts...)
+	if err != nil {
+		return nil, err
+	}
+	if c.handshake != nil {
+		if err := c.handshake(conn); err != nil {
+			_ = conn.Close() // best effort close attempt
+			return nil, &handshakeError{err: err}
+		}
+	}
+	return conn, nil
+}
+
+// handshakeError is returned by dial when the handshake set with
+// WithReconnectHandshake fails. Reconnecting retries it whatever its cause.
+type handshakeError struct{ err error }
+
+func (e *handshakeError) Error() string { return "reconnect handshake failed: " + e.err.Error() }
+func (e *handshakeError) Unwrap() error { return e.err }
+
+// permanent reports whether a reconnect attempt that failed with err cannot
+// succeed if retried, e.g., because the Dialer was closed.
+func permanent(err error) bool {
+	var hErr *handshakeError
+	return !errors.As(err, &hErr) && !IsRetryable(err)
+}
+
+// current returns the current connection and its generation.
+func (c *ReconnectingConn) current() (net.Conn, int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return nil, 0, c.err
+	}
+	return c.conn, c.gen, nil
+}
+
+// reconnect replaces the connection of generation gen after it failed. If
+// another goroutine has already replaced it, reconnect returns immediately.
+func (c *ReconnectingConn) reconnect(gen int) error {
+	c.reconnectMu.Lock()
+	defer c.reconnectMu.Unlock()
+	c.mu.Lock()
+	if c.err != nil || c.gen != gen {
+		err := c.err
+		c.mu.Unlock()
+		return err
+	}
+	old := c.conn
+	c.mu.Unlock()
+	_ = old.Close() // best effort close attempt
+
+	delay := c.baseDelay
+	for attempt := 1; ; attempt++ {
+		conn, err := c.dial(c.ctx)
+		if err == nil {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			if c.err != nil {
+				// closed while dialing
+				_ = conn.Close() // best effort close attempt
+				return c.err
+			}
+			if !c.readDeadline.IsZero() {
+				_ = conn.SetReadDeadline(c.readDeadline)
+			}
+			if !c.writeDeadline.IsZero() {
+				_ = conn.SetWriteDeadline(c.writeDeadline)
+			}
+			c.conn = conn
+			c.gen++
+			return nil
+		}
+		if c.ctx.Err() != nil {
+			return errReconnectingConnClosed
+		}
+		if permanent(err) {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			if c.err == nil {
+				c.err = err
+			}
+			return c.err
+		}
+		if c.maxAttempts > 0 && attempt >= c.maxAttempts {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			if c.err == nil {
+				c.err = fmt.Errorf("failed to reconnect after %d attempts: %w", attempt, err)
+			}
+			return c.err
+		}
+		t := time.NewTimer(delay)
+		select {
+		case <-c.ctx.Done():
+			t.Stop()
+			return errReconnectingConnClosed
+		case <-t.C:
+		}
+		if delay *= 2; delay > c.maxDelay {
+			delay = c.maxDelay
+		}
+	}
+}
+
+// shouldReconnect reports whether a read or write that failed with err calls
+// for a reconnect.
+func shouldReconnect(err error) bool {
+	var ne net.Error
+	return !(errors.As(err, &ne) && ne.Timeout())
+}
+
+// Read reads from the current connection, reconnecting if it fails.
+func (c *ReconnectingConn) Read(b []byte) (int, error) {
+	for {
+		conn, gen, err := c.current()
+		if err != nil {
+			return 0, err
+		}
+		n, err := conn.Read(b)
+		if err == nil || n > 0 || !shouldReconnect(err) {
+			// A failure after a partial read is seen by the next Read.
+			if n > 0 {
+				err = nil
+			}
+			return n, err
+		}
+		if err := c.reconnect(gen); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// Write writes b to the current connection, reconnecting and writing the
+// remainder if it fails.
+func (c *ReconnectingConn) Write(b []byte) (int, error) {
+	var written int
+	for {
+		conn, gen, err := c.current()
+		if err != nil {
+			return written, err
+		}
+		n, err := conn.Write(b[written:])
+		written += n
+		if err == nil || !shouldReconnect(err) {
+			return written, err
+		}
+		if err := c.reconnect(gen); err != nil {
+			return written, err
+		}
+	}
+}
+
+// Close closes the current connection and stops any reconnect in progress.
+func (c *ReconnectingConn) Close() error {
+	c.cancel()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err == errReconnectingConnClosed {
+		return nil
+	}
+	failed := c.err != nil
+	c.err = errReconnectingConnClosed
+	if failed {
+		// The connection was closed when reconnecting failed.
+		return nil
+	}
+	return c.conn.Close()
+}
+
+// LocalAddr returns the local address of the current connection.
+func (c *ReconnectingConn) LocalAddr() net.Addr {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn.LocalAddr()
+}
+
+// RemoteAddr returns the remote address of the current connection.
+func (c *ReconnectingConn) RemoteAddr() net.Addr {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn.RemoteAddr()
+}
+
+// SetDeadline sets the read and write deadlines of the current connection and
+// of those made by later reconnects.
+func (c *ReconnectingConn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readDeadline, c.writeDeadline = t, t
+	return c.conn.SetDeadline(t)
+}
+
+// SetReadDeadline sets the read deadline of the current connection and of
+// those made by later reconnects.
+func (c *ReconnectingConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.readDeadline = t
+	return c.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the write deadline of the current connection and of
+// those made by later reconnects.
+func (c *ReconnectingConn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writeDeadline = t
+	return c.conn.SetWriteDeadline(t)
+}
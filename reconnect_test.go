@@ -0,0 +1,186 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/cloudsqlconn/errtypes"
+	"cloud.google.com/go/cloudsqlconn/internal/mock"
+)
+
+func TestReconnectingConn(t *testing.T) {
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+	svc, cleanup, err := mock.NewSQLAdminService(
+		context.Background(),
+		mock.InstanceGetSuccess(inst, 1),
+		mock.CreateEphemeralSuccess(inst, 1),
+	)
+	if err != nil {
+		t.Fatalf("failed to create test SQL admin service: %s", err)
+	}
+	stop := mock.StartServerProxy(t, inst)
+	defer func() {
+		stop()
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	d, err := NewDialer(context.Background(), WithTokenSource(mock.EmptyTokenSource{}))
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	d.sqladmin = svc
+
+	var handshakes int32
+	conn, err := d.DialReconnecting(context.Background(), "my-project:my-region:my-instance",
+		WithReconnectHandshake(func(net.Conn) error {
+			atomic.AddInt32(&handshakes, 1)
+			return nil
+		}),
+		WithReconnectBackoff(10*time.Millisecond, 10*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatalf("expected DialReconnecting to succeed, but got error: %v", err)
+	}
+	defer conn.Close()
+
+	// The fake server proxy writes the instance name and closes each
+	// connection, so every read after the first needs a reconnect.
+	for n := 0; n < 3; n++ {
+		buf := make([]byte, len("my-instance"))
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			t.Fatalf("read %d failed: %v", n, err)
+		}
+		if got := string(buf); got != "my-instance" {
+			t.Fatalf("read %d: want = my-instance, got = %v", n, got)
+		}
+	}
+	if got := atomic.LoadInt32(&handshakes); got < 3 {
+		t.Fatalf("want a handshake for each connection, got %v", got)
+	}
+}
+
+func TestReconnectingConnGivesUp(t *testing.T) {
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+	svc, cleanup, err := mock.NewSQLAdminService(
+		context.Background(),
+		mock.InstanceGetSuccess(inst, 1),
+		mock.CreateEphemeralSuccess(inst, 1),
+	)
+	if err != nil {
+		t.Fatalf("failed to create test SQL admin service: %s", err)
+	}
+	defer cleanup()
+	stop := mock.StartServerProxy(t, inst)
+
+	d, err := NewDialer(context.Background(),
+		WithTokenSource(mock.EmptyTokenSource{}),
+		WithRefreshTimeout(time.Second),
+	)
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	d.sqladmin = svc
+
+	conn, err := d.DialReconnecting(context.Background(), "my-project:my-region:my-instance",
+		WithReconnectBackoff(10*time.Millisecond, 10*time.Millisecond),
+		WithMaxReconnectAttempts(2),
+	)
+	if err != nil {
+		t.Fatalf("expected DialReconnecting to succeed, but got error: %v", err)
+	}
+	stop()
+
+	if _, err := ioutil.ReadAll(conn); err == nil {
+		t.Fatal("want reads to fail once reconnecting gives up")
+	}
+	if _, err := conn.Write([]byte("hello")); err == nil {
+		t.Fatal("want writes to fail once reconnecting gives up")
+	}
+	if err := conn.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if _, err := conn.Read(make([]byte, 1)); err != errReconnectingConnClosed {
+		t.Fatalf("want = %v, got = %v", errReconnectingConnClosed, err)
+	}
+}
+
+func TestReconnectingConnStopsWhenDialerCloses(t *testing.T) {
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+	svc, cleanup, err := mock.NewSQLAdminService(
+		context.Background(),
+		mock.InstanceGetSuccess(inst, 1),
+		mock.CreateEphemeralSuccess(inst, 1),
+	)
+	if err != nil {
+		t.Fatalf("failed to create test SQL admin service: %s", err)
+	}
+	stop := mock.StartServerProxy(t, inst)
+	defer func() {
+		stop()
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	d, err := NewDialer(context.Background(), WithTokenSource(mock.EmptyTokenSource{}))
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	d.sqladmin = svc
+
+	conn, err := d.DialReconnecting(context.Background(), "my-project:my-region:my-instance",
+		WithReconnectBackoff(10*time.Millisecond, 10*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatalf("expected DialReconnecting to succeed, but got error: %v", err)
+	}
+	defer conn.Close()
+	buf := make([]byte, len("my-instance"))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	d.Close()
+
+	// the fake server proxy closes the connection, and reconnecting
+	// through the closed Dialer cannot succeed
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := conn.Read(buf)
+		errCh <- err
+	}()
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, errtypes.ErrDialerClosed) {
+			t.Fatalf("want = %v, got = %v", errtypes.ErrDialerClosed, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("want Read to return once the Dialer is closed")
+	}
+	if _, err := conn.Write([]byte("hello")); !errors.Is(err, errtypes.ErrDialerClosed) {
+		t.Fatalf("want writes to fail with %v, got = %v", errtypes.ErrDialerClosed, err)
+	}
+}
@@ -0,0 +1,280 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"cloud.google.com/go/cloudsqlconn/errtypes"
+	"cloud.google.com/go/cloudsqlconn/instance"
+)
+
+// ReplicaPolicy determines how a Dial with read-only intent selects among the
+// replicas of a replica set.
+type ReplicaPolicy int
+
+const (
+	// RoundRobin cycles through the healthy replicas in turn.
+	RoundRobin ReplicaPolicy = iota
+	// LeastConnections selects the healthy replica with the fewest open
+	// connections from this Dialer.
+	LeastConnections
+)
+
+// instanceTypePrimary is the instance type the Cloud SQL Admin API reports for
+// an instance that accepts writes.
+const instanceTypePrimary = "CLOUD_SQL_INSTANCE"
+
+// FailoverEvent describes the promotion of a replica to the primary of a
+// replica set.
+type FailoverEvent struct {
+	// ReplicaSet is the logical name of the replica set.
+	ReplicaSet string
+	// OldPrimary is the connection name of the primary that stopped
+	// accepting connections.
+	OldPrimary string
+	// NewPrimary is the connection name of the promoted replica.
+	NewPrimary string
+}
+
+// replicaSet groups a primary instance with its read replicas under a single
+// logical name.
+type replicaSet struct {
+	// next is the round-robin cursor and must be accessed atomically.
+	next uint32
+	// promoting is set to 1 while a failover check is in progress and must be
+	// accessed atomically.
+	promoting int32
+
+	mu       sync.RWMutex
+	primary  string
+	replicas []string
+	policy   ReplicaPolicy
+	// failures is the number of consecutive failed dials to the primary.
+	failures int
+	// dr is the connection name of the DR replica, if any.
+	dr string
+	// drType is the instance type of the DR replica as of its most recent
+	// refresh, or empty if it has not been observed since it became the DR
+	// replica.
+	drType string
+}
+
+// members returns the current primary and replicas.
+func (rs *replicaSet) members() (string, []string) {
+	rs.mu.RLock()
+	defer rs.mu.RUnlock()
+	return rs.primary, rs.replicas
+}
+
+// RegisterReplicaSet registers a primary and its read replicas under a logical
+// name. Dialing the logical name connects to the primary, unless the
+// WithReadOnlyIntent DialOption is used, in which case a healthy replica is
+// selected according to policy. A replica is unhealthy when its most recent
+// refresh has failed. When no replica is healthy, all replicas are considered.
+func (d *Dialer) RegisterReplicaSet(name string, policy ReplicaPolicy, primary string, replicas ...string) error {
+	for _, cn := range append([]string{primary}, replicas...) {
+		if err := instance.ValidateConnName(cn); err != nil {
+			return err
+		}
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if _, ok := d.instances[name]; ok {
+		return errtypes.NewConfigError("replica set name conflicts with an instance connection name", name)
+	}
+	if _, ok := d.aliases[name]; ok {
+		return errtypes.NewConfigError("replica set name conflicts with an alias", name)
+	}
+	d.replicaSets[name] = &replicaSet{
+		primary:  primary,
+		replicas: replicas,
+		policy:   policy,
+	}
+	return nil
+}
+
+// resolveReplicaSet returns the instance connection name that should be dialed
+// for name. If name is not a registered replica set, it is returned unchanged.
+func (d *Dialer) resolveReplicaSet(name string, readOnly bool) string {
+	d.lock.RLock()
+	rs, ok := d.replicaSets[name]
+	d.lock.RUnlock()
+	if !ok {
+		return name
+	}
+	primary, replicas := rs.members()
+	if !readOnly || len(replicas) == 0 {
+		return primary
+	}
+
+	var healthy []string
+	for _, cn := range replicas {
+		if d.healthy(cn) {
+			healthy = append(healthy, cn)
+		}
+	}
+	if len(healthy) == 0 {
+		healthy = replicas
+	}
+
+	switch rs.policy {
+	case LeastConnections:
+		best := healthy[0]
+		bestCt := d.openConnCount(best)
+		for _, cn := range healthy[1:] {
+			if ct := d.openConnCount(cn); ct < bestCt {
+				best, bestCt = cn, ct
+			}
+		}
+		return best
+	default:
+		n := atomic.AddUint32(&rs.next, 1) - 1
+		return healthy[int(n)%len(healthy)]
+	}
+}
+
+// recordPrimaryDial tracks the outcome of a dial to cn made on behalf of the
+// replica set name. When failover is enabled and dials to the primary fail
+// repeatedly, the replicas are checked for one that has been promoted.
+func (d *Dialer) recordPrimaryDial(name, cn string, err error) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	d.lock.RLock()
+	rs, ok := d.replicaSets[name]
+	d.lock.RUnlock()
+	if !ok {
+		return
+	}
+	rs.mu.Lock()
+	if cn != rs.primary {
+		rs.mu.Unlock()
+		return
+	}
+	if err == nil {
+		rs.failures = 0
+		rs.mu.Unlock()
+		return
+	}
+	rs.failures++
+	failed := rs.failures
+	rs.mu.Unlock()
+
+	if d.failoverThreshold <= 0 || failed < d.failoverThreshold {
+		return
+	}
+	if !atomic.CompareAndSwapInt32(&rs.promoting, 0, 1) {
+		return
+	}
+	// Close waits for failovers, so they are only started while the Dialer
+	// is open, which d.lock ensures
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	select {
+	case <-d.done:
+		atomic.StoreInt32(&rs.promoting, 0)
+		return
+	default:
+	}
+	d.failovers.Add(1)
+	go func() {
+		defer d.failovers.Done()
+		defer atomic.StoreInt32(&rs.promoting, 0)
+		d.failover(name, rs)
+	}()
+}
+
+// failover refreshes the replicas of rs, followed by its DR replica, and
+// promotes the first one that the Cloud SQL Admin API reports as a primary
+// instance. It gives up once the Dialer is closed.
+func (d *Dialer) failover(name string, rs *replicaSet) {
+	// stop checking replicas once the Dialer is closed
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-d.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	oldPrimary, replicas := rs.members()
+	rs.mu.RLock()
+	candidates := append(append([]string(nil), replicas...), rs.dr)
+	rs.mu.RUnlock()
+	for _, cn := range candidates {
+		if ctx.Err() != nil {
+			return
+		}
+		if cn == "" {
+			continue
+		}
+		i, err := d.instance(ctx, cn)
+		if err != nil {
+			continue
+		}
+		i.ForceRefresh()
+		tctx, tcancel := context.WithTimeout(ctx, d.refreshTimeout)
+		typ, err := i.InstanceType(tctx)
+		tcancel()
+		if err != nil || typ != instanceTypePrimary {
+			continue
+		}
+
+		rs.mu.Lock()
+		if rs.primary != oldPrimary {
+			// another failover has already happened
+			rs.mu.Unlock()
+			return
+		}
+		if cn == rs.dr {
+			e := d.switchToDR(name, rs)
+			rs.mu.Unlock()
+			if d.onFailover != nil {
+				d.onFailover(e)
+			}
+			return
+		}
+		rs.primary = cn
+		var remaining []string
+		for _, r := range rs.replicas {
+			if r != cn {
+				remaining = append(remaining, r)
+			}
+		}
+		rs.replicas = remaining
+		rs.failures = 0
+		rs.mu.Unlock()
+
+		if d.onFailover != nil {
+			d.onFailover(FailoverEvent{ReplicaSet: name, OldPrimary: oldPrimary, NewPrimary: cn})
+		}
+		return
+	}
+}
+
+// healthy reports whether the instance with connection name cn is usable.
+// Instances that have not been dialed yet are assumed to be healthy.
+func (d *Dialer) healthy(cn string) bool {
+	d.lock.RLock()
+	i, ok := d.instances[cn]
+	d.lock.RUnlock()
+	return !ok || i.Healthy()
+}
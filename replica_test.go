@@ -0,0 +1,222 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/cloudsqlconn/errtypes"
+	"cloud.google.com/go/cloudsqlconn/internal/cloudsql"
+	"cloud.google.com/go/cloudsqlconn/internal/mock"
+)
+
+func TestReplicaSetRouting(t *testing.T) {
+	d, err := NewDialer(context.Background(), WithTokenSource(mock.EmptyTokenSource{}))
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+
+	err = d.RegisterReplicaSet("my-db", RoundRobin, "p:r:primary", "p:r:replica1", "p:r:replica2")
+	if err != nil {
+		t.Fatalf("RegisterReplicaSet failed: %v", err)
+	}
+
+	if got := d.resolveReplicaSet("my-db", false); got != "p:r:primary" {
+		t.Fatalf("writes should go to the primary, got = %v", got)
+	}
+	for _, want := range []string{"p:r:replica1", "p:r:replica2", "p:r:replica1"} {
+		if got := d.resolveReplicaSet("my-db", true); got != want {
+			t.Fatalf("round robin selection mismatch, want = %v, got = %v", want, got)
+		}
+	}
+	if got := d.resolveReplicaSet("p:r:other", true); got != "p:r:other" {
+		t.Fatalf("unregistered names should be unchanged, got = %v", got)
+	}
+
+	err = d.RegisterReplicaSet("lc-db", LeastConnections, "p:r:primary", "p:r:replica1", "p:r:replica2")
+	if err != nil {
+		t.Fatalf("RegisterReplicaSet failed: %v", err)
+	}
+	atomic.AddInt64(d.openConnCounter("p:r:replica1"), 2)
+	if got := d.resolveReplicaSet("lc-db", true); got != "p:r:replica2" {
+		t.Fatalf("least connections selection mismatch, want = p:r:replica2, got = %v", got)
+	}
+
+	err = d.RegisterReplicaSet("bad-db", RoundRobin, "p:r:primary", "bad-name")
+	var wantErr *errtypes.ConfigError
+	if !errors.As(err, &wantErr) {
+		t.Fatalf("when replica name is invalid, want = %T, got = %v", wantErr, err)
+	}
+}
+
+func TestReplicaSetSkipsUnhealthyReplicas(t *testing.T) {
+	ctx := context.Background()
+	svc, cleanup, err := mock.NewSQLAdminService(ctx)
+	if err != nil {
+		t.Fatalf("failed to create test SQL admin service: %s", err)
+	}
+	defer cleanup()
+
+	d, err := NewDialer(ctx, WithTokenSource(mock.EmptyTokenSource{}))
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+
+	// A timeout of zero guarantees the refresh fails.
+	bad, err := cloudsql.NewInstance("p:r:replica1", svc, d.key, 0)
+	if err != nil {
+		t.Fatalf("failed to initialize Instance: %v", err)
+	}
+	if _, _, err := bad.ConnectInfo(ctx, cloudsql.PublicIP); err == nil {
+		t.Fatal("expected ConnectInfo to fail")
+	}
+	d.instances["p:r:replica1"] = bad
+
+	err = d.RegisterReplicaSet("my-db", RoundRobin, "p:r:primary", "p:r:replica1", "p:r:replica2")
+	if err != nil {
+		t.Fatalf("RegisterReplicaSet failed: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if got := d.resolveReplicaSet("my-db", true); got != "p:r:replica2" {
+			t.Fatalf("unhealthy replica should be skipped, got = %v", got)
+		}
+	}
+}
+
+func TestReplicaSetFailover(t *testing.T) {
+	ctx := context.Background()
+	replica := mock.NewFakeCSQLInstance("my-project", "my-region", "replica")
+	svc, cleanup, err := mock.NewSQLAdminService(
+		ctx,
+		mock.InstanceGetSuccess(replica, 1),
+		mock.CreateEphemeralSuccess(replica, 1),
+	)
+	if err != nil {
+		t.Fatalf("failed to create test SQL admin service: %s", err)
+	}
+	defer func() {
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	events := make(chan FailoverEvent, 1)
+	d, err := NewDialer(ctx,
+		WithTokenSource(mock.EmptyTokenSource{}),
+		WithReplicaFailover(1, func(e FailoverEvent) { events <- e }),
+	)
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	d.sqladmin = svc
+
+	err = d.RegisterReplicaSet("my-db", RoundRobin,
+		"my-project:my-region:primary", "my-project:my-region:replica")
+	if err != nil {
+		t.Fatalf("RegisterReplicaSet failed: %v", err)
+	}
+
+	// The primary has no registered API responses, so dialing it fails.
+	if _, err := d.Dial(ctx, "my-db"); err == nil {
+		t.Fatal("expected Dial to the primary to fail")
+	}
+
+	select {
+	case e := <-events:
+		want := FailoverEvent{
+			ReplicaSet: "my-db",
+			OldPrimary: "my-project:my-region:primary",
+			NewPrimary: "my-project:my-region:replica",
+		}
+		if e != want {
+			t.Fatalf("failover event mismatch, want = %v, got = %v", want, e)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for failover")
+	}
+
+	if got := d.resolveReplicaSet("my-db", false); got != "my-project:my-region:replica" {
+		t.Fatalf("writes should go to the promoted replica, got = %v", got)
+	}
+}
+
+func TestReplicaSetFailoverStopsOnClose(t *testing.T) {
+	ctx := context.Background()
+	replica := mock.NewFakeCSQLInstance("my-project", "my-region", "replica")
+	svc, cleanup, err := mock.NewSQLAdminService(
+		ctx,
+		mock.InstanceGetSuccess(replica, 1),
+		mock.CreateEphemeralSuccess(replica, 1),
+	)
+	if err != nil {
+		t.Fatalf("failed to create test SQL admin service: %s", err)
+	}
+	defer func() {
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	started := make(chan struct{})
+	var finished int32
+	d, err := NewDialer(ctx,
+		WithTokenSource(mock.EmptyTokenSource{}),
+		WithReplicaFailover(1, func(FailoverEvent) {
+			close(started)
+			time.Sleep(100 * time.Millisecond)
+			atomic.StoreInt32(&finished, 1)
+		}),
+	)
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	d.sqladmin = svc
+
+	err = d.RegisterReplicaSet("my-db", RoundRobin,
+		"my-project:my-region:primary", "my-project:my-region:replica")
+	if err != nil {
+		t.Fatalf("RegisterReplicaSet failed: %v", err)
+	}
+	// The primary has no registered API responses, so dialing it fails.
+	if _, err := d.Dial(ctx, "my-db"); err == nil {
+		t.Fatal("expected Dial to the primary to fail")
+	}
+	select {
+	case <-started:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for failover")
+	}
+
+	d.Close()
+	if atomic.LoadInt32(&finished) != 1 {
+		t.Fatal("want Close to wait for the failover in progress")
+	}
+
+	// A closed Dialer doesn't start failovers.
+	d.recordPrimaryDial("my-db", "my-project:my-region:replica", errors.New("dial failed"))
+	d.lock.RLock()
+	rs := d.replicaSets["my-db"]
+	d.lock.RUnlock()
+	if atomic.LoadInt32(&rs.promoting) != 0 {
+		t.Fatal("want no failover to start after Close")
+	}
+}
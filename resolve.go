@@ -0,0 +1,57 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"net"
+
+	"cloud.google.com/go/cloudsqlconn/errtypes"
+)
+
+// Resolve returns the address, in the form "host:port", that Dial would
+// connect to for the instance with the same options, without connecting. The
+// instance argument is an instance connection name, the name of a replica
+// set, an alias, or a domain name, as with Dial. Like Dial, Resolve waits for
+// the instance's connection info to be refreshed if necessary. When several IP
+// types are allowed (e.g., with WithAutoIP), Dial tries each available address
+// and Resolve returns the one it tries first. Resolve is useful for
+// diagnostics and for checking firewall rules before deploying.
+func (d *Dialer) Resolve(ctx context.Context, instance string, opts ...DialOption) (string, error) {
+	cfg := d.defaultDialCfg
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	names, err := d.resolveDNS(ctx, d.resolveAlias(instance))
+	if err != nil {
+		return "", err
+	}
+	// Dial tries the first of several instances a domain name resolves to
+	i, err := d.instance(ctx, d.resolveReplicaSet(d.orderCandidates(names)[0], cfg.readOnly))
+	if err != nil {
+		return "", err
+	}
+	ipTypes := cfg.preferredIPTypes()
+	ipAddrs, _, err := i.ConnectAddrs(ctx, ipTypes...)
+	if err != nil {
+		return "", err
+	}
+	for _, t := range ipTypes {
+		if a, ok := ipAddrs[t]; ok {
+			return net.JoinHostPort(a, serverProxyPort), nil
+		}
+	}
+	return "", errtypes.NewConfigError("instance has no address of the requested IP type", i.String())
+}
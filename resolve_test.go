@@ -0,0 +1,206 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/cloudsqlconn/errtypes"
+	"cloud.google.com/go/cloudsqlconn/internal/mock"
+)
+
+func TestResolve(t *testing.T) {
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance",
+		mock.WithPublicIP("127.0.0.1"),
+		mock.WithPrivateIP("10.0.0.1"),
+	)
+	svc, cleanup, err := mock.NewSQLAdminService(
+		context.Background(),
+		mock.InstanceGetSuccess(inst, 1),
+		mock.CreateEphemeralSuccess(inst, 1),
+	)
+	if err != nil {
+		t.Fatalf("failed to create test SQL admin service: %s", err)
+	}
+	defer func() {
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	d, err := NewDialer(context.Background(), WithTokenSource(mock.EmptyTokenSource{}))
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	d.sqladmin = svc
+
+	cn := "my-project:my-region:my-instance"
+	tcs := []struct {
+		desc string
+		opts []DialOption
+		want string
+	}{
+		{desc: "default", want: "127.0.0.1:3307"},
+		{desc: "private IP", opts: []DialOption{WithPrivateIP()}, want: "10.0.0.1:3307"},
+		{desc: "auto IP prefers public", opts: []DialOption{WithAutoIP()}, want: "127.0.0.1:3307"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, err := d.Resolve(context.Background(), cn, tc.opts...)
+			if err != nil {
+				t.Fatalf("Resolve failed: %v", err)
+			}
+			if got != tc.want {
+				t.Fatalf("want = %v, got = %v", tc.want, got)
+			}
+		})
+	}
+
+	// An instance without an IPv6 address resolves to its IPv4 address.
+	_, err = d.Resolve(context.Background(), cn, WithPublicIP(), WithIPv6Preferred())
+	if err != nil {
+		t.Fatalf("want IPv6 preference to fall back to the public IPv4 address, got error: %v", err)
+	}
+	if d.openConnCount(cn) != 0 {
+		t.Fatal("want Resolve to not open any connections")
+	}
+}
+
+func TestResolveSkipsUnhealthyCandidate(t *testing.T) {
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance",
+		mock.WithPublicIP("127.0.0.1"),
+	)
+	svc, cleanup, err := mock.NewSQLAdminService(
+		context.Background(),
+		mock.InstanceGetSuccess(inst, 1),
+		mock.CreateEphemeralSuccess(inst, 1),
+	)
+	if err != nil {
+		t.Fatalf("failed to create test SQL admin service: %s", err)
+	}
+	defer func() {
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	d, err := NewDialer(context.Background(),
+		WithTokenSource(mock.EmptyTokenSource{}),
+		WithDNSResolver(),
+	)
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	d.sqladmin = svc
+	d.lookupTXT = fakeTXT(map[string][]string{
+		"ha.example.com.": {"0 my-project:my-region:down", "1 my-project:my-region:my-instance"},
+	})
+	// the preferred instance has been failing, so Dial tries the other first
+	for i := 0; i < 2; i++ {
+		d.recordCandidateDial("my-project:my-region:down", errors.New("dial failed"))
+	}
+
+	got, err := d.Resolve(context.Background(), "ha.example.com")
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if want := "127.0.0.1:3307"; got != want {
+		t.Fatalf("want = %v, got = %v", want, got)
+	}
+}
+
+func TestResolveMissingIPType(t *testing.T) {
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+	svc, cleanup, err := mock.NewSQLAdminService(
+		context.Background(),
+		mock.InstanceGetSuccess(inst, 1),
+		mock.CreateEphemeralSuccess(inst, 1),
+	)
+	if err != nil {
+		t.Fatalf("failed to create test SQL admin service: %s", err)
+	}
+	defer func() {
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	d, err := NewDialer(context.Background(), WithTokenSource(mock.EmptyTokenSource{}))
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	d.sqladmin = svc
+
+	_, err = d.Resolve(context.Background(), "my-project:my-region:my-instance", WithPrivateIP())
+	var wantErr *errtypes.ConfigError
+	if !errors.As(err, &wantErr) {
+		t.Fatalf("want = %T, got = %v", wantErr, err)
+	}
+}
+
+func TestDefaultDialOptions(t *testing.T) {
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance",
+		mock.WithPublicIP("127.0.0.1"),
+		mock.WithPrivateIP("10.0.0.1"),
+	)
+	svc, cleanup, err := mock.NewSQLAdminService(
+		context.Background(),
+		mock.InstanceGetSuccess(inst, 1),
+		mock.CreateEphemeralSuccess(inst, 1),
+	)
+	if err != nil {
+		t.Fatalf("failed to create test SQL admin service: %s", err)
+	}
+	defer func() {
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	d, err := NewDialer(context.Background(),
+		WithTokenSource(mock.EmptyTokenSource{}),
+		WithDefaultDialOptions(WithPrivateIP(), WithTCPKeepAlive(time.Minute)),
+	)
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	d.sqladmin = svc
+	if got := d.defaultDialCfg.tcpKeepAlive; got != time.Minute {
+		t.Fatalf("want default TCP keep alive = %v, got = %v", time.Minute, got)
+	}
+
+	cn := "my-project:my-region:my-instance"
+	addr, err := d.Resolve(context.Background(), cn)
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if want := "10.0.0.1:3307"; addr != want {
+		t.Fatalf("with default options, want = %v, got = %v", want, addr)
+	}
+	addr, err = d.Resolve(context.Background(), cn, WithPublicIP())
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if want := "127.0.0.1:3307"; addr != want {
+		t.Fatalf("with overriding option, want = %v, got = %v", want, addr)
+	}
+}
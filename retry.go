@@ -0,0 +1,105 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"reflect"
+	"time"
+
+	"cloud.google.com/go/cloudsqlconn/errtypes"
+	"cloud.google.com/go/cloudsqlconn/internal/cloudsql"
+	"cloud.google.com/go/cloudsqlconn/internal/trace"
+)
+
+// WithDialRetries returns a DialOption that retries a failed TCP connect or
+// TLS handshake up to n times before Dial returns an error, waiting backoff
+// before the first retry and doubling the wait after each further failure.
+// Failed connects and rejected handshakes force a refresh, so retries use the
+// instance's latest IP addresses and certificates; as refreshes are rate
+// limited, a retry may wait for one. This hides brief outages, such as an
+// instance restarting, at the cost of a slower Dial. Errors retrieving the
+// instance's information are not retried, and ctx bounds the total time spent.
+// The default is no retries.
+func WithDialRetries(n int, backoff time.Duration) DialOption {
+	return func(cfg *dialCfg) {
+		cfg.dialRetries = n
+		cfg.dialBackoff = backoff
+	}
+}
+
+// connectWithRetries calls connect, retrying failed dials as configured by
+// cfg. Regardless of cfg, a dial that fails because of a server CA rotation
+// or because the instance's address refused the connection or is unreachable
+// and the refreshed information has a different address is retried once.
+func (d *Dialer) connectWithRetries(ctx context.Context, i *cloudsql.Instance, cfg dialCfg) (*tls.Conn, net.Conn, string, error) {
+	tlsConn, netConn, ipType, addrs, err := d.connect(ctx, i, cfg)
+	if cfg.preConn != nil {
+		// a provided connection can only be used once
+		return tlsConn, netConn, ipType, err
+	}
+	if err != nil && serverCARotated(err) {
+		// The server CA may have been rotated. The failed handshake has
+		// already forced a refresh, so retry once with the new server CA.
+		tlsConn, netConn, ipType, _, err = d.connect(ctx, i, cfg)
+	} else if err != nil && addrs != nil && addrUnreachable(err) && d.addrsChanged(ctx, i, cfg, addrs) {
+		// A failover has moved the instance to a new IP address, which the
+		// refresh forced by the failed dial found, so retry once with it.
+		tlsConn, netConn, ipType, _, err = d.connect(ctx, i, cfg)
+	}
+	backoff := cfg.dialBackoff
+	for attempt := 0; err != nil && attempt < cfg.dialRetries; attempt++ {
+		var dErr *errtypes.DialError
+		if !errors.As(err, &dErr) {
+			return nil, nil, "", err
+		}
+		if werr := d.sleep(ctx, backoff); werr != nil {
+			return nil, nil, "", err
+		}
+		backoff *= 2
+		tlsConn, netConn, ipType, _, err = d.connect(ctx, i, cfg)
+	}
+	return tlsConn, netConn, ipType, err
+}
+
+// addrsChanged reports whether the addresses of the types cfg prefers that i
+// has, once any refresh in progress completes, differ from addrs. The wait
+// for the refresh counts as time spent retrieving the instance's information.
+func (d *Dialer) addrsChanged(ctx context.Context, i *cloudsql.Instance, cfg dialCfg, addrs map[string]string) bool {
+	segStart := d.clock.Now()
+	cur, _, err := i.ConnectAddrs(ctx, cfg.preferredIPTypes()...)
+	d.recordSegment(i.String(), trace.DialSegmentInstanceInfo, segStart)
+	return err == nil && !reflect.DeepEqual(cur, addrs)
+}
+
+// sleep waits for dur on the Dialer's clock, returning early with ctx's error
+// if ctx is done first.
+func (d *Dialer) sleep(ctx context.Context, dur time.Duration) error {
+	if dur <= 0 {
+		return ctx.Err()
+	}
+	wake := make(chan struct{})
+	t := d.clock.AfterFunc(dur, func() { close(wake) })
+	select {
+	case <-wake:
+		return nil
+	case <-ctx.Done():
+		t.Stop()
+		return ctx.Err()
+	}
+}
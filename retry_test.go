@@ -0,0 +1,165 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/cloudsqlconn/errtypes"
+	"cloud.google.com/go/cloudsqlconn/internal/mock"
+)
+
+// flakyDialer fails the first failures dials and then dials with a
+// net.Dialer.
+type flakyDialer struct {
+	mu       sync.Mutex
+	failures int
+	attempts int
+}
+
+func (f *flakyDialer) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	f.mu.Lock()
+	f.attempts++
+	fail := f.attempts <= f.failures
+	f.mu.Unlock()
+	if fail {
+		return nil, errors.New("connection refused")
+	}
+	var d net.Dialer
+	return d.DialContext(ctx, network, addr)
+}
+
+func (f *flakyDialer) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.attempts
+}
+
+func TestDialRetries(t *testing.T) {
+	tcs := []struct {
+		desc         string
+		failures     int
+		opts         []DialOption
+		wantErr      bool
+		wantAttempts int
+	}{
+		{
+			desc:         "no retries by default",
+			failures:     1,
+			wantErr:      true,
+			wantAttempts: 1,
+		},
+		{
+			desc:         "succeeds after retrying",
+			failures:     1,
+			opts:         []DialOption{WithDialRetries(2, time.Millisecond)},
+			wantAttempts: 2,
+		},
+		{
+			desc:         "gives up after n retries",
+			failures:     3,
+			opts:         []DialOption{WithDialRetries(1, time.Millisecond)},
+			wantErr:      true,
+			wantAttempts: 2,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.desc, func(t *testing.T) {
+			inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+			svc, cleanup, err := mock.NewSQLAdminService(
+				context.Background(),
+				mock.InstanceGetSuccess(inst, 10),
+				mock.CreateEphemeralSuccess(inst, 10),
+			)
+			if err != nil {
+				t.Fatalf("failed to create SQL Admin service: %v", err)
+			}
+			defer cleanup()
+			stop := mock.StartServerProxy(t, inst)
+			defer stop()
+
+			fd := &flakyDialer{failures: tc.failures}
+			d, err := NewDialer(context.Background(),
+				WithTokenSource(mock.EmptyTokenSource{}),
+				WithDialFunc(fd.dial),
+			)
+			if err != nil {
+				t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+			}
+			defer d.Close()
+			d.sqladmin = svc
+
+			conn, err := d.Dial(context.Background(), "my-project:my-region:my-instance", tc.opts...)
+			if tc.wantErr {
+				var dErr *errtypes.DialError
+				if !errors.As(err, &dErr) {
+					t.Fatalf("want = *errtypes.DialError, got = %v", err)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("expected Dial to succeed, but got error: %v", err)
+				}
+				conn.Close()
+			}
+			if got := fd.count(); got != tc.wantAttempts {
+				t.Fatalf("attempts, want = %v, got = %v", tc.wantAttempts, got)
+			}
+		})
+	}
+}
+
+func TestDialRetriesContextDone(t *testing.T) {
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+	svc, cleanup, err := mock.NewSQLAdminService(
+		context.Background(),
+		mock.InstanceGetSuccess(inst, 10),
+		mock.CreateEphemeralSuccess(inst, 10),
+	)
+	if err != nil {
+		t.Fatalf("failed to create SQL Admin service: %v", err)
+	}
+	defer cleanup()
+
+	fd := &flakyDialer{failures: 100}
+	d, err := NewDialer(context.Background(),
+		WithTokenSource(mock.EmptyTokenSource{}),
+		WithDialFunc(fd.dial),
+	)
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	d.sqladmin = svc
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = d.Dial(ctx, "my-project:my-region:my-instance", WithDialRetries(5, time.Hour))
+	var dErr *errtypes.DialError
+	if !errors.As(err, &dErr) {
+		t.Fatalf("want = *errtypes.DialError, got = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("Dial did not stop waiting when ctx was done, took %v", elapsed)
+	}
+	if got := fd.count(); got != 1 {
+		t.Fatalf("attempts, want = 1, got = %v", got)
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+
+	"cloud.google.com/go/cloudsqlconn/internal/cloudsql"
+)
+
+// RotateClientKey generates a new RSA key for the Dialer's client certificates
+// and refreshes every instance the Dialer has connected to, so that each
+// obtains a certificate for the new key. Dials continue to use the previous
+// certificates until the refreshes complete, and open connections are
+// unaffected. RotateClientKey waits for the refreshes and returns the first
+// error encountered; instances whose refresh failed keep using their previous
+// certificate while it is valid and obtain one for the new key on their next
+// refresh.
+func (d *Dialer) RotateClientKey(ctx context.Context) error {
+	k, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return fmt.Errorf("failed to generate RSA keys: %v", err)
+	}
+	d.lock.Lock()
+	d.key = k
+	instances := make([]*cloudsql.Instance, 0, len(d.instances))
+	for _, i := range d.instances {
+		instances = append(instances, i)
+	}
+	d.lock.Unlock()
+
+	errs := make(chan error, len(instances))
+	for _, i := range instances {
+		go func(i *cloudsql.Instance) {
+			errs <- i.RotateKey(ctx, k)
+		}(i)
+	}
+	var firstErr error
+	for range instances {
+		if err := <-errs; err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
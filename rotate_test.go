@@ -0,0 +1,74 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"testing"
+
+	"cloud.google.com/go/cloudsqlconn/internal/mock"
+)
+
+func TestRotateClientKey(t *testing.T) {
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+	svc, cleanup, err := mock.NewSQLAdminService(
+		context.Background(),
+		mock.InstanceGetSuccess(inst, 2),
+		mock.CreateEphemeralSuccess(inst, 2),
+	)
+	if err != nil {
+		t.Fatalf("failed to create test SQL admin service: %s", err)
+	}
+	stop := mock.StartServerProxy(t, inst)
+	defer func() {
+		stop()
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	d, err := NewDialer(context.Background(), WithTokenSource(mock.EmptyTokenSource{}))
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	d.sqladmin = svc
+
+	cn := "my-project:my-region:my-instance"
+	open, err := d.Dial(context.Background(), cn)
+	if err != nil {
+		t.Fatalf("expected Dial to succeed, but got error: %v", err)
+	}
+	defer open.Close()
+
+	old := d.key
+	if err := d.RotateClientKey(context.Background()); err != nil {
+		t.Fatalf("RotateClientKey failed: %v", err)
+	}
+	if d.key == old {
+		t.Fatal("want RotateClientKey to replace the Dialer's key")
+	}
+
+	// Connections opened before the rotation are unaffected.
+	buf := make([]byte, len("my-instance"))
+	if _, err := open.Read(buf); err != nil {
+		t.Fatalf("read from connection opened before rotation failed: %v", err)
+	}
+	conn, err := d.Dial(context.Background(), cn)
+	if err != nil {
+		t.Fatalf("expected Dial after rotation to succeed, but got error: %v", err)
+	}
+	conn.Close()
+}
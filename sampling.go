@@ -0,0 +1,71 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"sync/atomic"
+
+	"cloud.google.com/go/cloudsqlconn/internal/trace"
+)
+
+// WithTraceSampling returns a DialerOption that starts trace spans for one in
+// every n calls to Dial, reducing the overhead of tracing for Dialers that
+// dial at a high rate. Spans for an unsampled Dial, including those of any
+// refresh it triggers, are not started at all, regardless of the OpenCensus
+// sampler. Metrics are recorded for every Dial. The default, or an n of 1 or
+// less, traces every Dial.
+func WithTraceSampling(n int) DialerOption {
+	return func(d *dialerConfig) {
+		d.traceSampling = n
+	}
+}
+
+// WithInlineMetrics returns a DialerOption that records the metrics of each
+// Dial on the goroutine calling Dial, instead of starting a goroutine per Dial
+// to record them. OpenCensus records measurements asynchronously, so this
+// adds little latency to Dial while avoiding the cost of the goroutines.
+func WithInlineMetrics() DialerOption {
+	return func(d *dialerConfig) {
+		d.inlineMetrics = true
+	}
+}
+
+// sampled reports whether the next Dial is traced.
+func (d *Dialer) sampled() bool {
+	if d.traceSampling <= 1 {
+		return true
+	}
+	return (atomic.AddUint32(&d.dialCount, 1)-1)%d.traceSampling == 0
+}
+
+// sampleDial returns the context for a Dial with ctx, in which no spans are
+// started unless the Dial is sampled.
+func (d *Dialer) sampleDial(ctx context.Context) context.Context {
+	if d.sampled() {
+		return ctx
+	}
+	return trace.WithoutSpans(ctx)
+}
+
+// recordMetrics calls record, which records metrics about a Dial, either on a
+// new goroutine or, with WithInlineMetrics, immediately.
+func (d *Dialer) recordMetrics(record func()) {
+	if d.inlineMetrics {
+		record()
+		return
+	}
+	go record()
+}
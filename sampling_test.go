@@ -0,0 +1,103 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"testing"
+
+	"cloud.google.com/go/cloudsqlconn/internal/mock"
+)
+
+func TestWithTraceSampling(t *testing.T) {
+	tcs := []struct {
+		n    int
+		want []bool
+	}{
+		{n: 0, want: []bool{true, true, true}},
+		{n: 1, want: []bool{true, true, true}},
+		{n: 3, want: []bool{true, false, false, true, false, false, true}},
+	}
+	for _, tc := range tcs {
+		d, err := NewDialer(context.Background(),
+			WithTokenSource(mock.EmptyTokenSource{}),
+			WithTraceSampling(tc.n),
+		)
+		if err != nil {
+			t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+		}
+		for i, want := range tc.want {
+			if got := d.sampled(); got != want {
+				t.Errorf("WithTraceSampling(%v): dial %v sampled, want = %v, got = %v", tc.n, i, want, got)
+			}
+		}
+		d.Close()
+	}
+}
+
+func TestWithInlineMetrics(t *testing.T) {
+	d, err := NewDialer(context.Background(),
+		WithTokenSource(mock.EmptyTokenSource{}),
+		WithInlineMetrics(),
+	)
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+
+	recorded := false
+	d.recordMetrics(func() { recorded = true })
+	if !recorded {
+		t.Fatal("want metrics to be recorded before recordMetrics returns")
+	}
+}
+
+func TestDialWithTraceSampling(t *testing.T) {
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+	svc, cleanup, err := mock.NewSQLAdminService(
+		context.Background(),
+		mock.InstanceGetSuccess(inst, 1),
+		mock.CreateEphemeralSuccess(inst, 1),
+	)
+	if err != nil {
+		t.Fatalf("failed to create test SQL admin service: %s", err)
+	}
+	stop := mock.StartServerProxy(t, inst)
+	defer func() {
+		stop()
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	d, err := NewDialer(context.Background(),
+		WithTokenSource(mock.EmptyTokenSource{}),
+		WithTraceSampling(2),
+		WithInlineMetrics(),
+	)
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	d.sqladmin = svc
+
+	for i := 0; i < 2; i++ {
+		conn, err := d.Dial(context.Background(), "my-project:my-region:my-instance")
+		if err != nil {
+			t.Fatalf("expected Dial to succeed, but got error: %v", err)
+		}
+		conn.Close()
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+
+	"cloud.google.com/go/cloudsqlconn/errtypes"
+)
+
+// startDial returns the context for a Dial with ctx, which Close cancels,
+// and a func to call once the Dial is done, which reports whether the Dialer
+// was closed in the meantime. It returns errtypes.ErrDialerClosed if the
+// Dialer is already closed. Dials don't take a lock to register with the
+// Dialer.
+func (d *Dialer) startDial(ctx context.Context) (context.Context, func() bool, error) {
+	if d.dialsCtx.Err() != nil {
+		return nil, nil, errtypes.ErrDialerClosed
+	}
+	closed := func() bool { return d.dialsCtx.Err() != nil }
+	if ctx.Done() == nil {
+		// the caller never cancels the Dial, so only Close does
+		return dialContext{Context: d.dialsCtx, values: ctx}, closed, nil
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-d.dialsCtx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() bool {
+		cancel()
+		return closed()
+	}, nil
+}
+
+// dialContext is the context of a Dial whose caller's context is never done.
+// It has the caller's values, and it is done once the Dialer is closed.
+type dialContext struct {
+	// Context is canceled by Close.
+	context.Context
+	values context.Context
+}
+
+// Value returns the value of the caller's context for key, if any. Other
+// keys are looked up in the Dialer's context, so that contexts derived from
+// a dialContext can find the context they are canceled with.
+func (c dialContext) Value(key interface{}) interface{} {
+	if v := c.values.Value(key); v != nil {
+		return v
+	}
+	return c.Context.Value(key)
+}
@@ -0,0 +1,131 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/cloudsqlconn/errtypes"
+	"cloud.google.com/go/cloudsqlconn/internal/mock"
+)
+
+func TestDialAfterClose(t *testing.T) {
+	d, err := NewDialer(context.Background(), WithTokenSource(mock.EmptyTokenSource{}))
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	d.Close()
+
+	_, err = d.Dial(context.Background(), "my-project:my-region:my-instance")
+	if !errors.Is(err, errtypes.ErrDialerClosed) {
+		t.Fatalf("Dial after Close, want = %v, got = %v", errtypes.ErrDialerClosed, err)
+	}
+}
+
+func TestCloseCancelsInflightDials(t *testing.T) {
+	tcs := []struct {
+		desc string
+		ctx  func() (context.Context, context.CancelFunc)
+	}{
+		{
+			desc: "context never done",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.Background(), func() {}
+			},
+		},
+		{
+			desc: "cancelable context",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithCancel(context.Background())
+			},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.desc, func(t *testing.T) {
+			inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+			svc, cleanup, err := mock.NewSQLAdminService(
+				context.Background(),
+				mock.InstanceGetSuccess(inst, 1),
+				mock.CreateEphemeralSuccess(inst, 1),
+			)
+			if err != nil {
+				t.Fatalf("failed to create test SQL admin service: %s", err)
+			}
+			defer func() {
+				if err := cleanup(); err != nil {
+					t.Fatalf("%v", err)
+				}
+			}()
+
+			dialing := make(chan struct{})
+			d, err := NewDialer(context.Background(),
+				WithTokenSource(mock.EmptyTokenSource{}),
+				WithDialFunc(func(ctx context.Context, _, _ string) (net.Conn, error) {
+					// hang until the Dial is cancelled
+					close(dialing)
+					<-ctx.Done()
+					return nil, ctx.Err()
+				}),
+			)
+			if err != nil {
+				t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+			}
+			d.sqladmin = svc
+
+			ctx, cancel := tc.ctx()
+			defer cancel()
+			errCh := make(chan error, 1)
+			go func() {
+				_, err := d.Dial(ctx, "my-project:my-region:my-instance")
+				errCh <- err
+			}()
+			<-dialing
+			d.Close()
+
+			select {
+			case err := <-errCh:
+				if !errors.Is(err, errtypes.ErrDialerClosed) {
+					t.Fatalf("in-flight Dial, want = %v, got = %v", errtypes.ErrDialerClosed, err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("want Close to cancel the in-flight Dial")
+			}
+		})
+	}
+}
+
+func TestCloseTwice(t *testing.T) {
+	d, err := NewDialer(context.Background(), WithTokenSource(mock.EmptyTokenSource{}))
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	v := d.WithDefaults(WithPrivateIP())
+
+	// neither a second Close nor closing a view of a closed Dialer panics
+	d.Close()
+	d.Close()
+	v.Close()
+
+	if err := d.ForceRefresh("my-project:my-region:my-instance"); !errors.Is(err, errtypes.ErrDialerClosed) {
+		t.Fatalf("ForceRefresh after Close, want = %v, got = %v", errtypes.ErrDialerClosed, err)
+	}
+	if len(d.instances) != 0 {
+		t.Fatalf("want no instances to be created after Close, got = %v", d.instances)
+	}
+}
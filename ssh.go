@@ -0,0 +1,142 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// WithSSHJumpHost returns a DialerOption that makes the TCP connections to
+// instances through an SSH bastion at addr (host:port), authenticated with
+// config, e.g., to reach private IP instances from a laptop without running a
+// separate tunnel. The connection is still secured end to end with the
+// Dialer's ephemeral certificate, so the bastion only sees encrypted traffic.
+// One SSH connection to the bastion is shared by all dials and is
+// reestablished if it breaks. Connections through the bastion do not support
+// deadlines.
+func WithSSHJumpHost(addr string, config *ssh.ClientConfig) DialerOption {
+	return func(d *dialerConfig) {
+		d.sshJumpHost = &sshJumpHost{addr: addr, config: config}
+	}
+}
+
+// sshJumpHost dials through an SSH bastion.
+type sshJumpHost struct {
+	addr   string
+	config *ssh.ClientConfig
+	// netDial connects to the bastion.
+	netDial dialFunc
+
+	// mu guards client.
+	mu sync.Mutex
+	// client is the connection to the bastion, or nil if there is none.
+	client *ssh.Client
+}
+
+// dial connects to addr through the bastion. If the connection to the
+// bastion has broken, it is reestablished once.
+func (j *sshJumpHost) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	client, err := j.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := dialSSH(ctx, client, network, addr)
+	if err == nil || ctx.Err() != nil {
+		return conn, err
+	}
+	// the error may be the broken connection to the bastion rather than
+	// addr refusing the connection, so retry with a new one
+	j.reset(client)
+	client, err = j.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return dialSSH(ctx, client, network, addr)
+}
+
+// dialSSH connects to addr through client, giving up when ctx is done.
+func dialSSH(ctx context.Context, client *ssh.Client, network, addr string) (net.Conn, error) {
+	type dialResult struct {
+		conn net.Conn
+		err  error
+	}
+	// ssh.Client.Dial doesn't take a context
+	result := make(chan dialResult, 1)
+	go func() {
+		conn, err := client.Dial(network, addr)
+		result <- dialResult{conn: conn, err: err}
+	}()
+	select {
+	case r := <-result:
+		return r.conn, r.err
+	case <-ctx.Done():
+		go func() {
+			if r := <-result; r.conn != nil {
+				r.conn.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+// connect returns the connection to the bastion, establishing it if needed.
+func (j *sshJumpHost) connect(ctx context.Context) (*ssh.Client, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.client != nil {
+		return j.client, nil
+	}
+	conn, err := j.netDial(ctx, "tcp", j.addr)
+	if err != nil {
+		return nil, err
+	}
+	// the SSH handshake doesn't take a context
+	stop := closeOnCancel(ctx, conn)
+	c, chans, reqs, err := ssh.NewClientConn(conn, j.addr, j.config)
+	stop()
+	if err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	j.client = ssh.NewClient(c, chans, reqs)
+	return j.client, nil
+}
+
+// reset discards client if it is still the connection to the bastion.
+func (j *sshJumpHost) reset(client *ssh.Client) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.client == client {
+		j.client.Close()
+		j.client = nil
+	}
+}
+
+// close closes the connection to the bastion, if any.
+func (j *sshJumpHost) close() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.client != nil {
+		j.client.Close()
+		j.client = nil
+	}
+}
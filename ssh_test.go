@@ -0,0 +1,200 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"cloud.google.com/go/cloudsqlconn/errtypes"
+	"cloud.google.com/go/cloudsqlconn/internal/mock"
+	"golang.org/x/crypto/ssh"
+)
+
+// startFakeBastion starts an SSH server that forwards direct-tcpip channels,
+// as used by ssh.Client.Dial. It returns the server's address, a count of
+// the forwarded connections, and a func to stop it.
+func startFakeBastion(t *testing.T) (string, *int64, func()) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if c.User() == "dev" && string(pass) == "secret" {
+				return nil, nil
+			}
+			return nil, io.EOF
+		},
+	}
+	config.AddHostKey(signer)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var forwarded int64
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, chans, reqs, err := ssh.NewServerConn(conn, config)
+				if err != nil {
+					return
+				}
+				go ssh.DiscardRequests(reqs)
+				for nc := range chans {
+					if nc.ChannelType() != "direct-tcpip" {
+						nc.Reject(ssh.UnknownChannelType, "unsupported")
+						continue
+					}
+					// the payload starts with the target host and port
+					p := nc.ExtraData()
+					n := binary.BigEndian.Uint32(p)
+					host := string(p[4 : 4+n])
+					port := binary.BigEndian.Uint32(p[4+n:])
+					backend, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(port))))
+					if err != nil {
+						nc.Reject(ssh.ConnectionFailed, err.Error())
+						continue
+					}
+					ch, reqs, err := nc.Accept()
+					if err != nil {
+						backend.Close()
+						continue
+					}
+					atomic.AddInt64(&forwarded, 1)
+					go ssh.DiscardRequests(reqs)
+					go func() {
+						io.Copy(ch, backend)
+						ch.Close()
+					}()
+					go func() {
+						io.Copy(backend, ch)
+						backend.Close()
+					}()
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String(), &forwarded, func() { ln.Close() }
+}
+
+func TestDialerWithSSHJumpHost(t *testing.T) {
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+	svc, cleanup, err := mock.NewSQLAdminService(
+		context.Background(),
+		mock.InstanceGetSuccess(inst, 1),
+		mock.CreateEphemeralSuccess(inst, 1),
+	)
+	if err != nil {
+		t.Fatalf("failed to create SQL Admin service: %v", err)
+	}
+	stop := mock.StartServerProxy(t, inst)
+	addr, forwarded, stopBastion := startFakeBastion(t)
+	defer func() {
+		stopBastion()
+		stop()
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	d, err := NewDialer(context.Background(),
+		WithTokenSource(mock.EmptyTokenSource{}),
+		WithSSHJumpHost(addr, &ssh.ClientConfig{
+			User:            "dev",
+			Auth:            []ssh.AuthMethod{ssh.Password("secret")},
+			HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		}),
+	)
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	d.sqladmin = svc
+
+	for i := 0; i < 2; i++ {
+		conn, err := d.Dial(context.Background(), "my-project:my-region:my-instance")
+		if err != nil {
+			t.Fatalf("expected Dial to succeed, but got error: %v", err)
+		}
+		data, err := ioutil.ReadAll(conn)
+		conn.Close()
+		if err != nil {
+			t.Fatalf("expected ReadAll to succeed, got error %v", err)
+		}
+		if string(data) != "my-instance" {
+			t.Fatalf("expected known response from the server, but got %v", string(data))
+		}
+	}
+	if got := atomic.LoadInt64(forwarded); got != 2 {
+		t.Fatalf("forwarded connections, got = %v, want = 2", got)
+	}
+}
+
+func TestDialerWithSSHJumpHostAuthFailure(t *testing.T) {
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+	svc, cleanup, err := mock.NewSQLAdminService(
+		context.Background(),
+		mock.InstanceGetSuccess(inst, 1),
+		mock.CreateEphemeralSuccess(inst, 1),
+	)
+	if err != nil {
+		t.Fatalf("failed to create SQL Admin service: %v", err)
+	}
+	addr, _, stopBastion := startFakeBastion(t)
+	defer func() {
+		stopBastion()
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	d, err := NewDialer(context.Background(),
+		WithTokenSource(mock.EmptyTokenSource{}),
+		WithSSHJumpHost(addr, &ssh.ClientConfig{
+			User:            "dev",
+			Auth:            []ssh.AuthMethod{ssh.Password("wrong")},
+			HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		}),
+	)
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	d.sqladmin = svc
+
+	_, err = d.Dial(context.Background(), "my-project:my-region:my-instance")
+	var wantErr *errtypes.DialError
+	if !errors.As(err, &wantErr) {
+		t.Fatalf("when the bastion rejects the credentials, want = %T, got = %v", wantErr, err)
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/cloudsqlconn/internal/cloudsql"
+	"cloud.google.com/go/cloudsqlconn/internal/sqladmin"
+)
+
+// ValidationError is returned by NewDialer and Validate when the Dialer's
+// configuration does not allow it to connect to the instances given to
+// WithStrictStartup.
+type ValidationError struct {
+	// Credentials is the error obtaining a token with the Dialer's
+	// credentials, if any.
+	Credentials error
+	// Errors maps the connection names of the instances that failed
+	// validation to the cause of their failure.
+	Errors map[string]error
+}
+
+func (e *ValidationError) Error() string {
+	var msgs []string
+	if e.Credentials != nil {
+		msgs = append(msgs, fmt.Sprintf("credentials: %v", e.Credentials))
+	}
+	names := make([]string, 0, len(e.Errors))
+	for cn := range e.Errors {
+		names = append(names, cn)
+	}
+	sort.Strings(names)
+	for _, cn := range names {
+		msgs = append(msgs, fmt.Sprintf("%s: %v", cn, e.Errors[cn]))
+	}
+	return fmt.Sprintf("dialer failed validation: %s", strings.Join(msgs, "; "))
+}
+
+// WithStrictStartup returns a DialerOption that makes NewDialer check that the
+// Dialer can connect to each of instances before returning, so that
+// misconfiguration is reported at startup rather than by the first Dial. The
+// Dialer's credentials must yield a token, and each instance must be
+// retrievable from the Cloud SQL Admin API, which requires the API to be
+// enabled, and have an IP address of the type selected by the default
+// DialOptions. If any check fails, NewDialer returns a *ValidationError
+// listing every failure. Use Dialer.Validate to repeat the checks later,
+// e.g., in a readiness probe.
+func WithStrictStartup(instances ...string) DialerOption {
+	return func(d *dialerConfig) {
+		d.strictStartup = true
+		d.startupInstances = instances
+	}
+}
+
+// Validate runs the checks described by WithStrictStartup for the instances
+// given to it. Unlike Dial, Validate reports a failed refresh even if an
+// earlier refresh of the instance succeeded. Validate returns nil if
+// WithStrictStartup was not used.
+func (d *Dialer) Validate(ctx context.Context) error {
+	if !d.strictStartup {
+		return nil
+	}
+	if d.checkToken {
+		if err := d.validateCredentials(ctx); err != nil {
+			// every instance would fail for the same reason
+			return &ValidationError{Credentials: err}
+		}
+	}
+	var (
+		mu   sync.Mutex
+		errs = make(map[string]error)
+		wg   sync.WaitGroup
+	)
+	for _, name := range d.startupInstances {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			if err := d.validateInstances(ctx, name); err != nil {
+				mu.Lock()
+				errs[name] = err
+				mu.Unlock()
+			}
+		}(name)
+	}
+	wg.Wait()
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+	return nil
+}
+
+// validateCredentials checks that the Dialer's credentials yield a token.
+func (d *Dialer) validateCredentials(ctx context.Context) error {
+	d.lock.RLock()
+	opts := append(append([]sqladmin.Option{}, d.sqladminOpts...), d.credentialOpts...)
+	d.lock.RUnlock()
+	ts, err := sqladmin.TokenSource(ctx, opts...)
+	if err != nil {
+		return err
+	}
+	_, err = ts.Token()
+	return err
+}
+
+// validateInstances checks that the Dialer can connect to the instances that
+// name, which is an instance connection name, the name of a replica set or an
+// alias of either, stands for.
+func (d *Dialer) validateInstances(ctx context.Context, name string) error {
+	names, err := d.configurableNames(d.resolveAlias(name))
+	if err != nil {
+		return err
+	}
+	for _, cn := range names {
+		i, err := d.instance(ctx, cn)
+		if err != nil {
+			return err
+		}
+		if err := i.Wait(ctx); err != nil {
+			return err
+		}
+		ipTypes := d.defaultDialCfg.preferredIPTypes()
+		if d.defaultDialCfg.iapTarget != nil {
+			ipTypes = []string{cloudsql.PrivateIP, cloudsql.PublicIP, cloudsql.PublicIPv6}
+		}
+		if _, _, err := i.ConnectAddrs(ctx, ipTypes...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"cloud.google.com/go/cloudsqlconn/errtypes"
+	"cloud.google.com/go/cloudsqlconn/internal/mock"
+	"golang.org/x/oauth2"
+)
+
+type errTokenSource struct{}
+
+func (errTokenSource) Token() (*oauth2.Token, error) {
+	return nil, errors.New("invalid_grant")
+}
+
+func TestValidate(t *testing.T) {
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+	disabled := mock.NewFakeCSQLInstance("other-project", "my-region", "disabled")
+	svc, cleanup, err := mock.NewSQLAdminService(
+		context.Background(),
+		mock.InstanceGetSuccess(inst, 1),
+		mock.CreateEphemeralSuccess(inst, 1),
+		mock.InstanceGetError(disabled, http.StatusForbidden, "accessNotConfigured", 1),
+	)
+	if err != nil {
+		t.Fatalf("failed to create SQL Admin service: %v", err)
+	}
+	defer func() {
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	d, err := NewDialer(context.Background(), WithTokenSource(mock.EmptyTokenSource{}))
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	if err := d.Validate(context.Background()); err != nil {
+		t.Fatalf("want Validate to succeed without WithStrictStartup, got = %v", err)
+	}
+	d.sqladmin = svc
+	d.strictStartup = true
+	d.startupInstances = []string{
+		"my-project:my-region:my-instance",
+		"other-project:my-region:disabled",
+		"bad-name",
+	}
+
+	err = d.Validate(context.Background())
+	var vErr *ValidationError
+	if !errors.As(err, &vErr) {
+		t.Fatalf("want = *ValidationError, got = %v", err)
+	}
+	if len(vErr.Errors) != 2 {
+		t.Fatalf("want 2 failed instances, got = %v", vErr.Errors)
+	}
+	var rErr *errtypes.RefreshError
+	if !errors.As(vErr.Errors["other-project:my-region:disabled"], &rErr) {
+		t.Errorf("want = *errtypes.RefreshError, got = %v", vErr.Errors["other-project:my-region:disabled"])
+	}
+	var cErr *errtypes.ConfigError
+	if !errors.As(vErr.Errors["bad-name"], &cErr) {
+		t.Errorf("want = *errtypes.ConfigError, got = %v", vErr.Errors["bad-name"])
+	}
+}
+
+func TestNewDialerWithStrictStartup(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+	}))
+	defer api.Close()
+
+	d, err := NewDialer(context.Background(),
+		WithTokenSource(mock.EmptyTokenSource{}),
+		WithEndpointResolver(func(string) string { return api.URL }),
+		WithStrictStartup("my-project:my-region:my-instance"),
+	)
+	if err == nil {
+		d.Close()
+		t.Fatal("want NewDialer to fail when an instance cannot be retrieved")
+	}
+	var vErr *ValidationError
+	if !errors.As(err, &vErr) {
+		t.Fatalf("want = *ValidationError, got = %v", err)
+	}
+	if _, ok := vErr.Errors["my-project:my-region:my-instance"]; !ok {
+		t.Fatalf("want the instance to fail validation, got = %v", vErr.Errors)
+	}
+}
+
+func TestNewDialerWithStrictStartupCredentials(t *testing.T) {
+	d, err := NewDialer(context.Background(),
+		WithTokenSource(errTokenSource{}),
+		WithStrictStartup("my-project:my-region:my-instance"),
+	)
+	if err == nil {
+		d.Close()
+		t.Fatal("want NewDialer to fail with invalid credentials")
+	}
+	var vErr *ValidationError
+	if !errors.As(err, &vErr) {
+		t.Fatalf("want = *ValidationError, got = %v", err)
+	}
+	if vErr.Credentials == nil || len(vErr.Errors) != 0 {
+		t.Fatalf("want only a credentials error, got = %v", vErr)
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+)
+
+// StaticConnectInfo is the information used to connect to an instance,
+// provisioned out-of-band, e.g., exported with Certificates from an
+// environment that can reach the Cloud SQL Admin API.
+type StaticConnectInfo struct {
+	// IPAddrs maps IP types (PUBLIC, PRIVATE, or PUBLIC_IPV6) to the
+	// instance's addresses.
+	IPAddrs map[string]string
+	// ServerCAs are the certificates of the CAs that issue the instance's
+	// server certificate.
+	ServerCAs []*x509.Certificate
+	// ClientCert is a client certificate, with its private key, that the
+	// instance accepts.
+	ClientCert tls.Certificate
+}
+
+// WithStaticConnectInfo returns a DialerOption that connects to the instance
+// with connection name instance using info, without calling the Cloud SQL
+// Admin API. This supports air-gapped environments that cannot reach the API
+// at runtime. Once info's client certificate expires, Dial returns an error
+// wrapping errtypes.ErrStaticCertExpired. The option may be given once for
+// each instance; if no credentials can be found, the Dialer can only connect
+// to these instances.
+func WithStaticConnectInfo(instance string, info StaticConnectInfo) DialerOption {
+	return func(d *dialerConfig) {
+		if d.staticInfo == nil {
+			d.staticInfo = make(map[string]StaticConnectInfo)
+		}
+		addrs := make(map[string]string, len(info.IPAddrs))
+		for t, a := range info.IPAddrs {
+			addrs[t] = a
+		}
+		info.IPAddrs = addrs
+		d.staticInfo[instance] = info
+	}
+}
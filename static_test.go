@@ -0,0 +1,109 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/cloudsqlconn/errtypes"
+	"cloud.google.com/go/cloudsqlconn/internal/mock"
+)
+
+// staticInfo returns connect info for inst with a client certificate signed
+// by the instance's CA.
+func staticInfo(t *testing.T, inst mock.FakeCSQLInstance) StaticConnectInfo {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	certPEM, err := mock.SignWithClientKey(inst.Cert, inst.Key, &key.PublicKey)
+	if err != nil {
+		t.Fatalf("failed to sign client certificate: %v", err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("failed to load client certificate: %v", err)
+	}
+	caPEM, err := mock.SelfSign(inst.Cert, inst.Key)
+	if err != nil {
+		t.Fatalf("failed to sign server CA: %v", err)
+	}
+	block, _ := pem.Decode(caPEM)
+	ca, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("failed to parse server CA: %v", err)
+	}
+	return StaticConnectInfo{
+		IPAddrs:    map[string]string{"PUBLIC": "127.0.0.1"},
+		ServerCAs:  []*x509.Certificate{ca},
+		ClientCert: cert,
+	}
+}
+
+func TestDialWithStaticConnectInfo(t *testing.T) {
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+	stop := mock.StartServerProxy(t, inst)
+	defer stop()
+
+	// no credentials or Cloud SQL Admin API are needed
+	d, err := NewDialer(context.Background(),
+		WithStaticConnectInfo("my-project:my-region:my-instance", staticInfo(t, inst)),
+	)
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+
+	conn, err := d.Dial(context.Background(), "my-project:my-region:my-instance")
+	if err != nil {
+		t.Fatalf("expected Dial to succeed, but got error: %v", err)
+	}
+	defer conn.Close()
+	data, err := ioutil.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("expected ReadAll to succeed, got error %v", err)
+	}
+	if string(data) != "my-instance" {
+		t.Fatalf("expected known response from the server, but got %v", string(data))
+	}
+}
+
+func TestDialWithExpiredStaticConnectInfo(t *testing.T) {
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance",
+		mock.WithCertExpiry(time.Now().Add(-time.Hour)),
+	)
+	d, err := NewDialer(context.Background(),
+		WithStaticConnectInfo("my-project:my-region:my-instance", staticInfo(t, inst)),
+	)
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+
+	_, err = d.Dial(context.Background(), "my-project:my-region:my-instance")
+	if !errors.Is(err, errtypes.ErrStaticCertExpired) {
+		t.Fatalf("want ErrStaticCertExpired, got = %v", err)
+	}
+}
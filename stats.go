@@ -0,0 +1,68 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import "sync/atomic"
+
+// ipTypeIAP is the IP type recorded for connections made through an IAP
+// tunnel, which reaches the instance over whichever address the VM uses.
+const ipTypeIAP = "IAP"
+
+// ipTypeProvided is the IP type recorded for connections made over a
+// connection provided with WithPreconnectedConn.
+const ipTypeProvided = "PROVIDED"
+
+// Stats describes the connections that a Dialer has open.
+type Stats struct {
+	// Instances maps the connection names of instances with open
+	// connections to their statistics.
+	Instances map[string]InstanceStats
+}
+
+// InstanceStats describes the connections that a Dialer has open to an
+// instance.
+type InstanceStats struct {
+	// OpenConns is the number of open connections.
+	OpenConns int
+	// OpenConnsByIPType maps the IP type that connections were dialed over
+	// (PUBLIC, PRIVATE, PUBLIC_IPV6, IAP for an IAP tunnel, or PROVIDED for a
+	// connection given with WithPreconnectedConn) to the number of open
+	// connections, e.g., to verify that a migration from public to private IP
+	// is complete.
+	OpenConnsByIPType map[string]int
+}
+
+// Stats returns statistics about the connections returned by Dial that are
+// still open. The same counts, tagged by IP type, are reported as the
+// OpenCensus view /cloudsqlconn/open_connections_by_ip_type.
+func (d *Dialer) Stats() Stats {
+	s := Stats{Instances: make(map[string]InstanceStats)}
+	d.openConns.Range(func(k, v interface{}) bool {
+		c := v.(*connCounters)
+		open := atomic.LoadInt64(&c.open)
+		if open <= 0 {
+			return true
+		}
+		is := InstanceStats{OpenConns: int(open), OpenConnsByIPType: make(map[string]int)}
+		for i, t := range connIPTypes {
+			if n := atomic.LoadInt64(&c.byIPType[i]); n > 0 {
+				is.OpenConnsByIPType[t] = int(n)
+			}
+		}
+		s.Instances[k.(string)] = is
+		return true
+	})
+	return s
+}
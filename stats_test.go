@@ -0,0 +1,84 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/cloudsqlconn/internal/mock"
+)
+
+func TestDialerStatsByIPType(t *testing.T) {
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance",
+		mock.WithPublicIP("127.0.0.1"),
+		mock.WithPrivateIP("127.0.0.2"),
+	)
+	svc, cleanup, err := mock.NewSQLAdminService(
+		context.Background(),
+		mock.InstanceGetSuccess(inst, 1),
+		mock.CreateEphemeralSuccess(inst, 1),
+	)
+	if err != nil {
+		t.Fatalf("failed to create SQL Admin service: %v", err)
+	}
+	stop := mock.StartServerProxy(t, inst)
+	defer func() {
+		stop()
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	d, err := NewDialer(context.Background(), WithTokenSource(mock.EmptyTokenSource{}))
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	d.sqladmin = svc
+
+	const cn = "my-project:my-region:my-instance"
+	public, err := d.Dial(context.Background(), cn)
+	if err != nil {
+		t.Fatalf("expected Dial to succeed, but got error: %v", err)
+	}
+	defer public.Close()
+	private, err := d.Dial(context.Background(), cn, WithPrivateIP())
+	if err != nil {
+		t.Fatalf("expected Dial to succeed, but got error: %v", err)
+	}
+
+	want := InstanceStats{OpenConns: 2, OpenConnsByIPType: map[string]int{"PUBLIC": 1, "PRIVATE": 1}}
+	if got := d.Stats().Instances[cn]; !reflect.DeepEqual(got, want) {
+		t.Fatalf("stats, want = %+v, got = %+v", want, got)
+	}
+
+	private.Close()
+	want = InstanceStats{OpenConns: 1, OpenConnsByIPType: map[string]int{"PUBLIC": 1}}
+	// connections are untracked asynchronously
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got := d.Stats().Instances[cn]
+		if reflect.DeepEqual(got, want) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("stats after close, want = %+v, got = %+v", want, got)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
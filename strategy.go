@@ -0,0 +1,139 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"time"
+
+	"cloud.google.com/go/cloudsqlconn/internal/cloudsql"
+)
+
+// RefreshInfo describes an instance when a refresh of the information used to
+// connect to it completes, or when a Dial uses it while no background refresh
+// is scheduled.
+type RefreshInfo struct {
+	// Instance is the instance's connection name.
+	Instance string
+	// Now is when the refresh completed or the Dial started.
+	Now time.Time
+	// Expiry is when the client certificate of the most recent successful
+	// refresh expires, or the zero time if none has succeeded.
+	Expiry time.Time
+	// Latency is how long the refresh took, or zero for a Dial.
+	Latency time.Duration
+	// Failures is the number of consecutive failed refreshes, including this
+	// one. It is zero if the refresh succeeded.
+	Failures int
+	// LastUsed is when a Dial last used the instance's information, or the
+	// zero time if none has.
+	LastUsed time.Time
+}
+
+// RefreshStrategy decides when a Dialer refreshes the information used to
+// connect to an instance.
+type RefreshStrategy interface {
+	// NextRefresh is called each time a refresh completes, and on each Dial
+	// to an instance for which it last returned false. It returns how long
+	// after info.Now to refresh again in the background, or false to
+	// refresh only when a Dial finds that the most recent refresh failed or
+	// its certificate has expired, in which case the Dial waits for the
+	// refresh. NextRefresh must not block.
+	NextRefresh(info RefreshInfo) (time.Duration, bool)
+}
+
+// WithRefreshStrategy returns a DialerOption that schedules refreshes with s.
+// The default is RefreshAheadStrategy.
+func WithRefreshStrategy(s RefreshStrategy) DialerOption {
+	return func(d *dialerConfig) {
+		d.refreshStrategy = s
+	}
+}
+
+// RefreshAheadStrategy returns the default RefreshStrategy. It refreshes in
+// the background about five minutes before the certificate expires and
+// retries failed refreshes with an exponential backoff, so that Dial rarely
+// waits on a refresh.
+func RefreshAheadStrategy() RefreshStrategy {
+	return refreshAhead{}
+}
+
+type refreshAhead struct{}
+
+func (refreshAhead) NextRefresh(info RefreshInfo) (time.Duration, bool) {
+	return cloudsql.RefreshAhead(toInternalInfo(info))
+}
+
+// LazyRefreshStrategy returns a RefreshStrategy that never refreshes in the
+// background. An instance's information is refreshed only when a Dial needs
+// it, so a Dialer makes no Cloud SQL Admin API calls while idle, e.g., on a
+// battery-powered device or a serverless platform that throttles the CPU
+// between requests, at the cost of Dials that wait for a refresh about once
+// an hour.
+func LazyRefreshStrategy() RefreshStrategy {
+	return lazyRefresh{}
+}
+
+type lazyRefresh struct{}
+
+func (lazyRefresh) NextRefresh(RefreshInfo) (time.Duration, bool) {
+	return 0, false
+}
+
+// HybridRefreshStrategy returns a RefreshStrategy that refreshes instances in
+// the background like RefreshAheadStrategy while they are in use, and like
+// LazyRefreshStrategy once no Dial has used them for idle. A Dial to an idle
+// instance resumes background refreshes, and waits for a refresh only if the
+// certificate has expired in the meantime. This suits spiky workloads that
+// are busy at times and idle for hours at others.
+func HybridRefreshStrategy(idle time.Duration) RefreshStrategy {
+	return hybridRefresh{idle: idle}
+}
+
+type hybridRefresh struct {
+	idle time.Duration
+}
+
+func (h hybridRefresh) NextRefresh(info RefreshInfo) (time.Duration, bool) {
+	if info.LastUsed.IsZero() || info.Now.Sub(info.LastUsed) > h.idle {
+		return 0, false
+	}
+	return refreshAhead{}.NextRefresh(info)
+}
+
+// toInternalInfo converts info for the internal refresh strategy.
+func toInternalInfo(info RefreshInfo) cloudsql.RefreshInfo {
+	return cloudsql.RefreshInfo{
+		Now:      info.Now,
+		Expiry:   info.Expiry,
+		Latency:  info.Latency,
+		Failures: info.Failures,
+		LastUsed: info.LastUsed,
+	}
+}
+
+// instanceStrategy adapts s to schedule the refreshes of the instance with
+// connection name cn.
+func instanceStrategy(cn string, s RefreshStrategy) cloudsql.RefreshStrategy {
+	return func(info cloudsql.RefreshInfo) (time.Duration, bool) {
+		return s.NextRefresh(RefreshInfo{
+			Instance: cn,
+			Now:      info.Now,
+			Expiry:   info.Expiry,
+			Latency:  info.Latency,
+			Failures: info.Failures,
+			LastUsed: info.LastUsed,
+		})
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/cloudsqlconn/internal/mock"
+)
+
+// fakeStrategy is a RefreshStrategy that never refreshes in the background
+// and sends the information it is called with on a channel.
+type fakeStrategy chan RefreshInfo
+
+func (s fakeStrategy) NextRefresh(info RefreshInfo) (time.Duration, bool) {
+	s <- info
+	return 0, false
+}
+
+func TestDialWithRefreshStrategy(t *testing.T) {
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+	svc, cleanup, err := mock.NewSQLAdminService(
+		context.Background(),
+		mock.InstanceGetSuccess(inst, 1),
+		mock.CreateEphemeralSuccess(inst, 1),
+	)
+	if err != nil {
+		t.Fatalf("failed to create test SQL admin service: %s", err)
+	}
+	stop := mock.StartServerProxy(t, inst)
+	defer func() {
+		stop()
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	s := make(fakeStrategy, 10)
+	d, err := NewDialer(context.Background(),
+		WithTokenSource(mock.EmptyTokenSource{}),
+		WithRefreshStrategy(s),
+	)
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	d.sqladmin = svc
+
+	// the mock serves a single refresh, so a second Dial succeeds only if
+	// the strategy stopped a background refresh from being scheduled
+	for i := 0; i < 2; i++ {
+		conn, err := d.Dial(context.Background(), "my-project:my-region:my-instance")
+		if err != nil {
+			t.Fatalf("expected Dial to succeed, but got error: %v", err)
+		}
+		conn.Close()
+	}
+
+	select {
+	case info := <-s:
+		if info.Instance != "my-project:my-region:my-instance" {
+			t.Fatalf("Instance, want = %v, got = %v", "my-project:my-region:my-instance", info.Instance)
+		}
+		if info.Failures != 0 {
+			t.Fatalf("Failures, want = 0, got = %v", info.Failures)
+		}
+		if !info.Expiry.After(info.Now) {
+			t.Fatalf("want Expiry (%v) after Now (%v)", info.Expiry, info.Now)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("want the refresh strategy to be called")
+	}
+	// with no background refresh scheduled, the second Dial consults the
+	// strategy again
+	select {
+	case info := <-s:
+		if info.LastUsed.IsZero() {
+			t.Fatalf("want the Dial to be recorded in LastUsed, got = %+v", info)
+		}
+	default:
+		t.Fatal("want the refresh strategy to be called on the second Dial")
+	}
+}
+
+func TestBuiltinRefreshStrategies(t *testing.T) {
+	now := time.Now()
+	tcs := []struct {
+		desc           string
+		s              RefreshStrategy
+		info           RefreshInfo
+		wantBackground bool
+	}{
+		{
+			desc:           "refresh ahead",
+			s:              RefreshAheadStrategy(),
+			info:           RefreshInfo{Now: now, Expiry: now.Add(time.Hour)},
+			wantBackground: true,
+		},
+		{
+			desc:           "lazy",
+			s:              LazyRefreshStrategy(),
+			info:           RefreshInfo{Now: now, Expiry: now.Add(time.Hour), LastUsed: now},
+			wantBackground: false,
+		},
+		{
+			desc:           "hybrid in use",
+			s:              HybridRefreshStrategy(10 * time.Minute),
+			info:           RefreshInfo{Now: now, Expiry: now.Add(time.Hour), LastUsed: now.Add(-time.Minute)},
+			wantBackground: true,
+		},
+		{
+			desc:           "hybrid idle",
+			s:              HybridRefreshStrategy(10 * time.Minute),
+			info:           RefreshInfo{Now: now, Expiry: now.Add(time.Hour), LastUsed: now.Add(-time.Hour)},
+			wantBackground: false,
+		},
+		{
+			desc:           "hybrid never used",
+			s:              HybridRefreshStrategy(10 * time.Minute),
+			info:           RefreshInfo{Now: now, Expiry: now.Add(time.Hour)},
+			wantBackground: false,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.desc, func(t *testing.T) {
+			delay, background := tc.s.NextRefresh(tc.info)
+			if background != tc.wantBackground {
+				t.Fatalf("background, want = %v, got = %v", tc.wantBackground, background)
+			}
+			if background && (delay <= 0 || delay >= time.Hour) {
+				t.Fatalf("delay, want between 0 and 1h, got = %v", delay)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+const (
+	// unknownTokenLifetime is how long a token with no expiry is used before
+	// its file is read, or its command run, again.
+	unknownTokenLifetime = time.Minute
+	// tokenCommandTimeout bounds a run of a token command.
+	tokenCommandTimeout = 30 * time.Second
+)
+
+// WithTokenFile returns a DialerOption that authenticates with OAuth2 access
+// tokens read from the file at path, which another process, e.g., a sidecar,
+// keeps up to date. This suits platforms where the Go process cannot hold
+// Google credentials itself. The file contains either the token alone or a
+// JSON object with an "access_token" and, optionally, an "expires_in" in
+// seconds from when the file was written, as returned by the metadata server.
+// The file is read again when the token expires, or after a minute if its
+// expiry is unknown.
+func WithTokenFile(path string) DialerOption {
+	return WithTokenSource(oauth2.ReuseTokenSource(nil, fileTokenSource{path: path}))
+}
+
+// WithTokenCommand returns a DialerOption that authenticates with OAuth2
+// access tokens printed by the command name run with args, e.g.,
+// "gcloud auth print-access-token". The output is parsed as the contents of a
+// file passed to WithTokenFile, with "expires_in" counted from when the
+// command ran. The command is run again when the token expires, or after a
+// minute if its expiry is unknown.
+func WithTokenCommand(name string, args ...string) DialerOption {
+	return WithTokenSource(oauth2.ReuseTokenSource(nil, commandTokenSource{name: name, args: args}))
+}
+
+// fileTokenSource reads tokens from a file.
+type fileTokenSource struct {
+	path string
+}
+
+func (s fileTokenSource) Token() (*oauth2.Token, error) {
+	fi, err := os.Stat(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token file: %v", err)
+	}
+	b, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token file: %v", err)
+	}
+	tok, err := parseToken(b, fi.ModTime(), time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("invalid token file %q: %v", s.path, err)
+	}
+	return tok, nil
+}
+
+// commandTokenSource runs a command that prints tokens.
+type commandTokenSource struct {
+	name string
+	args []string
+}
+
+func (s commandTokenSource) Token() (*oauth2.Token, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), tokenCommandTimeout)
+	defer cancel()
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, s.name, s.args...)
+	cmd.Stderr = &stderr
+	now := time.Now()
+	b, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("token command %q failed: %v: %s", s.name, err, strings.TrimSpace(stderr.String()))
+	}
+	tok, err := parseToken(b, now, now)
+	if err != nil {
+		return nil, fmt.Errorf("token command %q printed an invalid token: %v", s.name, err)
+	}
+	return tok, nil
+}
+
+// parseToken parses a token alone or as a JSON object. A JSON object's
+// expires_in is counted from issued. A token with no expiry expires
+// unknownTokenLifetime after now.
+func parseToken(b []byte, issued, now time.Time) (*oauth2.Token, error) {
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 {
+		return nil, errors.New("no token")
+	}
+	if b[0] != '{' {
+		return &oauth2.Token{
+			AccessToken: string(b),
+			TokenType:   "Bearer",
+			Expiry:      now.Add(unknownTokenLifetime),
+		}, nil
+	}
+	var v struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+	if v.AccessToken == "" {
+		return nil, errors.New("no access_token")
+	}
+	tok := &oauth2.Token{
+		AccessToken: v.AccessToken,
+		TokenType:   v.TokenType,
+		Expiry:      now.Add(unknownTokenLifetime),
+	}
+	if tok.TokenType == "" {
+		tok.TokenType = "Bearer"
+	}
+	if v.ExpiresIn > 0 {
+		tok.Expiry = issued.Add(time.Duration(v.ExpiresIn) * time.Second)
+	}
+	return tok, nil
+}
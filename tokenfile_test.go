@@ -0,0 +1,120 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestParseToken(t *testing.T) {
+	issued := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := issued.Add(time.Minute)
+	tcs := []struct {
+		desc       string
+		in         string
+		wantToken  string
+		wantType   string
+		wantExpiry time.Time
+	}{
+		{
+			desc:       "token alone",
+			in:         "ya29.token\n",
+			wantToken:  "ya29.token",
+			wantType:   "Bearer",
+			wantExpiry: now.Add(unknownTokenLifetime),
+		},
+		{
+			desc:       "metadata server JSON",
+			in:         `{"access_token":"ya29.token","expires_in":3599,"token_type":"Bearer"}`,
+			wantToken:  "ya29.token",
+			wantType:   "Bearer",
+			wantExpiry: issued.Add(3599 * time.Second),
+		},
+		{
+			desc:       "JSON without expiry",
+			in:         `{"access_token":"ya29.token"}`,
+			wantToken:  "ya29.token",
+			wantType:   "Bearer",
+			wantExpiry: now.Add(unknownTokenLifetime),
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.desc, func(t *testing.T) {
+			tok, err := parseToken([]byte(tc.in), issued, now)
+			if err != nil {
+				t.Fatalf("parseToken failed: %v", err)
+			}
+			if tok.AccessToken != tc.wantToken || tok.TokenType != tc.wantType || !tok.Expiry.Equal(tc.wantExpiry) {
+				t.Fatalf("want = %v %v %v, got = %v %v %v",
+					tc.wantToken, tc.wantType, tc.wantExpiry, tok.AccessToken, tok.TokenType, tok.Expiry)
+			}
+		})
+	}
+
+	for _, in := range []string{"", " \n", "{}", "{not json"} {
+		if _, err := parseToken([]byte(in), issued, now); err == nil {
+			t.Errorf("parseToken(%q) want error", in)
+		}
+	}
+}
+
+func TestFileTokenSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "token")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "token")
+	s := fileTokenSource{path: path}
+
+	if _, err := s.Token(); err == nil {
+		t.Fatal("want an error for a missing file")
+	}
+	// the file is read on every call, so a sidecar's updates are seen
+	for _, want := range []string{"first", "second"} {
+		if err := ioutil.WriteFile(path, []byte(want), 0600); err != nil {
+			t.Fatalf("failed to write token file: %v", err)
+		}
+		tok, err := s.Token()
+		if err != nil {
+			t.Fatalf("Token failed: %v", err)
+		}
+		if tok.AccessToken != want {
+			t.Fatalf("token, want = %v, got = %v", want, tok.AccessToken)
+		}
+	}
+}
+
+func TestCommandTokenSource(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test uses a POSIX shell")
+	}
+	tok, err := commandTokenSource{name: "sh", args: []string{"-c", "echo ya29.token"}}.Token()
+	if err != nil {
+		t.Fatalf("Token failed: %v", err)
+	}
+	if tok.AccessToken != "ya29.token" {
+		t.Fatalf("token, want = ya29.token, got = %v", tok.AccessToken)
+	}
+
+	if _, err := (commandTokenSource{name: "sh", args: []string{"-c", "echo oops >&2; exit 1"}}).Token(); err == nil {
+		t.Fatal("want an error when the command fails")
+	}
+}
@@ -0,0 +1,32 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+// WithDefaults returns a view of the Dialer whose default DialOptions are the
+// Dialer's followed by opts, e.g., to connect over private IP from one part of
+// a program and over public IP from another. The view shares everything else
+// with the Dialer, including the information used to connect to each
+// instance, so using several views does not increase the number of refreshes.
+// Configuration made through any view, such as RegisterReplicaSet, applies to
+// all of them, and closing any view closes the Dialer and all of its views.
+// Warm connections are only used by Dials that use the Dialer's own default
+// DialOptions.
+func (d *Dialer) WithDefaults(opts ...DialOption) *Dialer {
+	cfg := d.defaultDialCfg
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return &Dialer{dialerState: d.dialerState, defaultDialCfg: cfg}
+}
@@ -0,0 +1,117 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"time"
+
+	"cloud.google.com/go/cloudsqlconn/internal/cloudsql"
+)
+
+// warmConn is an established TLS connection waiting to be returned by Dial.
+type warmConn struct {
+	tlsConn *tls.Conn
+	conn    net.Conn
+	ipType  string
+	created time.Time
+}
+
+// warmPool holds the warm connections to an instance.
+type warmPool struct {
+	conns []warmConn
+	// filling is the number of warm connections being established.
+	filling int
+}
+
+// takeWarm removes and returns the oldest warm connection to instance that has
+// been idle for less than warmMaxIdle. Connections idle for longer are closed.
+func (d *Dialer) takeWarm(instance string) (*tls.Conn, net.Conn, string, bool) {
+	d.warmLock.Lock()
+	defer d.warmLock.Unlock()
+	p, ok := d.warmPools[instance]
+	if !ok {
+		return nil, nil, "", false
+	}
+	now := d.clock.Now()
+	for len(p.conns) > 0 {
+		w := p.conns[0]
+		p.conns = p.conns[1:]
+		if now.Sub(w.created) < d.warmMaxIdle {
+			return w.tlsConn, w.conn, w.ipType, true
+		}
+		_ = w.tlsConn.Close() // best effort close attempt
+	}
+	return nil, nil, "", false
+}
+
+// refillWarm establishes connections to the instance i in the background until
+// its pool, counting connections in progress, holds warmConns connections.
+func (d *Dialer) refillWarm(i *cloudsql.Instance, instance string) {
+	d.warmLock.Lock()
+	defer d.warmLock.Unlock()
+	select {
+	case <-d.done:
+		return
+	default:
+	}
+	p, ok := d.warmPools[instance]
+	if !ok {
+		p = &warmPool{}
+		d.warmPools[instance] = p
+	}
+	for len(p.conns)+p.filling < d.warmConns {
+		p.filling++
+		go d.warm(i, p)
+	}
+}
+
+// warm establishes a connection to the instance i and adds it to p. Failures
+// are left for the next Dial to discover and report.
+func (d *Dialer) warm(i *cloudsql.Instance, p *warmPool) {
+	ctx, cancel := context.WithTimeout(context.Background(), d.refreshTimeout)
+	defer cancel()
+	// warm connections wait for the Dials that need a connection now
+	cfg := d.warmDialCfg
+	cfg.priority = PriorityLow
+	tlsConn, conn, ipType, _, err := d.connect(ctx, i, cfg)
+	d.warmLock.Lock()
+	defer d.warmLock.Unlock()
+	p.filling--
+	if err != nil {
+		return
+	}
+	select {
+	case <-d.done:
+		_ = tlsConn.Close() // best effort close attempt
+		return
+	default:
+	}
+	p.conns = append(p.conns, warmConn{tlsConn: tlsConn, conn: conn, ipType: ipType, created: d.clock.Now()})
+}
+
+// closeWarm closes all warm connections.
+func (d *Dialer) closeWarm() {
+	d.warmLock.Lock()
+	defer d.warmLock.Unlock()
+	for _, p := range d.warmPools {
+		for _, w := range p.conns {
+			_ = w.tlsConn.Close() // best effort close attempt
+		}
+		p.conns = nil
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/cloudsqlconn/internal/mock"
+)
+
+// warmCount returns the number of warm connections to instance.
+func warmCount(d *Dialer, instance string) int {
+	d.warmLock.Lock()
+	defer d.warmLock.Unlock()
+	p, ok := d.warmPools[instance]
+	if !ok {
+		return 0
+	}
+	return len(p.conns)
+}
+
+func TestWarmConnections(t *testing.T) {
+	inst := mock.NewFakeCSQLInstance("my-project", "my-region", "my-instance")
+	svc, cleanup, err := mock.NewSQLAdminService(
+		context.Background(),
+		mock.InstanceGetSuccess(inst, 1),
+		mock.CreateEphemeralSuccess(inst, 1),
+	)
+	if err != nil {
+		t.Fatalf("failed to create test SQL admin service: %s", err)
+	}
+	stop := mock.StartServerProxy(t, inst)
+	defer func() {
+		stop()
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	d, err := NewDialer(context.Background(),
+		WithTokenSource(mock.EmptyTokenSource{}),
+		WithWarmConnections(2, time.Minute),
+	)
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	d.sqladmin = svc
+
+	cn := "my-project:my-region:my-instance"
+	conn, err := d.Dial(context.Background(), cn)
+	if err != nil {
+		t.Fatalf("expected Dial to succeed, but got error: %v", err)
+	}
+	conn.Close()
+	waitForWarm := func(want int) {
+		t.Helper()
+		for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+			if warmCount(d, cn) == want {
+				return
+			}
+		}
+		t.Fatalf("want %v warm connections, got %v", want, warmCount(d, cn))
+	}
+	waitForWarm(2)
+
+	// A Dial takes a warm connection, which is replaced.
+	conn, err = d.Dial(context.Background(), cn)
+	if err != nil {
+		t.Fatalf("expected Dial to succeed, but got error: %v", err)
+	}
+	buf := make([]byte, len("my-instance"))
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "my-instance" {
+		t.Fatalf("want to read my-instance from warm connection, got = %q, err = %v", buf, err)
+	}
+	conn.Close()
+	waitForWarm(2)
+
+	// Dials with other options don't use warm connections.
+	conn, err = d.Dial(context.Background(), cn, WithTCPKeepAlive(time.Minute))
+	if err != nil {
+		t.Fatalf("expected Dial to succeed, but got error: %v", err)
+	}
+	conn.Close()
+	if got := warmCount(d, cn); got != 2 {
+		t.Fatalf("want warm connections to be unused, got %v left", got)
+	}
+
+	d.closeWarm()
+	if got := warmCount(d, cn); got != 0 {
+		t.Fatalf("want closeWarm to close warm connections, got %v left", got)
+	}
+}
+
+func TestWarmConnectionsExpire(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	d := &Dialer{dialerState: &dialerState{
+		clock:       realClock{},
+		warmConns:   1,
+		warmMaxIdle: time.Minute,
+		warmPools: map[string]*warmPool{
+			"my-instance": {conns: []warmConn{{
+				tlsConn: tls.Client(client, &tls.Config{}),
+				conn:    client,
+				created: time.Now().Add(-time.Hour),
+			}}},
+		},
+	}}
+	if _, _, _, ok := d.takeWarm("my-instance"); ok {
+		t.Fatal("want no warm connection once it has been idle too long")
+	}
+	if got := warmCount(d, "my-instance"); got != 0 {
+		t.Fatalf("want the idle connection to be discarded, got %v left", got)
+	}
+	if _, err := client.Write([]byte{0}); err == nil {
+		t.Fatal("want the idle connection to be closed")
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// WarmupError is returned by WarmupAll when some instances could not be
+// warmed up.
+type WarmupError struct {
+	// Errors maps the connection names of the instances that failed to the
+	// cause of their failure.
+	Errors map[string]error
+}
+
+func (e *WarmupError) Error() string {
+	names := make([]string, 0, len(e.Errors))
+	for cn := range e.Errors {
+		names = append(names, cn)
+	}
+	sort.Strings(names)
+	msgs := make([]string, 0, len(names))
+	for _, cn := range names {
+		msgs = append(msgs, fmt.Sprintf("%s: %v", cn, e.Errors[cn]))
+	}
+	return fmt.Sprintf("failed to warm up %d instance(s): %s", len(names), strings.Join(msgs, "; "))
+}
+
+// WarmupAll retrieves the information used to connect to each of instances,
+// such as their IP addresses and client certificates, so that the first Dial
+// to each does not have to wait for it. At most concurrency instances are
+// warmed up at once; a concurrency of zero or less warms them all up at once.
+// WarmupAll blocks until every instance has been warmed up or ctx is done;
+// instances not yet started when ctx is done fail with ctx's error. If any
+// instance fails, a *WarmupError listing every failure is returned.
+func (d *Dialer) WarmupAll(ctx context.Context, instances []string, concurrency int) error {
+	if concurrency <= 0 || concurrency > len(instances) {
+		concurrency = len(instances)
+	}
+	var (
+		mu   sync.Mutex
+		errs = make(map[string]error)
+		wg   sync.WaitGroup
+		sem  = make(chan struct{}, concurrency)
+	)
+	for _, cn := range instances {
+		// once ctx is done, the remaining instances are not started
+		var err error
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+		case sem <- struct{}{}:
+			if err = ctx.Err(); err != nil {
+				<-sem
+			}
+		}
+		if err != nil {
+			mu.Lock()
+			errs[cn] = err
+			mu.Unlock()
+			continue
+		}
+		wg.Add(1)
+		go func(cn string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if err := d.warmup(ctx, cn); err != nil {
+				mu.Lock()
+				errs[cn] = err
+				mu.Unlock()
+			}
+		}(cn)
+	}
+	wg.Wait()
+	if len(errs) > 0 {
+		return &WarmupError{Errors: errs}
+	}
+	return nil
+}
+
+// warmup starts the refresh cycle for the instance with connection name cn
+// and waits for the first refresh to complete.
+func (d *Dialer) warmup(ctx context.Context, cn string) error {
+	i, err := d.instance(ctx, cn)
+	if err != nil {
+		return err
+	}
+	return i.Wait(ctx)
+}
@@ -0,0 +1,119 @@
+// Copyright 2021 Google LLC
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+
+//     https://www.apache.org/licenses/LICENSE-2.0
+
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudsqlconn
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/cloudsqlconn/errtypes"
+	"cloud.google.com/go/cloudsqlconn/internal/mock"
+)
+
+func TestWarmupAll(t *testing.T) {
+	inst1 := mock.NewFakeCSQLInstance("my-project", "my-region", "inst1")
+	inst2 := mock.NewFakeCSQLInstance("my-project", "my-region", "inst2")
+	svc, cleanup, err := mock.NewSQLAdminService(
+		context.Background(),
+		mock.InstanceGetSuccess(inst1, 1),
+		mock.CreateEphemeralSuccess(inst1, 1),
+		mock.InstanceGetSuccess(inst2, 1),
+		mock.CreateEphemeralSuccess(inst2, 1),
+	)
+	if err != nil {
+		t.Fatalf("failed to create test SQL admin service: %s", err)
+	}
+	defer func() {
+		if err := cleanup(); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}()
+
+	d, err := NewDialer(context.Background(), WithTokenSource(mock.EmptyTokenSource{}))
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+	d.sqladmin = svc
+
+	err = d.WarmupAll(context.Background(), []string{
+		"my-project:my-region:inst1",
+		"my-project:my-region:inst2",
+		"bad-instance-name",
+	}, 2)
+	var wErr *WarmupError
+	if !errors.As(err, &wErr) {
+		t.Fatalf("want = %T, got = %v", wErr, err)
+	}
+	if len(wErr.Errors) != 1 {
+		t.Fatalf("want only the invalid instance to fail, got = %v", err)
+	}
+	var cErr *errtypes.ConfigError
+	if !errors.As(wErr.Errors["bad-instance-name"], &cErr) {
+		t.Fatalf("when instance name is invalid, want = %T, got = %v", cErr, wErr.Errors["bad-instance-name"])
+	}
+	for _, cn := range []string{"my-project:my-region:inst1", "my-project:my-region:inst2"} {
+		if !d.instances[cn].Healthy() {
+			t.Fatalf("want %v to be warmed up", cn)
+		}
+	}
+}
+
+func TestWarmupAllStopsWhenCanceled(t *testing.T) {
+	// api never answers until the test is done, so warmups wait for ctx.
+	release := make(chan struct{})
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer api.Close()
+	defer close(release)
+
+	d, err := NewDialer(context.Background(),
+		WithTokenSource(mock.EmptyTokenSource{}),
+		WithEndpointResolver(func(string) string { return api.URL + "/" }),
+	)
+	if err != nil {
+		t.Fatalf("expected NewDialer to succeed, but got error: %v", err)
+	}
+	defer d.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	instances := []string{
+		"my-project:my-region:inst1",
+		"my-project:my-region:inst2",
+		"my-project:my-region:inst3",
+	}
+	err = d.WarmupAll(ctx, instances, 1)
+	var wErr *WarmupError
+	if !errors.As(err, &wErr) {
+		t.Fatalf("want = %T, got = %v", wErr, err)
+	}
+	for _, cn := range instances {
+		if !errors.Is(wErr.Errors[cn], context.DeadlineExceeded) {
+			t.Fatalf("want %v to fail with %v, got = %v", cn, context.DeadlineExceeded, wErr.Errors[cn])
+		}
+	}
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	if got := len(d.instances); got != 1 {
+		t.Fatalf("want only the first instance to be started, got %v instances", got)
+	}
+}